@@ -67,6 +67,7 @@ func Run(name, usage string) {
 		getTestExtensionsCommand(),
 		getMigrateCommand(),
 		getResyncCommand(),
+		getPolicyCommand(),
 		getTemplateCommand(),
 		getRunCommand(),
 		getTestCommand(),
@@ -111,6 +112,11 @@ ARGUMENTS:
                 --output-format [json/table] - specifies in which format results should be shown
                 --verbosity [0-3] - specifies how much debug info Gohan Client should show (default 0)
                 --fields [field1,field2] - specifies which fields should be visible (default all)
+
+            Pagination arguments of 'list' command:
+                --limit [n] - specifies maximum number of listed resources
+                --sort-key [property] --sort-order [asc/desc] - specifies order of listed resources
+                --marker [marker] - lists resources following the marker returned with the previous page
         - unnamed:
             they are in 'value' format and should be specified at the end of the line,
             after all named arguments. At the moment only 'id' argument in 'show',
@@ -266,9 +272,9 @@ Gohan convert can be used to migrate Gohan resources between different types of
 Setting meta-schema option will additionally convert meta-schema table with schema resources.
 Useful for development purposes.`,
 		Flags: []cli.Flag{
-			cli.StringFlag{Name: "in-type, it", Value: "", Usage: "Input db type (yaml, json, sqlite3, mysql)"},
+			cli.StringFlag{Name: "in-type, it", Value: "", Usage: "Input db type (yaml, json, sqlite3, mysql, postgres)"},
 			cli.StringFlag{Name: "in, i", Value: "", Usage: "Input db connection spec (or filename)"},
-			cli.StringFlag{Name: "out-type, ot", Value: "", Usage: "Output db type (yaml, json, sqlite3, mysql)"},
+			cli.StringFlag{Name: "out-type, ot", Value: "", Usage: "Output db type (yaml, json, sqlite3, mysql, postgres)"},
 			cli.StringFlag{Name: "out, o", Value: "", Usage: "Output db connection spec (or filename)"},
 			cli.StringFlag{Name: "schema, s", Value: "", Usage: "Schema file"},
 			cli.StringFlag{Name: "meta-schema, m", Value: "embed://etc/schema/gohan.json", Usage: "Meta-schema file (optional)"},
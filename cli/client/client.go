@@ -299,12 +299,12 @@ func (gohanClientCLI *GohanClientCLI) getSchemaByID(id string) (*schema.Schema,
 func (gohanClientCLI *GohanClientCLI) logRequest(method, url, tokenID string, args map[string]interface{}) {
 	log.Notice("Sent request: %s %s", method, url)
 	log.Debug("X-Auth-Token: %s", tokenID)
-	jsonArgs, _ := json.MarshalIndent(args, "", "    ")
+	jsonArgs, _ := json.MarshalIndent(schema.RedactSecrets(args, schema.SecretPropertyIDs(gohanClientCLI.schemas)), "", "    ")
 	log.Info("Request body:\n %s", jsonArgs)
 }
 
 func (gohanClientCLI *GohanClientCLI) logResponse(status string, body interface{}) {
 	log.Notice("Received response: %s", status)
-	jsonBody, _ := json.MarshalIndent(body, "", "    ")
+	jsonBody, _ := json.MarshalIndent(schema.RedactSecrets(body, schema.SecretPropertyIDs(gohanClientCLI.schemas)), "", "    ")
 	log.Info("Response body:\n %s", jsonBody)
 }
@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"sort"
 
@@ -883,6 +884,37 @@ var _ = Describe("CLI functions", func() {
 `))
 					})
 
+					It("Should not show secret properties", func() {
+						secretSchema := *netSchema
+						secretSchema.Properties = []schema.Property{}
+						for _, property := range netSchema.Properties {
+							property.Secret = property.ID != "cidr" && property.ID != "mac"
+							secretSchema.Properties = append(secretSchema.Properties, property)
+						}
+						rawResult := map[string]interface{}{
+							"resource": map[string]interface{}{
+								"cidr":  "cidr",
+								"mac":   "mac",
+								"id":    "test",
+								"port":  "port",
+								"regex": "regex",
+							},
+						}
+						result := gohanClientCLI.formatOutput(&secretSchema, rawResult)
+						Expect(result).To(Equal(
+							`+----------+-------+
+| PROPERTY | VALUE |
++----------+-------+
+| CIDR     | cidr  |
+| MAC      | mac   |
++----------+-------+
+`))
+
+						gohanClientCLI.opts.outputFormat = outputFormatJSON
+						result = gohanClientCLI.formatOutput(&secretSchema, rawResult)
+						Expect(result).To(MatchJSON(`{"resource": {"cidr": "cidr", "mac": "mac"}}`))
+					})
+
 					It("Should format multiple resources successfully", func() {
 						rawResult := map[string]interface{}{
 							"resources": []interface{}{
@@ -1068,6 +1100,19 @@ var _ = Describe("CLI functions", func() {
 					Expect(len(gohanClientCLI.opts.fields)).To(Equal(2))
 				})
 
+				It("Should pass pagination arguments and show next marker", func() {
+					server.SetHandler(1, ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", "/v2.0/towers", "limit=1&marker=abc&sort_key=name&sort_order=desc"),
+						ghttp.RespondWithJSONEncoded(200, getTowerListResponse(), http.Header{
+							"Link": []string{`</v2.0/towers?limit=1&marker=def&sort_key=name&sort_order=desc>; rel="next"`},
+						}),
+					))
+					gohanClientCLI.opts.outputFormat = outputFormatTable
+					result, err := listCommand.Action([]string{"--limit", "1", "--marker", "abc", "--sort-key", "name", "--sort-order", "desc"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(result).To(HaveSuffix("Next marker: def\n"))
+				})
+
 				It("Should show error - error parsing arguments", func() {
 					result, err := listCommand.Action([]string{"--isMain", "yes"})
 					Expect(result).To(Equal(""))
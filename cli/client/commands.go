@@ -20,7 +20,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	u "net/url"
 	"regexp"
+	"strings"
 
 	"github.com/rackspace/gophercloud"
 
@@ -32,6 +34,9 @@ var (
 	multipleResourcesFoundError = "Multiple %s with name '%s' found"
 	resourceNotFoundError       = "Resource not found"
 	unexpectedResponse          = "Unexpected response: %v"
+	nextMarkerOutput            = "Next marker: %s\n"
+
+	nextLinkRegexp = regexp.MustCompile(`<([^>]*)>;\s*rel="next"`)
 )
 
 type gohanCommand struct {
@@ -70,13 +75,24 @@ func (gohanClientCLI *GohanClientCLI) getListCommand(s *schema.Schema) gohanComm
 		Name:   fmt.Sprintf("%s list", s.ID),
 		Schema: s,
 		Action: func(args []string) (string, error) {
-			_, err := gohanClientCLI.handleArguments(args, s)
+			argsMap, err := gohanClientCLI.handleArguments(args, s)
 			if err != nil {
 				return "", err
 			}
 			url := fmt.Sprintf("%s%s%s", gohanClientCLI.opts.gohanEndpointURL, s.URL, gohanClientCLI.getFieldsParam(true))
-			result, err := gohanClientCLI.request("GET", url, nil)
-			return gohanClientCLI.formatOutput(s, result), err
+			url = appendPaginationParams(url, argsMap)
+			opts := gophercloud.RequestOpts{
+				JSONBody: map[string]interface{}{},
+			}
+			gohanClientCLI.logRequest("GET", url, gohanClientCLI.provider.TokenID, opts.JSONBody.(map[string]interface{}))
+			response, err := gohanClientCLI.provider.Request("GET", url, opts)
+			nextMarker := getNextMarker(response)
+			result, err := gohanClientCLI.handleResponse(response, err)
+			output := gohanClientCLI.formatOutput(s, result)
+			if err == nil && nextMarker != "" && gohanClientCLI.opts.outputFormat == outputFormatTable {
+				output += fmt.Sprintf(nextMarkerOutput, nextMarker)
+			}
+			return output, err
 		},
 	}
 }
@@ -359,6 +375,37 @@ func (gohanClientCLI *GohanClientCLI) handleResponse(response *http.Response, er
 	return result, err
 }
 
+func appendPaginationParams(url string, args map[string]interface{}) string {
+	query := u.Values{}
+	for key, param := range paginationParams {
+		if value, ok := args[key]; ok {
+			query.Set(param, fmt.Sprint(value))
+		}
+	}
+	if len(query) == 0 {
+		return url
+	}
+	if strings.Contains(url, "?") {
+		return url + "&" + query.Encode()
+	}
+	return url + "?" + query.Encode()
+}
+
+func getNextMarker(response *http.Response) string {
+	if response == nil {
+		return ""
+	}
+	match := nextLinkRegexp.FindStringSubmatch(response.Header.Get("Link"))
+	if match == nil {
+		return ""
+	}
+	next, err := u.Parse(match[1])
+	if err != nil {
+		return ""
+	}
+	return next.Query().Get("marker")
+}
+
 func (gohanClientCLI *GohanClientCLI) getFieldsParam(prependQuestionMark bool) string {
 	if len(gohanClientCLI.opts.fields) == 0 {
 		return ""
@@ -68,6 +68,14 @@ var (
 	fieldsKey    = "fields"
 	fieldsEnvKey = "GOHAN_FIELDS"
 
+	// pagination of list command, mapped to query parameters
+	paginationParams = map[string]string{
+		"limit":      "limit",
+		"marker":     "marker",
+		"sort-key":   "sort_key",
+		"sort-order": "sort_order",
+	}
+
 	commonParams = map[string]struct{}{
 		outputFormatKey: struct{}{},
 		logLevelKey:     struct{}{},
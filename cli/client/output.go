@@ -31,6 +31,7 @@ func (gohanClientCLI *GohanClientCLI) formatOutput(s *schema.Schema, rawResult i
 	if rawResult == nil {
 		return ""
 	}
+	rawResult = removeSecretProperties(s, rawResult)
 	switch gohanClientCLI.opts.outputFormat {
 	case outputFormatTable:
 		return gohanClientCLI.formatOutputTable(s, rawResult)
@@ -40,6 +41,33 @@ func (gohanClientCLI *GohanClientCLI) formatOutput(s *schema.Schema, rawResult i
 	}
 }
 
+//removeSecretProperties removes secret properties from resources of the result
+func removeSecretProperties(s *schema.Schema, rawResult interface{}) interface{} {
+	result, ok := rawResult.(map[string]interface{})
+	if !ok {
+		return rawResult
+	}
+	filtered := make(map[string]interface{}, len(result))
+	for k, v := range result {
+		switch value := v.(type) {
+		case []interface{}:
+			resources := make([]interface{}, 0, len(value))
+			for _, rawResource := range value {
+				if resource, ok := rawResource.(map[string]interface{}); ok {
+					rawResource = s.RemoveSecretProperties(resource)
+				}
+				resources = append(resources, rawResource)
+			}
+			filtered[k] = resources
+		case map[string]interface{}:
+			filtered[k] = s.RemoveSecretProperties(value)
+		default:
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
 func (gohanClientCLI *GohanClientCLI) formatOutputTable(s *schema.Schema, rawResult interface{}) string {
 	buffer := bytes.NewBufferString("")
 	for k, v := range rawResult.(map[string]interface{}) {
@@ -67,7 +95,7 @@ func (gohanClientCLI *GohanClientCLI) createResourcesTable(s *schema.Schema, buf
 	include := gohanClientCLI.fieldFilter(s)
 	titles := make([]string, 0, len(s.Properties))
 	for _, property := range s.Properties {
-		if include != nil && !include[normField(property.ID, s.ID)] {
+		if property.Secret || include != nil && !include[normField(property.ID, s.ID)] {
 			continue
 		}
 
@@ -79,7 +107,7 @@ func (gohanClientCLI *GohanClientCLI) createResourcesTable(s *schema.Schema, buf
 		resourceSlice := []string{}
 		resource := rawResource.(map[string]interface{})
 		for _, property := range s.Properties {
-			if include != nil && !include[normField(property.ID, s.ID)] {
+			if property.Secret || include != nil && !include[normField(property.ID, s.ID)] {
 				continue
 			}
 
@@ -110,7 +138,7 @@ func (gohanClientCLI *GohanClientCLI) createSingleResourceTable(s *schema.Schema
 	table := tablewriter.NewWriter(buffer)
 	table.SetHeader([]string{"Property", "Value"})
 	for _, property := range s.Properties {
-		if include != nil && !include[normField(property.ID, s.ID)] {
+		if property.Secret || include != nil && !include[normField(property.ID, s.ID)] {
 			continue
 		}
 
@@ -0,0 +1,143 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+	"github.com/codegangsta/cli"
+)
+
+func getPolicyCommand() cli.Command {
+	return cli.Command{
+		Name:  "policy",
+		Usage: "Inspect policies",
+		Subcommands: []cli.Command{
+			getPolicyExplainCommand(),
+		},
+	}
+}
+
+func getPolicyExplainCommand() cli.Command {
+	return cli.Command{
+		Name:  "explain",
+		Usage: "Explain which policy applies to an action",
+		Description: `
+Evaluates policies of the server configuration for the given roles, tenant,
+action and path, and reports every policy considered, which one was selected
+and which condition or property caused denial.
+
+Policies are loaded from schema files and the database of the configuration.
+
+Example:
+    gohan policy explain --roles Member --tenant-id demo --action update \
+        --path /v2.0/networks/red --resource '{"tenant_id": "demo", "status": "ACTIVE"}' \
+        --update '{"name": "blue"}'`,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "config-file", Value: defaultConfigFile, Usage: "Server config File"},
+			cli.StringFlag{Name: "action, a", Value: schema.ActionRead, Usage: "Action"},
+			cli.StringFlag{Name: "path, p", Value: "", Usage: "Resource path"},
+			cli.StringFlag{Name: "tenant-id", Value: "", Usage: "Tenant ID"},
+			cli.StringFlag{Name: "tenant-name", Value: "", Usage: "Tenant name"},
+			cli.StringFlag{Name: "user-id", Value: "", Usage: "User ID"},
+			cli.StringSliceFlag{Name: "roles, r", Usage: "Role names, may be given multiple times"},
+			cli.StringFlag{Name: "resource", Value: "", Usage: "Resource data (JSON)"},
+			cli.StringFlag{Name: "update", Value: "", Usage: "Update candidate data (JSON)"},
+		},
+		Action: func(c *cli.Context) {
+			if c.String("path") == "" {
+				log.Fatal("Need to provide resource path")
+			}
+			resource, err := parseJSONFlag(c, "resource")
+			if err != nil {
+				log.Fatal(err)
+			}
+			update, err := parseJSONFlag(c, "update")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := loadPolicies(c.String("config-file")); err != nil {
+				log.Fatal(err)
+			}
+			auth := schema.NewUserAuthorization(c.String("user-id"), c.String("tenant-id"), c.String("tenant-name"),
+				"", c.StringSlice("roles"), nil)
+			explanation := schema.GetManager().ExplainPolicy(c.String("action"), c.String("path"), auth, resource, update)
+			output, _ := json.MarshalIndent(explanation, "", "    ")
+			fmt.Println(string(output))
+			if !explanation.Allowed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func parseJSONFlag(c *cli.Context, name string) (map[string]interface{}, error) {
+	if c.String(name) == "" {
+		return nil, nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(c.String(name)), &data); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %s", name, err)
+	}
+	return data, nil
+}
+
+//loadPolicies loads schemas and policies of the server configuration, including policies stored in the database
+func loadPolicies(configFile string) error {
+	config := util.GetConfig()
+	if err := config.ReadConfig(configFile); err != nil {
+		return fmt.Errorf("Error while loading server config file: %s", err)
+	}
+	if err := os.Chdir(path.Dir(configFile)); err != nil {
+		return fmt.Errorf("Chdir error: %s", err)
+	}
+	schemaManager := schema.GetManager()
+	roleGraph, err := schema.NewRoleGraphFromConfig(config.GetParam("roles", nil))
+	if err != nil {
+		return fmt.Errorf("Invalid roles configuration: %s", err)
+	}
+	schemaManager.SetRoleGraph(roleGraph)
+	schemaFiles := config.GetStringList("schemas", nil)
+	if schemaFiles == nil {
+		return fmt.Errorf("No schema specified in configuration")
+	}
+	if err := schemaManager.LoadSchemasFromFiles(schemaFiles...); err != nil {
+		return fmt.Errorf("Error when loading schemas: %s", err)
+	}
+	policySchema, ok := schemaManager.Schema("policy")
+	if !ok {
+		return nil
+	}
+	dbConn, err := db.CreateFromConfig(config)
+	if err != nil {
+		return fmt.Errorf("Failed to create db conn, err: %s", err)
+	}
+	return db.Within(dbConn, func(tx transaction.Transaction) error {
+		policyList, _, err := tx.List(policySchema, nil, nil, nil)
+		if err != nil {
+			log.Warning("Failed to load policies from the database: %s", err)
+			return nil
+		}
+		return schemaManager.LoadPolicies(policyList)
+	})
+}
@@ -0,0 +1,454 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/rackspace/gophercloud"
+)
+
+var log = l.NewLogger()
+
+//minJWKSRefreshInterval limits how often keys are fetched when a token signed with unknown key is seen
+const minJWKSRefreshInterval = time.Minute
+
+//maxTenantNames limits the number of remembered tenant names, an arbitrary one is forgotten when it is reached
+const maxTenantNames = 10000
+
+//JWTConfig describes how JWT bearer tokens are validated and mapped to authorization
+type JWTConfig struct {
+	//JWKSFile is a path of the JSON Web Key Set file
+	JWKSFile string
+	//JWKSURL is an URL the JSON Web Key Set is fetched from, used when JWKSFile is empty
+	JWKSURL string
+	//JWKSRefreshInterval is an interval keys are fetched again from JWKSURL
+	JWKSRefreshInterval time.Duration
+	//Issuer is an expected value of iss claim, not checked when empty
+	Issuer string
+	//Audience is a value required in aud claim, not checked when empty
+	Audience string
+	//Leeway is a clock skew tolerated when checking exp and nbf claims
+	Leeway time.Duration
+	//TenantIDClaim, TenantNameClaim and RolesClaim are names of the claims mapped to authorization.
+	//Nested claims are separated with dots, e.g. realm_access.roles
+	TenantIDClaim   string
+	TenantNameClaim string
+	RolesClaim      string
+	//ServiceTenantID, ServiceTenantName and ServiceRoles describe authorization used by gohan itself
+	ServiceTenantID   string
+	ServiceTenantName string
+	ServiceRoles      []string
+}
+
+//JWTIdentity middleware verifies OIDC JWT bearer tokens
+type JWTIdentity struct {
+	config     JWTConfig
+	httpClient *http.Client
+	now        func() time.Time
+
+	mutex       sync.RWMutex
+	keys        map[string]crypto.PublicKey
+	lastRefresh time.Time
+	tenantNames map[string]string
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+//NewJWTIdentity is a constructor for JWTIdentity middleware
+func NewJWTIdentity(config JWTConfig) (*JWTIdentity, error) {
+	if config.JWKSFile == "" && config.JWKSURL == "" {
+		return nil, fmt.Errorf("JWKS file or URL is required")
+	}
+	if config.TenantIDClaim == "" {
+		config.TenantIDClaim = "tenant_id"
+	}
+	identity := &JWTIdentity{
+		config:      config,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		now:         time.Now,
+		tenantNames: map[string]string{},
+		stop:        make(chan struct{}),
+	}
+	if err := identity.refreshKeys(); err != nil {
+		return nil, err
+	}
+	if config.JWKSURL != "" && config.JWKSFile == "" && config.JWKSRefreshInterval > 0 {
+		go identity.refreshPeriodically()
+	}
+	return identity, nil
+}
+
+// VerifyToken verifies signature and claims of the token
+func (identity *JWTIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	claims, err := identity.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid token: %s", err)
+	}
+	tenantID, _ := claimValue(claims, identity.config.TenantIDClaim).(string)
+	if tenantID == "" {
+		return nil, fmt.Errorf("Invalid token: claim %s is missing", identity.config.TenantIDClaim)
+	}
+	tenantName := tenantID
+	if identity.config.TenantNameClaim != "" {
+		if name, ok := claimValue(claims, identity.config.TenantNameClaim).(string); ok && name != "" {
+			tenantName = name
+		}
+	}
+	roles := []string{}
+	if identity.config.RolesClaim != "" {
+		roles = claimStrings(claimValue(claims, identity.config.RolesClaim))
+	}
+	identity.rememberTenantName(tenantID, tenantName)
+	userID, _ := claims["sub"].(string)
+	auth := schema.NewUserAuthorization(userID, tenantID, tenantName, token, roles, nil)
+	if iat, ok := claims["iat"].(float64); ok {
+		auth = schema.WithIssuedAt(auth, time.Unix(int64(iat), 0))
+	}
+	return auth, nil
+}
+
+func (identity *JWTIdentity) rememberTenantName(tenantID, tenantName string) {
+	identity.mutex.Lock()
+	defer identity.mutex.Unlock()
+	if _, ok := identity.tenantNames[tenantID]; !ok && len(identity.tenantNames) >= maxTenantNames {
+		for id := range identity.tenantNames {
+			delete(identity.tenantNames, id)
+			break
+		}
+	}
+	identity.tenantNames[tenantID] = tenantName
+}
+
+// GetTenantID maps the given tenant name to the tenant's ID.
+// Only tenants of the already verified tokens are known.
+func (identity *JWTIdentity) GetTenantID(tenantName string) (string, error) {
+	identity.mutex.RLock()
+	defer identity.mutex.RUnlock()
+	for id, name := range identity.tenantNames {
+		if name == tenantName {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("Tenant %s not found", tenantName)
+}
+
+// GetTenantName maps the given tenant ID to the tenant's name.
+// Tenant ID is returned for tenants which haven't been seen in verified tokens.
+func (identity *JWTIdentity) GetTenantName(tenantID string) (string, error) {
+	identity.mutex.RLock()
+	defer identity.mutex.RUnlock()
+	if name, ok := identity.tenantNames[tenantID]; ok {
+		return name, nil
+	}
+	return tenantID, nil
+}
+
+// GetServiceAuthorization returns authorization configured for gohan itself
+func (identity *JWTIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	return schema.NewAuthorization(identity.config.ServiceTenantID, identity.config.ServiceTenantName, "", identity.config.ServiceRoles, nil), nil
+}
+
+// GetClient returns nil, there is no openstack client
+func (identity *JWTIdentity) GetClient() *gophercloud.ServiceClient {
+	return nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+func (identity *JWTIdentity) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT")
+	}
+	header := jwtHeader{}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed header: %s", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed signature: %s", err)
+	}
+	key, err := identity.key(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch header.Algorithm {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("key %s is not a RSA key", header.KeyID)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, hash[:], signature); err != nil {
+			return nil, fmt.Errorf("signature verification failed")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return nil, fmt.Errorf("key %s is not a P-256 key", header.KeyID)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, hash[:], r, s) {
+			return nil, fmt.Errorf("signature verification failed")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %s", header.Algorithm)
+	}
+	claims := map[string]interface{}{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed claims: %s", err)
+	}
+	if err := identity.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (identity *JWTIdentity) verifyClaims(claims map[string]interface{}) error {
+	now := identity.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("exp claim is missing")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(identity.config.Leeway)) {
+		return fmt.Errorf("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(identity.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if identity.config.Issuer != "" && claims["iss"] != identity.config.Issuer {
+		return fmt.Errorf("unexpected issuer %v", claims["iss"])
+	}
+	if identity.config.Audience != "" {
+		found := false
+		for _, audience := range claimStrings(claims["aud"]) {
+			found = found || audience == identity.config.Audience
+		}
+		if !found {
+			return fmt.Errorf("token is not intended for %s", identity.config.Audience)
+		}
+	}
+	return nil
+}
+
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+//claimValue returns value of the claim; nested claims are separated with dots
+func claimValue(claims map[string]interface{}, name string) interface{} {
+	var value interface{} = claims
+	for _, key := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+//claimStrings converts claim given as a list or a space separated string to a list of strings
+func claimStrings(value interface{}) []string {
+	result := []string{}
+	switch v := value.(type) {
+	case string:
+		result = append(result, strings.Fields(v)...)
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+//key returns public key with the ID, refreshing keys from JWKS URL when the key is unknown
+func (identity *JWTIdentity) key(keyID string) (crypto.PublicKey, error) {
+	if key, ok := identity.lookupKey(keyID); ok {
+		return key, nil
+	}
+	identity.mutex.RLock()
+	canRefresh := identity.config.JWKSFile == "" && identity.now().Sub(identity.lastRefresh) > minJWKSRefreshInterval
+	identity.mutex.RUnlock()
+	if canRefresh {
+		if err := identity.refreshKeys(); err != nil {
+			log.Warning("Failed to refresh JWKS: %s", err)
+		}
+		if key, ok := identity.lookupKey(keyID); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown key %s", keyID)
+}
+
+func (identity *JWTIdentity) lookupKey(keyID string) (crypto.PublicKey, bool) {
+	identity.mutex.RLock()
+	defer identity.mutex.RUnlock()
+	if keyID == "" && len(identity.keys) == 1 {
+		for _, key := range identity.keys {
+			return key, true
+		}
+	}
+	key, ok := identity.keys[keyID]
+	return key, ok
+}
+
+func (identity *JWTIdentity) refreshPeriodically() {
+	ticker := time.NewTicker(identity.config.JWKSRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-identity.stop:
+			return
+		case <-ticker.C:
+			if err := identity.refreshKeys(); err != nil {
+				log.Warning("Failed to refresh JWKS: %s", err)
+			}
+		}
+	}
+}
+
+//Stop stops refreshing keys from JWKS URL
+func (identity *JWTIdentity) Stop() {
+	identity.stopOnce.Do(func() {
+		close(identity.stop)
+	})
+}
+
+func (identity *JWTIdentity) refreshKeys() error {
+	data, err := identity.loadJWKS()
+	if err != nil {
+		return err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+	identity.mutex.Lock()
+	defer identity.mutex.Unlock()
+	identity.keys = keys
+	identity.lastRefresh = identity.now()
+	return nil
+}
+
+func (identity *JWTIdentity) loadJWKS() ([]byte, error) {
+	if identity.config.JWKSFile != "" {
+		return ioutil.ReadFile(identity.config.JWKSFile)
+	}
+	resp, err := identity.httpClient.Get(identity.config.JWKSURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS endpoint returned %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+//ParseJWKS parses RSA and P-256 keys of JSON Web Key Set, keys for other uses than signing are skipped
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("malformed JWKS: %s", err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.KeyType {
+		case "RSA":
+			n, err := decodeBigInt(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("malformed key %s: %s", jwk.KeyID, err)
+			}
+			e, err := decodeBigInt(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("malformed key %s: %s", jwk.KeyID, err)
+			}
+			keys[jwk.KeyID] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			if jwk.Curve != "P-256" {
+				continue
+			}
+			x, err := decodeBigInt(jwk.X)
+			if err != nil {
+				return nil, fmt.Errorf("malformed key %s: %s", jwk.KeyID, err)
+			}
+			y, err := decodeBigInt(jwk.Y)
+			if err != nil {
+				return nil, fmt.Errorf("malformed key %s: %s", jwk.KeyID, err)
+			}
+			if !elliptic.P256().IsOnCurve(x, y) {
+				return nil, fmt.Errorf("malformed key %s: point is not on curve", jwk.KeyID)
+			}
+			keys[jwk.KeyID] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable keys")
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,255 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloud
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("JWT identity", func() {
+	var (
+		rsaKey   *rsa.PrivateKey
+		ecKey    *ecdsa.PrivateKey
+		jwks     []byte
+		dir      string
+		config   JWTConfig
+		identity *JWTIdentity
+		now      time.Time
+	)
+
+	encode := func(value interface{}) string {
+		data, err := json.Marshal(value)
+		Expect(err).ToNot(HaveOccurred())
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	sign := func(alg, kid string, claims map[string]interface{}) string {
+		signingInput := encode(map[string]interface{}{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+		hash := sha256.Sum256([]byte(signingInput))
+		var signature []byte
+		switch alg {
+		case "RS256":
+			var err error
+			signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, hash[:])
+			Expect(err).ToNot(HaveOccurred())
+		case "ES256":
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, hash[:])
+			Expect(err).ToNot(HaveOccurred())
+			signature = make([]byte, 64)
+			copy(signature[32-len(r.Bytes()):32], r.Bytes())
+			copy(signature[64-len(s.Bytes()):], s.Bytes())
+		}
+		return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+
+	claims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":         "https://sso.example.com",
+			"aud":         []interface{}{"gohan", "other"},
+			"exp":         now.Add(time.Hour).Unix(),
+			"iat":         now.Unix(),
+			"tenant_id":   "tenant-id",
+			"tenant_name": "tenant-name",
+			"realm_access": map[string]interface{}{
+				"roles": []interface{}{"member", "viewer"},
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		jwks, err = json.Marshal(map[string]interface{}{
+			"keys": []interface{}{
+				map[string]interface{}{
+					"kty": "RSA", "kid": "rsa-key", "use": "sig",
+					"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+					"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+				},
+				map[string]interface{}{
+					"kty": "EC", "kid": "ec-key", "crv": "P-256",
+					"x": base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+					"y": base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+				},
+				map[string]interface{}{"kty": "RSA", "kid": "enc-key", "use": "enc"},
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		dir, err = ioutil.TempDir("", "gohan_jwt")
+		Expect(err).ToNot(HaveOccurred())
+		jwksFile := filepath.Join(dir, "jwks.json")
+		Expect(ioutil.WriteFile(jwksFile, jwks, 0644)).To(Succeed())
+
+		now = time.Now()
+		config = JWTConfig{
+			JWKSFile:        jwksFile,
+			Issuer:          "https://sso.example.com",
+			Audience:        "gohan",
+			Leeway:          time.Minute,
+			TenantIDClaim:   "tenant_id",
+			TenantNameClaim: "tenant_name",
+			RolesClaim:      "realm_access.roles",
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		identity, err = NewJWTIdentity(config)
+		Expect(err).ToNot(HaveOccurred())
+		identity.now = func() time.Time { return now }
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("maps claims of RS256 token to authorization", func() {
+		token := sign("RS256", "rsa-key", claims())
+		auth, err := identity.VerifyToken(token)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.TenantID()).To(Equal("tenant-id"))
+		Expect(auth.TenantName()).To(Equal("tenant-name"))
+		Expect(auth.AuthToken()).To(Equal(token))
+		Expect(auth.Roles()).To(HaveLen(2))
+		Expect(auth.Roles()[0].Name).To(Equal("member"))
+		Expect(schema.IssuedAtOf(auth)).To(Equal(time.Unix(now.Unix(), 0)))
+
+		name, err := identity.GetTenantName("tenant-id")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(name).To(Equal("tenant-name"))
+		id, err := identity.GetTenantID("tenant-name")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id).To(Equal("tenant-id"))
+	})
+
+	It("verifies ES256 token", func() {
+		_, err := identity.VerifyToken(sign("ES256", "ec-key", claims()))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("rejects tampered token", func() {
+		parts := strings.Split(sign("RS256", "rsa-key", claims()), ".")
+		other := claims()
+		other["tenant_id"] = "admin"
+		_, err := identity.VerifyToken(parts[0] + "." + encode(other) + "." + parts[2])
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("rejects tokens signed with not supported algorithm or wrong key", func() {
+		_, err := identity.VerifyToken(sign("none", "rsa-key", claims()))
+		Expect(err).To(MatchError(ContainSubstring("unsupported algorithm")))
+		_, err = identity.VerifyToken(sign("ES256", "rsa-key", claims()))
+		Expect(err).To(MatchError(ContainSubstring("is not a P-256 key")))
+		_, err = identity.VerifyToken(sign("RS256", "unknown", claims()))
+		Expect(err).To(MatchError(ContainSubstring("unknown key")))
+	})
+
+	It("checks expiry, issuer and audience", func() {
+		expired := claims()
+		expired["exp"] = now.Add(-2 * time.Minute).Unix()
+		_, err := identity.VerifyToken(sign("RS256", "rsa-key", expired))
+		Expect(err).To(MatchError(ContainSubstring("expired")))
+
+		withinLeeway := claims()
+		withinLeeway["exp"] = now.Add(-30 * time.Second).Unix()
+		_, err = identity.VerifyToken(sign("RS256", "rsa-key", withinLeeway))
+		Expect(err).ToNot(HaveOccurred())
+
+		issuer := claims()
+		issuer["iss"] = "https://evil.example.com"
+		_, err = identity.VerifyToken(sign("RS256", "rsa-key", issuer))
+		Expect(err).To(MatchError(ContainSubstring("unexpected issuer")))
+
+		audience := claims()
+		audience["aud"] = "other"
+		_, err = identity.VerifyToken(sign("RS256", "rsa-key", audience))
+		Expect(err).To(MatchError(ContainSubstring("not intended for gohan")))
+	})
+
+	It("requires tenant ID claim", func() {
+		noTenant := claims()
+		delete(noTenant, "tenant_id")
+		_, err := identity.VerifyToken(sign("RS256", "rsa-key", noTenant))
+		Expect(err).To(MatchError(ContainSubstring("claim tenant_id is missing")))
+	})
+
+	It("limits the number of remembered tenant names", func() {
+		for i := 0; i < maxTenantNames+10; i++ {
+			identity.rememberTenantName(fmt.Sprintf("tenant-%d", i), fmt.Sprintf("name-%d", i))
+		}
+		Expect(identity.tenantNames).To(HaveLen(maxTenantNames))
+		Expect(identity.GetTenantName("tenant-last")).To(Equal("tenant-last"))
+		identity.rememberTenantName("tenant-last", "name-last")
+		Expect(identity.GetTenantName("tenant-last")).To(Equal("name-last"))
+	})
+
+	Context("With JWKS URL", func() {
+		var server *ghttp.Server
+
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+			server.AppendHandlers(ghttp.RespondWith(http.StatusOK, jwks))
+			config.JWKSFile = ""
+			config.JWKSURL = server.URL() + "/jwks"
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("loads keys from the URL", func() {
+			_, err := identity.VerifyToken(sign("RS256", "rsa-key", claims()))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(server.ReceivedRequests()).To(HaveLen(1))
+		})
+
+		It("stops refreshing keys when stopped", func() {
+			server.RouteToHandler("GET", "/jwks", ghttp.RespondWith(http.StatusOK, jwks))
+			config.JWKSRefreshInterval = 10 * time.Millisecond
+			refreshing, err := NewJWTIdentity(config)
+			Expect(err).ToNot(HaveOccurred())
+			refreshing.Stop()
+			refreshing.Stop()
+			// let a refresh which was in progress when stopping finish
+			time.Sleep(20 * time.Millisecond)
+			requests := len(server.ReceivedRequests())
+			Consistently(func() int { return len(server.ReceivedRequests()) }, "50ms").Should(Equal(requests))
+		})
+	})
+})
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"net/http"
 	"regexp"
+	"time"
 
 	"github.com/cloudwan/gohan/schema"
 	"github.com/rackspace/gophercloud"
@@ -207,6 +208,10 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 	project := projectObj.(map[string]interface{})
 	tenantID := project["id"].(string)
 	tenantName := project["name"].(string)
+	userID := ""
+	if user, ok := tokenBodyMap["user"].(map[string]interface{}); ok {
+		userID, _ = user["id"].(string)
+	}
 	catalogList, ok := tokenBodyMap["catalog"].([]interface{})
 	catalogObj := []*schema.Catalog{}
 	if ok {
@@ -224,7 +229,20 @@ func (client *keystoneV3Client) VerifyToken(token string) (schema.Authorization,
 			catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 		}
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	auth := schema.NewUserAuthorization(userID, tenantID, tenantName, token, roleIDs, catalogObj)
+	return schema.WithIssuedAt(auth, parseIssuedAt(tokenBodyMap["issued_at"])), nil
+}
+
+//parseIssuedAt parses issue time of a token; keystone v2.0 omits the time zone, which is UTC.
+//Zero time is returned when it can't be parsed.
+func parseIssuedAt(value interface{}) time.Time {
+	issuedAt, _ := value.(string)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if parsed, err := time.Parse(layout, issuedAt); err == nil {
+			return parsed
+		}
+	}
+	return time.Time{}
 }
 
 // GetTenantID maps the given v3.0 project ID to the projects's name
@@ -314,7 +332,9 @@ func (client *keystoneV2Client) VerifyToken(token string) (schema.Authorization,
 		}
 		catalogObj = append(catalogObj, schema.NewCatalog(catalog["name"].(string), catalog["type"].(string), endPoints))
 	}
-	return schema.NewAuthorization(tenantID, tenantName, token, roleIDs, catalogObj), nil
+	userID, _ := userBody.(map[string]interface{})["id"].(string)
+	auth := schema.NewUserAuthorization(userID, tenantID, tenantName, token, roleIDs, catalogObj)
+	return schema.WithIssuedAt(auth, parseIssuedAt(tokenBodyMap["token"].(map[string]interface{})["issued_at"])), nil
 }
 
 // GetTenantID maps the given v2.0 project name to the tenant's id
@@ -16,12 +16,14 @@
 package db_test
 
 import (
+	"context"
 	"os"
 	"time"
 
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/mocks"
 	"github.com/cloudwan/gohan/db/options"
+	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/util"
@@ -377,6 +379,161 @@ var _ = Describe("Database operation test", func() {
 		})
 	})
 
+	Context("Full-text search", func() {
+		var noteSchema *schema.Schema
+
+		BeforeEach(func() {
+			Expect(manager.LoadSchemaFromFile("../tests/test_search_schema.yaml")).To(Succeed())
+			noteSchema, ok = manager.Schema("note")
+			Expect(ok).To(BeTrue())
+		})
+
+		listIDs := func(filter transaction.Filter, paginator *pagination.Paginator) ([]string, uint64) {
+			ids := []string{}
+			var total uint64
+			Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+				var resources []*schema.Resource
+				resources, total, err = tx.List(noteSchema, filter, nil, paginator)
+				Expect(err).ToNot(HaveOccurred())
+				for _, resource := range resources {
+					ids = append(ids, resource.ID())
+				}
+				return tx.Commit()
+			})).To(Succeed())
+			return ids, total
+		}
+
+		for _, backend := range []struct{ dbType, conn string }{{"sqlite3", "test.db"}, {"yaml", "test.yaml"}} {
+			backend := backend
+
+			It("Lists matching resources by relevance using "+backend.dbType, func() {
+				conn = backend.conn
+				os.Remove(conn)
+				dataStore, err = db.ConnectDB(backend.dbType, conn, db.DefaultMaxOpenConn, options.Default())
+				Expect(err).ToNot(HaveOccurred())
+				defer dataStore.Close()
+				for _, s := range manager.Schemas() {
+					Expect(dataStore.RegisterTable(s, false, true)).To(Succeed())
+				}
+				notes := []map[string]interface{}{
+					{"id": "note1", "title": "Gohan", "body": "Install guide", "tenant_id": "red"},
+					{"id": "note2", "title": "Shopping", "body": "Buy milk", "tenant_id": "red"},
+					{"id": "note3", "title": "Gohan release", "body": "What is new in the release", "tenant_id": "red"},
+				}
+				Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+					for _, note := range notes {
+						resource, err := manager.LoadResource("note", note)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(tx.Create(resource)).To(Succeed())
+					}
+					return tx.Commit()
+				})).To(Succeed())
+
+				search := transaction.Filter{transaction.SearchKey: "gohan release"}
+				ids, total := listIDs(search, nil)
+				Expect(ids).To(Equal([]string{"note3", "note1"}))
+				Expect(total).To(Equal(uint64(2)))
+
+				byID, err := pagination.NewPaginator(noteSchema, "id", pagination.ASC, 0, 0)
+				Expect(err).ToNot(HaveOccurred())
+				ids, _ = listIDs(search, byID)
+				Expect(ids).To(Equal([]string{"note1", "note3"}))
+
+				ids, _ = listIDs(transaction.Filter{transaction.SearchKey: "milk", "tenant_id": "blue"}, nil)
+				Expect(ids).To(BeEmpty())
+
+				Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+					resource, err := manager.LoadResource("note", map[string]interface{}{
+						"id": "note2", "title": "Shopping", "body": "Buy the Gohan book", "tenant_id": "red"})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(tx.Update(resource)).To(Succeed())
+					Expect(tx.Delete(noteSchema, "note1")).To(Succeed())
+					return tx.Commit()
+				})).To(Succeed())
+				ids, _ = listIDs(transaction.Filter{transaction.SearchKey: "gohan"}, byID)
+				Expect(ids).To(Equal([]string{"note2", "note3"}))
+
+				By("listing equally matching resources by ID")
+				Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+					for _, id := range []string{"note5", "note4"} {
+						resource, err := manager.LoadResource("note", map[string]interface{}{
+							"id": id, "title": "Groceries", "body": "Buy bread", "tenant_id": "red"})
+						Expect(err).ToNot(HaveOccurred())
+						Expect(tx.Create(resource)).To(Succeed())
+					}
+					return tx.Commit()
+				})).To(Succeed())
+				ids, _ = listIDs(transaction.Filter{transaction.SearchKey: "bread"}, nil)
+				Expect(ids).To(Equal([]string{"note4", "note5"}))
+			})
+		}
+	})
+
+	Context("Aggregation", func() {
+		var noteSchema *schema.Schema
+
+		BeforeEach(func() {
+			Expect(manager.LoadSchemaFromFile("../tests/test_search_schema.yaml")).To(Succeed())
+			noteSchema, ok = manager.Schema("note")
+			Expect(ok).To(BeTrue())
+		})
+
+		aggregate := func(filter transaction.Filter, groupBy []string, aggregations ...transaction.Aggregation) []map[string]interface{} {
+			var result []map[string]interface{}
+			Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+				result, err = tx.Aggregate(context.Background(), noteSchema, filter, groupBy, aggregations)
+				Expect(err).ToNot(HaveOccurred())
+				return tx.Commit()
+			})).To(Succeed())
+			return result
+		}
+
+		for _, backend := range []struct{ dbType, conn string }{{"sqlite3", "test.db"}, {"yaml", "test.yaml"}} {
+			backend := backend
+
+			It("Aggregates groups of matching resources using "+backend.dbType, func() {
+				conn = backend.conn
+				os.Remove(conn)
+				dataStore, err = db.ConnectDB(backend.dbType, conn, db.DefaultMaxOpenConn, options.Default())
+				Expect(err).ToNot(HaveOccurred())
+				defer dataStore.Close()
+				for _, s := range manager.Schemas() {
+					Expect(dataStore.RegisterTable(s, false, true)).To(Succeed())
+				}
+				notes := []map[string]interface{}{
+					{"id": "note1", "title": "Gohan", "body": "Install guide", "pages": 10, "tenant_id": "red"},
+					{"id": "note2", "title": "Shopping", "body": "Buy milk", "pages": 1, "tenant_id": "red"},
+					{"id": "note3", "title": "Gohan release", "body": "What is new", "pages": 4, "tenant_id": "blue"},
+				}
+				Expect(db.Within(dataStore, func(tx transaction.Transaction) error {
+					for _, note := range notes {
+						resource, err := manager.LoadResource("note", note)
+						Expect(err).ToNot(HaveOccurred())
+						Expect(tx.Create(resource)).To(Succeed())
+					}
+					return tx.Commit()
+				})).To(Succeed())
+
+				count := transaction.Aggregation{Function: transaction.AggregateCount}
+				sum := transaction.Aggregation{Function: transaction.AggregateSum, Property: "pages"}
+				max := transaction.Aggregation{Function: transaction.AggregateMax, Property: "title"}
+				Expect(aggregate(nil, []string{"tenant_id"}, count, sum, max)).To(Equal([]map[string]interface{}{
+					{"tenant_id": "blue", "count": 1, "sum_pages": 4, "max_title": "Gohan release"},
+					{"tenant_id": "red", "count": 2, "sum_pages": 11, "max_title": "Shopping"},
+				}))
+
+				avg := transaction.Aggregation{Function: transaction.AggregateAvg, Property: "pages"}
+				Expect(aggregate(transaction.Filter{"tenant_id": "red"}, nil, count, avg)).To(Equal([]map[string]interface{}{
+					{"count": 2, "avg_pages": 5.5},
+				}))
+				Expect(aggregate(transaction.Filter{"tenant_id": "green"}, nil, count, sum)).To(Equal([]map[string]interface{}{
+					{"count": 0, "sum_pages": nil},
+				}))
+				Expect(aggregate(transaction.Filter{"tenant_id": "green"}, []string{"tenant_id"}, count)).To(BeEmpty())
+			})
+		}
+	})
+
 	Context("Converting", func() {
 		BeforeEach(func() {
 			Expect(manager.LoadSchemaFromFile("test_data/conv_in.yaml")).To(Succeed())
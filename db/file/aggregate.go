@@ -0,0 +1,149 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+)
+
+//Aggregate computes aggregations of matching resources grouped by values of the groupBy properties.
+//Groups are ordered by their values; without groupBy a single group of all matching resources is returned.
+func (tx *Transaction) Aggregate(_ context.Context, s *schema.Schema, filter transaction.Filter,
+	groupBy []string, aggregations []transaction.Aggregation) ([]map[string]interface{}, error) {
+	if err := transaction.ValidateAggregation(s, groupBy, aggregations); err != nil {
+		return nil, err
+	}
+	list, _, err := tx.List(s, filter, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	groups := map[string][]*schema.Resource{}
+	values := map[string][]interface{}{}
+	keys := []string{}
+	if len(groupBy) == 0 {
+		// like in SQL, the single group is returned even when no resource matches
+		key := fmt.Sprintf("%#v", []interface{}{})
+		keys = append(keys, key)
+		values[key] = []interface{}{}
+	}
+	for _, resource := range list {
+		groupValues := make([]interface{}, len(groupBy))
+		for i, id := range groupBy {
+			groupValues[i] = resource.Get(id)
+		}
+		key := fmt.Sprintf("%#v", groupValues)
+		if _, ok := values[key]; !ok {
+			keys = append(keys, key)
+		}
+		values[key] = groupValues
+		groups[key] = append(groups[key], resource)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := values[keys[i]], values[keys[j]]
+		for k := range groupBy {
+			if c := compareGroupValues(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	result := []map[string]interface{}{}
+	for _, key := range keys {
+		group := map[string]interface{}{}
+		for i, id := range groupBy {
+			group[id] = values[key][i]
+		}
+		for _, aggregation := range aggregations {
+			group[aggregation.Key()] = aggregate(s, aggregation, groups[key])
+		}
+		result = append(result, group)
+	}
+	return result, nil
+}
+
+//aggregate computes the aggregation of resources; like in SQL, null values are ignored
+func aggregate(s *schema.Schema, aggregation transaction.Aggregation, resources []*schema.Resource) interface{} {
+	if aggregation.Property == "" {
+		return len(resources)
+	}
+	property, _ := s.GetPropertyByID(aggregation.Property)
+	count := 0
+	sum := 0.0
+	var extreme interface{}
+	for _, resource := range resources {
+		value := resource.Get(aggregation.Property)
+		if value == nil {
+			continue
+		}
+		count++
+		switch aggregation.Function {
+		case transaction.AggregateSum, transaction.AggregateAvg:
+			number, _ := toFloat(value)
+			sum += number
+		case transaction.AggregateMin:
+			if extreme == nil || compareGroupValues(value, extreme) < 0 {
+				extreme = value
+			}
+		case transaction.AggregateMax:
+			if extreme == nil || compareGroupValues(value, extreme) > 0 {
+				extreme = value
+			}
+		}
+	}
+	switch aggregation.Function {
+	case transaction.AggregateCount:
+		return count
+	case transaction.AggregateSum:
+		if count == 0 {
+			return nil
+		}
+		if property.Type == "integer" {
+			return int(sum)
+		}
+		return sum
+	case transaction.AggregateAvg:
+		if count == 0 {
+			return nil
+		}
+		return sum / float64(count)
+	}
+	return extreme
+}
+
+//compareGroupValues compares values like sort keys; values which aren't comparable that way,
+//e.g. objects or values of different types, are compared by their string representation
+func compareGroupValues(a, b interface{}) int {
+	if isScalar(a) && isScalar(b) {
+		if c, err := compareSortValues(a, b); err == nil {
+			return c
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case nil, int, int64, float64, bool, string:
+		return true
+	}
+	return false
+}
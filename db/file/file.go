@@ -16,9 +16,13 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 
@@ -208,37 +212,154 @@ func (tx *Transaction) Delete(s *schema.Schema, resourceID interface{}) error {
 }
 
 type byPaginator struct {
-	data []*schema.Resource
-	pg   *pagination.Paginator
+	data  []*schema.Resource
+	key   string
+	order string
+	err   error
 }
 
-func (s byPaginator) Len() int {
+func (s *byPaginator) Len() int {
 	return len(s.data)
 }
-func (s byPaginator) Swap(i, j int) {
+func (s *byPaginator) Swap(i, j int) {
 	s.data[i], s.data[j] = s.data[j], s.data[i]
 }
-func (s byPaginator) Less(i, j int) bool {
-	key := s.pg.Key
-	vi := s.data[i].Get(key)
-	vj := s.data[j].Get(key)
-	var less bool
+func (s *byPaginator) Less(i, j int) bool {
+	c, err := compareSortKeys(s.data[i], s.data[j].Get(s.key), s.data[j].ID(), s.key)
+	if err != nil && s.err == nil {
+		s.err = err
+	}
+	if s.order == pagination.DESC {
+		return c > 0
+	}
+	return c < 0
+}
 
-	switch vi.(type) {
-	case int:
-		less = vi.(int) < vj.(int)
-	case float64:
-		less = vi.(float64) < vj.(float64)
+//compareSortKeys compares resource with given sort key value and id.
+//Resources with equal sort key values are ordered by id.
+func compareSortKeys(resource *schema.Resource, value interface{}, id, key string) (int, error) {
+	c, err := compareSortValues(resource.Get(key), value)
+	if err != nil || c != 0 {
+		return c, err
+	}
+	return strings.Compare(resource.ID(), id), nil
+}
+
+func compareSortValues(a, b interface{}) (int, error) {
+	switch {
+	case a == nil && b == nil:
+		return 0, nil
+	case a == nil:
+		return -1, nil
+	case b == nil:
+		return 1, nil
+	}
+	switch va := a.(type) {
+	case int, int64, float64:
+		fa, _ := toFloat(va)
+		fb, err := toFloat(b)
+		if err != nil {
+			return 0, fmt.Errorf("Uncomparable types %T and %T", a, b)
+		}
+		switch {
+		case fa < fb:
+			return -1, nil
+		case fa > fb:
+			return 1, nil
+		}
+		return 0, nil
+	case bool:
+		vb, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, fmt.Errorf("Uncomparable types %T and %T", a, b)
+		case va == vb:
+			return 0, nil
+		case vb:
+			return -1, nil
+		}
+		return 1, nil
 	case string:
-		less = vi.(string) < vj.(string)
-	default:
-		panic(fmt.Sprintf("uncomparable type %T", vi))
+		return strings.Compare(va, fmt.Sprint(b)), nil
+	}
+	return 0, fmt.Errorf("Uncomparable type %T", a)
+}
+
+//paginate sorts the list and applies marker, offset and limit of the paginator
+func paginate(list []*schema.Resource, pg *pagination.Paginator) ([]*schema.Resource, error) {
+	key := pg.Key
+	if key == "" {
+		key = "id"
+	}
+	sorter := &byPaginator{data: list, key: key, order: pg.Order}
+	sort.Sort(sorter)
+	if sorter.err != nil {
+		return nil, sorter.err
+	}
+	if pg.Marker != "" {
+		marker, err := pagination.DecodeMarker(pg.Marker)
+		if err != nil {
+			return nil, err
+		}
+		value := marker.Value
+		if key == "id" {
+			value = marker.ID
+		}
+		next := sort.Search(len(list), func(i int) bool {
+			c, compareErr := compareSortKeys(list[i], value, marker.ID, key)
+			if compareErr != nil && err == nil {
+				err = compareErr
+			}
+			if pg.Order == pagination.DESC {
+				return c < 0
+			}
+			return c > 0
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Invalid marker %s: %s", pg.Marker, err)
+		}
+		list = list[next:]
 	}
+	return limit(list, pg), nil
+}
 
-	if s.pg.Order == pagination.DESC {
-		return !less
+//limit applies offset and limit of the paginator
+func limit(list []*schema.Resource, pg *pagination.Paginator) []*schema.Resource {
+	if pg.Offset > 0 {
+		if pg.Offset >= uint64(len(list)) {
+			return []*schema.Resource{}
+		}
+		list = list[pg.Offset:]
 	}
-	return less
+	if pg.Limit > 0 && pg.Limit < uint64(len(list)) {
+		list = list[:pg.Limit]
+	}
+	return list
+}
+
+//searchScore returns how many times words of the search occur in properties covered by full-text indexes
+func searchScore(s *schema.Schema, data map[string]interface{}, words []string) int {
+	score := 0
+	for _, property := range s.SearchProperties() {
+		if data[property] == nil {
+			continue
+		}
+		value := strings.ToLower(fmt.Sprint(data[property]))
+		for _, word := range words {
+			score += strings.Count(value, strings.ToLower(word))
+		}
+	}
+	return score
+}
+
+//sortByRelevance orders resources by search score, the best matching first
+func sortByRelevance(list []*schema.Resource, scores map[string]int) {
+	sort.SliceStable(list, func(i, j int) bool {
+		if scores[list[i].ID()] != scores[list[j].ID()] {
+			return scores[list[i].ID()] > scores[list[j].ID()]
+		}
+		return list[i].ID() < list[j].ID()
+	})
 }
 
 func (tx *Transaction) ListContext(_ context.Context, s *schema.Schema, filter transaction.Filter, options *transaction.ViewOptions, pg *pagination.Paginator) (list []*schema.Resource, total uint64, err error) {
@@ -247,6 +368,13 @@ func (tx *Transaction) ListContext(_ context.Context, s *schema.Schema, filter t
 
 //List resources in the db
 func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options *transaction.ViewOptions, pg *pagination.Paginator) (list []*schema.Resource, total uint64, err error) {
+	filter = transaction.NotDeleted(s, filter)
+	search, filter := transaction.SplitSearch(filter)
+	words := transaction.SearchWords(search)
+	if search != "" && len(s.SearchProperties()) == 0 {
+		return nil, 0, fmt.Errorf("Schema %s has no full-text index to search", s.ID)
+	}
+	scores := map[string]int{}
 	db := tx.db
 	db.load()
 	table := db.getTable(s)
@@ -261,6 +389,19 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 		valid := true
 		if filter != nil {
 			for key, value := range filter {
+				switch value.(type) {
+				case transaction.Condition, transaction.Conditions, []transaction.Condition:
+					property, err := s.GetPropertyByID(key)
+					if err != nil {
+						continue
+					}
+					for _, condition := range transaction.ConditionsOf(value) {
+						if !matchCondition(property, data[key], condition) {
+							valid = false
+						}
+					}
+					continue
+				}
 				if data[key] == nil {
 					continue
 				}
@@ -296,18 +437,24 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 				}
 			}
 		}
+		if valid && len(words) > 0 {
+			scores[resource.ID()] = searchScore(s, data, words)
+			valid = scores[resource.ID()] > 0
+		}
 		if valid {
 			list = append(list, resource)
 		}
-
+	}
+	total = uint64(len(list))
+	//resources are ordered by relevance unless sort key is given
+	if len(words) > 0 && (pg == nil || pg.Key == "") {
+		sortByRelevance(list, scores)
 		if pg != nil {
-			sort.Sort(byPaginator{list, pg})
-			if pg.Limit > 0 {
-				list = list[:pg.Limit]
-			}
+			list = limit(list, pg)
 		}
+	} else if pg != nil {
+		list, err = paginate(list, pg)
 	}
-	total = uint64(len(list))
 	return
 }
 
@@ -406,3 +553,133 @@ func boolInSlice(a bool, list []string) bool {
 	}
 	return false
 }
+
+func matchCondition(property *schema.Property, data interface{}, condition transaction.Condition) bool {
+	if err := condition.Validate(); err != nil {
+		log.Warning("Invalid filter on %s: %s", property.ID, err)
+		return false
+	}
+	if condition.Operator == transaction.IsNull {
+		return (data == nil) == condition.Value.(bool)
+	}
+	if data == nil {
+		return false
+	}
+	values := valueList(condition.Value)
+	switch condition.Operator {
+	case transaction.Equal:
+		for _, value := range values {
+			if cmp, ok := compareValues(property, data, value); ok && cmp == 0 {
+				return true
+			}
+		}
+		return false
+	case transaction.NotEqual:
+		for _, value := range values {
+			if cmp, ok := compareValues(property, data, value); !ok || cmp == 0 {
+				return false
+			}
+		}
+		return true
+	case transaction.Like:
+		for _, value := range values {
+			if matchLike(data, value) {
+				return true
+			}
+		}
+		return false
+	case transaction.NotLike:
+		for _, value := range values {
+			if matchLike(data, value) {
+				return false
+			}
+		}
+		return true
+	}
+	cmp, ok := compareValues(property, data, condition.Value)
+	if !ok {
+		return false
+	}
+	switch condition.Operator {
+	case transaction.LessThan:
+		return cmp < 0
+	case transaction.LessThanOrEqual:
+		return cmp <= 0
+	case transaction.GreaterThan:
+		return cmp > 0
+	case transaction.GreaterThanOrEqual:
+		return cmp >= 0
+	}
+	return false
+}
+
+// compareValues compares a value stored in db with a filter value
+// and returns -1, 0 or 1 and whether these values are comparable at all
+func compareValues(property *schema.Property, data, value interface{}) (int, bool) {
+	switch property.Type {
+	case "integer", "number":
+		a, err1 := toFloat(data)
+		b, err2 := toFloat(value)
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		switch {
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	case "boolean":
+		a, err1 := strconv.ParseBool(fmt.Sprint(data))
+		b, err2 := strconv.ParseBool(fmt.Sprint(value))
+		if err1 != nil || err2 != nil || a != b {
+			return 1, err1 == nil && err2 == nil
+		}
+		return 0, true
+	}
+	return strings.Compare(fmt.Sprint(data), fmt.Sprint(value)), true
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return strconv.ParseFloat(fmt.Sprint(value), 64)
+}
+
+// matchLike matches value against SQL LIKE pattern
+func matchLike(data, pattern interface{}) bool {
+	var expr bytes.Buffer
+	expr.WriteString("(?is)^")
+	for _, r := range fmt.Sprint(pattern) {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	matched, _ := regexp.MatchString(expr.String(), fmt.Sprint(data))
+	return matched
+}
+
+func valueList(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
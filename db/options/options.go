@@ -26,17 +26,34 @@ const (
 	DefaultDeadlockRetryTxCount    = 0
 )
 
-// Options is type for retry transaction options
+// default read replica options
+const (
+	DefaultReplicaMaxLag        = 10 * time.Second
+	DefaultReplicaCheckInterval = 1 * time.Second
+)
+
+// Options is type for retry transaction and read replica options
 type Options struct {
 	RetryTxCount    int
 	RetryTxInterval time.Duration
+
+	// Replicas are connection strings of read replicas serving read only transactions
+	Replicas []string
+	// ReplicaMaxLag is the replication lag above which a replica isn't used
+	ReplicaMaxLag time.Duration
+	// ReplicaCheckInterval is how often health and lag of a replica are checked
+	ReplicaCheckInterval time.Duration
 }
 
-// Read gets retry transaction options from config
+// Read gets retry transaction and read replica options from config
 func Read(config *util.Config) Options {
 	opts := Options{
 		RetryTxCount:    config.GetInt("database/deadlock_retry_tx/count", DefaultDeadlockRetryTxCount),
 		RetryTxInterval: time.Duration(config.GetInt("database/deadlock_retry_tx/interval_msec", int(DefaultDeadlockRetryTxInterval))) * time.Millisecond,
+
+		Replicas:             config.GetStringList("database/read_replicas/connections", nil),
+		ReplicaMaxLag:        time.Duration(config.GetInt("database/read_replicas/max_lag_msec", int(DefaultReplicaMaxLag/time.Millisecond))) * time.Millisecond,
+		ReplicaCheckInterval: time.Duration(config.GetInt("database/read_replicas/check_interval_msec", int(DefaultReplicaCheckInterval/time.Millisecond))) * time.Millisecond,
 	}
 
 	if opts.RetryTxCount < 0 {
@@ -49,7 +66,9 @@ func Read(config *util.Config) Options {
 // Default returns default retry transaction options
 func Default() Options {
 	return Options{
-		RetryTxCount:    DefaultDeadlockRetryTxCount,
-		RetryTxInterval: DefaultDeadlockRetryTxInterval,
+		RetryTxCount:         DefaultDeadlockRetryTxCount,
+		RetryTxInterval:      DefaultDeadlockRetryTxInterval,
+		ReplicaMaxLag:        DefaultReplicaMaxLag,
+		ReplicaCheckInterval: DefaultReplicaCheckInterval,
 	}
 }
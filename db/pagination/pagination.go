@@ -16,6 +16,8 @@
 package pagination
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"strconv"
@@ -39,6 +41,51 @@ type Paginator struct {
 	Order  string
 	Limit  uint64
 	Offset uint64
+	Marker string
+}
+
+//Marker is a decoded pagination marker.
+//It points at the last resource of the previous page
+//by its sort key value and id.
+type Marker struct {
+	Value interface{} `json:"v"`
+	ID    string      `json:"id"`
+}
+
+//EncodeMarker creates an opaque marker for given sort key value and resource id
+func EncodeMarker(value interface{}, id string) (string, error) {
+	data, err := json.Marshal(&Marker{Value: value, ID: id})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+//DecodeMarker decodes marker created by EncodeMarker
+func DecodeMarker(marker string) (*Marker, error) {
+	data, err := base64.RawURLEncoding.DecodeString(marker)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid marker %s", marker)
+	}
+	decoded := &Marker{}
+	if err := json.Unmarshal(data, decoded); err != nil || decoded.ID == "" {
+		return nil, fmt.Errorf("Invalid marker %s", marker)
+	}
+	return decoded, nil
+}
+
+//NextMarker returns marker of the page following the given one.
+//Empty string is returned when the page is the last one.
+func (pg *Paginator) NextMarker(list []*schema.Resource) (string, error) {
+	if pg == nil || pg.Limit == 0 || uint64(len(list)) < pg.Limit {
+		return "", nil
+	}
+	last := list[len(list)-1]
+	var value interface{}
+	if pg.Key != "" && pg.Key != defaultSortKey {
+		value = last.Get(pg.Key)
+	}
+	return EncodeMarker(value, last.ID())
 }
 
 //NewPaginator create Paginator
@@ -94,5 +141,44 @@ func FromURLQuery(s *schema.Schema, values url.Values) (pg *Paginator, err error
 		}
 	}
 
-	return NewPaginator(s, sortKey, sortOrder, limit, offset)
+	pg, err = NewPaginator(s, sortKey, sortOrder, limit, offset)
+	if err != nil {
+		return
+	}
+
+	if m := values.Get("marker"); m != "" {
+		var marker *Marker
+		if marker, err = DecodeMarker(m); err != nil {
+			return nil, err
+		}
+		if err = marker.validate(s, pg.Key); err != nil {
+			return nil, err
+		}
+		pg.Marker = m
+	}
+	return
+}
+
+//validate checks that the marker value has the type of the sort key property
+func (marker *Marker) validate(s *schema.Schema, key string) error {
+	if s == nil || key == defaultSortKey || marker.Value == nil {
+		return nil
+	}
+	property, err := s.GetPropertyByID(key)
+	if err != nil {
+		return err
+	}
+	valid := true
+	switch property.Type {
+	case "integer", "number":
+		_, valid = marker.Value.(float64)
+	case "boolean":
+		_, valid = marker.Value.(bool)
+	case "string":
+		_, valid = marker.Value.(string)
+	}
+	if !valid {
+		return fmt.Errorf("Invalid marker, %v isn't a value of sort key %s", marker.Value, key)
+	}
+	return nil
 }
@@ -104,3 +104,73 @@ func TestFromURLQueryErrors(t *testing.T) {
 	pg, err = FromURLQuery(s, values)
 	Expect(err).To(HaveOccurred(), "Got %v", pg)
 }
+
+func TestMarkerFromURLQuery(t *testing.T) {
+	RegisterTestingT(t)
+	marker, err := EncodeMarker("name", "id1")
+	Expect(err).ToNot(HaveOccurred())
+	values := url.Values{
+		"limit":  []string{"10"},
+		"marker": []string{marker},
+	}
+	pg, err := FromURLQuery(nil, values)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(pg.Marker).To(Equal(marker))
+
+	decoded, err := DecodeMarker(pg.Marker)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(decoded).To(Equal(&Marker{Value: "name", ID: "id1"}))
+
+	values.Set("marker", "bad_marker")
+	pg, err = FromURLQuery(nil, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+}
+
+func TestMarkerOfWrongTypeFromURLQuery(t *testing.T) {
+	RegisterTestingT(t)
+	s := schema.NewSchema("foo", "foos", "Foo", "", "foo")
+	s.Properties = append(s.Properties,
+		schema.NewProperty("id", "", "", "string", "", "", "", "", "", false, true, false, map[string]interface{}{}, "", false),
+		schema.NewProperty("size", "", "", "integer", "", "", "", "", "", false, true, false, map[string]interface{}{}, "", false))
+	marker, err := EncodeMarker(10, "id1")
+	Expect(err).ToNot(HaveOccurred())
+	values := url.Values{
+		"sort_key": []string{"size"},
+		"marker":   []string{marker},
+	}
+	_, err = FromURLQuery(s, values)
+	Expect(err).ToNot(HaveOccurred())
+
+	marker, err = EncodeMarker("v", "id1")
+	Expect(err).ToNot(HaveOccurred())
+	values.Set("marker", marker)
+	pg, err := FromURLQuery(s, values)
+	Expect(err).To(HaveOccurred(), "Got %v", pg)
+}
+
+func TestNextMarker(t *testing.T) {
+	RegisterTestingT(t)
+	s := schema.NewSchema("foo", "foos", "Foo", "", "foo")
+	s.Properties = append(s.Properties,
+		schema.NewProperty("id", "", "", "string", "", "", "", "", "", false, true, false, map[string]interface{}{}, "", false),
+		schema.NewProperty("prop", "", "", "string", "", "", "", "", "", false, true, false, map[string]interface{}{}, "", false))
+	list := []*schema.Resource{}
+	for _, id := range []string{"a", "b"} {
+		resource, err := schema.NewResource(s, map[string]interface{}{"id": id, "prop": "value_" + id})
+		Expect(err).ToNot(HaveOccurred())
+		list = append(list, resource)
+	}
+
+	pg, err := NewPaginator(s, "prop", ASC, 2, 0)
+	Expect(err).ToNot(HaveOccurred())
+	marker, err := pg.NextMarker(list)
+	Expect(err).ToNot(HaveOccurred())
+	decoded, err := DecodeMarker(marker)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(decoded).To(Equal(&Marker{Value: "value_b", ID: "b"}))
+
+	pg.Limit = 3
+	Expect(pg.NextMarker(list)).To(BeEmpty())
+	pg.Limit = 0
+	Expect(pg.NextMarker(list)).To(BeEmpty())
+}
@@ -0,0 +1,139 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+)
+
+//Aggregate computes aggregations of matching resources grouped by values of the groupBy properties.
+//Groups are ordered by their values; without groupBy a single group of all matching resources is returned.
+func (tx *Transaction) Aggregate(ctx context.Context, s *schema.Schema, filter transaction.Filter,
+	groupBy []string, aggregations []transaction.Aggregation) ([]map[string]interface{}, error) {
+	defer tx.measureTime(time.Now(), s.ID, "aggregate")
+
+	if err := transaction.ValidateAggregation(s, groupBy, aggregations); err != nil {
+		return nil, err
+	}
+	// columns are aliased, so property IDs can't clash with SQL keywords or aggregation keys
+	columns := []string{}
+	groupColumns := []string{}
+	for i, id := range groupBy {
+		columns = append(columns, fmt.Sprintf("%s as %s", quote(id), quote(groupAlias(i))))
+		groupColumns = append(groupColumns, quote(groupAlias(i)))
+	}
+	for i, aggregation := range aggregations {
+		argument := "*"
+		if aggregation.Property != "" {
+			argument = quote(aggregation.Property)
+		}
+		columns = append(columns, fmt.Sprintf("%s(%s) as %s",
+			strings.ToUpper(string(aggregation.Function)), argument, quote(aggregationAlias(i))))
+	}
+	q := sq.Select(columns...).From(quote(s.GetDbTableName()))
+	search, filter := transaction.SplitSearch(filter)
+	q, err := addFilterToQuery(s, q, transaction.NotDeleted(s, filter), false)
+	if err != nil {
+		return nil, err
+	}
+	if search != "" {
+		if q, err = addSearchToQuery(tx.db.sqlType, s, q, search, false); err != nil {
+			return nil, err
+		}
+	}
+	if len(groupColumns) > 0 {
+		q = q.GroupBy(groupColumns...).OrderBy(groupColumns...)
+	}
+	sql, args, err := q.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.transaction.QueryxContext(ctx, tx.db.rebind(sql), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []map[string]interface{}{}
+	for rows.Next() {
+		data := map[string]interface{}{}
+		if err := rows.MapScan(data); err != nil {
+			return nil, err
+		}
+		group, err := tx.decodeAggregates(s, groupBy, aggregations, data)
+		if err != nil {
+			return nil, fmt.Errorf("SQL Aggregate decoding error: %s", err)
+		}
+		result = append(result, group)
+	}
+	return result, rows.Err()
+}
+
+func groupAlias(i int) string {
+	return fmt.Sprintf("group_%d", i)
+}
+
+func aggregationAlias(i int) string {
+	return fmt.Sprintf("aggregate_%d", i)
+}
+
+//decodeAggregates converts a row of aggregated values to their JSON representation.
+//Counts are integers, averages are numbers and other aggregations have the type of the property.
+func (tx *Transaction) decodeAggregates(s *schema.Schema, groupBy []string, aggregations []transaction.Aggregation,
+	data map[string]interface{}) (map[string]interface{}, error) {
+	group := map[string]interface{}{}
+	for i, id := range groupBy {
+		property, _ := s.GetPropertyByID(id)
+		value, err := tx.db.handler(property).decode(property, data[groupAlias(i)])
+		if err != nil {
+			return nil, err
+		}
+		group[id] = value
+	}
+	for i, aggregation := range aggregations {
+		var handler propertyHandler
+		var property *schema.Property
+		switch aggregation.Function {
+		case transaction.AggregateCount:
+			handler = &integerHandler{}
+		case transaction.AggregateAvg:
+			handler = &numberHandler{}
+		default:
+			property, _ = s.GetPropertyByID(aggregation.Property)
+			handler = tx.db.handler(property)
+		}
+		value := data[aggregationAlias(i)]
+		if _, ok := handler.(*numberHandler); ok {
+			// sqlite3 returns integers when aggregating integral values
+			if integer, isInteger := value.(int64); isInteger {
+				value = float64(integer)
+			}
+		}
+		decoded, err := handler.decode(property, value)
+		if err != nil {
+			return nil, err
+		}
+		group[aggregation.Key()] = decoded
+	}
+	return group, nil
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+//replica is a read replica serving read only transactions while it is healthy
+type replica struct {
+	index     int
+	db        *sqlx.DB
+	mutex     sync.Mutex
+	healthy   bool
+	checkedAt time.Time
+}
+
+//connectReplicas opens connections to read replicas.
+//Replicas are checked when first used, so an unreachable replica doesn't prevent the startup.
+func (db *DB) connectReplicas(maxOpenConn int) error {
+	db.replicas = nil
+	for i, conn := range db.options.Replicas {
+		rawDB, err := sql.Open(db.sqlType, conn)
+		if err != nil {
+			return fmt.Errorf("Failed to open read replica %d: %s", i, err)
+		}
+		rawDB.SetMaxOpenConns(maxOpenConn)
+		rawDB.SetMaxIdleConns(maxOpenConn)
+		db.replicas = append(db.replicas, &replica{index: i, db: sqlx.NewDb(rawDB, db.sqlType)})
+	}
+	return nil
+}
+
+func (db *DB) closeReplicas() {
+	for _, replica := range db.replicas {
+		replica.db.Close()
+	}
+}
+
+//beginOnReplica starts transaction on a healthy replica picked in round robin.
+//Nil transaction is returned when no replica could start it and the primary should be used.
+func (db *DB) beginOnReplica(ctx context.Context, sqlOptions *sql.TxOptions) (*sqlx.Tx, *replica) {
+	count := len(db.replicas)
+	if count == 0 {
+		return nil, nil
+	}
+	start := int(atomic.AddUint32(&db.nextReplica, 1))
+	for i := 0; i < count; i++ {
+		replica := db.replicas[(start+i)%count]
+		if !db.checkReplica(replica) {
+			continue
+		}
+		rawTx, err := replica.db.BeginTxx(ctx, sqlOptions)
+		if err != nil {
+			log.Warning("Failed to begin transaction on read replica %d: %s", replica.index, err)
+			replica.setHealthy(false)
+			continue
+		}
+		db.updateCounter(1, "replica.begin")
+		return rawTx, replica
+	}
+	db.updateCounter(1, "replica.fallback")
+	return nil, nil
+}
+
+//checkReplica returns whether the replica is reachable and not lagging behind the primary too much.
+//The check is repeated at most once per check interval; concurrent callers use the last result meanwhile.
+func (db *DB) checkReplica(replica *replica) bool {
+	replica.mutex.Lock()
+	if time.Since(replica.checkedAt) < db.options.ReplicaCheckInterval {
+		healthy := replica.healthy
+		replica.mutex.Unlock()
+		return healthy
+	}
+	wasHealthy, first := replica.healthy, replica.checkedAt.IsZero()
+	replica.checkedAt = time.Now()
+	replica.mutex.Unlock()
+
+	// only changes of the state are logged
+	healthy := false
+	lag, err := db.replicaLag(replica.db)
+	switch {
+	case err != nil:
+		if wasHealthy || first {
+			log.Warning("Read replica %d is unavailable: %s", replica.index, err)
+		}
+	case lag > db.options.ReplicaMaxLag:
+		if wasHealthy || first {
+			log.Warning("Read replica %d lags %s behind the primary", replica.index, lag)
+		}
+	default:
+		if !wasHealthy {
+			log.Info("Read replica %d is available", replica.index)
+		}
+		healthy = true
+	}
+	replica.setHealthy(healthy)
+	return healthy
+}
+
+func (replica *replica) setHealthy(healthy bool) {
+	replica.mutex.Lock()
+	defer replica.mutex.Unlock()
+	replica.healthy = healthy
+}
+
+//replicaLag returns how long the replica lags behind the primary.
+//Databases without replication lag information are only checked to be reachable.
+func (db *DB) replicaLag(replicaDB *sqlx.DB) (time.Duration, error) {
+	timeout := db.options.ReplicaCheckInterval
+	if timeout <= 0 {
+		timeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	switch db.sqlType {
+	case "mysql":
+		return mysqlReplicaLag(ctx, replicaDB)
+	case "postgres":
+		var seconds float64
+		err := replicaDB.QueryRowContext(ctx, "SELECT CASE WHEN pg_is_in_recovery() "+
+			"THEN COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) ELSE 0 END").Scan(&seconds)
+		return time.Duration(seconds * float64(time.Second)), err
+	}
+	return 0, replicaDB.PingContext(ctx)
+}
+
+func mysqlReplicaLag(ctx context.Context, replicaDB *sqlx.DB) (time.Duration, error) {
+	rows, err := replicaDB.QueryxContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		// not replicating, so it can't lag behind
+		return 0, rows.Err()
+	}
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+	var seconds sql.NullInt64
+	if err := seconds.Scan(status["Seconds_Behind_Master"]); err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		return 0, fmt.Errorf("replication is not running")
+	}
+	return time.Duration(seconds.Int64) * time.Second, nil
+}
@@ -0,0 +1,148 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/lann/squirrel"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+)
+
+//relevanceColumn is selected in full-text searches to order resources by relevance
+const relevanceColumn = "_relevance"
+
+//addSearchToQuery restricts query to resources matching full-text search text.
+//When ordered, the best matching resources are listed first, equally matching ones by ID.
+//MySQL uses FULLTEXT indexes in natural language mode and sqlite3 uses FTS5 tables of the indexes.
+func addSearchToQuery(sqlType string, s *schema.Schema, q sq.SelectBuilder, text string, ordered bool) (sq.SelectBuilder, error) {
+	indexes := s.FullTextIndexes()
+	if len(indexes) == 0 {
+		return q, fmt.Errorf("Schema %s has no full-text index to search", s.ID)
+	}
+	words := transaction.SearchWords(text)
+	if len(words) == 0 {
+		return q, nil
+	}
+	t := quote(s.GetDbTableName())
+	matches := sq.Or{}
+	scores := []string{}
+	var scoreArgs []interface{}
+	switch sqlType {
+	case "mysql":
+		for _, index := range indexes {
+			columns := make([]string, len(index.Columns))
+			for i, column := range index.Columns {
+				columns[i] = t + "." + quote(column)
+			}
+			match := fmt.Sprintf("MATCH(%s) AGAINST (? IN NATURAL LANGUAGE MODE)", strings.Join(columns, ","))
+			matches = append(matches, sq.Expr(match, text))
+			scores = append(scores, match)
+			scoreArgs = append(scoreArgs, text)
+		}
+	case "sqlite3":
+		query := ftsQuery(words)
+		for _, index := range indexes {
+			fts := quote(index.Name)
+			matches = append(matches, sq.Expr(
+				fmt.Sprintf("%s.rowid IN (SELECT rowid FROM %s WHERE %s MATCH ?)", t, fts, fts), query))
+			// bm25 is lower for better matches
+			scores = append(scores, fmt.Sprintf("-COALESCE((SELECT bm25(%s) FROM %s WHERE %s MATCH ? AND rowid = %s.rowid), 0)",
+				fts, fts, fts, t))
+			scoreArgs = append(scoreArgs, query)
+		}
+	default:
+		return q, fmt.Errorf("Full-text search isn't supported on %s", sqlType)
+	}
+	q = q.Where(matches)
+	if ordered {
+		q = q.Column(sq.Expr("("+strings.Join(scores, " + ")+") as "+quote(relevanceColumn), scoreArgs...)).
+			OrderBy(quote(relevanceColumn)+" desc", t+"."+quote("id"))
+	}
+	return q, nil
+}
+
+//ftsQuery makes FTS5 query matching any of the words
+func ftsQuery(words []string) string {
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + strings.Replace(word, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(terms, " OR ")
+}
+
+//searchTableDefs generates statements creating sqlite3 FTS5 table of a full-text index
+//and triggers keeping it in sync with the indexed table
+func searchTableDefs(s *schema.Schema, index schema.Index) []string {
+	t := quote(s.GetDbTableName())
+	fts := quote(index.Name)
+	columns := make([]string, len(index.Columns))
+	newValues := make([]string, len(index.Columns))
+	oldValues := make([]string, len(index.Columns))
+	for i, column := range index.Columns {
+		columns[i] = quote(column)
+		newValues[i] = "new." + quote(column)
+		oldValues[i] = "old." + quote(column)
+	}
+	cols := strings.Join(columns, ",")
+	insert := fmt.Sprintf("INSERT INTO %s(rowid,%s) VALUES (new.rowid,%s);", fts, cols, strings.Join(newValues, ","))
+	remove := fmt.Sprintf("INSERT INTO %s(%s,rowid,%s) VALUES ('delete',old.rowid,%s);", fts, fts, cols, strings.Join(oldValues, ","))
+	return []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content='%s');", fts, cols, s.GetDbTableName()),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN %s END;", quote(index.Name+"_insert"), t, insert),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN %s END;", quote(index.Name+"_delete"), t, remove),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN %s %s END;", quote(index.Name+"_update"), t, remove, insert),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild');", fts, fts),
+	}
+}
+
+//registerSearchTables creates missing sqlite3 FTS5 tables of full-text indexes
+func (db *DB) registerSearchTables(s *schema.Schema) error {
+	if db.sqlType != "sqlite3" {
+		return nil
+	}
+	for _, index := range s.FullTextIndexes() {
+		var count int
+		if err := db.DB.QueryRow("SELECT count(*) FROM sqlite_master WHERE name = ?", index.Name).Scan(&count); err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		for _, def := range searchTableDefs(s, index) {
+			if _, err := db.DB.Exec(def); err != nil {
+				return fmt.Errorf("Failed to create full-text search table %s: %s", index.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+//dropSearchTables drops sqlite3 FTS5 tables of full-text indexes
+func (db *DB) dropSearchTables(s *schema.Schema) error {
+	if db.sqlType != "sqlite3" {
+		return nil
+	}
+	for _, index := range s.FullTextIndexes() {
+		if _, err := db.DB.Exec(fmt.Sprintf("drop table if exists %s", quote(index.Name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
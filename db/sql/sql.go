@@ -17,8 +17,10 @@ package sql
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -27,6 +29,8 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 	sq "github.com/lann/squirrel"
+	// Import postgres lib
+	_ "github.com/lib/pq"
 	// Import go-sqlite3 lib
 	_ "github.com/mattn/go-sqlite3"
 	// Import go-fakedb lib
@@ -39,14 +43,21 @@ import (
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension/goext"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/tracing"
 	"github.com/cloudwan/gohan/util"
 )
 
 const retryDB = 50
 const retryDBWait = 10
 
+//postgresDataTypes maps column types generated for MySQL to their PostgreSQL counterparts
+var postgresDataTypes = map[string]string{
+	"real": "double precision",
+}
+
 const (
 	configVersionColumnName   = "config_version"
 	stateVersionColumnName    = "state_version"
@@ -63,6 +74,9 @@ type DB struct {
 
 	// options
 	options options.Options
+
+	replicas    []*replica
+	nextReplica uint32
 }
 
 //Transaction is sql implementation of Transaction
@@ -71,6 +85,9 @@ type Transaction struct {
 	db             *DB
 	closed         bool
 	isolationLevel transaction.Type
+	span           *tracing.Span
+	// log carries ID of the request the transaction was begun for
+	log l.Logger
 }
 
 func mapTxOptions(options *transaction.TxOptions) (*sql.TxOptions, error) {
@@ -92,6 +109,16 @@ func mapTxOptions(options *transaction.TxOptions) (*sql.TxOptions, error) {
 	return sqlOptions, nil
 }
 
+//replicaTxOptions returns options of a transaction served by a read replica.
+//Read only transactions falling back to the primary are started as usual, because
+//extensions such as pre_show_in_transaction handlers may write in them.
+func replicaTxOptions(sqlType string, sqlOptions *sql.TxOptions) *sql.TxOptions {
+	replicaOptions := *sqlOptions
+	// the mysql driver rejects read only transactions, so they are only routed to replicas there
+	replicaOptions.ReadOnly = sqlType != "mysql"
+	return &replicaOptions
+}
+
 //NewDB constructor
 func NewDB(options options.Options) *DB {
 	handlers := make(map[string]propertyHandler)
@@ -281,9 +308,14 @@ func (handler *jsonHandler) encode(property *schema.Property, data interface{})
 }
 
 func (handler *jsonHandler) decode(property *schema.Property, data interface{}) (interface{}, error) {
-	if bytes, ok := data.([]byte); ok {
+	switch t := data.(type) {
+	case []byte: // mysql, sqlite3
+		var ret interface{}
+		err := json.Unmarshal(t, &ret)
+		return ret, err
+	case string: // postgres
 		var ret interface{}
-		err := json.Unmarshal(bytes, &ret)
+		err := json.Unmarshal([]byte(t), &ret)
 		return ret, err
 	}
 	return data, nil
@@ -297,6 +329,14 @@ func quote(str string) string {
 	return fmt.Sprintf("`%s`", str)
 }
 
+//rebind converts query written with MySQL style quoting and placeholders to the dialect of the db
+func (db *DB) rebind(query string) string {
+	if db.sqlType != "postgres" {
+		return query
+	}
+	return db.DB.Rebind(strings.Replace(query, "`", `"`, -1))
+}
+
 func foreignKeyName(fromTable, fromProperty, toTable, toProperty string) string {
 	name := fmt.Sprintf("%s_%s_%s_%s", fromTable, fromProperty, toTable, toProperty)
 	if len(name) > 64 {
@@ -335,7 +375,7 @@ func (db *DB) Connect(sqlType, conn string, maxOpenConn int) (err error) {
 	for i := 0; i < retryDB; i++ {
 		err = db.DB.Ping()
 		if err == nil {
-			return nil
+			return db.connectReplicas(maxOpenConn)
 		}
 		time.Sleep(retryDBWait * time.Second)
 		log.Info("Retrying db connection... (%s)", err)
@@ -348,6 +388,7 @@ func (db *DB) Connect(sqlType, conn string, maxOpenConn int) (err error) {
 func (db *DB) Close() {
 	defer db.measureTime(time.Now(), "close")
 	db.DB.Close()
+	db.closeReplicas()
 }
 
 //Begin starts new transaction
@@ -371,6 +412,7 @@ func (db *DB) Begin() (tx transaction.Transaction, err error) {
 		transaction:    rawTx,
 		closed:         false,
 		isolationLevel: transaction.RepeatableRead,
+		log:            log,
 	}
 	if os.Getenv("FUZZY_DB_TX") == "true" {
 		log.Notice("FUZZY_DB_TX is enabled")
@@ -391,7 +433,17 @@ func (db *DB) BeginTx(ctx context.Context, options *transaction.TxOptions) (tx t
 		return nil, err
 	}
 
-	rawTx, err := db.DB.BeginTxx(ctx, sqlOptions)
+	txLog := l.WithRequestID(log, l.RequestIDFromContext(ctx))
+	var rawTx *sqlx.Tx
+	if options.ReadOnly {
+		var replica *replica
+		if rawTx, replica = db.beginOnReplica(ctx, replicaTxOptions(db.sqlType, sqlOptions)); rawTx != nil {
+			txLog.Debug("[%p] Transaction is served by read replica %d", rawTx, replica.index)
+		}
+	}
+	if rawTx == nil {
+		rawTx, err = db.DB.BeginTxx(ctx, sqlOptions)
+	}
 	if err != nil {
 		db.updateCounter(1, "begin.failed")
 		return nil, err
@@ -405,11 +457,30 @@ func (db *DB) BeginTx(ctx context.Context, options *transaction.TxOptions) (tx t
 		transaction:    rawTx,
 		closed:         false,
 		isolationLevel: options.IsolationLevel,
+		span:           tracing.SpanFromContext(ctx),
+		log:            txLog,
 	}
-	log.Debug("[%p] Created transaction %#v, isolation level %s", rawTx, rawTx, tx.GetIsolationLevel())
+	txLog.Debug("[%p] Created transaction %#v, isolation level %s", rawTx, rawTx, tx.GetIsolationLevel())
 	return
 }
 
+//postgresAutoIncrement maps an auto_increment column type to the PostgreSQL serial type of the same size
+func postgresAutoIncrement(sqlDataType string) string {
+	if !strings.Contains(sqlDataType, "auto_increment") {
+		return sqlDataType
+	}
+	fields := strings.Fields(strings.Replace(sqlDataType, "auto_increment", "", 1))
+	switch strings.ToLower(fields[0]) {
+	case "bigint":
+		fields[0] = "bigserial"
+	case "smallint":
+		fields[0] = "smallserial"
+	default:
+		fields[0] = "serial"
+	}
+	return strings.Join(fields, " ")
+}
+
 func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]string, []string, []string) {
 	var cols []string
 	var relations []string
@@ -422,11 +493,17 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 		handler := db.handlers[property.Type]
 		sqlDataType := property.SQLType
 		sqlDataProperties := ""
-		if db.sqlType == "sqlite3" {
+		switch db.sqlType {
+		case "sqlite3":
 			sqlDataType = strings.Replace(sqlDataType, "auto_increment", "autoincrement", 1)
+		case "postgres":
+			sqlDataType = postgresAutoIncrement(sqlDataType)
 		}
 		if sqlDataType == "" {
 			sqlDataType = handler.dataType(&property)
+			if postgresDataType, ok := postgresDataTypes[sqlDataType]; ok && db.sqlType == "postgres" {
+				sqlDataType = postgresDataType
+			}
 			if property.ID == "id" {
 				sqlDataProperties = " primary key"
 			}
@@ -468,7 +545,7 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 
 		if property.Indexed {
 			prefix := ""
-			if sqlDataType == "text" {
+			if sqlDataType == "text" && db.sqlType != "postgres" {
 				prefix = "(255)"
 			}
 			indices = append(indices, fmt.Sprintf("CREATE INDEX %s_%s_idx ON `%s`(`%s`%s);", s.Plural, property.ID,
@@ -482,8 +559,12 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 			quotedColumns[i] = quote(column)
 		}
 
-		if db.sqlType == "sqlite3" && (index.Type == schema.Spatial || index.Type == schema.FullText) {
-			log.Error("index %s won't be created since sqlite doesn't support spatial and fulltext index types", index.Name)
+		if db.sqlType == "sqlite3" && index.Type == schema.FullText {
+			indices = append(indices, searchTableDefs(s, index)...)
+			continue
+		}
+		if (db.sqlType == "sqlite3" || db.sqlType == "postgres") && (index.Type == schema.Spatial || index.Type == schema.FullText) {
+			log.Error("index %s won't be created since %s doesn't support spatial and fulltext index types", index.Name, db.sqlType)
 			continue
 		}
 
@@ -498,7 +579,7 @@ func (db *DB) genTableCols(s *schema.Schema, cascade bool, exclude []string) ([]
 //AlterTableDef generates alter table sql
 func (db *DB) AlterTableDef(s *schema.Schema, cascade bool) (string, []string, error) {
 	var existing []string
-	rows, err := db.DB.Query(fmt.Sprintf("select * from `%s` limit 1;", s.GetDbTableName()))
+	rows, err := db.DB.Query(db.rebind(fmt.Sprintf("select * from `%s` limit 1;", s.GetDbTableName())))
 	if err == nil {
 		defer rows.Close()
 		existing, err = rows.Columns()
@@ -509,12 +590,24 @@ func (db *DB) AlterTableDef(s *schema.Schema, cascade bool) (string, []string, e
 	}
 
 	cols, relations, indices := db.genTableCols(s, cascade, existing)
-	cols = append(cols, relations...)
 
-	if len(cols) == 0 {
+	if len(cols) == 0 && len(relations) == 0 {
 		return "", nil, nil
 	}
-	alterTable := fmt.Sprintf("alter table`%s` add (%s);\n", s.GetDbTableName(), strings.Join(cols, ","))
+	var alterTable string
+	if db.sqlType == "postgres" {
+		var clauses []string
+		for _, col := range cols {
+			clauses = append(clauses, "add column "+col)
+		}
+		for _, relation := range relations {
+			clauses = append(clauses, "add "+relation)
+		}
+		alterTable = fmt.Sprintf("alter table `%s` %s;\n", s.GetDbTableName(), strings.Join(clauses, ","))
+	} else {
+		cols = append(cols, relations...)
+		alterTable = fmt.Sprintf("alter table`%s` add (%s);\n", s.GetDbTableName(), strings.Join(cols, ","))
+	}
 	log.Debug("Altering table: " + alterTable)
 	log.Debug("Altering indices: " + strings.Join(indices, ""))
 	return alterTable, indices, nil
@@ -554,18 +647,21 @@ func (db *DB) RegisterTable(s *schema.Schema, cascade, migrate bool) error {
 		tableDef, indices = db.GenTableDef(s, cascade)
 	}
 	if tableDef == "" {
-		return nil
+		return db.registerSearchTables(s)
 	}
-	_, err = db.DB.Exec(tableDef)
+	_, err = db.DB.Exec(db.rebind(tableDef))
 	if err != nil && indices != nil {
 		for _, indexSQL := range indices {
-			_, err = db.DB.Exec(indexSQL)
+			_, err = db.DB.Exec(db.rebind(indexSQL))
 			if err != nil {
 				return err
 			}
 		}
 	}
-	return err
+	if err != nil {
+		return err
+	}
+	return db.registerSearchTables(s)
 }
 
 //DropTable drop table definition
@@ -573,8 +669,11 @@ func (db *DB) DropTable(s *schema.Schema) error {
 	if s.IsAbstract() {
 		return nil
 	}
+	if err := db.dropSearchTables(s); err != nil {
+		return err
+	}
 	sql := fmt.Sprintf("drop table if exists %s\n", quote(s.GetDbTableName()))
-	_, err := db.DB.Exec(sql)
+	_, err := db.DB.Exec(db.rebind(sql))
 	return err
 }
 
@@ -582,14 +681,42 @@ func escapeID(ID string) string {
 	return strings.Replace(ID, "-", "_escape_", -1)
 }
 
+//secretValue hides value of a secret property in logged queries
+type secretValue struct {
+	value interface{}
+}
+
+//Value implements driver.Valuer
+func (v secretValue) Value() (driver.Value, error) {
+	return driver.DefaultParameterConverter.ConvertValue(v.value)
+}
+
+func (v secretValue) String() string {
+	return schema.RedactedValue
+}
+
 func (tx *Transaction) logQuery(sql string, args ...interface{}) {
 	sqlFormat := strings.Replace(sql, "?", "%s", -1)
 	query := fmt.Sprintf(sqlFormat, args...)
-	log.Debug("[%p] Executing SQL query '%s'", tx.transaction, query)
+	tx.log.Debug("[%p] Executing SQL query '%s'", tx.transaction, query)
 }
 
 func (tx *Transaction) measureTime(timeStarted time.Time, schemaId, action string) {
 	metrics.UpdateTimer(timeStarted, "tx.%s.%s", schemaId, action)
+	tx.recordSpan(timeStarted, schemaId, action)
+}
+
+//recordSpan records finished operation as a child of the span the transaction was started in
+func (tx *Transaction) recordSpan(timeStarted time.Time, schemaID, action string) {
+	if tx.span == nil {
+		return
+	}
+	span := tracing.StartSpanAt(tx.span, "db "+action, tracing.SpanKindClient, timeStarted)
+	span.SetAttribute("db.system", tx.db.sqlType)
+	if schemaID != "" {
+		span.SetAttribute("gohan.schema", schemaID)
+	}
+	span.End()
 }
 
 func (tx *Transaction) Exec(sql string, args ...interface{}) error {
@@ -604,7 +731,7 @@ func (tx *Transaction) ExecContext(ctx context.Context, sql string, args ...inte
 
 func (tx *Transaction) exec(ctx context.Context, sql string, args ...interface{}) error {
 	tx.logQuery(sql, args...)
-	_, err := tx.transaction.ExecContext(ctx, sql, args...)
+	_, err := tx.transaction.ExecContext(ctx, tx.db.rebind(sql), args...)
 	return err
 }
 
@@ -631,6 +758,9 @@ func (tx *Transaction) CreateContext(ctx context.Context, resource *schema.Resou
 			if err != nil {
 				return fmt.Errorf("SQL Create encoding error: %s", err)
 			}
+			if attr.Secret {
+				encoded = secretValue{encoded}
+			}
 			values = append(values, encoded)
 		}
 	}
@@ -655,6 +785,9 @@ func (tx *Transaction) updateQuery(resource *schema.Resource) (sq.UpdateBuilder,
 			if err != nil {
 				return q, fmt.Errorf("SQL Update encoding error: %s", err)
 			}
+			if attr.Secret {
+				encoded = secretValue{encoded}
+			}
 			q = q.Set(quote(attr.ID), encoded)
 		}
 	}
@@ -817,24 +950,28 @@ func decodeState(data map[string]interface{}, state *transaction.ResourceState)
 	if !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateVersionColumnName)
 	}
-	stateError, ok := data[stateErrorColumnName].([]byte)
-	if !ok {
+	if state.Error, ok = decodeStateText(data[stateErrorColumnName]); !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateErrorColumnName)
 	}
-	state.Error = string(stateError)
-	stateState, ok := data[stateColumnName].([]byte)
-	if !ok {
+	if state.State, ok = decodeStateText(data[stateColumnName]); !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateColumnName)
 	}
-	state.State = string(stateState)
-	stateMonitoring, ok := data[stateMonitoringColumnName].([]byte)
-	if !ok {
+	if state.Monitoring, ok = decodeStateText(data[stateMonitoringColumnName]); !ok {
 		return fmt.Errorf("Wrong state column %s returned from query", stateMonitoringColumnName)
 	}
-	state.Monitoring = string(stateMonitoring)
 	return nil
 }
 
+func decodeStateText(value interface{}) (string, bool) {
+	switch t := value.(type) {
+	case []byte: // mysql, sqlite3
+		return string(t), true
+	case string: // postgres
+		return t, true
+	}
+	return "", false
+}
+
 //normFields runs normFields on all the fields.
 func normFields(fields []string, s *schema.Schema) []string {
 	if fields != nil {
@@ -854,6 +991,7 @@ func normField(field, schemaID string) string {
 }
 
 type selectContext struct {
+	sqlType   string
 	schema    *schema.Schema
 	filter    transaction.Filter
 	fields    []string
@@ -866,15 +1004,35 @@ func buildSelect(sc *selectContext) (string, []interface{}, error) {
 
 	cols := MakeColumns(sc.schema, t, sc.fields, sc.join)
 	q := sq.Select(cols...).From(quote(t))
-	q, err := addFilterToQuery(sc.schema, q, sc.filter, sc.join)
+	search, filter := transaction.SplitSearch(sc.filter)
+	q, err := addFilterToQuery(sc.schema, q, filter, sc.join)
 	if err != nil {
 		return "", nil, err
 	}
+	if search != "" {
+		//resources are ordered by relevance unless sort key is given
+		ordered := sc.paginator == nil || sc.paginator.Key == ""
+		if q, err = addSearchToQuery(sc.sqlType, sc.schema, q, search, ordered); err != nil {
+			return "", nil, err
+		}
+	}
 	if sc.paginator != nil {
+		idColumn := quote(t) + ".id"
 		if sc.paginator.Key != "" {
 			property, err := sc.schema.GetPropertyByID(sc.paginator.Key)
 			if err == nil {
-				q = q.OrderBy(makeColumn(t, *property) + " " + sc.paginator.Order)
+				column := makeColumn(t, *property)
+				q = q.OrderBy(column + " " + sc.paginator.Order + nullsOrder(sc.sqlType, sc.paginator.Order))
+				if property.ID != "id" {
+					//id is used as a tie-breaker so that the order is stable across pages
+					q = q.OrderBy(idColumn + " " + sc.paginator.Order)
+				}
+				if sc.paginator.Marker != "" {
+					q, err = addMarkerToQuery(q, property, column, idColumn, sc.paginator)
+					if err != nil {
+						return "", nil, err
+					}
+				}
 			}
 		}
 
@@ -891,9 +1049,52 @@ func buildSelect(sc *selectContext) (string, []interface{}, error) {
 	return q.ToSql()
 }
 
+//nullsOrder makes PostgreSQL order NULL values as the lowest ones like the other databases do,
+//which addMarkerToQuery relies on
+func nullsOrder(sqlType, order string) string {
+	if sqlType != "postgres" {
+		return ""
+	}
+	if order == pagination.DESC {
+		return " NULLS LAST"
+	}
+	return " NULLS FIRST"
+}
+
+//addMarkerToQuery restricts query to the resources following the paginator marker
+//in (sort key, id) order. NULL sort key values are ordered first.
+func addMarkerToQuery(q sq.SelectBuilder, property *schema.Property, column, idColumn string, pg *pagination.Paginator) (sq.SelectBuilder, error) {
+	marker, err := pagination.DecodeMarker(pg.Marker)
+	if err != nil {
+		return q, err
+	}
+	next := ">"
+	if pg.Order == pagination.DESC {
+		next = "<"
+	}
+	if property.ID == "id" {
+		return q.Where(sq.Expr(idColumn+" "+next+" ?", marker.ID)), nil
+	}
+	afterID := sq.Expr(idColumn+" "+next+" ?", marker.ID)
+	if marker.Value == nil {
+		if pg.Order == pagination.DESC {
+			return q.Where(sq.And{sq.Eq{column: nil}, afterID}), nil
+		}
+		return q.Where(sq.Or{sq.NotEq{column: nil}, sq.And{sq.Eq{column: nil}, afterID}}), nil
+	}
+	after := sq.Or{
+		sq.Expr(column+" "+next+" ?", marker.Value),
+		sq.And{sq.Eq{column: marker.Value}, afterID},
+	}
+	if pg.Order == pagination.DESC {
+		after = append(after, sq.Eq{column: nil})
+	}
+	return q.Where(after), nil
+}
+
 func (tx *Transaction) executeSelect(ctx context.Context, sc *selectContext, sql string, args []interface{}) (list []*schema.Resource, total uint64, err error) {
 	tx.logQuery(sql, args...)
-	rows, err := tx.transaction.QueryxContext(ctx, sql, args...)
+	rows, err := tx.transaction.QueryxContext(ctx, tx.db.rebind(sql), args...)
 	if err != nil {
 		return
 	}
@@ -914,8 +1115,10 @@ func (tx *Transaction) List(s *schema.Schema, filter transaction.Filter, options
 //List resources in the db
 func (tx *Transaction) ListContext(ctx context.Context, s *schema.Schema, filter transaction.Filter, options *transaction.ViewOptions, pg *pagination.Paginator) (list []*schema.Resource, total uint64, err error) {
 	defer tx.measureTime(time.Now(), s.ID, "list")
+	filter = transaction.NotDeleted(s, filter)
 
 	sc := &selectContext{
+		sqlType:   tx.db.sqlType,
 		schema:    s,
 		filter:    filter,
 		join:      true,
@@ -953,10 +1156,12 @@ func (tx *Transaction) LockList(s *schema.Schema, filter transaction.Filter, opt
 // LockList locks resources in the db
 func (tx *Transaction) LockListContext(ctx context.Context, s *schema.Schema, filter transaction.Filter, options *transaction.ViewOptions, pg *pagination.Paginator, lockPolicy schema.LockPolicy) (list []*schema.Resource, total uint64, err error) {
 	defer tx.measureTime(time.Now(), s.ID, "lock_list")
+	filter = transaction.NotDeleted(s, filter)
 
 	policyJoin := shouldJoin(lockPolicy)
 
 	sc := &selectContext{
+		sqlType:   tx.db.sqlType,
 		schema:    s,
 		filter:    filter,
 		join:      policyJoin,
@@ -972,8 +1177,12 @@ func (tx *Transaction) LockListContext(ctx context.Context, s *schema.Schema, fi
 		return nil, 0, err
 	}
 
-	if tx.db.sqlType == "mysql" {
+	switch tx.db.sqlType {
+	case "mysql":
 		sql += " FOR UPDATE"
+	case "postgres":
+		// rows of outer joined tables can't be locked in PostgreSQL
+		sql += " FOR UPDATE OF " + quote(s.GetDbTableName())
 	}
 
 	// update join for recursive
@@ -995,7 +1204,7 @@ func (tx *Transaction) QueryContext(ctx context.Context, s *schema.Schema, query
 	defer tx.measureTime(time.Now(), s.ID, "query")
 
 	tx.logQuery(query, arguments...)
-	rows, err := tx.transaction.QueryxContext(ctx, query, arguments...)
+	rows, err := tx.transaction.QueryxContext(ctx, tx.db.rebind(query), arguments...)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to run query: %s", query)
 	}
@@ -1037,7 +1246,7 @@ func (tx *Transaction) decode(s *schema.Schema, tableName string, skipNil, recur
 		if value != nil || (property.Nullable && !skipNil) {
 			decoded, err := handler.decode(&property, value)
 			if err != nil {
-				log.Error(fmt.Sprintf("SQL List decoding error: %s", err))
+				tx.log.Error(fmt.Sprintf("SQL List decoding error: %s", err))
 			}
 			resourceData[property.ID] = decoded
 		}
@@ -1059,14 +1268,20 @@ func (tx *Transaction) CountContext(ctx context.Context, s *schema.Schema, filte
 	defer tx.measureTime(time.Now(), s.ID, "count")
 
 	q := sq.Select("Count(id) as count").From(quote(s.GetDbTableName()))
+	search, filter := transaction.SplitSearch(filter)
 	//Filter get already tested
-	q, _ = addFilterToQuery(s, q, filter, false)
+	q, _ = addFilterToQuery(s, q, transaction.NotDeleted(s, filter), false)
+	if search != "" {
+		if q, err = addSearchToQuery(tx.db.sqlType, s, q, search, false); err != nil {
+			return
+		}
+	}
 	sql, args, err := q.ToSql()
 	if err != nil {
 		return
 	}
 	result := map[string]interface{}{}
-	err = tx.transaction.QueryRowxContext(ctx, sql, args...).MapScan(result)
+	err = tx.transaction.QueryRowxContext(ctx, tx.db.rebind(sql), args...).MapScan(result)
 	if err != nil {
 		return
 	}
@@ -1137,7 +1352,7 @@ func (tx *Transaction) StateFetchContext(ctx context.Context, s *schema.Schema,
 		return
 	}
 	tx.logQuery(sql, args...)
-	rows, err := tx.transaction.QueryxContext(ctx, sql, args...)
+	rows, err := tx.transaction.QueryxContext(ctx, tx.db.rebind(sql), args...)
 	if err != nil {
 		return
 	}
@@ -1160,12 +1375,13 @@ func (tx *Transaction) RawTransaction() *sqlx.Tx {
 //Commit commits transaction
 func (tx *Transaction) Commit() error {
 	defer tx.db.measureTime(time.Now(), "commit")
+	defer tx.recordSpan(time.Now(), "", "commit")
 	defer tx.db.updateCounter(-1, "active")
 
-	log.Debug("[%p] Committing transaction %#v", tx.transaction, tx)
+	tx.log.Debug("[%p] Committing transaction %#v", tx.transaction, tx)
 	err := tx.transaction.Commit()
 	if err != nil {
-		log.Error("[%p] Commit %#v failed: %s", tx.transaction, tx, err)
+		tx.log.Error("[%p] Commit %#v failed: %s", tx.transaction, tx, err)
 		tx.db.updateCounter(1, "commit.failed")
 		return err
 	}
@@ -1178,14 +1394,14 @@ func (tx *Transaction) Close() error {
 	defer tx.db.measureTime(time.Now(), "rollback")
 
 	//Rollback if it isn't committed yet
-	log.Debug("[%p] Closing transaction %#v", tx.transaction, tx)
+	tx.log.Debug("[%p] Closing transaction %#v", tx.transaction, tx)
 	var err error
 	if !tx.closed {
 		defer tx.db.updateCounter(-1, "active")
-		log.Debug("[%p] Rolling back %#v", tx.transaction, tx)
+		tx.log.Debug("[%p] Rolling back %#v", tx.transaction, tx)
 		err = tx.transaction.Rollback()
 		if err != nil {
-			log.Error("[%p] Rolling back %#v failed: %s", tx.transaction, tx, err)
+			tx.log.Error("[%p] Rolling back %#v failed: %s", tx.transaction, tx, err)
 			tx.db.updateCounter(1, "rollback.failed")
 			return err
 		}
@@ -1222,6 +1438,18 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 			column = quote(key)
 		}
 
+		switch value.(type) {
+		case transaction.Condition, transaction.Conditions, []transaction.Condition:
+			for _, condition := range transaction.ConditionsOf(value) {
+				expr, err := conditionToSQL(property, column, condition)
+				if err != nil {
+					return q, err
+				}
+				q = q.Where(expr)
+			}
+			continue
+		}
+
 		queryValues, ok := value.([]string)
 		if ok && property.Type == "boolean" {
 			v := make([]bool, len(queryValues))
@@ -1236,6 +1464,75 @@ func addFilterToQuery(s *schema.Schema, q sq.SelectBuilder, filter map[string]in
 	return q, nil
 }
 
+func conditionToSQL(property *schema.Property, column string, condition transaction.Condition) (sq.Sqlizer, error) {
+	if err := condition.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid filter on %s: %s", property.ID, err)
+	}
+	value := condition.Value
+	if property.Type == "boolean" {
+		value = parseBoolValues(value)
+	}
+	switch condition.Operator {
+	case transaction.Equal:
+		return sq.Eq{column: value}, nil
+	case transaction.NotEqual:
+		return sq.NotEq{column: value}, nil
+	case transaction.LessThan:
+		return sq.Expr(column+" < ?", value), nil
+	case transaction.LessThanOrEqual:
+		return sq.Expr(column+" <= ?", value), nil
+	case transaction.GreaterThan:
+		return sq.Expr(column+" > ?", value), nil
+	case transaction.GreaterThanOrEqual:
+		return sq.Expr(column+" >= ?", value), nil
+	case transaction.Like:
+		patterns := sq.Or{}
+		for _, pattern := range valueList(value) {
+			patterns = append(patterns, sq.Expr(column+" LIKE ?", pattern))
+		}
+		return patterns, nil
+	case transaction.NotLike:
+		patterns := sq.And{}
+		for _, pattern := range valueList(value) {
+			patterns = append(patterns, sq.Expr(column+" NOT LIKE ?", pattern))
+		}
+		return patterns, nil
+	case transaction.IsNull:
+		if value.(bool) {
+			return sq.Eq{column: nil}, nil
+		}
+		return sq.NotEq{column: nil}, nil
+	}
+	return nil, fmt.Errorf("Unsupported filter operator %s", condition.Operator)
+}
+
+func parseBoolValues(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		b, _ := strconv.ParseBool(v)
+		return b
+	case []string:
+		values := make([]bool, len(v))
+		for i, s := range v {
+			values[i], _ = strconv.ParseBool(s)
+		}
+		return values
+	}
+	return value
+}
+
+func valueList(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice {
+		return []interface{}{value}
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
 //SetMaxOpenConns limit maximum connections
 func (db *DB) SetMaxOpenConns(maxIdleConns int) {
 	// db.DB.SetMaxOpenConns(maxIdleConns)
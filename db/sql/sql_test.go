@@ -16,6 +16,7 @@
 package sql_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -99,6 +100,141 @@ var _ = Describe("Sql", func() {
 			Expect(len(results)).To(Equal(1))
 		})
 
+		listPages := func(key, order string, limit uint64) [][]string {
+			pg, err := pagination.NewPaginator(s, key, order, limit, 0)
+			Expect(err).ToNot(HaveOccurred())
+			pages := [][]string{}
+			for {
+				results, total, err := tx.List(s, nil, nil, pg)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(total).To(Equal(uint64(4)))
+				page := []string{}
+				for _, r := range results {
+					page = append(page, r.ID())
+				}
+				pages = append(pages, page)
+				pg.Marker, err = pg.NextMarker(results)
+				Expect(err).ToNot(HaveOccurred())
+				if pg.Marker == "" {
+					return pages
+				}
+			}
+		}
+
+		It("Pages with marker ordered by id", func() {
+			Expect(listPages("id", pagination.ASC, 3)).To(Equal([][]string{{"0", "1", "2"}, {"3"}}))
+			Expect(listPages("id", pagination.DESC, 2)).To(Equal([][]string{{"3", "2"}, {"1", "0"}, {}}))
+		})
+
+		It("Pages with marker using id as a tie-breaker", func() {
+			Expect(listPages("tenant_id", pagination.ASC, 1)).To(Equal([][]string{{"0"}, {"1"}, {"2"}, {"3"}, {}}))
+			Expect(listPages("tenant_id", pagination.DESC, 3)).To(Equal([][]string{{"3", "2", "1"}, {"0"}}))
+		})
+
+		It("Pages with marker on numeric key", func() {
+			Expect(listPages("test_integer", pagination.DESC, 3)).To(Equal([][]string{{"3", "2", "0"}, {"1"}}))
+			Expect(listPages("test_number", pagination.ASC, 2)).To(Equal([][]string{{"3", "1"}, {"0", "2"}, {}}))
+		})
+
+		It("Pages with marker including null sort key values", func() {
+			Expect(tx.Exec("INSERT INTO `tests` (`id`, `tenant_id`) values ('4', 'tenant1')")).To(Succeed())
+			Expect(tx.Exec("INSERT INTO `tests` (`id`, `tenant_id`) values ('5', 'tenant1')")).To(Succeed())
+			pg, err := pagination.NewPaginator(s, "test_string", pagination.ASC, 1, 0)
+			Expect(err).ToNot(HaveOccurred())
+			ids := []string{}
+			for {
+				results, _, err := tx.List(s, nil, nil, pg)
+				Expect(err).ToNot(HaveOccurred())
+				if len(results) == 0 {
+					break
+				}
+				ids = append(ids, results[0].ID())
+				pg.Marker, err = pg.NextMarker(results)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(ids).To(Equal([]string{"4", "5", "0", "1", "2", "3"}))
+		})
+
+		It("Rejects invalid marker", func() {
+			pg, err := pagination.NewPaginator(s, "id", pagination.ASC, 1, 0)
+			Expect(err).ToNot(HaveOccurred())
+			pg.Marker = "invalid"
+			_, _, err = tx.List(s, nil, nil, pg)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("Filter conditions", func() {
+		var s *schema.Schema
+
+		BeforeEach(func() {
+			manager := schema.GetManager()
+			var ok bool
+			s, ok = manager.Schema("test")
+			Expect(ok).To(BeTrue())
+		})
+
+		listIDs := func(filter transaction.Filter) []string {
+			results, total, err := tx.List(s, filter, nil, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(uint64(len(results))))
+			ids := []string{}
+			for _, r := range results {
+				ids = append(ids, r.ID())
+			}
+			return ids
+		}
+
+		It("Filters with range operators", func() {
+			Expect(listIDs(transaction.Filter{
+				"test_integer": transaction.Condition{Operator: transaction.GreaterThan, Value: 0},
+			})).To(ConsistOf("2", "3"))
+			Expect(listIDs(transaction.Filter{
+				"test_integer": transaction.Conditions{
+					{Operator: transaction.GreaterThanOrEqual, Value: 0},
+					{Operator: transaction.LessThan, Value: 3},
+				},
+			})).To(ConsistOf("0", "2"))
+			Expect(listIDs(transaction.Filter{
+				"test_number": transaction.Condition{Operator: transaction.LessThanOrEqual, Value: -0.1},
+			})).To(ConsistOf("1", "3"))
+		})
+
+		It("Filters with not equal operator", func() {
+			Expect(listIDs(transaction.Filter{
+				"tenant_id": transaction.Condition{Operator: transaction.NotEqual, Value: "tenant0"},
+			})).To(ConsistOf("2", "3"))
+			Expect(listIDs(transaction.Filter{
+				"test_string": transaction.Condition{Operator: transaction.NotEqual, Value: []string{"obj0", "obj1"}},
+			})).To(ConsistOf("2", "3"))
+		})
+
+		It("Filters with like operators", func() {
+			Expect(tx.Exec("UPDATE `tests` SET `test_string` = 'web1' WHERE `id` = '3'")).To(Succeed())
+			Expect(listIDs(transaction.Filter{
+				"test_string": transaction.Condition{Operator: transaction.Like, Value: "web%"},
+			})).To(ConsistOf("3"))
+			Expect(listIDs(transaction.Filter{
+				"test_string": transaction.Condition{Operator: transaction.NotLike, Value: []string{"web%", "%0"}},
+			})).To(ConsistOf("1", "2"))
+		})
+
+		It("Filters with null checks", func() {
+			Expect(tx.Exec("INSERT INTO `tests` (`id`, `tenant_id`) values ('id_null', 'tenant2')")).To(Succeed())
+			Expect(listIDs(transaction.Filter{
+				"test_string": transaction.Condition{Operator: transaction.IsNull, Value: true},
+			})).To(ConsistOf("id_null"))
+			Expect(listIDs(transaction.Filter{
+				"test_string": transaction.Condition{Operator: transaction.IsNull, Value: false},
+			})).To(ConsistOf("0", "1", "2", "3"))
+		})
+
+		It("Rejects invalid conditions", func() {
+			_, _, err := tx.List(s, transaction.Filter{
+				"test_integer": transaction.Condition{Operator: transaction.GreaterThan, Value: []int{1, 2}},
+			}, nil, nil)
+			Expect(err).To(HaveOccurred())
+		})
 	})
 
 	Describe("MakeColumns", func() {
@@ -353,6 +489,69 @@ var _ = Describe("Sql", func() {
 			})
 		})
 	})
+	Describe("Read replicas", func() {
+		const replicaConn = "./test_replica.db"
+
+		var s *schema.Schema
+
+		BeforeEach(func() {
+			if os.Getenv("MYSQL_TEST") == "true" {
+				Skip("Replicas are tested with sqlite3 files")
+			}
+			var ok bool
+			s, ok = schema.GetManager().Schema("test")
+			Expect(ok).To(BeTrue())
+			db.InitDBWithSchemas("sqlite3", replicaConn, db.DefaultTestInitDBParams())
+			replica, err := db.ConnectDB("sqlite3", replicaConn, db.DefaultMaxOpenConn, options.Default())
+			Expect(err).ToNot(HaveOccurred())
+			defer replica.Close()
+			Expect(db.Within(replica, func(tx transaction.Transaction) error {
+				Expect(tx.Exec("INSERT INTO `tests` (`id`, `tenant_id`) values ('replica', 'tenant0')")).To(Succeed())
+				return tx.Commit()
+			})).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.Remove(replicaConn)
+		})
+
+		listIDs := func(dataStore db.DB, options *transaction.TxOptions) []string {
+			ids := []string{}
+			Expect(db.WithinTx(context.Background(), dataStore, options, func(tx transaction.Transaction) error {
+				resources, _, err := tx.List(s, nil, nil, nil)
+				Expect(err).ToNot(HaveOccurred())
+				for _, resource := range resources {
+					ids = append(ids, resource.ID())
+				}
+				return tx.Commit()
+			})).To(Succeed())
+			return ids
+		}
+
+		connectWithReplicas := func(replicas ...string) db.DB {
+			opts := options.Default()
+			opts.Replicas = replicas
+			dataStore, err := db.ConnectDB("sqlite3", conn, db.DefaultMaxOpenConn, opts)
+			Expect(err).ToNot(HaveOccurred())
+			return dataStore
+		}
+
+		It("Serves only read only transactions from replica", func() {
+			dataStore := connectWithReplicas(replicaConn)
+			defer dataStore.Close()
+
+			Expect(listIDs(dataStore, &transaction.TxOptions{IsolationLevel: transaction.RepeatableRead, ReadOnly: true})).To(
+				Equal([]string{"replica"}))
+			Expect(listIDs(dataStore, &transaction.TxOptions{IsolationLevel: transaction.RepeatableRead})).To(HaveLen(4))
+		})
+
+		It("Falls back to primary when replica is unavailable", func() {
+			dataStore := connectWithReplicas("/nonexistent/replica.db")
+			defer dataStore.Close()
+
+			Expect(listIDs(dataStore, &transaction.TxOptions{IsolationLevel: transaction.RepeatableRead, ReadOnly: true})).To(HaveLen(4))
+		})
+	})
 })
 
 func readFixtures(path string, v interface{}) {
@@ -0,0 +1,108 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transaction
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//AggregateFunction represents a function computed over a group of resources
+type AggregateFunction string
+
+const (
+	//AggregateCount counts resources, or resources with non null property value when property is given
+	AggregateCount AggregateFunction = "count"
+	//AggregateSum sums property values
+	AggregateSum AggregateFunction = "sum"
+	//AggregateMin returns the lowest property value
+	AggregateMin AggregateFunction = "min"
+	//AggregateMax returns the highest property value
+	AggregateMax AggregateFunction = "max"
+	//AggregateAvg returns the average of property values
+	AggregateAvg AggregateFunction = "avg"
+)
+
+var aggregateFunctions = []AggregateFunction{
+	AggregateCount, AggregateSum, AggregateMin, AggregateMax, AggregateAvg,
+}
+
+//Aggregation is an aggregate function applied to a property
+type Aggregation struct {
+	Function AggregateFunction
+	Property string
+}
+
+//Key returns the key the aggregation result is stored with, e.g. count or sum_size
+func (a Aggregation) Key() string {
+	if a.Property == "" {
+		return string(a.Function)
+	}
+	return string(a.Function) + "_" + a.Property
+}
+
+//ParseAggregation parses aggregation from its key, e.g. count or sum_size
+func ParseAggregation(key string) (Aggregation, error) {
+	parts := strings.SplitN(key, "_", 2)
+	for _, function := range aggregateFunctions {
+		if string(function) != parts[0] {
+			continue
+		}
+		aggregation := Aggregation{Function: function}
+		if len(parts) == 2 {
+			aggregation.Property = parts[1]
+		}
+		if aggregation.Property == "" && function != AggregateCount {
+			return aggregation, fmt.Errorf("Aggregate function %s requires a property", function)
+		}
+		return aggregation, nil
+	}
+	return Aggregation{}, fmt.Errorf("Unknown aggregate function %s", parts[0])
+}
+
+//ValidateAggregation checks that grouped and aggregated properties exist in the schema
+//and that only numeric properties are summed or averaged
+func ValidateAggregation(s *schema.Schema, groupBy []string, aggregations []Aggregation) error {
+	for _, id := range groupBy {
+		if _, err := s.GetPropertyByID(id); err != nil {
+			return fmt.Errorf("Can't group by %s: %s", id, err)
+		}
+	}
+	for _, aggregation := range aggregations {
+		if aggregation.Property == "" {
+			if aggregation.Function != AggregateCount {
+				return fmt.Errorf("Aggregate function %s requires a property", aggregation.Function)
+			}
+			continue
+		}
+		property, err := s.GetPropertyByID(aggregation.Property)
+		if err != nil {
+			return fmt.Errorf("Can't aggregate %s: %s", aggregation.Key(), err)
+		}
+		switch aggregation.Function {
+		case AggregateSum, AggregateAvg:
+			if property.Type != "integer" && property.Type != "number" {
+				return fmt.Errorf("Can't aggregate %s: property %s isn't numeric", aggregation.Key(), property.ID)
+			}
+		case AggregateCount, AggregateMin, AggregateMax:
+		default:
+			return fmt.Errorf("Unknown aggregate function %s", aggregation.Function)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transaction
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//VersionETag returns entity tag of a resource with given config version
+func VersionETag(configVersion int64) string {
+	return fmt.Sprintf(`"v%d"`, configVersion)
+}
+
+//ContentETag returns entity tag of a resource computed from its property values.
+//Data of related resources is not taken into account. Values of secret properties
+//are hashed on their own first, so that changing them changes the tag as well.
+func ContentETag(s *schema.Schema, data map[string]interface{}) string {
+	hash := sha1.New()
+	encoder := json.NewEncoder(hash)
+	for _, property := range s.Properties {
+		hash.Write([]byte(property.ID))
+		if property.Secret {
+			encoder.Encode(secretDigest(data[property.ID]))
+			continue
+		}
+		encoder.Encode(data[property.ID])
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil))
+}
+
+//secretDigest returns SHA-256 digest of the secret value
+func secretDigest(value interface{}) string {
+	hash := sha256.New()
+	json.NewEncoder(hash).Encode(value)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+//ResourceETag returns entity tag of the stored resource.
+//Config version is used for schemas with state versioning, property values otherwise.
+func ResourceETag(ctx context.Context, tx Transaction, s *schema.Schema, resource *schema.Resource) (string, error) {
+	if s.StateVersioning() {
+		state, err := tx.StateFetchContext(ctx, s, IDFilter(resource.ID()))
+		if err != nil {
+			return "", err
+		}
+		return VersionETag(state.ConfigVersion), nil
+	}
+	return ContentETag(s, resource.Data()), nil
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transaction
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/cloudwan/gohan/schema"
+)
+
+//Operator represents a comparison operator used in filter conditions
+type Operator string
+
+const (
+	//Equal matches values equal to the condition value (or any of them, for lists)
+	Equal Operator = "eq"
+	//NotEqual matches values different from the condition value (or all of them, for lists)
+	NotEqual Operator = "ne"
+	//LessThan matches values lower than the condition value
+	LessThan Operator = "lt"
+	//LessThanOrEqual matches values lower than or equal to the condition value
+	LessThanOrEqual Operator = "lte"
+	//GreaterThan matches values greater than the condition value
+	GreaterThan Operator = "gt"
+	//GreaterThanOrEqual matches values greater than or equal to the condition value
+	GreaterThanOrEqual Operator = "gte"
+	//Like matches values against a SQL LIKE pattern (or any of them, for lists)
+	Like Operator = "like"
+	//NotLike matches values not matching a SQL LIKE pattern (nor any of them, for lists)
+	NotLike Operator = "not_like"
+	//IsNull matches null values when the condition value is true
+	//and non null values when it is false
+	IsNull Operator = "is_null"
+)
+
+var operators = []Operator{
+	Equal, NotEqual,
+	LessThan, LessThanOrEqual, GreaterThan, GreaterThanOrEqual,
+	Like, NotLike,
+	IsNull,
+}
+
+//ParseOperator returns the operator with the given name
+func ParseOperator(name string) (Operator, error) {
+	for _, operator := range operators {
+		if string(operator) == name {
+			return operator, nil
+		}
+	}
+	return "", fmt.Errorf("Unknown filter operator %s", name)
+}
+
+//Condition is a single operator condition on a property.
+//It can be used as a Filter value.
+type Condition struct {
+	Operator Operator
+	Value    interface{}
+}
+
+//Conditions is a list of conditions on a single property, all of which have to be met.
+//It can be used as a Filter value.
+type Conditions []Condition
+
+//IsList returns whether the condition value is a list of values
+func (c Condition) IsList() bool {
+	if c.Value == nil {
+		return false
+	}
+	kind := reflect.TypeOf(c.Value).Kind()
+	return kind == reflect.Slice || kind == reflect.Array
+}
+
+//Validate checks whether the value is acceptable for the operator
+func (c Condition) Validate() error {
+	if _, err := ParseOperator(string(c.Operator)); err != nil {
+		return err
+	}
+	if c.IsList() && reflect.ValueOf(c.Value).Len() == 0 {
+		return fmt.Errorf("Operator %s requires at least one value", c.Operator)
+	}
+	switch c.Operator {
+	case LessThan, LessThanOrEqual, GreaterThan, GreaterThanOrEqual:
+		if c.Value == nil || c.IsList() {
+			return fmt.Errorf("Operator %s requires a single value", c.Operator)
+		}
+	case IsNull:
+		if _, ok := c.Value.(bool); !ok {
+			return fmt.Errorf("Operator %s requires a boolean value", c.Operator)
+		}
+	}
+	return nil
+}
+
+//ConditionsOf returns filter value as a list of conditions.
+//Plain values are converted to a single Equal condition.
+func ConditionsOf(value interface{}) Conditions {
+	switch v := value.(type) {
+	case Condition:
+		return Conditions{v}
+	case Conditions:
+		return v
+	case []Condition:
+		return Conditions(v)
+	}
+	return Conditions{{Operator: Equal, Value: value}}
+}
+
+//SearchKey is the filter key of a full-text search text.
+//Resources having any word of the text in a property covered by a full-text index match it.
+const SearchKey = "_search"
+
+//SplitSearch returns full-text search text of the filter and the filter without it
+func SplitSearch(filter Filter) (string, Filter) {
+	text, ok := filter[SearchKey].(string)
+	if !ok {
+		return "", filter
+	}
+	result := Filter{}
+	for key, value := range filter {
+		if key != SearchKey {
+			result[key] = value
+		}
+	}
+	return text, result
+}
+
+//SearchWords returns words of a full-text search text
+func SearchWords(text string) []string {
+	return strings.Fields(text)
+}
+
+//NotDeleted returns filter which also excludes soft deleted resources of the schema.
+//Filter having its own condition on the deletion time is returned as is.
+func NotDeleted(s *schema.Schema, filter Filter) Filter {
+	if !s.SoftDelete() {
+		return filter
+	}
+	if _, ok := filter[schema.DeletedAtPropertyID]; ok {
+		return filter
+	}
+	result := Filter{schema.DeletedAtPropertyID: Condition{Operator: IsNull, Value: true}}
+	for key, value := range filter {
+		result[key] = value
+	}
+	return result
+}
+
+//OnlyDeleted returns copy of filter matching only soft deleted resources
+func OnlyDeleted(filter Filter) Filter {
+	result := Filter{schema.DeletedAtPropertyID: Condition{Operator: IsNull, Value: false}}
+	for key, value := range filter {
+		result[key] = value
+	}
+	return result
+}
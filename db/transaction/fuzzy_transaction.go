@@ -162,6 +162,15 @@ func (ft *FuzzyTransaction) CountContext(ctx context.Context, s *schema.Schema,
 	})
 }
 
+func (ft *FuzzyTransaction) Aggregate(ctx context.Context, s *schema.Schema, filter Filter, groupBy []string, aggregations []Aggregation) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	return result, ft.fuzzIt(func() error {
+		var err error
+		result, err = ft.Tx.Aggregate(ctx, s, filter, groupBy, aggregations)
+		return err
+	})
+}
+
 func (ft *FuzzyTransaction) FetchContext(_ context.Context, s *schema.Schema, filter Filter, options *ViewOptions) (*schema.Resource, error) {
 	return ft.Fetch(s, filter, options)
 }
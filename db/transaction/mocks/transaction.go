@@ -371,6 +371,19 @@ func (mr *MockTransactionMockRecorder) CountContext(arg0, arg1, arg2 interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountContext", reflect.TypeOf((*MockTransaction)(nil).CountContext), arg0, arg1, arg2)
 }
 
+// Aggregate mocks base method
+func (m *MockTransaction) Aggregate(arg0 context.Context, arg1 *schema.Schema, arg2 transaction.Filter, arg3 []string, arg4 []transaction.Aggregation) ([]map[string]interface{}, error) {
+	ret := m.ctrl.Call(m, "Aggregate", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]map[string]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Aggregate indicates an expected call of Aggregate
+func (mr *MockTransactionMockRecorder) Aggregate(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockTransaction)(nil).Aggregate), arg0, arg1, arg2, arg3, arg4)
+}
+
 // QueryContext mocks base method
 func (m *MockTransaction) QueryContext(arg0 context.Context, arg1 *schema.Schema, arg2 string, arg3 []interface{}) ([]*schema.Resource, error) {
 	ret := m.ctrl.Call(m, "QueryContext", arg0, arg1, arg2, arg3)
@@ -48,6 +48,8 @@ const (
 // TxOptions represents transaction options
 type TxOptions struct {
 	IsolationLevel Type
+	// ReadOnly transactions may be served by a read replica
+	ReadOnly bool
 }
 
 //Filter represents db filter
@@ -100,6 +102,7 @@ type Transaction interface {
 	ListContext(context.Context, *schema.Schema, Filter, *ViewOptions, *pagination.Paginator) ([]*schema.Resource, uint64, error)
 	LockListContext(context.Context, *schema.Schema, Filter, *ViewOptions, *pagination.Paginator, schema.LockPolicy) ([]*schema.Resource, uint64, error)
 	CountContext(context.Context, *schema.Schema, Filter) (uint64, error)
+	Aggregate(ctx context.Context, s *schema.Schema, filter Filter, groupBy []string, aggregations []Aggregation) ([]map[string]interface{}, error)
 	QueryContext(context.Context, *schema.Schema, string, []interface{}) (list []*schema.Resource, err error)
 	ExecContext(ctx context.Context, query string, args ...interface{}) error
 }
@@ -119,6 +122,14 @@ func GetIsolationLevel(s *schema.Schema, action string) Type {
 	return Type(levelStr)
 }
 
+// GetTxOptions returns transaction options for an action; read transactions are read only
+func GetTxOptions(s *schema.Schema, action string) *TxOptions {
+	return &TxOptions{
+		IsolationLevel: GetIsolationLevel(s, action),
+		ReadOnly:       action == "read",
+	}
+}
+
 //IDFilter create filter for specific ID
 func IDFilter(ID interface{}) Filter {
 	return Filter{"id": ID}
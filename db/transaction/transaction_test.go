@@ -51,4 +51,119 @@ var _ = Describe("Transaction", func() {
 			Expect(tx.GetIsolationLevel(netSchema, "update")).To(Equal(tx.Serializable))
 		})
 	})
+
+	Describe("Filter conditions", func() {
+		It("Parses known operators", func() {
+			operator, err := tx.ParseOperator("gte")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(operator).To(Equal(tx.GreaterThanOrEqual))
+
+			_, err = tx.ParseOperator("unknown")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Validates condition values", func() {
+			Expect(tx.Condition{Operator: tx.Like, Value: []string{"a%", "b%"}}.Validate()).To(Succeed())
+			Expect(tx.Condition{Operator: tx.Equal, Value: []string{}}.Validate()).ToNot(Succeed())
+			Expect(tx.Condition{Operator: tx.LessThan, Value: []string{"1", "2"}}.Validate()).ToNot(Succeed())
+			Expect(tx.Condition{Operator: tx.IsNull, Value: "yes"}.Validate()).ToNot(Succeed())
+		})
+
+		It("Converts plain values to equality conditions", func() {
+			Expect(tx.ConditionsOf("value")).To(Equal(tx.Conditions{{Operator: tx.Equal, Value: "value"}}))
+			condition := tx.Condition{Operator: tx.NotEqual, Value: "value"}
+			Expect(tx.ConditionsOf(condition)).To(Equal(tx.Conditions{condition}))
+		})
+
+		It("Excludes soft deleted resources unless asked for them", func() {
+			folderSchema := schema.NewSchema("folder", "folders", "Folder", "Folder", "folder")
+			filter := tx.Filter{"id": "folder1"}
+			Expect(tx.NotDeleted(folderSchema, filter)).To(Equal(filter))
+
+			folderSchema.Metadata = map[string]interface{}{"soft_delete": true}
+			Expect(tx.NotDeleted(folderSchema, filter)).To(Equal(tx.Filter{
+				"id":                       "folder1",
+				schema.DeletedAtPropertyID: tx.Condition{Operator: tx.IsNull, Value: true},
+			}))
+			deleted := tx.OnlyDeleted(filter)
+			Expect(deleted).To(HaveKeyWithValue(schema.DeletedAtPropertyID, tx.Condition{Operator: tx.IsNull, Value: false}))
+			Expect(tx.NotDeleted(folderSchema, deleted)).To(Equal(deleted))
+			Expect(filter).To(HaveLen(1))
+		})
+	})
+
+	Describe("Aggregations", func() {
+		BeforeEach(func() {
+			var exists bool
+			manager := schema.GetManager()
+			Expect(manager.LoadSchemaFromFile("../../tests/test_abstract_schema.yaml")).To(Succeed())
+			Expect(manager.LoadSchemaFromFile("../../tests/test_schema.yaml")).To(Succeed())
+			netSchema, exists = manager.Schema("network")
+			Expect(exists).To(BeTrue())
+		})
+
+		It("Parses aggregation keys", func() {
+			aggregation, err := tx.ParseAggregation("max_shared")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aggregation).To(Equal(tx.Aggregation{Function: tx.AggregateMax, Property: "shared"}))
+			Expect(aggregation.Key()).To(Equal("max_shared"))
+
+			aggregation, err = tx.ParseAggregation("count")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(aggregation.Key()).To(Equal("count"))
+
+			_, err = tx.ParseAggregation("sum")
+			Expect(err).To(HaveOccurred())
+			_, err = tx.ParseAggregation("median_name")
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Validates aggregated properties", func() {
+			Expect(tx.ValidateAggregation(netSchema, []string{"tenant_id"},
+				[]tx.Aggregation{{Function: tx.AggregateCount}, {Function: tx.AggregateMin, Property: "name"}})).To(Succeed())
+			Expect(tx.ValidateAggregation(netSchema, []string{"unknown"}, nil)).ToNot(Succeed())
+			Expect(tx.ValidateAggregation(netSchema, nil,
+				[]tx.Aggregation{{Function: tx.AggregateSum, Property: "name"}})).ToNot(Succeed())
+		})
+	})
+
+	Describe("Entity tags", func() {
+		BeforeEach(func() {
+			var exists bool
+			manager := schema.GetManager()
+			Expect(manager.LoadSchemaFromFile("../../tests/test_abstract_schema.yaml")).To(Succeed())
+			Expect(manager.LoadSchemaFromFile("../../tests/test_schema.yaml")).To(Succeed())
+			netSchema, exists = manager.Schema("network")
+			Expect(exists).To(BeTrue())
+		})
+
+		It("Depends on property values only", func() {
+			data := map[string]interface{}{"id": "net1", "name": "red", "route_targets": []interface{}{"a"}}
+			etag := tx.ContentETag(netSchema, data)
+			Expect(etag).To(HavePrefix(`"`))
+			Expect(etag).To(HaveSuffix(`"`))
+			Expect(tx.ContentETag(netSchema, map[string]interface{}{
+				"id": "net1", "name": "red", "route_targets": []interface{}{"a"}, "related": map[string]interface{}{"id": "x"},
+			})).To(Equal(etag))
+
+			data["name"] = "blue"
+			Expect(tx.ContentETag(netSchema, data)).ToNot(Equal(etag))
+		})
+
+		It("Depends on secret property values", func() {
+			s := schema.NewSchema("secret_test", "secret_tests", "Secret test", "", "secret_test")
+			secret := schema.NewProperty("password", "", "", "string", "", "", "", "", "", false, false, false, nil, nil, false)
+			secret.Secret = true
+			s.Properties = append(s.Properties,
+				schema.NewProperty("id", "", "", "string", "", "", "", "", "", false, false, false, nil, nil, false),
+				secret)
+			etag := tx.ContentETag(s, map[string]interface{}{"id": "a", "password": "secret"})
+			Expect(tx.ContentETag(s, map[string]interface{}{"id": "a", "password": "secret"})).To(Equal(etag))
+			Expect(tx.ContentETag(s, map[string]interface{}{"id": "a", "password": "other"})).ToNot(Equal(etag))
+		})
+
+		It("Uses config version", func() {
+			Expect(tx.VersionETag(3)).To(Equal(`"v3"`))
+		})
+	})
 })
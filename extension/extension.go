@@ -23,6 +23,7 @@ import (
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/singleton"
+	"github.com/cloudwan/gohan/tracing"
 )
 
 //Environment is a interface for extension environment
@@ -52,6 +53,24 @@ func (manager *Manager) RegisterEnvironment(schemaID string, env Environment) er
 	return nil
 }
 
+//ReplaceEnvironments atomically replaces environments registered for the given schema IDs.
+//Swap, unless nil, is called with the manager locked, so that what the environments were built from
+//is replaced together with them; environments are left untouched when it fails.
+func (manager *Manager) ReplaceEnvironments(envs map[string]Environment, swap func() error) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if swap != nil {
+		if err := swap(); err != nil {
+			return err
+		}
+	}
+	for schemaID, env := range envs {
+		manager.environments[schemaID] = env
+	}
+	return nil
+}
+
 //UnRegisterEnvironment removes an environment registered for the given schema ID
 func (manager *Manager) UnRegisterEnvironment(schemaID string) error {
 	manager.mu.Lock()
@@ -115,7 +134,23 @@ func measureExtensionTime(timeStarted time.Time, event string, schemaID string)
 //HandleEvent handles the event in the given environment
 func HandleEvent(context map[string]interface{}, environment Environment, event string, schemaID string) error {
 	defer measureExtensionTime(time.Now(), event, schemaID)
+	parent := tracing.SpanFromMap(context)
+	span := tracing.StartSpan(parent, "extension "+event, tracing.SpanKindInternal)
+	if span != nil {
+		span.SetAttribute("gohan.schema", schemaID)
+		span.SetAttribute("gohan.event", event)
+		context[tracing.SpanKey] = span
+		defer func() {
+			span.End()
+			if parent != nil {
+				context[tracing.SpanKey] = parent
+			} else {
+				delete(context, tracing.SpanKey)
+			}
+		}()
+	}
 	if err := environment.HandleEvent(event, context); err != nil {
+		span.SetError(err)
 		return err
 	}
 	exceptionInfoRaw, ok := context["exception"]
@@ -20,4 +20,10 @@ type IAuth interface {
 	HasRole(context Context, role string) bool
 	GetTenantName(context Context) string
 	IsAdmin(context Context) bool
+	// RevokeToken rejects the token on all Gohan nodes
+	RevokeToken(token string) error
+	// RevokeTenantTokens rejects tokens of the tenant issued before on all Gohan nodes
+	RevokeTenantTokens(tenantID string) error
+	// RevokeUserTokens rejects tokens of the user issued before on all Gohan nodes
+	RevokeUserTokens(userID string) error
 }
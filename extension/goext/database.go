@@ -52,6 +52,8 @@ func IsDeadlock(err error) bool {
 	knownDatabaseErrorMessages := []string{
 		"Deadlock found when trying to get lock; try restarting transaction", /* MySQL / MariaDB */
 		"database is locked",                                                 /* SQLite */
+		"deadlock detected",                                                  /* PostgreSQL */
+		"could not serialize access",                                         /* PostgreSQL */
 	}
 
 	for _, msg := range knownDatabaseErrorMessages {
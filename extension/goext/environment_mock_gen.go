@@ -455,6 +455,19 @@ func (m *MockITransaction) EXPECT() *MockITransactionMockRecorder {
 	return m.recorder
 }
 
+// Aggregate mocks base method
+func (m *MockITransaction) Aggregate(arg0 context.Context, arg1 ISchema, arg2 Filter, arg3 []string, arg4 []Aggregation) ([]map[string]interface{}, error) {
+	ret := m.ctrl.Call(m, "Aggregate", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].([]map[string]interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Aggregate indicates an expected call of Aggregate
+func (mr *MockITransactionMockRecorder) Aggregate(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Aggregate", reflect.TypeOf((*MockITransaction)(nil).Aggregate), arg0, arg1, arg2, arg3, arg4)
+}
+
 // Close mocks base method
 func (m *MockITransaction) Close() error {
 	ret := m.ctrl.Call(m, "Close")
@@ -781,6 +794,42 @@ func (mr *MockIAuthMockRecorder) IsAdmin(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsAdmin", reflect.TypeOf((*MockIAuth)(nil).IsAdmin), arg0)
 }
 
+// RevokeTenantTokens mocks base method
+func (m *MockIAuth) RevokeTenantTokens(arg0 string) error {
+	ret := m.ctrl.Call(m, "RevokeTenantTokens", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeTenantTokens indicates an expected call of RevokeTenantTokens
+func (mr *MockIAuthMockRecorder) RevokeTenantTokens(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeTenantTokens", reflect.TypeOf((*MockIAuth)(nil).RevokeTenantTokens), arg0)
+}
+
+// RevokeToken mocks base method
+func (m *MockIAuth) RevokeToken(arg0 string) error {
+	ret := m.ctrl.Call(m, "RevokeToken", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeToken indicates an expected call of RevokeToken
+func (mr *MockIAuthMockRecorder) RevokeToken(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeToken", reflect.TypeOf((*MockIAuth)(nil).RevokeToken), arg0)
+}
+
+// RevokeUserTokens mocks base method
+func (m *MockIAuth) RevokeUserTokens(arg0 string) error {
+	ret := m.ctrl.Call(m, "RevokeUserTokens", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserTokens indicates an expected call of RevokeUserTokens
+func (mr *MockIAuthMockRecorder) RevokeUserTokens(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserTokens", reflect.TypeOf((*MockIAuth)(nil).RevokeUserTokens), arg0)
+}
+
 // MockIConfig is a mock of IConfig interface
 type MockIConfig struct {
 	ctrl     *gomock.Controller
@@ -901,3 +950,16 @@ func (m *MockIUtil) ResourceToMap(arg0 interface{}) map[string]interface{} {
 func (mr *MockIUtilMockRecorder) ResourceToMap(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResourceToMap", reflect.TypeOf((*MockIUtil)(nil).ResourceToMap), arg0)
 }
+
+// NextMarker mocks base method
+func (m *MockIUtil) NextMarker(arg0 *Paginator, arg1 []interface{}) (string, error) {
+	ret := m.ctrl.Call(m, "NextMarker", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextMarker indicates an expected call of NextMarker
+func (mr *MockIUtilMockRecorder) NextMarker(arg0, arg1 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextMarker", reflect.TypeOf((*MockIUtil)(nil).NextMarker), arg0, arg1)
+}
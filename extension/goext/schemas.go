@@ -43,15 +43,62 @@ type Resources []Resource
 // Context represents a context of a handler
 type Context map[string]interface{}
 
-// Filter represents filtering options for fetching functions
+// Filter represents filtering options for fetching functions.
+// Values are matched exactly, unless FilterCondition or FilterConditions is used.
 type Filter map[string]interface{}
 
+// FilterSearchKey is the Filter key of a full-text search text; resources having any of its words
+// in properties covered by full-text indexes match it and are ordered by relevance unless the paginator has a sort key
+const FilterSearchKey = "_search"
+
+// FilterOperator represents a comparison operator of a filter condition
+type FilterOperator string
+
+const (
+	// FilterEqual matches values equal to the condition value (or any of them, for lists)
+	FilterEqual FilterOperator = "eq"
+
+	// FilterNotEqual matches values different from the condition value (or all of them, for lists)
+	FilterNotEqual FilterOperator = "ne"
+
+	// FilterLessThan matches values lower than the condition value
+	FilterLessThan FilterOperator = "lt"
+
+	// FilterLessThanOrEqual matches values lower than or equal to the condition value
+	FilterLessThanOrEqual FilterOperator = "lte"
+
+	// FilterGreaterThan matches values greater than the condition value
+	FilterGreaterThan FilterOperator = "gt"
+
+	// FilterGreaterThanOrEqual matches values greater than or equal to the condition value
+	FilterGreaterThanOrEqual FilterOperator = "gte"
+
+	// FilterLike matches values against a SQL LIKE pattern (or any of them, for lists)
+	FilterLike FilterOperator = "like"
+
+	// FilterNotLike matches values not matching a SQL LIKE pattern (nor any of them, for lists)
+	FilterNotLike FilterOperator = "not_like"
+
+	// FilterIsNull matches null values if the condition value is true and non null values otherwise
+	FilterIsNull FilterOperator = "is_null"
+)
+
+// FilterCondition represents a single operator condition on a property, usable as a Filter value
+type FilterCondition struct {
+	Operator FilterOperator
+	Value    interface{}
+}
+
+// FilterConditions represents conditions on a single property which all have to be met, usable as a Filter value
+type FilterConditions []FilterCondition
+
 // Paginator represents a paginator
 type Paginator struct {
 	Key    string
 	Order  string
 	Limit  uint64
 	Offset uint64
+	Marker string
 }
 
 // MakeContext creates an empty context
@@ -112,6 +159,9 @@ const PriorityDefault = 0
 // ErrResourceNotFound represents 'resource not found' error
 var ErrResourceNotFound = errors.New("resource not found")
 
+// ErrPreconditionFailed represents 'precondition failed' error, returned when a resource has been modified
+var ErrPreconditionFailed = errors.New("precondition failed")
+
 // ISchema is an interface representing a single schema in Gohan
 type ISchema interface {
 	// ID returns the identifier of this resource
@@ -138,6 +188,9 @@ type ISchema interface {
 	// FetchRaw returns a pointer to raw resource, containing db annotations
 	FetchRaw(id string, context Context) (interface{}, error)
 
+	// ETag returns entity tag of the stored resource, same as in the ETag header of REST API responses
+	ETag(id string, context Context) (string, error)
+
 	// StateFetchRaw returns a resource state
 	StateFetchRaw(id string, requestContext Context) (ResourceState, error)
 
@@ -156,6 +209,10 @@ type ISchema interface {
 	// UpdateRaw updates a raw resource, given by a pointer
 	UpdateRaw(rawResource interface{}, context Context) error
 
+	// UpdateRawIfMatch updates a raw resource, given by a pointer, if entity tag of the stored resource equals etag,
+	// ErrPreconditionFailed is returned otherwise
+	UpdateRawIfMatch(rawResource interface{}, etag string, context Context) error
+
 	// DbUpdateRaw updates a raw resource, given by a pointer, no events are emitted
 	DbUpdateRaw(rawResource interface{}, context Context) error
 
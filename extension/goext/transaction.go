@@ -40,6 +40,8 @@ const (
 // TxOptions represents transaction options
 type TxOptions struct {
 	IsolationLevel Type
+	// ReadOnly transactions may be served by a read replica
+	ReadOnly bool
 }
 
 // ResourceState represents the state of a resource
@@ -60,6 +62,29 @@ type ListOptions struct {
 	Fields []string
 }
 
+// AggregateFunction represents a function computed over a group of resources
+type AggregateFunction string
+
+const (
+	// AggregateCount counts resources, or resources with non null property value when property is given
+	AggregateCount AggregateFunction = "count"
+	// AggregateSum sums property values
+	AggregateSum AggregateFunction = "sum"
+	// AggregateMin returns the lowest property value
+	AggregateMin AggregateFunction = "min"
+	// AggregateMax returns the highest property value
+	AggregateMax AggregateFunction = "max"
+	// AggregateAvg returns the average of property values
+	AggregateAvg AggregateFunction = "avg"
+)
+
+// Aggregation represents an aggregate function applied to a property;
+// its result is stored under the function name, followed by an underscore and the property if given, e.g. sum_size
+type Aggregation struct {
+	Function AggregateFunction
+	Property string
+}
+
 // ITransaction is common interface for handling transaction
 type ITransaction interface {
 	Create(ctx context.Context, schema ISchema, resource map[string]interface{}) error
@@ -72,6 +97,7 @@ type ITransaction interface {
 	List(ctx context.Context, schema ISchema, filter Filter, listOptions *ListOptions, paginator *Paginator) ([]map[string]interface{}, uint64, error)
 	LockList(ctx context.Context, schema ISchema, filter Filter, listOptions *ListOptions, paginator *Paginator, lockPolicy LockPolicy) ([]map[string]interface{}, uint64, error)
 	Count(ctx context.Context, schema ISchema, filter Filter) (uint64, error)
+	Aggregate(ctx context.Context, schema ISchema, filter Filter, groupBy []string, aggregations []Aggregation) ([]map[string]interface{}, error)
 	RawTransaction() interface{} // *sqlx.Tx
 	Query(ctx context.Context, schema ISchema, query string, args []interface{}) (list []map[string]interface{}, err error)
 	Commit() error
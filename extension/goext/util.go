@@ -25,4 +25,8 @@ type IUtil interface {
 
 	// ResourceToMap converts structure representation of the resource to mapped representation
 	ResourceToMap(resource interface{}) map[string]interface{}
+
+	// NextMarker returns the marker of the page following given list of resources fetched with the paginator,
+	// or an empty string if it is the last page
+	NextMarker(paginator *Paginator, resources []interface{}) (string, error)
 }
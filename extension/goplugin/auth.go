@@ -16,8 +16,11 @@
 package goplugin
 
 import (
+	"fmt"
+
 	"github.com/cloudwan/gohan/extension/goext"
 	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
 )
 
 // Auth is an implementation of IAuth
@@ -59,3 +62,38 @@ func (a *Auth) GetTenantName(context goext.Context) string {
 func (a *Auth) IsAdmin(context goext.Context) bool {
 	return a.HasRole(context, "admin")
 }
+
+// RevokeToken rejects the token on all Gohan nodes
+func (a *Auth) RevokeToken(token string) error {
+	revocations, err := getTokenRevocations()
+	if err != nil {
+		return err
+	}
+	return revocations.RevokeToken(token)
+}
+
+// RevokeTenantTokens rejects tokens of the tenant issued before on all Gohan nodes
+func (a *Auth) RevokeTenantTokens(tenantID string) error {
+	revocations, err := getTokenRevocations()
+	if err != nil {
+		return err
+	}
+	return revocations.RevokeTenant(tenantID)
+}
+
+// RevokeUserTokens rejects tokens of the user issued before on all Gohan nodes
+func (a *Auth) RevokeUserTokens(userID string) error {
+	revocations, err := getTokenRevocations()
+	if err != nil {
+		return err
+	}
+	return revocations.RevokeUser(userID)
+}
+
+func getTokenRevocations() (*middleware.TokenRevocations, error) {
+	revocations := middleware.GetTokenRevocations()
+	if revocations == nil {
+		return nil, fmt.Errorf("token revocation is not available")
+	}
+	return revocations, nil
+}
@@ -22,6 +22,7 @@ import (
 	gohan_db "github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension/goext"
+	gohan_log "github.com/cloudwan/gohan/log"
 	"github.com/pkg/errors"
 )
 
@@ -62,8 +63,9 @@ func (db *Database) Begin() (goext.ITransaction, error) {
 
 // BeginTx starts a new transaction with options
 func (db *Database) BeginTx(ctx goext.Context, options *goext.TxOptions) (goext.ITransaction, error) {
-	opts := transaction.TxOptions{IsolationLevel: transaction.Type(options.IsolationLevel)}
-	t, err := db.raw.BeginTx(context.Background(), &opts)
+	opts := transaction.TxOptions{IsolationLevel: transaction.Type(options.IsolationLevel), ReadOnly: options.ReadOnly}
+	requestID, _ := ctx["request_id"].(string)
+	t, err := db.raw.BeginTx(gohan_log.ContextWithRequestID(context.Background(), requestID), &opts)
 	return handleBeginError(t, err)
 }
 
@@ -33,6 +33,7 @@ import (
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/tracing"
 	"github.com/mohae/deepcopy"
 	"github.com/pkg/errors"
 	"github.com/twinj/uuid"
@@ -75,6 +76,7 @@ type Environment struct {
 
 	name       string
 	traceID    string
+	requestID  string
 	timeLimit  time.Duration
 	timeLimits []*schema.EventTimeLimit
 
@@ -100,6 +102,7 @@ type IEnvironment interface {
 	getRawType(schemaID string) (reflect.Type, bool)
 	getType(schemaID string) (reflect.Type, bool)
 	getTraceID() string
+	getRequestID() string
 	getTimeLimit() time.Duration
 	getTimeLimits() []*schema.EventTimeLimit
 }
@@ -403,6 +406,10 @@ func (env *Environment) getTraceID() string {
 	return env.traceID
 }
 
+func (env *Environment) getRequestID() string {
+	return env.requestID
+}
+
 func (env *Environment) getTimeLimit() time.Duration {
 	return env.timeLimit
 }
@@ -418,6 +425,10 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 		context[goext.KeyTopLevelHandler] = true
 		defer delete(context, goext.KeyTopLevelHandler)
 	}
+	// environments are cloned for each request, so the ID is remembered for logging
+	if requestID, ok := context["request_id"].(string); ok {
+		env.requestID = requestID
+	}
 
 	err := handleEventForEnv(env, event, context)
 	if err != nil && !hasParent {
@@ -507,7 +518,7 @@ type interrupt struct {
 }
 
 func newInterrupt(env IEnvironment, event string, requestContext map[string]interface{}) *interrupt {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(tracing.ContextWithSpan(context.Background(), tracing.SpanFromMap(requestContext)))
 	doneCh := make(chan struct{}, 1)
 	interrupt := &interrupt{env, event, requestContext, doneCh, ctx, cancel}
 
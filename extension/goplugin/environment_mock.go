@@ -217,6 +217,10 @@ func (mockEnv *MockIEnvironment) getTraceID() string {
 	return mockEnv.env.getTraceID()
 }
 
+func (mockEnv *MockIEnvironment) getRequestID() string {
+	return mockEnv.env.getRequestID()
+}
+
 func (mockEnv *MockIEnvironment) getTimeLimit() time.Duration {
 	return mockEnv.env.timeLimit
 }
@@ -23,6 +23,7 @@ import (
 
 	"github.com/cloudwan/gohan/extension/goext"
 	"github.com/cloudwan/gohan/extension/otto"
+	"github.com/cloudwan/gohan/tracing"
 )
 
 // HTTP is an implementation of IHTTP
@@ -31,7 +32,19 @@ type HTTP struct{}
 // Request performs http request
 func (http *HTTP) Request(ctx context.Context, method, rawURL string, headers map[string]interface{}, postData interface{}, opaque bool) (*goext.Response, error) {
 	log.Debug("gohan_http  [%s] %s %s %t", method, headers, rawURL, opaque)
+	span := startRequestSpan(ctx, method, rawURL)
+	defer span.End()
+	if span != nil {
+		tracedHeaders := map[string]interface{}{}
+		for key, value := range headers {
+			tracedHeaders[key] = value
+		}
+		tracedHeaders[tracing.TraceParentHeader] = span.TraceParent()
+		headers = tracedHeaders
+	}
 	code, header, body, error := otto.GohanHTTP(ctx, method, rawURL, headers, postData, opaque)
+	span.SetAttribute("http.status_code", code)
+	span.SetError(error)
 	return &goext.Response{Code: code, Header: convertHeader(header), Body: body}, error
 }
 
@@ -49,10 +62,16 @@ func (http *HTTP) RequestRaw(ctx context.Context, method, rawURL string, headers
 		req.Header.Set(header, value)
 	}
 
+	span := startRequestSpan(ctx, method, rawURL)
+	defer span.End()
+	tracing.Inject(span, req.Header)
+
 	resp, err := net_http.DefaultTransport.RoundTrip(req)
 	if err != nil {
+		span.SetError(err)
 		return nil, err
 	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -60,6 +79,13 @@ func (http *HTTP) RequestRaw(ctx context.Context, method, rawURL string, headers
 	return &goext.Response{Code: resp.StatusCode, Status: resp.Status, Header: convertHeader(resp.Header), Body: string(body)}, nil
 }
 
+func startRequestSpan(ctx context.Context, method, rawURL string) *tracing.Span {
+	span := tracing.StartSpan(tracing.SpanFromContext(ctx), "HTTP "+method, tracing.SpanKindClient)
+	span.SetAttribute("http.method", method)
+	span.SetAttribute("http.url", rawURL)
+	return span
+}
+
 func convertHeader(header net_http.Header) goext.Header {
 	ret := make(map[string][]string, len(header))
 	for k, v := range header {
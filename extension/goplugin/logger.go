@@ -30,7 +30,7 @@ type Logger struct {
 }
 
 func (logger *Logger) dispatchLog(module string, level goext.Level, format string) {
-	log := gohan_log.NewLoggerForModule(module)
+	log := gohan_log.WithRequestID(gohan_log.NewLoggerForModule(module), logger.env.getRequestID())
 	format = fmt.Sprintf("[%s] %s", logger.env.getTraceID(), format)
 
 	switch level {
@@ -52,7 +52,7 @@ func (logger *Logger) dispatchLog(module string, level goext.Level, format strin
 }
 
 func (logger *Logger) dispatchLogf(module string, level goext.Level, format string, args ...interface{}) {
-	log := gohan_log.NewLoggerForModule(module)
+	log := gohan_log.WithRequestID(gohan_log.NewLoggerForModule(module), logger.env.getRequestID())
 	format = fmt.Sprintf("[%s] %s", logger.env.getTraceID(), format)
 
 	switch level {
@@ -365,6 +365,57 @@ func (schema *Schema) UpdateRaw(rawResource interface{}, context goext.Context)
 	return schema.update(rawResource, context, true)
 }
 
+// UpdateRawIfMatch updates a resource and triggers handlers if entity tag of the stored resource equals etag
+func (schema *Schema) UpdateRawIfMatch(rawResource interface{}, etag string, context goext.Context) error {
+	if !isPointer(rawResource) {
+		return ErrNotPointer
+	}
+	resourceData, err := schema.structToResource(rawResource)
+	if err != nil {
+		return err
+	}
+	tx := mustGetOpenTransactionFromContext(context)
+	current, err := schema.etag(goext.GetContext(context), tx, resourceData.ID(), true)
+	if err != nil {
+		return err
+	}
+	if current != etag {
+		return goext.ErrPreconditionFailed
+	}
+	return schema.update(rawResource, context, true)
+}
+
+// ETag returns entity tag of the stored resource
+func (schema *Schema) ETag(id string, context goext.Context) (string, error) {
+	tx := mustGetOpenTransactionFromContext(context)
+	return schema.etag(goext.GetContext(context), tx, id, false)
+}
+
+func (schema *Schema) etag(ctx context.Context, tx goext.ITransaction, id string, lock bool) (string, error) {
+	filter := goext.Filter{"id": id}
+	var data map[string]interface{}
+	var err error
+	if lock {
+		data, err = tx.LockFetch(ctx, schema, filter, goext.SkipRelatedResources)
+	} else {
+		data, err = tx.Fetch(ctx, schema, filter)
+	}
+	if err != nil {
+		if err == transaction.ErrResourceNotFound {
+			return "", goext.ErrResourceNotFound
+		}
+		return "", err
+	}
+	if schema.raw.StateVersioning() {
+		state, err := tx.StateFetch(ctx, schema, filter)
+		if err != nil {
+			return "", err
+		}
+		return transaction.VersionETag(state.ConfigVersion), nil
+	}
+	return transaction.ContentETag(schema.raw, data), nil
+}
+
 // DbUpdateRaw updates a raw resource without triggering events
 func (schema *Schema) DbUpdateRaw(rawResource interface{}, context goext.Context) error {
 	return schema.update(rawResource, context, false)
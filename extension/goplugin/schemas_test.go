@@ -285,6 +285,22 @@ var _ = Describe("Schemas", func() {
 			Expect(returnedTest.Description).To(Equal("other-description"))
 		})
 
+		It("UpdateRawIfMatch updates resource with matching entity tag only", func() {
+			Expect(testSchema.CreateRaw(&createdResource, context)).To(Succeed())
+			etag, err := testSchema.ETag(createdResource.ID, context)
+			Expect(err).ToNot(HaveOccurred())
+
+			createdResource.Description = "other-description"
+			Expect(testSchema.UpdateRawIfMatch(&createdResource, etag, context)).To(Succeed())
+
+			createdResource.Description = "stale-description"
+			Expect(testSchema.UpdateRawIfMatch(&createdResource, etag, context)).To(Equal(goext.ErrPreconditionFailed))
+
+			returnedResource, err := testSchema.FetchRaw(createdResource.ID, context)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(returnedResource.(*test.Test).Description).To(Equal("other-description"))
+		})
+
 		It("should fetch resource state", func() {
 			Expect(testSchema.CreateRaw(&createdResource, context)).To(Succeed())
 
@@ -43,6 +43,7 @@ type cancelableTransaction interface {
 	QueryContext(context.Context, *schema.Schema, string, []interface{}) (list []*schema.Resource, err error)
 	ExecContext(ctx context.Context, query string, args ...interface{}) error
 	CountContext(context.Context, *schema.Schema, transaction.Filter) (uint64, error)
+	Aggregate(context.Context, *schema.Schema, transaction.Filter, []string, []transaction.Aggregation) ([]map[string]interface{}, error)
 }
 
 //Transaction is common interface for handling transaction
@@ -136,7 +137,7 @@ func (t *Transaction) Fetch(ctx context.Context, schema goext.ISchema, filter go
 	if err := ctx.Err(); err != nil {
 		return nil, ctx.Err()
 	}
-	res, err := t.tx.FetchContext(context.Background(), t.findRawSchema(schema.ID()), transaction.Filter(filter), nil)
+	res, err := t.tx.FetchContext(context.Background(), t.findRawSchema(schema.ID()), convertFilter(filter), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -148,13 +149,42 @@ func (t *Transaction) LockFetch(ctx context.Context, schema goext.ISchema, filte
 	if err := ctx.Err(); err != nil {
 		return nil, ctx.Err()
 	}
-	res, err := t.tx.LockFetchContext(context.Background(), t.findRawSchema(schema.ID()), transaction.Filter(filter), convertLockPolicy(lockPolicy), nil)
+	res, err := t.tx.LockFetchContext(context.Background(), t.findRawSchema(schema.ID()), convertFilter(filter), convertLockPolicy(lockPolicy), nil)
 	if err != nil {
 		return nil, err
 	}
 	return res.Data(), nil
 }
 
+func convertFilter(filter goext.Filter) transaction.Filter {
+	if filter == nil {
+		return nil
+	}
+	converted := transaction.Filter{}
+	for key, value := range filter {
+		switch v := value.(type) {
+		case goext.FilterCondition:
+			converted[key] = convertFilterCondition(v)
+		case goext.FilterConditions:
+			conditions := make(transaction.Conditions, len(v))
+			for i, condition := range v {
+				conditions[i] = convertFilterCondition(condition)
+			}
+			converted[key] = conditions
+		default:
+			converted[key] = value
+		}
+	}
+	return converted
+}
+
+func convertFilterCondition(condition goext.FilterCondition) transaction.Condition {
+	return transaction.Condition{
+		Operator: transaction.Operator(condition.Operator),
+		Value:    condition.Value,
+	}
+}
+
 func convertLockPolicy(policy goext.LockPolicy) schema.LockPolicy {
 	switch policy {
 	case goext.SkipRelatedResources:
@@ -173,7 +203,7 @@ func (t *Transaction) StateFetch(ctx context.Context, schema goext.ISchema, filt
 	if err := ctx.Err(); err != nil {
 		return goext.ResourceState{}, ctx.Err()
 	}
-	transactionResourceState, err := t.tx.StateFetchContext(context.Background(), t.findRawSchema(schema.ID()), transaction.Filter(filter))
+	transactionResourceState, err := t.tx.StateFetchContext(context.Background(), t.findRawSchema(schema.ID()), convertFilter(filter))
 	if err != nil {
 		return goext.ResourceState{}, err
 	}
@@ -187,7 +217,7 @@ func (t *Transaction) List(ctx context.Context, schema goext.ISchema, filter goe
 	if err := ctx.Err(); err != nil {
 		return nil, 0, ctx.Err()
 	}
-	data, _, err := t.tx.ListContext(context.Background(), t.findRawSchema(schemaID), transaction.Filter(filter), nil, (*pagination.Paginator)(paginator))
+	data, _, err := t.tx.ListContext(context.Background(), t.findRawSchema(schemaID), convertFilter(filter), nil, (*pagination.Paginator)(paginator))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -211,7 +241,7 @@ func (t *Transaction) LockList(ctx context.Context, schema goext.ISchema, filter
 	if err := ctx.Err(); err != nil {
 		return nil, 0, ctx.Err()
 	}
-	data, _, err := t.tx.LockListContext(context.Background(), t.findRawSchema(schemaID), transaction.Filter(filter), nil, (*pagination.Paginator)(paginator), convertLockPolicy(lockingPolicy))
+	data, _, err := t.tx.LockListContext(context.Background(), t.findRawSchema(schemaID), convertFilter(filter), nil, (*pagination.Paginator)(paginator), convertLockPolicy(lockingPolicy))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -278,5 +308,21 @@ func (t *Transaction) Count(ctx context.Context, schema goext.ISchema, filter go
 	if err := ctx.Err(); err != nil {
 		return 0, ctx.Err()
 	}
-	return t.tx.CountContext(context.Background(), t.findRawSchema(schemaID), transaction.Filter(filter))
+	return t.tx.CountContext(context.Background(), t.findRawSchema(schemaID), convertFilter(filter))
+}
+
+func (t *Transaction) Aggregate(ctx context.Context, schema goext.ISchema, filter goext.Filter, groupBy []string, aggregations []goext.Aggregation) ([]map[string]interface{}, error) {
+	schemaID := schema.ID()
+
+	if err := ctx.Err(); err != nil {
+		return nil, ctx.Err()
+	}
+	converted := make([]transaction.Aggregation, len(aggregations))
+	for i, aggregation := range aggregations {
+		converted[i] = transaction.Aggregation{
+			Function: transaction.AggregateFunction(aggregation.Function),
+			Property: aggregation.Property,
+		}
+	}
+	return t.tx.Aggregate(context.Background(), t.findRawSchema(schemaID), convertFilter(filter), groupBy, converted)
 }
@@ -21,6 +21,7 @@ import (
 	"reflect"
 	"strings"
 
+	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension/goext"
 	"github.com/golang/mock/gomock"
@@ -264,6 +265,20 @@ func sliceToMap(context map[string]interface{}, fieldName string, field reflect.
 	return nil
 }
 
+// NextMarker returns the marker of the page following given list of resources fetched with the paginator
+func (util *Util) NextMarker(paginator *goext.Paginator, resources []interface{}) (string, error) {
+	if paginator == nil || paginator.Limit == 0 || uint64(len(resources)) < paginator.Limit {
+		return "", nil
+	}
+	last := util.ResourceToMap(resources[len(resources)-1])
+	id, _ := last["id"].(string)
+	var value interface{}
+	if paginator.Key != "" && paginator.Key != "id" {
+		value = last[paginator.Key]
+	}
+	return pagination.EncodeMarker(value, id)
+}
+
 // ResourceToMap converts structure representation of the resource to mapped representation
 func (util *Util) ResourceToMap(resource interface{}) map[string]interface{} {
 	fieldsMap := map[string]interface{}{}
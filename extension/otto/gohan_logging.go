@@ -34,7 +34,7 @@ func init() {
 
 		builtins := map[string]interface{}{
 			"gohan_log_impl": func(call otto.FunctionCall) otto.Value {
-				VerifyCallArguments(&call, "gohan_log_impl", 4)
+				VerifyCallArguments(&call, "gohan_log_impl", 5)
 
 				// TODO:
 				// Taking this as an argument is a workaround
@@ -59,7 +59,13 @@ func init() {
 					ThrowOttoException(&call, "Caller: %v", err)
 				}
 
-				message, err := GetString(call.Argument(3))
+				requestID, err := GetString(call.Argument(3))
+				if err != nil {
+					ThrowOttoException(&call, "Request ID: %v", err)
+				}
+				logger = l.WithRequestID(logger, requestID)
+
+				message, err := GetString(call.Argument(4))
 				if err != nil {
 					ThrowOttoException(&call, "Message: %v", err)
 				}
@@ -91,6 +97,8 @@ func init() {
 		vm.Set("LOG_LEVEL", logLevels)
 
 		vm.Set("LOG_MODULE", "gohan.extension."+env.Name)
+		// set by HandleEvent to ID of the request the event is handled for
+		vm.Set("LOG_REQUEST_ID", "")
 
 		err := env.Load("<Gohan logging built-ins>", `
 		function gohan_log_module_push(new_module){
@@ -104,7 +112,7 @@ func init() {
 		}
 
 		function gohan_log(module, level, msg) {
-		    gohan_log_impl(module, level, gohan_caller, msg);
+		    gohan_log_impl(module, level, gohan_caller, LOG_REQUEST_ID, msg);
 		}
 
 		function gohan_log_critical(msg) {
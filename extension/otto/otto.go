@@ -196,6 +196,10 @@ func (env *Environment) HandleEvent(event string, context map[string]interface{}
 		}
 	}
 	context["event_type"] = event
+	if requestID, ok := context["request_id"].(string); ok {
+		// environments are cloned for each request, so the ID is kept for gohan_log
+		vm.Set("LOG_REQUEST_ID", requestID)
+	}
 	var timeout = fmt.Errorf("exceed timeout for extension execution for event: %s", event)
 	var disconnected = fmt.Errorf("client disconnected for event: %s", event)
 
@@ -16,6 +16,7 @@
 package otto_test
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -33,6 +34,7 @@ import (
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
 	"github.com/cloudwan/gohan/extension/otto"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
 	"github.com/cloudwan/gohan/server/resources"
@@ -239,6 +241,29 @@ var _ = Describe("Otto extension manager", func() {
 			})
 		})
 
+		Context("When a handler logs a message", func() {
+			AfterEach(func() {
+				l.SetUpBasicLogging(os.Stderr, l.DefaultFormat)
+			})
+
+			It("should prefix the record with the request ID", func() {
+				extension, err := schema.NewExtension(map[string]interface{}{
+					"id":   "logging_extension",
+					"code": `gohan_register_handler("test_event", function(context) { gohan_log_warning("handled"); });`,
+					"path": ".*",
+				})
+				Expect(err).ToNot(HaveOccurred())
+				extension.URL = "logging_extension.js"
+				env := newEnvironment()
+				Expect(env.LoadExtensionsForPath([]*schema.Extension{extension}, timeLimit, timeLimits, "test_path")).To(Succeed())
+
+				output := &bytes.Buffer{}
+				l.SetUpBasicLogging(output, l.DefaultFormat)
+				Expect(env.HandleEvent("test_event", map[string]interface{}{"request_id": "req-42"})).To(Succeed())
+				Expect(output.String()).To(MatchRegexp(`\[request_id=req-42\] \[[^\]]+\] handled`))
+			})
+		})
+
 		Context("When extension is running too long", func() {
 			It("should be aborted in the middle of extension and cleaned up", func() {
 				timeoutExtension, err := schema.NewExtension(map[string]interface{}{
@@ -21,6 +21,20 @@ func (f *jsonFormatter) Format(calldepth int, record *logging.Record, output io.
 		"msg":            record.Message(),
 		"component_name": record.Module,
 	}
+	if requestID, message := splitRequestID(record.Message()); requestID != "" {
+		result["request_id"] = requestID
+		result["msg"] = message
+	}
+	if record.Module == AccessLogModule {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(record.Message()), &fields); err == nil {
+			delete(result, "msg")
+			result["log_type"] = "access"
+			for key, value := range fields {
+				result[key] = value
+			}
+		}
+	}
 	resultJSON, err := json.Marshal(result)
 	if err != nil {
 		return err
@@ -0,0 +1,131 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+type requestIDContextKey struct{}
+
+//ContextWithRequestID returns context carrying the request ID
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+//RequestIDFromContext returns request ID carried by the context
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+const requestIDPrefix = "[request_id="
+
+//WithRequestID returns logger prefixing its records with the request ID, e.g. "[request_id=42] message".
+//JSON formatter moves the ID to request_id field. Logger is returned unchanged when the ID is empty.
+func WithRequestID(logger Logger, requestID string) Logger {
+	if requestID == "" {
+		return logger
+	}
+	return &requestLogger{logger: logger, prefix: requestIDPrefix + requestID + "] "}
+}
+
+//splitRequestID splits request ID prefix added by WithRequestID from the message.
+//Request IDs don't contain spaces, so the prefix ends with the first "] ".
+func splitRequestID(message string) (requestID, rest string) {
+	if !strings.HasPrefix(message, requestIDPrefix) {
+		return "", message
+	}
+	end := strings.Index(message, "] ")
+	if end < 0 {
+		return "", message
+	}
+	return message[len(requestIDPrefix):end], message[end+2:]
+}
+
+type requestLogger struct {
+	logger Logger
+	prefix string
+}
+
+func (l *requestLogger) Fatal(args ...interface{}) {
+	l.logger.Fatal(append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Fatalf("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Panic(args ...interface{}) {
+	l.logger.Panic(append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Panicf(format string, args ...interface{}) {
+	l.logger.Panicf("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Critical(format string, args ...interface{}) {
+	l.logger.Critical("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Error(format string, args ...interface{}) {
+	l.logger.Error("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Warning(format string, args ...interface{}) {
+	l.logger.Warning("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Notice(format string, args ...interface{}) {
+	l.logger.Notice("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Info(format string, args ...interface{}) {
+	l.logger.Info("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+func (l *requestLogger) Debug(format string, args ...interface{}) {
+	l.logger.Debug("%s"+format, append([]interface{}{l.prefix}, args...)...)
+}
+
+//AccessLogModule is a name of the module access records are logged with
+const AccessLogModule = "gohan.access"
+
+var accessLog = NewLoggerForModule(AccessLogModule)
+
+//AccessRecord describes a handled HTTP request
+type AccessRecord struct {
+	RequestID  string  `json:"request_id"`
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	RemoteAddr string  `json:"remote_addr"`
+	Status     int     `json:"status"`
+	Duration   float64 `json:"duration_ms"`
+	TenantID   string  `json:"tenant_id,omitempty"`
+	TenantName string  `json:"tenant_name,omitempty"`
+}
+
+//LogAccess logs the access record encoded in JSON.
+//JSON formatter outputs its fields in a record with log_type "access".
+func LogAccess(record *AccessRecord) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	accessLog.Info("%s", data)
+}
@@ -64,6 +64,7 @@ func getGraphiteConfig(config *util.Config) (graphiteConfigs []graphite.Config,
 // SetupMetrics setups metrics from config
 func SetupMetrics(config *util.Config) (err error) {
 	monitoringEnabled = config.GetBool("metrics/enabled", false)
+	prometheusConfig = getPrometheusConfig(config)
 	graphiteConfigs, err = getGraphiteConfig(config)
 	return
 }
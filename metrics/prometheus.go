@@ -0,0 +1,239 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/util"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rcrowley/go-metrics"
+)
+
+const prometheusNamespace = "gohan"
+
+var (
+	prometheusConfig       *PrometheusConfig
+	prometheusRegistry     *prometheus.Registry
+	prometheusRegistryOnce sync.Once
+
+	prometheusQuantiles    = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+	prometheusInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_]")
+)
+
+// PrometheusConfig describes the endpoint exposing metrics in Prometheus text format
+type PrometheusConfig struct {
+	Path          string
+	Authenticated bool
+}
+
+// prometheusRule maps dotted go-metrics names to a Prometheus metric with labels.
+// Pattern segments in braces are label names; the last one may end with "*"
+// to match all the remaining segments.
+type prometheusRule struct {
+	pattern   []string
+	name      string
+	monotonic bool
+}
+
+var prometheusRules = []prometheusRule{
+	newPrometheusRule("http.{method}.status.{code}", "http_responses", true),
+	newPrometheusRule("http.{method}.{result}", "http_requests", true),
+	newPrometheusRule("req.peer_disconnect", "request_peer_disconnects", true),
+	newPrometheusRule("req.rate_limited", "request_rate_limited", true),
+	newPrometheusRule("auth.cache.{result}", "auth_cache", true),
+	newPrometheusRule("auth.revocation", "auth_revocations", true),
+	newPrometheusRule("config.reload", "config_reloads", true),
+	newPrometheusRule("req.{schema}.{type*}", "request", false),
+	newPrometheusRule("ext.{schema}.{event*}", "extension", false),
+	newPrometheusRule("tx.{schema}.{action*}", "transaction", false),
+	newPrometheusRule("db.{action*}", "db", false),
+	newPrometheusRule("sync.v3.{action*}", "etcd", false),
+	newPrometheusRule("sync.{action*}", "sync", false),
+	newPrometheusRule("state.{schema}.{event*}", "state", false),
+}
+
+func newPrometheusRule(pattern, name string, monotonic bool) prometheusRule {
+	return prometheusRule{pattern: strings.Split(pattern, "."), name: name, monotonic: monotonic}
+}
+
+func (rule prometheusRule) labelNames() []string {
+	labels := []string{}
+	for _, segment := range rule.pattern {
+		if strings.HasPrefix(segment, "{") {
+			labels = append(labels, strings.TrimSuffix(strings.Trim(segment, "{}"), "*"))
+		}
+	}
+	return labels
+}
+
+// match returns label values of the metric name or false if the rule doesn't apply
+func (rule prometheusRule) match(name string) ([]string, bool) {
+	segments := strings.Split(name, ".")
+	values := []string{}
+	for i, segment := range rule.pattern {
+		if i >= len(segments) {
+			return nil, false
+		}
+		if !strings.HasPrefix(segment, "{") {
+			if segment != segments[i] {
+				return nil, false
+			}
+			continue
+		}
+		if strings.HasSuffix(segment, "*}") {
+			return append(values, strings.Join(segments[i:], ".")), true
+		}
+		values = append(values, segments[i])
+	}
+	return values, len(segments) == len(rule.pattern)
+}
+
+func (rule prometheusRule) metricName(timer bool) string {
+	return prometheusName(rule.name, timer, rule.monotonic)
+}
+
+func prometheusName(name string, timer, monotonic bool) string {
+	suffix := "_counter"
+	if timer {
+		suffix = "_duration_seconds"
+	} else if monotonic {
+		suffix = "_total"
+	}
+	return prometheus.BuildFQName(prometheusNamespace, "", prometheusInvalidChars.ReplaceAllString(name, "_")+suffix)
+}
+
+func (rule prometheusRule) desc(timer bool) *prometheus.Desc {
+	return prometheus.NewDesc(rule.metricName(timer), "Gohan metric "+strings.Join(rule.pattern, "."), rule.labelNames(), nil)
+}
+
+// prometheusMetric returns rule matching the go-metrics name and label values
+func prometheusMetric(name string) (prometheusRule, []string) {
+	for _, rule := range prometheusRules {
+		if values, ok := rule.match(name); ok {
+			return rule, values
+		}
+	}
+	return prometheusRule{pattern: []string{name}, name: name}, nil
+}
+
+// goMetricsCollector exports metrics of the go-metrics registry
+type goMetricsCollector struct {
+	registry metrics.Registry
+}
+
+// Describe sends descriptors of the known metrics; other metrics are described when collected
+func (collector *goMetricsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, rule := range prometheusRules {
+		for _, timer := range []bool{true, false} {
+			descs <- rule.desc(timer)
+		}
+	}
+}
+
+// Collect converts go-metrics timers, counters and gauges to Prometheus metrics
+func (collector *goMetricsCollector) Collect(out chan<- prometheus.Metric) {
+	collector.registry.Each(func(name string, metric interface{}) {
+		switch m := metric.(type) {
+		case metrics.Timer:
+			rule, values := prometheusMetric(name)
+			snapshot := m.Snapshot()
+			percentiles := snapshot.Percentiles(prometheusQuantiles)
+			quantiles := make(map[float64]float64, len(prometheusQuantiles))
+			for i, quantile := range prometheusQuantiles {
+				quantiles[quantile] = percentiles[i] / float64(time.Second)
+			}
+			out <- prometheus.MustNewConstSummary(rule.desc(true), uint64(snapshot.Count()),
+				float64(snapshot.Sum())/float64(time.Second), quantiles, values...)
+		case metrics.Counter:
+			rule, values := prometheusMetric(name)
+			valueType := prometheus.UntypedValue
+			if rule.monotonic {
+				valueType = prometheus.CounterValue
+			}
+			out <- prometheus.MustNewConstMetric(rule.desc(false), valueType, float64(m.Count()), values...)
+		case metrics.Gauge:
+			desc := prometheus.NewDesc(prometheusGaugeName(name), "Gohan metric "+name, nil, nil)
+			out <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(m.Value()))
+		case metrics.GaugeFloat64:
+			desc := prometheus.NewDesc(prometheusGaugeName(name), "Gohan metric "+name, nil, nil)
+			out <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, m.Value())
+		}
+	})
+}
+
+func prometheusGaugeName(name string) string {
+	return prometheus.BuildFQName(prometheusNamespace, "", prometheusInvalidChars.ReplaceAllString(name, "_"))
+}
+
+func getPrometheusRegistry() *prometheus.Registry {
+	prometheusRegistryOnce.Do(func() {
+		prometheusRegistry = prometheus.NewRegistry()
+		prometheusRegistry.MustRegister(
+			&goMetricsCollector{registry: metrics.DefaultRegistry},
+			prometheus.NewGoCollector(),
+		)
+	})
+	return prometheusRegistry
+}
+
+func getPrometheusConfig(config *util.Config) *PrometheusConfig {
+	if !config.GetBool("metrics/prometheus/enabled", false) {
+		log.Debug("Prometheus endpoint disabled in config file")
+		return nil
+	}
+	return &PrometheusConfig{
+		Path:          config.GetString("metrics/prometheus/path", "/metrics"),
+		Authenticated: config.GetBool("metrics/prometheus/authenticated", false),
+	}
+}
+
+// GetPrometheusConfig returns config of the Prometheus endpoint or nil when it is disabled
+func GetPrometheusConfig() *PrometheusConfig {
+	if !monitoringEnabled {
+		return nil
+	}
+	return prometheusConfig
+}
+
+// PrometheusHandler returns handler serving runtime metrics in Prometheus text format
+func PrometheusHandler() http.Handler {
+	registry := getPrometheusRegistry()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		families, err := registry.Gather()
+		if err != nil {
+			log.Warning("Failed to gather metrics: %s", err)
+			if len(families) == 0 {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		encoder := expfmt.NewEncoder(w, format)
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				log.Warning("Failed to encode metrics: %s", err)
+				return
+			}
+		}
+	})
+}
@@ -8,6 +8,12 @@ if [[ $MYSQL_TEST == "true" ]]; then
   mysql -uroot -e "drop database if exists gohan_test; create database gohan_test;"
 fi
 
+if [[ $POSTGRES_TEST == "true" ]]; then
+  # set POSTGRES_TEST true if you want to run test against PostgreSQL.
+  # you need running postgres on local with gohan user (password gohan) for testing.
+  psql -U postgres -c "drop database if exists gohan_test;" -c "create database gohan_test owner gohan;"
+fi
+
 DATA_DIR=`mktemp -d 2>/dev/null || mktemp -d -t 'mytmpdir'`
 etcd -data-dir $DATA_DIR --listen-peer-urls http://:2380 --listen-client-urls http://:2379 --advertise-client-urls http://127.0.0.1:2379 &
 ETCD_PID=$!
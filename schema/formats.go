@@ -17,6 +17,7 @@ package schema
 
 import (
 	"net"
+	"net/url"
 	"regexp"
 	"strconv"
 
@@ -34,6 +35,8 @@ type nonHyphenatedUUIDFormatChecker struct{}
 type portFormatChecker struct{}
 type yamlFormatChecker struct{}
 type textFormatChecker struct{}
+type javascriptFormatChecker struct{}
+type urlFormatChecker struct{}
 
 func (f macFormatChecker) IsFormat(input string) bool {
 	match, _ := regexp.MatchString(`^([0-9A-Fa-f]{2}:){5}[0-9A-Fa-f]{2}$`, input)
@@ -84,6 +87,18 @@ func (f textFormatChecker) IsFormat(input string) bool {
 	return true
 }
 
+func (f javascriptFormatChecker) IsFormat(input string) bool {
+	return true
+}
+
+func (f urlFormatChecker) IsFormat(input string) bool {
+	if input == "" {
+		return true
+	}
+	u, err := url.Parse(input)
+	return err == nil && u.Scheme != ""
+}
+
 func registerGohanFormats(checkers gojsonschema.FormatCheckerChain) {
 	checkers.Add("mac", macFormatChecker{})
 	checkers.Add("cidr", cidrFormatChecker{})
@@ -95,4 +110,6 @@ func registerGohanFormats(checkers gojsonschema.FormatCheckerChain) {
 	checkers.Add("port", portFormatChecker{})
 	checkers.Add("yaml", yamlFormatChecker{})
 	checkers.Add("text", textFormatChecker{})
+	checkers.Add("javascript", javascriptFormatChecker{})
+	checkers.Add("url", urlFormatChecker{})
 }
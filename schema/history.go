@@ -0,0 +1,101 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+//HistorySchemaSuffix is appended to schema ID to get ID of the schema storing its revisions
+const HistorySchemaSuffix = "_revision"
+
+//History whether revisions of resources of this schema are recorded
+func (schema *Schema) History() bool {
+	history, _ := schema.Metadata["history"].(bool)
+	return history
+}
+
+//HistoryOf returns ID of the schema whose revisions are stored with this schema,
+//or an empty string when this is not a history schema
+func (schema *Schema) HistoryOf() string {
+	historyOf, _ := schema.Metadata["history_of"].(string)
+	return historyOf
+}
+
+//HistorySchemaID returns ID of the schema storing revisions of this schema
+func (schema *Schema) HistorySchemaID() string {
+	return schema.ID + HistorySchemaSuffix
+}
+
+//NewHistorySchema creates schema storing revisions of resources of the schema.
+//Revision records a snapshot of resource data after each change, or null once the resource is deleted.
+func NewHistorySchema(schema *Schema) (*Schema, error) {
+	id := schema.HistorySchemaID()
+	stringProperty := func(title string) map[string]interface{} {
+		return map[string]interface{}{"type": "string", "title": title, "description": title, "permission": []interface{}{}}
+	}
+	properties := map[string]interface{}{
+		"id":          stringProperty("ID"),
+		"resource_id": stringProperty("Resource ID"),
+		"revision": map[string]interface{}{
+			"type": "integer", "title": "Revision", "description": "Revision number", "permission": []interface{}{},
+		},
+		"action":     stringProperty("Action"),
+		"timestamp":  stringProperty("Timestamp"),
+		"request_id": stringProperty("Request ID"),
+		"tenant_id": map[string]interface{}{
+			"type": []interface{}{"string", "null"}, "title": "Tenant ID", "description": "Tenant ID", "permission": []interface{}{},
+		},
+		"data": map[string]interface{}{
+			"type": []interface{}{"object", "null"}, "title": "Data", "description": "Resource data", "permission": []interface{}{},
+		},
+	}
+	return newSchemaFromObj(map[string]interface{}{
+		"id":          id,
+		"singular":    id,
+		"plural":      id + "s",
+		"title":       schema.Title + " revision",
+		"description": "Revisions of " + schema.Title,
+		"metadata": map[string]interface{}{
+			"nosync":     true,
+			"history_of": schema.ID,
+		},
+		"schema": map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+			"propertiesOrder": []interface{}{
+				"id", "resource_id", "revision", "action", "timestamp", "request_id", "tenant_id", "data",
+			},
+			"indexes": map[string]interface{}{
+				id + "s_resource_revision": map[string]interface{}{
+					"columns": []interface{}{"resource_id", "revision"},
+					"type":    "unique",
+				},
+				id + "s_resource_timestamp": map[string]interface{}{
+					"columns": []interface{}{"resource_id", "timestamp"},
+				},
+			},
+		},
+	}, nil)
+}
+
+//registerHistorySchema registers schema storing revisions of the schema when its history is recorded
+func (manager *Manager) registerHistorySchema(schema *Schema) error {
+	if !schema.History() {
+		return nil
+	}
+	historySchema, err := NewHistorySchema(schema)
+	if err != nil {
+		return err
+	}
+	return manager.registerSchema(historySchema)
+}
@@ -3,6 +3,8 @@ package schema
 import (
 	"fmt"
 	"strings"
+
+	"github.com/cloudwan/gohan/util"
 )
 
 // Copyright (C) 2017 NTT Innovation Institute, Inc.
@@ -79,3 +81,27 @@ func NewIndexFromObj(name string, rawTypeData interface{}) (*Index, error) {
 	index := NewIndex(name, columns, indexType)
 	return &index, nil
 }
+
+//FullTextIndexes returns full-text indexes of the schema
+func (schema *Schema) FullTextIndexes() []Index {
+	indexes := []Index{}
+	for _, index := range schema.Indexes {
+		if index.Type == FullText {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+//SearchProperties returns IDs of properties covered by full-text indexes
+func (schema *Schema) SearchProperties() []string {
+	properties := []string{}
+	for _, index := range schema.FullTextIndexes() {
+		for _, column := range index.Columns {
+			if !util.ContainsString(properties, column) {
+				properties = append(properties, column)
+			}
+		}
+	}
+	return properties
+}
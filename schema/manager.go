@@ -44,7 +44,13 @@ type Manager struct {
 	TimeLimit   time.Duration         // default time limit for an extension
 	TimeLimits  []*PathEventTimeLimit // a list of exceptions for time limits
 	namespaces  map[string]*Namespace
+	roleGraph   *RoleGraph
 	mu          sync.RWMutex
+
+	// policies, extensions and namespaces loaded from the database, replaced on reload
+	storedPolicies   []*Policy
+	storedExtensions []*Extension
+	storedNamespaces []*Namespace
 }
 
 func (manager *Manager) String() string {
@@ -419,6 +425,9 @@ func (manager *Manager) loadSchemaFromFile(filePath string) error {
 			if err != nil {
 				return err
 			}
+			if err = manager.registerHistorySchema(schemaObj); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -458,49 +467,217 @@ func (manager *Manager) loadSchemaFromFile(filePath string) error {
 	return nil
 }
 
-//LoadPolicies register policy by db object
+//LoadPolicies register policy by db object.
+//Policies loaded previously from the database are replaced atomically,
+//so that the set is left untouched when any of the new policies is invalid.
 func (manager *Manager) LoadPolicies(policies []*Resource) error {
+	loaded, err := newPolicies(policies)
+	if err != nil {
+		return err
+	}
+
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
+	manager.replaceStoredPolicies(loaded)
+	return nil
+}
+
+func newPolicies(policies []*Resource) ([]*Policy, error) {
+	loaded := []*Policy{}
 	for _, policyData := range policies {
 		policy, err := NewPolicy(policyData.Data())
 		if err != nil {
-			return err
+			return nil, err
 		}
-		manager.policies = append(manager.policies, policy)
+		loaded = append(loaded, policy)
 	}
-	return nil
+	return loaded, nil
+}
+
+//replaceStoredPolicies has to be called with the mutex locked
+func (manager *Manager) replaceStoredPolicies(loaded []*Policy) {
+	result := []*Policy{}
+	for _, policy := range manager.policies {
+		if !containsPolicy(manager.storedPolicies, policy) {
+			result = append(result, policy)
+		}
+	}
+	manager.policies = append(result, loaded...)
+	manager.storedPolicies = loaded
+}
+
+func containsPolicy(policies []*Policy, policy *Policy) bool {
+	for _, p := range policies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
 }
 
-//LoadExtensions register extension by db object
+//LoadExtensions register extension by db object.
+//Extensions loaded previously from the database are replaced atomically.
 func (manager *Manager) LoadExtensions(extensions []*Resource) error {
+	loaded, err := newExtensions(extensions)
+	if err != nil {
+		return err
+	}
+
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
+	manager.Extensions = manager.extensionsWithStored(loaded)
+	manager.storedExtensions = loaded
+	return nil
+}
+
+func newExtensions(extensions []*Resource) ([]*Extension, error) {
+	loaded := []*Extension{}
 	for _, extensionData := range extensions {
 		extension, err := NewExtension(extensionData.Data())
 		if err != nil {
-			return err
+			return nil, err
 		}
-		manager.Extensions = append(manager.Extensions, extension)
+		loaded = append(loaded, extension)
 	}
-	return nil
+	return loaded, nil
 }
 
-//LoadNamespaces register namespaces by db object
+//extensionsWithStored returns extensions with the ones loaded previously from the database replaced;
+//it has to be called with the mutex locked
+func (manager *Manager) extensionsWithStored(loaded []*Extension) []*Extension {
+	result := []*Extension{}
+	for _, extension := range manager.Extensions {
+		if !containsExtension(manager.storedExtensions, extension) {
+			result = append(result, extension)
+		}
+	}
+	return append(result, loaded...)
+}
+
+func containsExtension(extensions []*Extension, extension *Extension) bool {
+	for _, e := range extensions {
+		if e == extension {
+			return true
+		}
+	}
+	return false
+}
+
+//LoadNamespaces register namespaces by db object.
+//Namespaces loaded previously from the database are replaced
+//unless a parent of any of the new namespaces is missing.
 func (manager *Manager) LoadNamespaces(namespaces []*Resource) error {
+	loaded, err := newNamespaces(namespaces)
+	if err != nil {
+		return err
+	}
+
 	manager.mu.Lock()
 	defer manager.mu.Unlock()
 
+	if err := manager.validateStoredNamespaces(loaded); err != nil {
+		return err
+	}
+	manager.replaceStoredNamespaces(loaded)
+	return nil
+}
+
+func newNamespaces(namespaces []*Resource) ([]*Namespace, error) {
+	loaded := []*Namespace{}
 	for _, namespaceData := range namespaces {
 		namespace, err := NewNamespace(namespaceData.Data())
 		if err != nil {
-			return err
+			return nil, err
+		}
+		loaded = append(loaded, namespace)
+	}
+	return loaded, nil
+}
+
+//validateStoredNamespaces checks that parents of namespaces replacing the stored ones exist;
+//it has to be called with the mutex locked
+func (manager *Manager) validateStoredNamespaces(loaded []*Namespace) error {
+	available := map[string]bool{}
+	for id, namespace := range manager.namespaces {
+		available[id] = !containsNamespace(manager.storedNamespaces, namespace)
+	}
+	for _, namespace := range loaded {
+		if namespace.Parent != "" && !available[namespace.Parent] {
+			return fmt.Errorf("Parent namespace %s of %s not found", namespace.Parent, namespace.ID)
 		}
+		available[namespace.ID] = true
+	}
+	return nil
+}
+
+//replaceStoredNamespaces has to be called with the mutex locked, after validateStoredNamespaces
+func (manager *Manager) replaceStoredNamespaces(loaded []*Namespace) {
+	for _, namespace := range manager.storedNamespaces {
+		if manager.namespaces[namespace.ID] == namespace {
+			delete(manager.namespaces, namespace.ID)
+		}
+	}
+	for _, namespace := range loaded {
 		manager.registerNamespace(namespace)
 	}
+	manager.storedNamespaces = loaded
+}
 
+func containsNamespace(namespaces []*Namespace, namespace *Namespace) bool {
+	for _, n := range namespaces {
+		if n == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+//StoredConfig holds policies, extensions and namespaces stored in the database
+type StoredConfig struct {
+	Policies   []*Policy
+	Extensions []*Extension
+	Namespaces []*Namespace
+}
+
+//NewStoredConfig parses policies, extensions and namespaces stored in the database
+func NewStoredConfig(policies, extensions, namespaces []*Resource) (*StoredConfig, error) {
+	config := &StoredConfig{}
+	var err error
+	if config.Policies, err = newPolicies(policies); err != nil {
+		return nil, fmt.Errorf("failed to load policies: %s", err)
+	}
+	if config.Extensions, err = newExtensions(extensions); err != nil {
+		return nil, fmt.Errorf("failed to load extensions: %s", err)
+	}
+	if config.Namespaces, err = newNamespaces(namespaces); err != nil {
+		return nil, fmt.Errorf("failed to load namespaces: %s", err)
+	}
+	return config, nil
+}
+
+//StoredConfigExtensions returns extensions the manager will have once the stored config is replaced,
+//so that extension environments can be built before the replacement
+func (manager *Manager) StoredConfigExtensions(config *StoredConfig) []*Extension {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.extensionsWithStored(config.Extensions)
+}
+
+//ReplaceStoredConfig replaces policies, extensions and namespaces loaded from the database previously.
+//Nothing is replaced when a parent of any of the namespaces is missing.
+func (manager *Manager) ReplaceStoredConfig(config *StoredConfig) error {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if err := manager.validateStoredNamespaces(config.Namespaces); err != nil {
+		return err
+	}
+	manager.replaceStoredPolicies(config.Policies)
+	manager.Extensions = manager.extensionsWithStored(config.Extensions)
+	manager.storedExtensions = config.Extensions
+	manager.replaceStoredNamespaces(config.Namespaces)
 	return nil
 }
 
@@ -539,7 +716,10 @@ func ClearManager() {
 
 //PolicyValidate API request using policy statements
 func (manager *Manager) PolicyValidate(action, path string, auth Authorization) (*Policy, *Role) {
-	return PolicyValidate(action, path, auth, manager.policies)
+	manager.mu.RLock()
+	policies := manager.policies
+	manager.mu.RUnlock()
+	return PolicyValidate(action, path, auth, policies)
 }
 
 //NobodyResourcePaths returns a list of paths that do not require authorization
@@ -18,6 +18,7 @@ package schema
 import (
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/cloudwan/gohan/util"
 )
@@ -37,6 +38,7 @@ const (
 	conditionIsOwner       = "is_owner"
 	conditionTypeBelongsTo = "belongs_to"
 	conditionProperty      = "property"
+	conditionExpression    = "expression"
 
 	globalRegexp = ".*"
 
@@ -83,6 +85,7 @@ type Policy struct {
 	requireOwner                               bool
 	actionTenantFilter                         map[string][]Tenant
 	actionPropertyConditionFilter              map[string][]map[string]interface{}
+	actionExpressionConditionFilter            map[string][]*PolicyExpression
 }
 
 //ResourcePolicy describes target resources
@@ -100,8 +103,49 @@ type Authorization interface {
 	Catalog() []*Catalog
 }
 
+//UserAuthorization is implemented by authorizations which know the authenticated user
+type UserAuthorization interface {
+	Authorization
+	UserID() string
+}
+
+//UserIDOf returns ID of the authenticated user or empty string when it isn't known
+func UserIDOf(auth Authorization) string {
+	if userAuth, ok := auth.(UserAuthorization); ok {
+		return userAuth.UserID()
+	}
+	return ""
+}
+
+//IssuedAuthorization is implemented by authorizations which know when their credentials were issued
+type IssuedAuthorization interface {
+	Authorization
+	IssuedAt() time.Time
+}
+
+//IssuedAtOf returns time the credentials of the authorization were issued or zero time when it isn't known
+func IssuedAtOf(auth Authorization) time.Time {
+	if issuedAuth, ok := auth.(IssuedAuthorization); ok {
+		return issuedAuth.IssuedAt()
+	}
+	return time.Time{}
+}
+
+//WithIssuedAt returns copy of the authorization whose credentials were issued at the given time
+func WithIssuedAt(auth Authorization, issuedAt time.Time) Authorization {
+	baseAuth, ok := auth.(*BaseAuthorization)
+	if !ok {
+		return auth
+	}
+	issuedAuth := *baseAuth
+	issuedAuth.issuedAt = issuedAt
+	return &issuedAuth
+}
+
 //BaseAuthorization is base struct for Authorization
 type BaseAuthorization struct {
+	userID     string
+	issuedAt   time.Time
 	tenantID   string
 	tenantName string
 	authToken  string
@@ -124,6 +168,23 @@ func NewAuthorization(tenantID, tenantName, authToken string, roleIDs []string,
 	}
 }
 
+//NewUserAuthorization is a constructor for auth info of the known user
+func NewUserAuthorization(userID, tenantID, tenantName, authToken string, roleIDs []string, catalog []*Catalog) Authorization {
+	auth := NewAuthorization(tenantID, tenantName, authToken, roleIDs, catalog).(*BaseAuthorization)
+	auth.userID = userID
+	return auth
+}
+
+//UserID returns ID of the authorized user
+func (auth *BaseAuthorization) UserID() string {
+	return auth.userID
+}
+
+//IssuedAt returns time the credentials were issued or zero time when it isn't known
+func (auth *BaseAuthorization) IssuedAt() time.Time {
+	return auth.issuedAt
+}
+
 //Roles returns authorized roles
 func (auth *BaseAuthorization) Roles() []*Role {
 	return auth.roles
@@ -178,9 +239,13 @@ func NewCatalog(name, catalogType string, endPoints []*Endpoint) *Catalog {
 	return &Catalog{Name: name, Type: catalogType, Endpoints: endPoints}
 }
 
-//Match checks if this role is for this principal
+//Match checks if this role is for this principal,
+//either directly or through role hierarchy and aliases of the manager
 func (r *Role) Match(principal string) bool {
-	return r.Name == principal
+	if r.Name == principal {
+		return true
+	}
+	return GetManager().RoleGraph().Implies(r.Name, principal)
 }
 
 //NewPolicy returns new policy from object
@@ -236,6 +301,7 @@ func NewPolicy(raw interface{}) (*Policy, error) {
 func (p *Policy) precomputeConditions() error {
 	p.actionTenantFilter = map[string][]Tenant{}
 	p.actionPropertyConditionFilter = map[string][]map[string]interface{}{}
+	p.actionExpressionConditionFilter = map[string][]*PolicyExpression{}
 	for _, condition := range p.Condition {
 		switch condition.(type) {
 		case string:
@@ -284,6 +350,22 @@ func (p *Policy) precomputeConditions() error {
 				for _, action := range actions {
 					p.AddPropertyConditionFilter(action, match)
 				}
+			case conditionExpression:
+				actions := AllActions
+				if action, ok := conditionObject["action"]; ok && action != ActionGlob {
+					actions = []string{action.(string)}
+				}
+				source, ok := conditionObject["expression"].(string)
+				if !ok {
+					return fmt.Errorf("expression should be string")
+				}
+				expression, err := CompilePolicyExpression(source)
+				if err != nil {
+					return fmt.Errorf("%s for policy '%s'", err, p.ID)
+				}
+				for _, action := range actions {
+					p.AddExpressionConditionFilter(action, expression)
+				}
 			default:
 				return fmt.Errorf("Unknown condition type '%s' for policy '%s'", conditionObject["type"], p.ID)
 			}
@@ -399,15 +481,8 @@ func contains(list []interface{}, key string) bool {
 
 //Check ...
 func (p *Policy) Check(action string, authorization Authorization, data map[string]interface{}) error {
-	if p.RequireOwner() {
-		ownerID, _ := data["tenant_id"].(string)
-		ownerName, _ := data["tenant_name"].(string)
-		owner := newTenant(ownerID, ownerName)
-		caller := newTenant(authorization.TenantID(), authorization.TenantName())
-
-		if caller.notEqual(owner) && !p.isTenantAllowed(action, owner, caller) {
-			return fmt.Errorf("Tenant '%s' is prohibited from operating on resources of tenant '%s'", caller, owner)
-		}
+	if err := p.checkOwner(action, authorization, data); err != nil {
+		return err
 	}
 
 	properties := p.Resource.Properties
@@ -427,6 +502,21 @@ func (p *Policy) Check(action string, authorization Authorization, data map[stri
 	return nil
 }
 
+func (p *Policy) checkOwner(action string, authorization Authorization, data map[string]interface{}) error {
+	if !p.RequireOwner() {
+		return nil
+	}
+	ownerID, _ := data["tenant_id"].(string)
+	ownerName, _ := data["tenant_name"].(string)
+	owner := newTenant(ownerID, ownerName)
+	caller := newTenant(authorization.TenantID(), authorization.TenantName())
+
+	if caller.notEqual(owner) && !p.isTenantAllowed(action, owner, caller) {
+		return fmt.Errorf("Tenant '%s' is prohibited from operating on resources of tenant '%s'", caller, owner)
+	}
+	return nil
+}
+
 // AddTenantToFilter adds tenant to filter for given action
 func (p *Policy) AddTenantToFilter(action string, tenant Tenant) {
 	p.actionTenantFilter[action] = append(p.actionTenantFilter[action], tenant)
@@ -494,6 +584,52 @@ FilterLoop:
 	return nil
 }
 
+// AddExpressionConditionFilter adds expression based filter for action
+func (p *Policy) AddExpressionConditionFilter(action string, expression *PolicyExpression) {
+	p.actionExpressionConditionFilter[action] = append(p.actionExpressionConditionFilter[action], expression)
+}
+
+// ApplyExpressionConditionFilter applies filter based on expressions.
+// Expressions are evaluated against the resource data, the update candidate
+// (nil unless it's update API) and the authorization of the caller.
+// Let's say we would like to allow members to update only small volumes
+// and nobody to delete active ones. We can define these policies like this.
+//
+//   - action: 'update'
+//     condition:
+//     - type: expression
+//       expression: "resource.size < 100 and has_role('Member')"
+//     effect: allow
+//     id: member
+//     principal: Member
+//   - action: '*'
+//     condition:
+//     - type: expression
+//       action: delete
+//       expression: "resource.status != 'ACTIVE'"
+//     effect: allow
+//     id: admin
+//     principal: admin
+//
+// This policy check error in case any expression for the action doesn't hold
+func (p *Policy) ApplyExpressionConditionFilter(action string, auth Authorization, data map[string]interface{}, updateCandidateData map[string]interface{}) error {
+	for _, expression := range p.actionExpressionConditionFilter[action] {
+		ok, err := expression.Evaluate(data, updateCandidateData, auth)
+		if err != nil {
+			return fmt.Errorf("Rejected by expression condition '%s': %s", expression, err)
+		}
+		if !ok {
+			return fmt.Errorf("Rejected by expression condition '%s'", expression)
+		}
+	}
+	return nil
+}
+
+// HasConditionFilter checks if resources are filtered by property or expression conditions for action
+func (p *Policy) HasConditionFilter(action string) bool {
+	return len(p.actionPropertyConditionFilter[action]) > 0 || len(p.actionExpressionConditionFilter[action]) > 0
+}
+
 // GetTenantIDFilter returns tenants filter for the action performed by the tenant
 func (p *Policy) GetTenantIDFilter(action string, tenantID string) []string {
 	if !p.requireOwner {
@@ -0,0 +1,142 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import "fmt"
+
+//PolicyExplanation describes how policies were evaluated for an action
+type PolicyExplanation struct {
+	Action   string              `json:"action"`
+	Path     string              `json:"path"`
+	Allowed  bool                `json:"allowed"`
+	PolicyID string              `json:"policy_id,omitempty"`
+	Reason   string              `json:"reason,omitempty"`
+	Policies []*PolicyEvaluation `json:"policies"`
+}
+
+//PolicyEvaluation describes whether a single policy matched
+type PolicyEvaluation struct {
+	ID        string `json:"id"`
+	Principal string `json:"principal"`
+	Action    string `json:"action"`
+	Effect    string `json:"effect,omitempty"`
+	Matched   bool   `json:"matched"`
+	Selected  bool   `json:"selected"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+//explainMatch returns why the policy doesn't match, or empty string when it does
+func (p *Policy) explainMatch(action, path string, auth Authorization) string {
+	if p.Action != "*" && action != p.Action {
+		return fmt.Sprintf("Action '%s' doesn't match '%s'", action, p.Action)
+	}
+	if !p.Resource.Path.MatchString(path) {
+		return fmt.Sprintf("Path '%s' doesn't match '%s'", path, p.Resource.Path)
+	}
+	if !p.TenantID.MatchString(auth.TenantID()) {
+		return fmt.Sprintf("Tenant ID '%s' doesn't match '%s'", auth.TenantID(), p.TenantID)
+	}
+	if !p.TenantName.MatchString(auth.TenantName()) {
+		return fmt.Sprintf("Tenant name '%s' doesn't match '%s'", auth.TenantName(), p.TenantName)
+	}
+	if p.match(action, path, auth) == nil {
+		return fmt.Sprintf("No role matches principal '%s'", p.Principal)
+	}
+	return ""
+}
+
+//ExplainPolicy evaluates policies the same way as API requests do and reports every policy considered.
+//When resource data is given, conditions and properties of the selected policy are checked against it;
+//update candidate is used for update action only.
+func ExplainPolicy(action, path string, auth Authorization, policies []*Policy,
+	data, updateCandidateData map[string]interface{}) *PolicyExplanation {
+	explanation := &PolicyExplanation{Action: action, Path: path, Policies: []*PolicyEvaluation{}}
+	var selected *Policy
+	for _, policy := range policies {
+		evaluation := &PolicyEvaluation{
+			ID:        policy.ID,
+			Principal: policy.Principal,
+			Action:    policy.Action,
+			Effect:    policy.Effect,
+			Reason:    policy.explainMatch(action, path, auth),
+		}
+		evaluation.Matched = evaluation.Reason == ""
+		if evaluation.Matched {
+			if selected == nil {
+				selected = policy
+				evaluation.Selected = true
+			} else {
+				evaluation.Reason = fmt.Sprintf("Shadowed by policy '%s'", selected.ID)
+			}
+		}
+		explanation.Policies = append(explanation.Policies, evaluation)
+	}
+	if selected == nil {
+		explanation.Reason = "No matching policy"
+		return explanation
+	}
+	explanation.PolicyID = selected.ID
+	if data != nil {
+		if err := selected.explainConditions(action, auth, data, updateCandidateData); err != nil {
+			explanation.Reason = err.Error()
+			return explanation
+		}
+	}
+	explanation.Allowed = true
+	return explanation
+}
+
+//explainConditions checks the resource data with the same checks as API requests
+func (p *Policy) explainConditions(action string, auth Authorization,
+	data, updateCandidateData map[string]interface{}) error {
+	if action != ActionUpdate {
+		updateCandidateData = nil
+	}
+	switch action {
+	case ActionCreate:
+		if err := p.Check(action, auth, data); err != nil {
+			return err
+		}
+	case ActionUpdate:
+		if err := p.checkOwner(action, auth, data); err != nil {
+			return err
+		}
+		if updateCandidateData != nil {
+			if err := p.Check(action, auth, updateCandidateData); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := p.checkOwner(action, auth, data); err != nil {
+			return err
+		}
+	}
+	propertyAction := action
+	if action == ActionDelete {
+		//delete API applies property conditions of update action
+		propertyAction = ActionUpdate
+	}
+	if err := p.ApplyPropertyConditionFilter(propertyAction, data, updateCandidateData); err != nil {
+		return err
+	}
+	return p.ApplyExpressionConditionFilter(action, auth, data, updateCandidateData)
+}
+
+//ExplainPolicy explains policy evaluation with policies of the manager
+func (manager *Manager) ExplainPolicy(action, path string, auth Authorization,
+	data, updateCandidateData map[string]interface{}) *PolicyExplanation {
+	return ExplainPolicy(action, path, auth, manager.Policies(), data, updateCandidateData)
+}
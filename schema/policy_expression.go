@@ -0,0 +1,614 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//PolicyExpression is a compiled condition expression.
+//Expressions can only read the resource, the update candidate and the authorization,
+//so they are safe to evaluate on every request.
+//
+//Supported syntax:
+//  - literals: 'string', "string", numbers, true, false, null and lists [1, 2]
+//  - variables: resource.<property>, update.<property>, auth.tenant_id, auth.tenant_name,
+//    auth.user_id, auth.roles and auth.catalog; nested properties are accessed with dots
+//  - operators: ==, !=, <, <=, >, >=, in, not in, and (&&), or (||), not (!) and parentheses
+//  - functions: has_role(name), has_service(name or type), len(value)
+type PolicyExpression struct {
+	source string
+	root   expressionNode
+}
+
+type expressionEnv struct {
+	resource map[string]interface{}
+	update   map[string]interface{}
+	auth     Authorization
+}
+
+type expressionNode func(env *expressionEnv) (interface{}, error)
+
+//CompilePolicyExpression parses the expression
+func CompilePolicyExpression(source string) (*PolicyExpression, error) {
+	tokens, err := tokenizeExpression(source)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression '%s': %s", source, err)
+	}
+	parser := &expressionParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err == nil && !parser.done() {
+		err = fmt.Errorf("unexpected '%s'", parser.peek().value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid expression '%s': %s", source, err)
+	}
+	return &PolicyExpression{source: source, root: root}, nil
+}
+
+//String returns source of the expression
+func (e *PolicyExpression) String() string {
+	return e.source
+}
+
+//Evaluate checks whether the expression holds for the resource, the update candidate and the authorization.
+//Update candidate and authorization may be nil.
+func (e *PolicyExpression) Evaluate(resource, update map[string]interface{}, auth Authorization) (bool, error) {
+	value, err := e.root(&expressionEnv{resource: resource, update: update, auth: auth})
+	if err != nil {
+		return false, err
+	}
+	return truth(value)
+}
+
+const (
+	tokenIdentifier = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type expressionToken struct {
+	kind  int
+	value string
+}
+
+var expressionOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "(", ")", "[", "]", ",", "."}
+
+func tokenizeExpression(source string) ([]expressionToken, error) {
+	tokens := []expressionToken{}
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, expressionToken{tokenIdentifier, string(runes[start:i])})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, expressionToken{tokenNumber, string(runes[start:i])})
+		case r == '\'' || r == '"':
+			value := []rune{}
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value = append(value, runes[i])
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			i++
+			tokens = append(tokens, expressionToken{tokenString, string(value)})
+		default:
+			operator := ""
+			for _, candidate := range expressionOperators {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character '%c'", r)
+			}
+			i += len([]rune(operator))
+			tokens = append(tokens, expressionToken{tokenOperator, operator})
+		}
+	}
+	return tokens, nil
+}
+
+type expressionParser struct {
+	tokens   []expressionToken
+	position int
+}
+
+func (p *expressionParser) done() bool {
+	return p.position >= len(p.tokens)
+}
+
+func (p *expressionParser) peek() expressionToken {
+	if p.done() {
+		return expressionToken{}
+	}
+	return p.tokens[p.position]
+}
+
+func (p *expressionParser) peekIs(values ...string) bool {
+	token := p.peek()
+	if token.kind != tokenOperator && token.kind != tokenIdentifier {
+		return false
+	}
+	for _, value := range values {
+		if token.value == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *expressionParser) expect(value string) error {
+	if !p.peekIs(value) {
+		if p.done() {
+			return fmt.Errorf("expected '%s' at the end", value)
+		}
+		return fmt.Errorf("expected '%s', got '%s'", value, p.peek().value)
+	}
+	p.position++
+	return nil
+}
+
+func (p *expressionParser) parseOr() (expressionNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs("or", "||") {
+		p.position++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode(left, right, true)
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (expressionNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekIs("and", "&&") {
+		p.position++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = logicalNode(left, right, false)
+	}
+	return left, nil
+}
+
+//logicalNode evaluates right operand only when left one doesn't decide the result
+func logicalNode(left, right expressionNode, or bool) expressionNode {
+	return func(env *expressionEnv) (interface{}, error) {
+		value, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		result, err := truth(value)
+		if err != nil || result == or {
+			return result, err
+		}
+		value, err = right(env)
+		if err != nil {
+			return nil, err
+		}
+		return truth(value)
+	}
+}
+
+func (p *expressionParser) parseNot() (expressionNode, error) {
+	if !p.peekIs("not", "!") {
+		return p.parseComparison()
+	}
+	p.position++
+	operand, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return func(env *expressionEnv) (interface{}, error) {
+		value, err := operand(env)
+		if err != nil {
+			return nil, err
+		}
+		result, err := truth(value)
+		return !result, err
+	}, nil
+}
+
+func (p *expressionParser) parseComparison() (expressionNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekIs("==", "!=", "<", "<=", ">", ">=", "in", "not") {
+		return left, nil
+	}
+	operator := p.peek().value
+	p.position++
+	if operator == "not" {
+		if err := p.expect("in"); err != nil {
+			return nil, err
+		}
+		operator = "not in"
+	}
+	right, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return func(env *expressionEnv) (interface{}, error) {
+		leftValue, err := left(env)
+		if err != nil {
+			return nil, err
+		}
+		rightValue, err := right(env)
+		if err != nil {
+			return nil, err
+		}
+		return compare(operator, leftValue, rightValue)
+	}, nil
+}
+
+func (p *expressionParser) parsePrimary() (expressionNode, error) {
+	if p.done() {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	token := p.tokens[p.position]
+	p.position++
+	switch token.kind {
+	case tokenNumber:
+		number, err := strconv.ParseFloat(token.value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", token.value)
+		}
+		return constantNode(number), nil
+	case tokenString:
+		return constantNode(token.value), nil
+	case tokenOperator:
+		switch token.value {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			return p.parseList()
+		}
+		return nil, fmt.Errorf("unexpected '%s'", token.value)
+	}
+	switch token.value {
+	case "true":
+		return constantNode(true), nil
+	case "false":
+		return constantNode(false), nil
+	case "null":
+		return constantNode(nil), nil
+	case "resource", "update", "auth":
+		return p.parseVariable(token.value)
+	}
+	if function, ok := expressionFunctions[token.value]; ok {
+		return p.parseCall(token.value, function)
+	}
+	return nil, fmt.Errorf("unknown identifier '%s'", token.value)
+}
+
+func constantNode(value interface{}) expressionNode {
+	return func(*expressionEnv) (interface{}, error) {
+		return value, nil
+	}
+}
+
+func (p *expressionParser) parseList() (expressionNode, error) {
+	items := []expressionNode{}
+	for !p.peekIs("]") {
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		item, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	p.position++
+	return func(env *expressionEnv) (interface{}, error) {
+		result := []interface{}{}
+		for _, item := range items {
+			value, err := item(env)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, value)
+		}
+		return result, nil
+	}, nil
+}
+
+func (p *expressionParser) parseVariable(root string) (expressionNode, error) {
+	path := []string{}
+	for p.peekIs(".") {
+		p.position++
+		token := p.peek()
+		if token.kind != tokenIdentifier {
+			return nil, fmt.Errorf("expected property name after '%s'", strings.Join(append([]string{root}, path...), "."))
+		}
+		p.position++
+		path = append(path, token.value)
+	}
+	if root == "auth" {
+		if len(path) == 0 {
+			return nil, fmt.Errorf("auth property is required")
+		}
+		if _, ok := authProperties[path[0]]; !ok {
+			return nil, fmt.Errorf("unknown auth property '%s'", path[0])
+		}
+	}
+	return func(env *expressionEnv) (interface{}, error) {
+		var value interface{}
+		switch root {
+		case "resource":
+			value = env.resource
+		case "update":
+			value = env.update
+		case "auth":
+			if env.auth == nil {
+				return nil, nil
+			}
+			return lookup(authProperties[path[0]](env.auth), path[1:]), nil
+		}
+		return lookup(value, path), nil
+	}, nil
+}
+
+//lookup returns nested property of the value or nil when it doesn't exist
+func lookup(value interface{}, path []string) interface{} {
+	for _, key := range path {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+var authProperties = map[string]func(auth Authorization) interface{}{
+	"tenant_id":   func(auth Authorization) interface{} { return auth.TenantID() },
+	"tenant_name": func(auth Authorization) interface{} { return auth.TenantName() },
+	"user_id":     func(auth Authorization) interface{} { return UserIDOf(auth) },
+	"roles": func(auth Authorization) interface{} {
+		roles := []interface{}{}
+		for _, role := range auth.Roles() {
+			roles = append(roles, role.Name)
+		}
+		return roles
+	},
+	"catalog": func(auth Authorization) interface{} {
+		catalog := []interface{}{}
+		for _, service := range auth.Catalog() {
+			catalog = append(catalog, map[string]interface{}{"name": service.Name, "type": service.Type})
+		}
+		return catalog
+	},
+}
+
+type expressionFunction struct {
+	arguments int
+	call      func(env *expressionEnv, arguments []interface{}) (interface{}, error)
+}
+
+var expressionFunctions = map[string]expressionFunction{
+	"has_role": {1, func(env *expressionEnv, arguments []interface{}) (interface{}, error) {
+		if env.auth == nil {
+			return false, nil
+		}
+		for _, role := range env.auth.Roles() {
+			if role.Match(fmt.Sprint(arguments[0])) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}},
+	"has_service": {1, func(env *expressionEnv, arguments []interface{}) (interface{}, error) {
+		if env.auth == nil {
+			return false, nil
+		}
+		name := fmt.Sprint(arguments[0])
+		for _, service := range env.auth.Catalog() {
+			if service.Name == name || service.Type == name {
+				return true, nil
+			}
+		}
+		return false, nil
+	}},
+	"len": {1, func(env *expressionEnv, arguments []interface{}) (interface{}, error) {
+		switch value := arguments[0].(type) {
+		case nil:
+			return float64(0), nil
+		case string:
+			return float64(len([]rune(value))), nil
+		}
+		reflected := reflect.ValueOf(arguments[0])
+		switch reflected.Kind() {
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return float64(reflected.Len()), nil
+		}
+		return nil, fmt.Errorf("len isn't defined for %T", arguments[0])
+	}},
+}
+
+func (p *expressionParser) parseCall(name string, function expressionFunction) (expressionNode, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arguments := []expressionNode{}
+	for !p.peekIs(")") {
+		if len(arguments) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		argument, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, argument)
+	}
+	p.position++
+	if len(arguments) != function.arguments {
+		return nil, fmt.Errorf("%s takes %d argument(s), %d given", name, function.arguments, len(arguments))
+	}
+	return func(env *expressionEnv) (interface{}, error) {
+		values := []interface{}{}
+		for _, argument := range arguments {
+			value, err := argument(env)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return function.call(env, values)
+	}, nil
+}
+
+//truth converts value to boolean; missing values are false
+func truth(value interface{}) (bool, error) {
+	switch value := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return value, nil
+	}
+	return false, fmt.Errorf("%v is not a boolean", value)
+}
+
+//toNumber converts numeric values to float64
+func toNumber(value interface{}) (float64, bool) {
+	reflected := reflect.ValueOf(value)
+	switch reflected.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(reflected.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(reflected.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return reflected.Float(), true
+	}
+	return 0, false
+}
+
+func equal(left, right interface{}) bool {
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	if leftOk && rightOk {
+		return leftNumber == rightNumber
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func contained(item, collection interface{}) (bool, error) {
+	switch collection := collection.(type) {
+	case nil:
+		return false, nil
+	case string:
+		itemString, ok := item.(string)
+		if !ok {
+			return false, fmt.Errorf("%v can't be searched in a string", item)
+		}
+		return strings.Contains(collection, itemString), nil
+	case map[string]interface{}:
+		_, ok := collection[fmt.Sprint(item)]
+		return ok, nil
+	}
+	reflected := reflect.ValueOf(collection)
+	if reflected.Kind() != reflect.Slice && reflected.Kind() != reflect.Array {
+		return false, fmt.Errorf("in isn't defined for %T", collection)
+	}
+	for i := 0; i < reflected.Len(); i++ {
+		if equal(item, reflected.Index(i).Interface()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func compare(operator string, left, right interface{}) (interface{}, error) {
+	switch operator {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "in":
+		return contained(left, right)
+	case "not in":
+		result, err := contained(left, right)
+		return !result, err
+	}
+	var order int
+	leftNumber, leftOk := toNumber(left)
+	rightNumber, rightOk := toNumber(right)
+	leftString, leftStringOk := left.(string)
+	rightString, rightStringOk := right.(string)
+	switch {
+	case leftOk && rightOk:
+		if leftNumber < rightNumber {
+			order = -1
+		} else if leftNumber > rightNumber {
+			order = 1
+		}
+	case leftStringOk && rightStringOk:
+		order = strings.Compare(leftString, rightString)
+	default:
+		return nil, fmt.Errorf("can't compare %v and %v", left, right)
+	}
+	switch operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
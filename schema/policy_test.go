@@ -72,6 +72,75 @@ var _ = Describe("Policies", func() {
 			Expect(memberPolicy).To(BeNil(), "Member should not be allowed to touch subnet %v", memberPolicy)
 			Expect(role).To(BeNil())
 		})
+
+		It("honors role hierarchy and aliases", func() {
+			graph, err := NewRoleGraph(map[string][]string{
+				"superuser": {"operator"},
+				"operator":  {"admin"},
+			}, map[string]string{"_member_": "Member"})
+			Expect(err).ToNot(HaveOccurred())
+			manager.SetRoleGraph(graph)
+
+			superuserAuth := NewAuthorization(adminTenantID, "admin", "fake_token", []string{"superuser"}, nil)
+			policy, role := manager.PolicyValidate("create", "/v2.0/networks", superuserAuth)
+			Expect(policy).NotTo(BeNil())
+			Expect(policy.RequireOwner()).To(BeFalse())
+			Expect(role.Match("admin")).To(BeTrue())
+
+			aliasAuth := NewAuthorization(demoTenantID, "demo", "fake_token", []string{"_member_"}, nil)
+			policy, role = manager.PolicyValidate("create", "/v2.0/networks/red", aliasAuth)
+			Expect(policy).NotTo(BeNil())
+			Expect(policy.RequireOwner()).To(BeTrue())
+			Expect(role.Match("admin")).To(BeFalse())
+		})
+
+		It("rejects cycles in role hierarchy", func() {
+			_, err := NewRoleGraph(map[string][]string{
+				"admin":    {"operator"},
+				"operator": {"viewer"},
+				"viewer":   {"admin"},
+			}, nil)
+			Expect(err).To(MatchError(ContainSubstring("Cycle in role hierarchy")))
+
+			_, err = NewRoleGraphFromConfig(map[string]interface{}{
+				"hierarchy": map[string]interface{}{"Member": []interface{}{"_member_"}},
+				"aliases":   map[string]interface{}{"_member_": "Member"},
+			})
+			Expect(err).To(MatchError("Cycle in role hierarchy: Member -> Member"))
+		})
+
+		It("explains policy evaluation", func() {
+			explanation := manager.ExplainPolicy("create", "/v2.0/network/test1/subnets", memberAuth, nil, nil)
+			Expect(explanation.Allowed).To(BeFalse())
+			Expect(explanation.Reason).To(Equal("No matching policy"))
+			Expect(explanation.Policies).To(HaveLen(len(manager.Policies())))
+			Expect(explanation.Policies[0].Reason).To(Equal("No role matches principal 'admin'"))
+
+			explanation = manager.ExplainPolicy("update", "/v2.0/networks/red", memberAuth,
+				map[string]interface{}{"tenant_id": adminTenantID}, map[string]interface{}{"name": "blue"})
+			Expect(explanation.Allowed).To(BeFalse())
+			Expect(explanation.PolicyID).To(Equal("member_statement"))
+			Expect(explanation.Reason).To(ContainSubstring("is prohibited from operating on resources of tenant"))
+
+			explanation = manager.ExplainPolicy("update", "/v2.0/networks/red", memberAuth,
+				map[string]interface{}{"tenant_id": demoTenantID}, map[string]interface{}{"shared": true})
+			Expect(explanation.Allowed).To(BeFalse())
+			Expect(explanation.Reason).To(Equal("shared is prohibited for this user"))
+
+			explanation = manager.ExplainPolicy("update", "/v2.0/networks/red", memberAuth,
+				map[string]interface{}{"tenant_id": demoTenantID}, map[string]interface{}{"name": "blue"})
+			Expect(explanation.Allowed).To(BeTrue())
+			selected := 0
+			for _, evaluation := range explanation.Policies {
+				if evaluation.Selected {
+					selected++
+					Expect(evaluation.ID).To(Equal("member_statement"))
+				} else if evaluation.Matched {
+					Expect(evaluation.Reason).To(Equal("Shadowed by policy 'member_statement'"))
+				}
+			}
+			Expect(selected).To(Equal(1))
+		})
 	})
 
 	Describe("Creation", func() {
@@ -157,6 +226,20 @@ var _ = Describe("Policies", func() {
 			Expect(policy.GetTenantIDFilter("update", "xyz")).To(ConsistOf("xyz", "acf5662bbff44060b93ac3db3c25a590"))
 			Expect(policy.GetTenantIDFilter("delete", "xyz")).To(ConsistOf("xyz", "acf5662bbff44060b93ac3db3c25a590"))
 		})
+
+		It("tests condition filters of actions", func() {
+			testPolicy["condition"] = []interface{}{
+				map[string]interface{}{
+					"action": "read",
+					"type":   "property",
+					"match":  map[string]interface{}{"status": "ACTIVE"},
+				},
+			}
+			policy, err := NewPolicy(testPolicy)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(policy.HasConditionFilter("read")).To(BeTrue())
+			Expect(policy.HasConditionFilter("update")).To(BeFalse())
+		})
 	})
 
 	Describe("Tenants", func() {
@@ -414,6 +497,101 @@ var _ = Describe("Policies", func() {
 				Expect(policy.ApplyPropertyConditionFilter("read", map[string]interface{}{}, nil)).NotTo(Succeed())
 			})
 		})
+
+		Describe("Expression based condition", func() {
+			var auth Authorization
+
+			BeforeEach(func() {
+				auth = NewUserAuthorization("user", "tenant", "tenantName", "", []string{"Member", "viewer"},
+					[]*Catalog{NewCatalog("nova", "compute", nil)})
+			})
+
+			It("should reject invalid expressions", func() {
+				for _, expression := range []string{"resource.size <", "unknown == 1", "auth.password == ''", "has_role()", "'abc"} {
+					testPolicy["condition"] = []interface{}{
+						map[string]interface{}{"type": "expression", "expression": expression},
+					}
+					_, err := NewPolicy(testPolicy)
+					Expect(err).To(MatchError(ContainSubstring("Invalid expression '%s'", expression)))
+				}
+			})
+
+			It("should work with expressions for given actions", func() {
+				testPolicy["condition"] = []interface{}{
+					map[string]interface{}{
+						"type":       "expression",
+						"action":     "update",
+						"expression": "resource.size < 100 and update.size <= 100 and has_role('Member')",
+					},
+					map[string]interface{}{
+						"type":       "expression",
+						"action":     "delete",
+						"expression": "not (resource.status == 'ACTIVE')",
+					},
+					map[string]interface{}{
+						"type":       "expression",
+						"action":     "read",
+						"expression": "resource.tenant_id == auth.tenant_id || 'viewer' in auth.roles",
+					},
+				}
+
+				policy, err := NewPolicy(testPolicy)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(policy.ApplyExpressionConditionFilter("update", auth, map[string]interface{}{
+					"size": 10,
+				}, map[string]interface{}{
+					"size": 100.0,
+				})).To(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("update", auth, map[string]interface{}{
+					"size": 10,
+				}, map[string]interface{}{
+					"size": 101.0,
+				})).NotTo(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("update", auth, map[string]interface{}{
+					"size": "10",
+				}, map[string]interface{}{
+					"size": 1,
+				})).To(MatchError(ContainSubstring("can't compare")))
+				Expect(policy.ApplyExpressionConditionFilter("delete", auth, map[string]interface{}{
+					"status": "ERROR",
+				}, nil)).To(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("delete", auth, map[string]interface{}{
+					"status": "ACTIVE",
+				}, nil)).NotTo(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("read", auth, map[string]interface{}{
+					"tenant_id": "other",
+				}, nil)).To(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("read", NewAuthorization("tenant", "tenantName", "", []string{"Member"}, nil),
+					map[string]interface{}{"tenant_id": "other"}, nil)).NotTo(Succeed())
+				Expect(policy.ApplyExpressionConditionFilter("create", auth, map[string]interface{}{}, nil)).To(Succeed())
+			})
+
+			It("should evaluate authorization and nested properties", func() {
+				for expression, expected := range map[string]bool{
+					"auth.user_id == 'user' && auth.tenant_name == 'tenantName'": true,
+					"has_service('compute') and has_service('nova')":             true,
+					"has_service('network')":                                     false,
+					"auth.catalog[0]":                                            false,
+					"resource.config.mode in ['a', 'b']":                         true,
+					"resource.config.missing == null":                            true,
+					"len(resource.tags) >= 2 and 'red' not in resource.tags":     true,
+					"resource.name > 'abc' and !resource.config.disabled":        true,
+				} {
+					parsed, err := CompilePolicyExpression(expression)
+					if err != nil {
+						Expect(expected).To(BeFalse(), expression)
+						continue
+					}
+					result, err := parsed.Evaluate(map[string]interface{}{
+						"name":   "abd",
+						"tags":   []interface{}{"blue", "green"},
+						"config": map[string]interface{}{"mode": "b"},
+					}, nil, auth)
+					Expect(err).ToNot(HaveOccurred(), expression)
+					Expect(result).To(Equal(expected), expression)
+				}
+			})
+		})
 	})
 })
 
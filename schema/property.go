@@ -29,6 +29,7 @@ type Property struct {
 	OnDeleteCascade        bool
 	Default                interface{}
 	Indexed                bool
+	Secret                 bool
 }
 
 //PropertyMap is a map of Property
@@ -92,6 +93,9 @@ func NewPropertyFromObj(id string, rawTypeData interface{}, required bool) *Prop
 	indexed, _ := typeData["indexed"].(bool)
 	Property := NewProperty(id, title, description, typeID, format, relation, relationColumn, relationProperty,
 		sqlType, unique, nullable, cascade, properties, defaultValue, indexed)
+	secret, _ := typeData["secret"].(bool)
+	writeOnly, _ := typeData["writeOnly"].(bool)
+	Property.Secret = secret || writeOnly
 	return &Property
 }
 
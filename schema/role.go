@@ -0,0 +1,147 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"strings"
+)
+
+//RoleGraph describes roles implied by other roles and role aliases
+type RoleGraph struct {
+	aliases map[string]string
+	implied map[string]map[string]bool
+}
+
+//NewRoleGraph creates role graph from a map of roles directly implied by each role
+//and a map from alias to role name. Cycles in hierarchy are rejected.
+func NewRoleGraph(hierarchy map[string][]string, aliases map[string]string) (*RoleGraph, error) {
+	graph := &RoleGraph{aliases: map[string]string{}, implied: map[string]map[string]bool{}}
+	for alias, name := range aliases {
+		if alias == name {
+			continue
+		}
+		if target, ok := aliases[name]; ok && target != name {
+			return nil, fmt.Errorf("Role alias '%s' refers to another alias '%s'", alias, name)
+		}
+		graph.aliases[alias] = name
+	}
+	edges := map[string][]string{}
+	for role, impliedRoles := range hierarchy {
+		role = graph.canonical(role)
+		for _, impliedRole := range impliedRoles {
+			edges[role] = append(edges[role], graph.canonical(impliedRole))
+		}
+	}
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(role string, path []string) error
+	visit = func(role string, path []string) error {
+		switch state[role] {
+		case visiting:
+			return fmt.Errorf("Cycle in role hierarchy: %s", strings.Join(append(path, role), " -> "))
+		case visited:
+			return nil
+		}
+		state[role] = visiting
+		implied := map[string]bool{}
+		for _, next := range edges[role] {
+			if err := visit(next, append(path, role)); err != nil {
+				return err
+			}
+			implied[next] = true
+			for name := range graph.implied[next] {
+				implied[name] = true
+			}
+		}
+		graph.implied[role] = implied
+		state[role] = visited
+		return nil
+	}
+	for role := range edges {
+		if err := visit(role, nil); err != nil {
+			return nil, err
+		}
+	}
+	return graph, nil
+}
+
+//NewRoleGraphFromConfig creates role graph from "roles" section of the configuration
+func NewRoleGraphFromConfig(raw interface{}) (*RoleGraph, error) {
+	if raw == nil {
+		return nil, nil
+	}
+	config, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Roles configuration should be a map")
+	}
+	hierarchy := map[string][]string{}
+	rawHierarchy, _ := config["hierarchy"].(map[string]interface{})
+	for role, rawImplied := range rawHierarchy {
+		switch implied := rawImplied.(type) {
+		case string:
+			hierarchy[role] = []string{implied}
+		case []interface{}:
+			for _, name := range implied {
+				hierarchy[role] = append(hierarchy[role], fmt.Sprint(name))
+			}
+		default:
+			return nil, fmt.Errorf("Roles implied by '%s' should be a list", role)
+		}
+	}
+	aliases := map[string]string{}
+	rawAliases, _ := config["aliases"].(map[string]interface{})
+	for alias, name := range rawAliases {
+		aliases[alias] = fmt.Sprint(name)
+	}
+	return NewRoleGraph(hierarchy, aliases)
+}
+
+func (graph *RoleGraph) canonical(role string) string {
+	if name, ok := graph.aliases[role]; ok {
+		return name
+	}
+	return role
+}
+
+//Implies checks if a user having role is granted principal
+func (graph *RoleGraph) Implies(role, principal string) bool {
+	if role == principal {
+		return true
+	}
+	if graph == nil {
+		return false
+	}
+	role, principal = graph.canonical(role), graph.canonical(principal)
+	return role == principal || graph.implied[role][principal]
+}
+
+//SetRoleGraph sets role graph used when matching roles with policy principals
+func (manager *Manager) SetRoleGraph(graph *RoleGraph) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	manager.roleGraph = graph
+}
+
+//RoleGraph returns role graph used when matching roles with policy principals
+func (manager *Manager) RoleGraph() *RoleGraph {
+	manager.mu.RLock()
+	defer manager.mu.RUnlock()
+	return manager.roleGraph
+}
@@ -245,6 +245,10 @@ func (schema *Schema) Init() error {
 		propertiesOrder = append(propertiesOrder, FormatParentID(parent))
 		required = append(required, FormatParentID(parent))
 	}
+	if schema.SoftDelete() && properties[DeletedAtPropertyID] == nil {
+		properties[DeletedAtPropertyID] = getDeletedAtPropertyObj()
+		propertiesOrder = append(propertiesOrder, DeletedAtPropertyID)
+	}
 
 	jsonSchema["required"] = required
 
@@ -472,6 +472,101 @@ var _ = Describe("Schema", func() {
 		})
 	})
 
+	Describe("History", func() {
+		It("should derive schema storing revisions", func() {
+			articleSchema, err := NewSchemaFromObj(map[string]interface{}{
+				"id":          "article",
+				"plural":      "articles",
+				"singular":    "article",
+				"title":       "Article",
+				"description": "Article",
+				"metadata":    map[string]interface{}{"history": true},
+				"schema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id": map[string]interface{}{"type": "string"},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(articleSchema.History()).To(BeTrue())
+
+			historySchema, err := NewHistorySchema(articleSchema)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(historySchema.ID).To(Equal("article_revision"))
+			Expect(historySchema.HistoryOf()).To(Equal("article"))
+			Expect(historySchema.History()).To(BeFalse())
+			_, err = historySchema.GetPropertyByID("data")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(historySchema.Indexes).To(ContainElement(
+				NewIndex("article_revisions_resource_revision", []string{"resource_id", "revision"}, Unique)))
+		})
+	})
+
+	Describe("Secret properties", func() {
+		var credentialSchema *Schema
+
+		BeforeEach(func() {
+			var err error
+			credentialSchema, err = NewSchemaFromObj(map[string]interface{}{
+				"id":          "credential",
+				"plural":      "credentials",
+				"singular":    "credential",
+				"title":       "Credential",
+				"description": "Credential",
+				"schema": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"id":       map[string]interface{}{"type": "string"},
+						"name":     map[string]interface{}{"type": "string"},
+						"password": map[string]interface{}{"type": "string", "secret": true},
+						"ssh_key":  map[string]interface{}{"type": "string", "writeOnly": true},
+					},
+				},
+			})
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should parse secret and writeOnly attributes", func() {
+			Expect(credentialSchema.SecretProperties()).To(ConsistOf("password", "ssh_key"))
+		})
+
+		It("should remove secret properties without modifying data", func() {
+			data := map[string]interface{}{"id": "c1", "name": "db", "password": "p", "ssh_key": "k"}
+			Expect(credentialSchema.RemoveSecretProperties(data)).To(Equal(map[string]interface{}{"id": "c1", "name": "db"}))
+			Expect(data).To(HaveKey("password"))
+		})
+
+		It("should redact secret values at any depth", func() {
+			secrets := SecretPropertyIDs([]*Schema{credentialSchema})
+			data := map[string]interface{}{
+				"credential":  map[string]interface{}{"name": "db", "password": "p"},
+				"credentials": []interface{}{map[string]interface{}{"ssh_key": "k"}},
+			}
+			Expect(RedactSecrets(data, secrets)).To(Equal(map[string]interface{}{
+				"credential":  map[string]interface{}{"name": "db", "password": RedactedValue},
+				"credentials": []interface{}{map[string]interface{}{"ssh_key": RedactedValue}},
+			}))
+		})
+
+		It("should redact secret keys registered for the schema in JSON", func() {
+			manager := GetManager()
+			defer ClearManager()
+			Expect(manager.registerSchema(credentialSchema)).To(Succeed())
+			RegisterSecretKey("credential", "one_time_token")
+			redacted := manager.RedactSecretsInJSON([]byte(`{
+				"credential": {"name": "k", "one_time_token": "t"},
+				"credentials": [{"one_time_token": "t"}],
+				"key": {"name": "k", "one_time_token": "t"}
+			}`))
+			Expect(redacted).To(MatchJSON(`{
+				"credential": {"name": "k", "one_time_token": "******"},
+				"credentials": [{"one_time_token": "******"}],
+				"key": {"name": "k", "one_time_token": "t"}
+			}`))
+		})
+	})
+
 	It("should ignore empty schema file", func() {
 		manager := GetManager()
 		Expect(manager.LoadSchemasFromFiles("")).To(Succeed())
@@ -0,0 +1,170 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+//RedactedValue replaces values of secret properties in logs
+const RedactedValue = "******"
+
+var (
+	secretKeysMutex sync.RWMutex
+	secretKeys      = map[string]map[string]bool{}
+)
+
+//RegisterSecretKey marks key of resources of the schema as secret for RedactSecretsInJSON,
+//so secrets returned in responses which aren't properties of the schema are redacted too
+func RegisterSecretKey(schemaID, key string) {
+	secretKeysMutex.Lock()
+	defer secretKeysMutex.Unlock()
+	if secretKeys[schemaID] == nil {
+		secretKeys[schemaID] = map[string]bool{}
+	}
+	secretKeys[schemaID][key] = true
+}
+
+//SecretProperties returns IDs of properties marked as secret or writeOnly
+func (schema *Schema) SecretProperties() []string {
+	secrets := []string{}
+	for _, property := range schema.Properties {
+		if property.Secret {
+			secrets = append(secrets, property.ID)
+		}
+	}
+	return secrets
+}
+
+//RemoveSecretProperties returns data without secret properties.
+//Data is returned as is when the schema has no secret property.
+func (schema *Schema) RemoveSecretProperties(data map[string]interface{}) map[string]interface{} {
+	secrets := schema.SecretProperties()
+	if len(secrets) == 0 || data == nil {
+		return data
+	}
+	result := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		result[key] = value
+	}
+	for _, secret := range secrets {
+		delete(result, secret)
+	}
+	return result
+}
+
+//SecretPropertyIDs returns IDs of properties which are secret in any of the schemas
+func SecretPropertyIDs(schemas []*Schema) map[string]bool {
+	secrets := map[string]bool{}
+	for _, schema := range schemas {
+		for _, secret := range schema.SecretProperties() {
+			secrets[secret] = true
+		}
+	}
+	return secrets
+}
+
+//RedactSecrets returns copy of data with values of the secret keys replaced at any depth
+func RedactSecrets(data interface{}, secrets map[string]bool) interface{} {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, inner := range value {
+			if secrets[key] {
+				result[key] = RedactedValue
+			} else {
+				result[key] = RedactSecrets(inner, secrets)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, inner := range value {
+			result[i] = RedactSecrets(inner, secrets)
+		}
+		return result
+	}
+	return data
+}
+
+//redactScopedSecrets is RedactSecrets which additionally redacts keys registered for a schema
+//within the objects under the singular or plural of the schema
+func redactScopedSecrets(data interface{}, secrets map[string]bool, scoped map[string]map[string]bool) interface{} {
+	switch value := data.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, inner := range value {
+			if secrets[key] {
+				result[key] = RedactedValue
+				continue
+			}
+			innerSecrets := secrets
+			if keys, ok := scoped[key]; ok {
+				innerSecrets = make(map[string]bool, len(secrets)+len(keys))
+				for secret := range secrets {
+					innerSecrets[secret] = true
+				}
+				for secret := range keys {
+					innerSecrets[secret] = true
+				}
+			}
+			result[key] = redactScopedSecrets(inner, innerSecrets, scoped)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, inner := range value {
+			result[i] = redactScopedSecrets(inner, secrets, scoped)
+		}
+		return result
+	}
+	return data
+}
+
+//RedactSecretsInJSON redacts values of properties which are secret in any schema of the manager
+//and of keys registered as secret for schemas.
+//Body which is not JSON or has nothing to redact is returned as is.
+func (manager *Manager) RedactSecretsInJSON(body []byte) []byte {
+	secrets := SecretPropertyIDs(manager.OrderedSchemas())
+	scoped := map[string]map[string]bool{}
+	secretKeysMutex.RLock()
+	for schemaID, keys := range secretKeys {
+		schema, ok := manager.Schema(schemaID)
+		if !ok {
+			continue
+		}
+		copied := make(map[string]bool, len(keys))
+		for key := range keys {
+			copied[key] = true
+		}
+		scoped[schema.Singular] = copied
+		scoped[schema.Plural] = copied
+	}
+	secretKeysMutex.RUnlock()
+	if (len(secrets) == 0 && len(scoped) == 0) || len(body) == 0 {
+		return body
+	}
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body
+	}
+	redacted, err := json.Marshal(redactScopedSecrets(data, secrets, scoped))
+	if err != nil {
+		return body
+	}
+	return redacted
+}
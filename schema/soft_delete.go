@@ -0,0 +1,60 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"time"
+
+	"github.com/cloudwan/gohan/util"
+)
+
+//DeletedAtPropertyID is ID of the property marking soft deleted resources with time of deletion
+const DeletedAtPropertyID = "deleted_at"
+
+//SoftDelete whether resources of this schema are only marked as deleted instead of being removed
+func (schema *Schema) SoftDelete() bool {
+	softDelete, _ := schema.Metadata["soft_delete"].(bool)
+	return softDelete
+}
+
+//Deleted checks if the resource is soft deleted
+func (resource *Resource) Deleted() bool {
+	if !resource.Schema().SoftDelete() {
+		return false
+	}
+	return resource.Get(DeletedAtPropertyID) != nil
+}
+
+//MarkDeleted sets deletion time of the resource
+func (resource *Resource) MarkDeleted(now time.Time) {
+	resource.Data()[DeletedAtPropertyID] = now.UTC().Format(util.TimestampFormat)
+}
+
+//UnmarkDeleted clears deletion time of the resource
+func (resource *Resource) UnmarkDeleted() {
+	resource.Data()[DeletedAtPropertyID] = nil
+}
+
+func getDeletedAtPropertyObj() map[string]interface{} {
+	return map[string]interface{}{
+		"type":        []interface{}{"string", "null"},
+		"format":      "date-time",
+		"title":       "Deleted at",
+		"description": "time the resource was soft deleted",
+		"indexed":     true,
+		"permission":  []interface{}{},
+	}
+}
@@ -18,6 +18,7 @@ package server
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
@@ -25,10 +26,12 @@ import (
 	"github.com/cloudwan/gohan/extension"
 	"github.com/cloudwan/gohan/extension/goext"
 	"github.com/cloudwan/gohan/job"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
 	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/tracing"
 	"github.com/drone/routes"
 	"github.com/go-martini/martini"
 )
@@ -56,6 +59,21 @@ func addParamToQuery(r *http.Request, key, value string) {
 	r.URL.RawQuery += "&" + key + "=" + value
 }
 
+//nextPageLink returns Link header value pointing at the page starting after the marker
+func nextPageLink(r *http.Request, marker string) string {
+	query := r.URL.Query()
+	query.Del("offset")
+	query.Set("marker", marker)
+	next := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=\"next\"", next.String())
+}
+
+func addETagHeader(w http.ResponseWriter, context middleware.Context) {
+	if etag, ok := context["etag"].(string); ok {
+		w.Header().Set("ETag", etag)
+	}
+}
+
 func addJSONContentTypeHeader(w http.ResponseWriter) {
 	w.Header().Add("Content-Type", "application/json")
 }
@@ -78,12 +96,14 @@ func problemToResponseCode(problem resources.ResourceProblem) int {
 		return http.StatusBadRequest
 	case resources.NotFound:
 		return http.StatusNotFound
-	case resources.DeleteFailed, resources.CreateFailed, resources.UpdateFailed:
+	case resources.DeleteFailed, resources.CreateFailed, resources.UpdateFailed, resources.QuotaExceeded:
 		return http.StatusConflict
 	case resources.Unauthorized:
 		return http.StatusUnauthorized
 	case resources.ForeignKeyFailed:
 		return http.StatusBadRequest
+	case resources.PreconditionFailed:
+		return http.StatusPreconditionFailed
 	}
 	return http.StatusInternalServerError
 }
@@ -186,6 +206,10 @@ func fillInContext(context middleware.Context, db db.DB,
 	identityService middleware.IdentityService,
 	queue *job.Queue) {
 	context["path"] = r.URL.Path
+	context["request_id"] = l.RequestIDFromContext(r.Context())
+	if span := tracing.SpanFromContext(r.Context()); span != nil {
+		context[tracing.SpanKey] = span
+	}
 	context["http_request"] = r
 	context["http_response"] = w
 	context["schema"] = s
@@ -203,9 +227,58 @@ func fillInContext(context middleware.Context, db db.DB,
 	context["openstack_client"] = identityService.GetClient()
 }
 
+//bulkFunc returns handler executing bulk operations on resources of the schema.
+//When the schema is nil, operations may target any schema.
+func bulkFunc(server *Server, dataStore db.DB, s *schema.Schema) func(http.ResponseWriter, *http.Request, martini.Params, middleware.IdentityService, middleware.Context) {
+	return func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+		addJSONContentTypeHeader(w)
+		dataMap, err := middleware.ReadJSON(r)
+		if err != nil {
+			handleError(w, resources.NewResourceError(err, fmt.Sprintf("Failed to parse data: %s", err), resources.WrongData))
+			return
+		}
+		operations, err := resources.BulkOperationsFromJSON(dataMap, s)
+		if err != nil {
+			handleError(w, err)
+			return
+		}
+		for _, operation := range operations {
+			operation.Context = middleware.Context{}
+			for key, value := range context {
+				operation.Context[key] = value
+			}
+			fillInContext(operation.Context, dataStore, r, w, operation.Schema, p, server.sync, identityService, server.queue)
+		}
+		if err := resources.BulkResources(dataStore, identityService, operations); err != nil {
+			handleError(w, err)
+			return
+		}
+		results := make([]interface{}, 0, len(operations))
+		for _, operation := range operations {
+			result := map[string]interface{}{}
+			switch operation.Method {
+			case resources.BulkCreate:
+				result["status"] = http.StatusCreated
+			case resources.BulkUpdate:
+				result["status"] = http.StatusOK
+			case resources.BulkDelete:
+				result["status"] = http.StatusNoContent
+			}
+			if response, ok := operation.Context["response"].(map[string]interface{}); ok && operation.Method != resources.BulkDelete {
+				for key, value := range response {
+					result[key] = value
+				}
+			}
+			results = append(results, result)
+		}
+		routes.ServeJson(w, map[string]interface{}{"results": results})
+	}
+}
+
 //MapRouteBySchema setup api route by schema
 func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
-	if s.IsAbstract() {
+	// revisions are accessed with routes of the resources they belong to
+	if s.IsAbstract() || s.HistoryOf() != "" {
 		return
 	}
 	route := server.martini
@@ -239,6 +312,9 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			return
 		}
 		w.Header().Add("X-Total-Count", fmt.Sprint(context["total"]))
+		if nextMarker, ok := context["next_marker"].(string); ok {
+			w.Header().Add("Link", nextPageLink(r, nextMarker))
+		}
 		routes.ServeJson(w, context["response"])
 	}
 	route.Get(pluralURL, middleware.Authorization(schema.ActionRead), getPluralFunc)
@@ -247,15 +323,45 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 		getPluralFunc(w, r, p, identityService, context)
 	})
 
+	//setup aggregate route
+	route.Get(pluralURL+"/_aggregate", middleware.Authorization(schema.ActionRead), func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+		addJSONContentTypeHeader(w)
+		fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+		if err := resources.AggregateResources(context, dataStore, s, r.URL.Query()); err != nil {
+			handleError(w, err)
+			return
+		}
+		routes.ServeJson(w, context["response"])
+	})
+
+	//setup watch routes
+	route.Get(pluralURL+"/_watch", watchResourcesFunc(server, s))
+	route.Get(singleURL+"/_watch", watchResourcesFunc(server, s))
+
 	//setup show route
 	getSingleFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
 		addJSONContentTypeHeader(w)
 		fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
 		id := p["id"]
+		if asOf := r.URL.Query().Get("as_of"); asOf != "" && s.History() {
+			if err := resources.GetResourceRevision(context, dataStore, s, id, asOf); err != nil {
+				handleError(w, err)
+				return
+			}
+			routes.ServeJson(w, context["response"])
+			return
+		}
 		if err := resources.GetSingleResource(context, dataStore, s, id); err != nil {
 			handleError(w, err)
 			return
 		}
+		if etag, ok := context["etag"].(string); ok {
+			w.Header().Set("ETag", etag)
+			if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" && resources.MatchETagWeak(ifNoneMatch, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
 		routes.ServeJson(w, context["response"])
 	}
 	route.Get(singleURL, middleware.Authorization(schema.ActionRead), getSingleFunc)
@@ -331,6 +437,8 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			return
 		} else if isCreated {
 			w.WriteHeader(http.StatusCreated)
+		} else {
+			addETagHeader(w, context)
 		}
 		routes.ServeJson(w, context["response"])
 	}
@@ -357,6 +465,7 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			handleError(w, err)
 			return
 		}
+		addETagHeader(w, context)
 		routes.ServeJson(w, context["response"])
 	}
 	route.Patch(singleURL, middleware.Authorization(schema.ActionUpdate), patchSingleFunc)
@@ -366,6 +475,35 @@ func MapRouteBySchema(server *Server, dataStore db.DB, s *schema.Schema) {
 			patchSingleFunc(w, r, p, identityService, context)
 		})
 
+	//setup restore route for soft deleted resources
+	if s.SoftDelete() {
+		restoreSingleFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addJSONContentTypeHeader(w)
+			fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+			id := p["id"]
+			if err := resources.RestoreResource(context, dataStore, s, id); err != nil {
+				handleError(w, err)
+				return
+			}
+			routes.ServeJson(w, context["response"])
+		}
+		route.Post(singleURL+"/restore", middleware.Authorization(schema.ActionUpdate), restoreSingleFunc)
+		route.Post(singleURLWithParents+"/restore", middleware.Authorization(schema.ActionUpdate),
+			func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+				addParamToQuery(r, schema.FormatParentID(s.Parent), p[s.Parent])
+				restoreSingleFunc(w, r, p, identityService, context)
+			})
+	}
+
+	//setup revision routes
+	if s.History() {
+		mapHistoryRoutes(server, dataStore, s)
+	}
+
+	//setup bulk route
+	// each operation is authorized by its own action when it is prepared
+	route.Post(pluralURL+"/_bulk", middleware.Authorization(schema.ActionGlob), bulkFunc(server, dataStore, s))
+
 	//Custom action support
 	for _, actionExt := range s.Actions {
 		action := actionExt
@@ -426,6 +564,9 @@ func MapRouteBySchemas(server *Server, dataStore db.DB) {
 			"http_response": w,
 		}
 		for _, s := range schemaManager.Schemas() {
+			if s.HistoryOf() != "" {
+				continue
+			}
 			policy, role := authorization(w, r, schema.ActionRead, s.GetPluralURL(), s, auth)
 			if policy == nil {
 				continue
@@ -436,12 +577,12 @@ func MapRouteBySchemas(server *Server, dataStore db.DB) {
 			context["auth"] = auth
 			context["sync"] = server.sync
 
-			if err := resources.GetResources(
-				context, dataStore,
-				s,
-				resources.FilterFromQueryParameter(s, r.URL.Query()),
-				nil,
-			); err != nil {
+			filter, err := resources.FilterFromQueryParameter(s, r.URL.Query())
+			if err != nil {
+				handleError(w, resources.NewResourceError(err, err.Error(), resources.WrongQuery))
+				return
+			}
+			if err := resources.GetResources(context, dataStore, s, filter, nil); err != nil {
 				handleError(w, err)
 				return
 			}
@@ -451,6 +592,7 @@ func MapRouteBySchemas(server *Server, dataStore db.DB) {
 		}
 		routes.ServeJson(w, responses)
 	})
+	route.Post("/_bulk", middleware.Authorization(schema.ActionGlob), bulkFunc(server, dataStore, nil))
 	for _, s := range schemaManager.Schemas() {
 		MapRouteBySchema(server, dataStore, s)
 	}
@@ -461,21 +603,50 @@ func MapNamespacesRoutes(route martini.Router) {
 	manager := schema.GetManager()
 
 	for _, namespace := range manager.Namespaces() {
-		if namespace.IsTopLevel() {
-			mapTopLevelNamespaceRoute(route, namespace)
-		} else {
-			mapChildNamespaceRoute(route, namespace)
+		mapNamespaceRoute(route, namespace)
+	}
+}
+
+func mapNamespaceRoute(route martini.Router, namespace *schema.Namespace) {
+	if namespace.IsTopLevel() {
+		mapTopLevelNamespaceRoute(route, namespace.GetFullPrefix())
+	} else {
+		mapChildNamespaceRoute(route, namespace.GetFullPrefix())
+	}
+}
+
+//namespaceRoutePattern returns pattern of the route mapped for the namespace
+func namespaceRoutePattern(namespace *schema.Namespace) string {
+	if namespace.IsTopLevel() {
+		return namespace.GetFullPrefix() + "/"
+	}
+	return namespace.GetFullPrefix()
+}
+
+//registeredNamespace returns namespace currently registered with the full prefix or writes 404,
+//so routes of namespaces removed on stored config reload are no longer served
+func registeredNamespace(w http.ResponseWriter, prefix string, topLevel bool) (*schema.Namespace, bool) {
+	for _, namespace := range schema.GetManager().Namespaces() {
+		if namespace.GetFullPrefix() == prefix && namespace.IsTopLevel() == topLevel {
+			return namespace, true
 		}
 	}
+	err := fmt.Errorf("Namespace %s not found", prefix)
+	handleError(w, resources.NewResourceError(err, err.Error(), resources.NotFound))
+	return nil, false
 }
 
 // mapTopLevelNamespaceRoute maps route listing available subnamespaces (versions)
 // for a top-level namespace
-func mapTopLevelNamespaceRoute(route martini.Router, namespace *schema.Namespace) {
-	log.Debug("[Path] %s/", namespace.GetFullPrefix())
+func mapTopLevelNamespaceRoute(route martini.Router, prefix string) {
+	log.Debug("[Path] %s/", prefix)
 	route.Get(
-		namespace.GetFullPrefix()+"/",
+		prefix+"/",
 		func(w http.ResponseWriter, r *http.Request, p martini.Params, context martini.Context) {
+			namespace, ok := registeredNamespace(w, prefix, true)
+			if !ok {
+				return
+			}
 			versions := []schema.Version{}
 			for _, childNamespace := range schema.GetManager().Namespaces() {
 				if childNamespace.Parent == namespace.ID {
@@ -502,11 +673,15 @@ func mapTopLevelNamespaceRoute(route martini.Router, namespace *schema.Namespace
 
 // mapChildNamespaceRoute sets a handler returning a dictionary of resources
 // supported by a certain API version identified by the given namespace
-func mapChildNamespaceRoute(route martini.Router, namespace *schema.Namespace) {
-	log.Debug("[Path] %s", namespace.GetFullPrefix())
+func mapChildNamespaceRoute(route martini.Router, prefix string) {
+	log.Debug("[Path] %s", prefix)
 	route.Get(
-		namespace.GetFullPrefix(),
+		prefix,
 		func(w http.ResponseWriter, r *http.Request, p martini.Params, context martini.Context) {
+			namespace, ok := registeredNamespace(w, prefix, false)
+			if !ok {
+				return
+			}
 			resources := []schema.NamespaceResource{}
 			for _, s := range schema.GetManager().Schemas() {
 				if s.NamespaceID == namespace.ID {
@@ -0,0 +1,100 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/golang"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+const apiKeyContextKey = "api_key_secret"
+
+//apiKeySecretKey is a key of the secret returned once in post_create response
+const apiKeySecretKey = "secret"
+
+//setupAPIKeys registers callback generating secrets of API keys; their hashes are secret properties.
+//Secrets aren't properties of the schema, so they are registered to be redacted in logged API keys.
+func setupAPIKeys() {
+	schema.RegisterSecretKey(middleware.APIKeySchemaID, apiKeySecretKey)
+	golang.RegisterGoCallback("handle_api_key",
+		func(event string, context map[string]interface{}) error {
+			switch event {
+			case "pre_create":
+				return prepareAPIKey(context)
+			case "pre_update":
+				resource, _ := context["resource"].(map[string]interface{})
+				return validateAPIKeyExpiry(resource)
+			case "post_create":
+				response, _ := context["response"].(map[string]interface{})
+				if apiKey, ok := response[middleware.APIKeySchemaID].(map[string]interface{}); ok {
+					apiKey[apiKeySecretKey] = context[apiKeyContextKey]
+				}
+			}
+			return nil
+		})
+}
+
+func prepareAPIKey(context map[string]interface{}) error {
+	resource := context["resource"].(map[string]interface{})
+	if err := validateAPIKeyExpiry(resource); err != nil {
+		return err
+	}
+	auth := context["auth"].(schema.Authorization)
+	if !hasRole(auth, "admin") {
+		roles, _ := resource["roles"].([]interface{})
+		for _, role := range roles {
+			roleName, _ := role.(string)
+			if !hasRole(auth, roleName) {
+				return extension.Errorf(401, "Unauthorized",
+					fmt.Sprintf("Role %s can't be granted to API key by user without it", roleName))
+			}
+		}
+	}
+	key, secretHash, err := middleware.NewAPIKey(fmt.Sprint(context["id"]))
+	if err != nil {
+		return err
+	}
+	resource["secret_hash"] = secretHash
+	context[apiKeyContextKey] = key
+	return nil
+}
+
+func validateAPIKeyExpiry(resource map[string]interface{}) error {
+	expiresAt, ok := resource["expires_at"].(string)
+	if !ok || expiresAt == "" {
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, expiresAt); err != nil {
+		return extension.Errorf(400, "ValidationException",
+			fmt.Sprintf("expires_at should be RFC3339 timestamp: %s", err))
+	}
+	return nil
+}
+
+//hasRole checks if the user has the role directly, via the role hierarchy or an alias
+func hasRole(auth schema.Authorization, roleName string) bool {
+	for _, role := range auth.Roles() {
+		if role.Match(roleName) {
+			return true
+		}
+	}
+	return false
+}
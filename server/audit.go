@@ -0,0 +1,94 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
+)
+
+const (
+	auditExportURL       = "/gohan/v0.1/audit_log_export"
+	auditExportBatchSize = 1000
+)
+
+//addAuditExportRoute adds route exporting audit records as newline delimited JSON.
+//Records are filtered with the same query parameters as the audit log list API.
+func (server *Server) addAuditExportRoute() {
+	server.martini.Get(auditExportURL, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization) {
+		auditSchema, ok := schema.GetManager().Schema(resources.AuditLogSchemaID)
+		if !ok {
+			middleware.HTTPJSONError(w, "Audit log is not available", http.StatusNotFound)
+			return
+		}
+		policy, _ := schema.GetManager().PolicyValidate(schema.ActionRead, auditSchema.GetPluralURL(), auth)
+		if policy == nil {
+			middleware.HTTPJSONError(w, fmt.Sprintf("No matching policy: %s %s", schema.ActionRead, auditExportURL),
+				http.StatusUnauthorized)
+			return
+		}
+		filter, err := resources.FilterFromQueryParameter(auditSchema, r.URL.Query())
+		if err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tenantIDs := policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID()); tenantIDs != nil {
+			filter["tenant_id"] = tenantIDs
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		if err := exportAuditRecords(server.db, auditSchema, filter, json.NewEncoder(w)); err != nil {
+			log.Error("Failed to export audit records: %s", err)
+		}
+	})
+}
+
+//exportAuditRecords writes matching records in time order, one page per transaction
+func exportAuditRecords(dataStore db.DB, auditSchema *schema.Schema, filter transaction.Filter, encoder *json.Encoder) error {
+	marker := ""
+	for {
+		var records []*schema.Resource
+		paginator, err := pagination.NewPaginator(auditSchema, "timestamp", pagination.ASC, auditExportBatchSize, 0)
+		if err != nil {
+			return err
+		}
+		paginator.Marker = marker
+		if err := db.Within(dataStore, func(tx transaction.Transaction) error {
+			records, _, err = tx.List(auditSchema, filter, nil, paginator)
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		}); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := encoder.Encode(record.Data()); err != nil {
+				return err
+			}
+		}
+		if marker, err = paginator.NextMarker(records); err != nil || marker == "" {
+			return err
+		}
+	}
+}
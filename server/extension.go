@@ -64,9 +64,14 @@ func (server *Server) newEnvironment(name string) extension.Environment {
 
 // NewEnvironmentForPath creates an extension environment and loads extensions for path
 func (server *Server) NewEnvironmentForPath(name string, path string) (env extension.Environment, err error) {
+	return server.newEnvironmentWithExtensions(name, path, schema.GetManager().Extensions)
+}
+
+//newEnvironmentWithExtensions creates an extension environment and loads the given extensions for path
+func (server *Server) newEnvironmentWithExtensions(name string, path string, extensions []*schema.Extension) (env extension.Environment, err error) {
 	manager := schema.GetManager()
 	env = server.newEnvironment(name)
-	err = env.LoadExtensionsForPath(manager.Extensions, manager.TimeLimit, manager.TimeLimits, path)
+	err = env.LoadExtensionsForPath(extensions, manager.TimeLimit, manager.TimeLimits, path)
 	if err != nil {
 		err = fmt.Errorf("Extensions parsing error: %v", err)
 	}
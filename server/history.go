@@ -0,0 +1,158 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
+	"github.com/drone/routes"
+	"github.com/go-martini/martini"
+)
+
+//DbHistoryWrapper wraps db.DB so it records revisions of resources in the transaction changing them
+type DbHistoryWrapper struct {
+	db.DB
+}
+
+//Begin wraps transaction object with history recorder
+func (hw *DbHistoryWrapper) Begin() (transaction.Transaction, error) {
+	tx, err := hw.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &transactionHistoryRecorder{tx, ""}, nil
+}
+
+//BeginTx wraps transaction object with history recorder
+func (hw *DbHistoryWrapper) BeginTx(ctx context.Context, options *transaction.TxOptions) (transaction.Transaction, error) {
+	tx, err := hw.DB.BeginTx(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return &transactionHistoryRecorder{tx, l.RequestIDFromContext(ctx)}, nil
+}
+
+type transactionHistoryRecorder struct {
+	transaction.Transaction
+	// requestID is ID of the request the transaction was begun for
+	requestID string
+}
+
+//withRequestID attaches ID of the request the transaction was begun for unless ctx carries one
+func (hr *transactionHistoryRecorder) withRequestID(ctx context.Context) context.Context {
+	if l.RequestIDFromContext(ctx) != "" || hr.requestID == "" {
+		return ctx
+	}
+	return l.ContextWithRequestID(ctx, hr.requestID)
+}
+
+func (hr *transactionHistoryRecorder) Create(resource *schema.Resource) error {
+	return hr.CreateContext(context.Background(), resource)
+}
+
+func (hr *transactionHistoryRecorder) CreateContext(ctx context.Context, resource *schema.Resource) error {
+	if err := hr.Transaction.CreateContext(ctx, resource); err != nil {
+		return err
+	}
+	return resources.RecordRevision(hr.withRequestID(ctx), hr.Transaction, resource.Schema(), schema.ActionCreate, resource.ID(), resource.Data())
+}
+
+func (hr *transactionHistoryRecorder) Update(resource *schema.Resource) error {
+	return hr.UpdateContext(context.Background(), resource)
+}
+
+func (hr *transactionHistoryRecorder) UpdateContext(ctx context.Context, resource *schema.Resource) error {
+	if err := hr.Transaction.UpdateContext(ctx, resource); err != nil {
+		return err
+	}
+	action := schema.ActionUpdate
+	if resource.Deleted() {
+		action = schema.ActionDelete
+	}
+	return resources.RecordRevision(hr.withRequestID(ctx), hr.Transaction, resource.Schema(), action, resource.ID(), resource.Data())
+}
+
+func (hr *transactionHistoryRecorder) Delete(s *schema.Schema, resourceID interface{}) error {
+	return hr.DeleteContext(context.Background(), s, resourceID)
+}
+
+func (hr *transactionHistoryRecorder) DeleteContext(ctx context.Context, s *schema.Schema, resourceID interface{}) error {
+	if err := hr.Transaction.DeleteContext(ctx, s, resourceID); err != nil {
+		return err
+	}
+	return resources.RecordRevision(hr.withRequestID(ctx), hr.Transaction, s, schema.ActionDelete, fmt.Sprint(resourceID), nil)
+}
+
+//mapHistoryRoutes maps routes listing revisions of resources and reverting resources to them
+func mapHistoryRoutes(server *Server, dataStore db.DB, s *schema.Schema) {
+	route := server.martini
+
+	getRevisionsFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+		addJSONContentTypeHeader(w)
+		fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+		if err := resources.GetRevisions(context, dataStore, s, p["id"], r.URL.Query()); err != nil {
+			handleError(w, err)
+			return
+		}
+		w.Header().Add("X-Total-Count", fmt.Sprint(context["total"]))
+		if nextMarker, ok := context["next_marker"].(string); ok {
+			w.Header().Add("Link", nextPageLink(r, nextMarker))
+		}
+		routes.ServeJson(w, context["response"])
+	}
+	route.Get(s.GetSingleURL()+"/revisions", middleware.Authorization(schema.ActionRead), getRevisionsFunc)
+	route.Get(s.GetSingleURLWithParents()+"/revisions", middleware.Authorization(schema.ActionRead),
+		func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addParamToQuery(r, schema.FormatParentID(s.Parent), p[s.Parent])
+			getRevisionsFunc(w, r, p, identityService, context)
+		})
+
+	revertFunc := func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+		addJSONContentTypeHeader(w)
+		fillInContext(context, dataStore, r, w, s, p, server.sync, identityService, server.queue)
+		input, err := middleware.ReadJSON(r)
+		if err != nil {
+			handleError(w, resources.NewResourceError(err, fmt.Sprintf("Failed to parse data: %s", err), resources.WrongData))
+			return
+		}
+		revision, ok := input["revision"].(float64)
+		if !ok || revision != float64(int(revision)) {
+			err := fmt.Errorf("revision should be an integer")
+			handleError(w, resources.NewResourceError(err, err.Error(), resources.WrongData))
+			return
+		}
+		if err := resources.RevertResource(context, dataStore, identityService, s, p["id"], int(revision)); err != nil {
+			handleError(w, err)
+			return
+		}
+		addETagHeader(w, context)
+		routes.ServeJson(w, context["response"])
+	}
+	route.Post(s.GetSingleURL()+"/revert", middleware.Authorization(schema.ActionUpdate), revertFunc)
+	route.Post(s.GetSingleURLWithParents()+"/revert", middleware.Authorization(schema.ActionUpdate),
+		func(w http.ResponseWriter, r *http.Request, p martini.Params, identityService middleware.IdentityService, context middleware.Context) {
+			addParamToQuery(r, schema.FormatParentID(s.Parent), p[s.Parent])
+			revertFunc(w, r, p, identityService, context)
+		})
+}
@@ -0,0 +1,204 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/rackspace/gophercloud"
+)
+
+const (
+	//APIKeySchemaID is an ID of the schema API keys are stored in
+	APIKeySchemaID = "api_key"
+	//APIKeyPrefix starts every API key, so keys can be told apart from other tokens
+	APIKeyPrefix = "gak_"
+
+	apiKeySecretLength       = 32
+	apiKeyLastUsedResolution = time.Minute
+)
+
+//NewAPIKey generates a key of the API key resource with the ID.
+//It returns the key, which is shown to the user only once, and hash of its secret, which is stored.
+func NewAPIKey(id string) (key, secretHash string, err error) {
+	secret := make([]byte, apiKeySecretLength)
+	if _, err = rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	encodedSecret := base64.RawURLEncoding.EncodeToString(secret)
+	return APIKeyPrefix + id + "." + encodedSecret, hashAPIKeySecret(encodedSecret), nil
+}
+
+func hashAPIKeySecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+//parseAPIKey splits the key into resource ID and secret
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return "", "", false
+	}
+	key = strings.TrimPrefix(key, APIKeyPrefix)
+	i := strings.LastIndex(key, ".")
+	if i <= 0 || i == len(key)-1 {
+		return "", "", false
+	}
+	return key[:i], key[i+1:], true
+}
+
+//APIKeyIdentity authenticates service accounts with API keys stored in api_key resources.
+//Other tokens are verified by the inner identity service, so API keys can be used together with keystone or JWT.
+type APIKeyIdentity struct {
+	inner IdentityService
+	db    db.DB
+	now   func() time.Time
+
+	mutex    gosync.Mutex
+	lastUsed map[string]time.Time
+}
+
+//NewAPIKeyIdentity creates API key identity service; inner may be nil when only API keys are accepted
+func NewAPIKeyIdentity(inner IdentityService, dataStore db.DB) *APIKeyIdentity {
+	return &APIKeyIdentity{
+		inner:    inner,
+		db:       dataStore,
+		now:      time.Now,
+		lastUsed: map[string]time.Time{},
+	}
+}
+
+//VerifyToken verifies API key or passes other tokens to the inner identity service
+func (identity *APIKeyIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	id, secret, ok := parseAPIKey(token)
+	if !ok {
+		if identity.inner == nil {
+			return nil, fmt.Errorf("Invalid API key")
+		}
+		return identity.inner.VerifyToken(token)
+	}
+	apiKeySchema, ok := schema.GetManager().Schema(APIKeySchemaID)
+	if !ok {
+		return nil, fmt.Errorf("API key schema is not loaded")
+	}
+	var apiKey *schema.Resource
+	err := db.Within(identity.db, func(tx transaction.Transaction) (err error) {
+		apiKey, err = tx.Fetch(apiKeySchema, transaction.IDFilter(id), nil)
+		return err
+	})
+	if err == transaction.ErrResourceNotFound {
+		return nil, fmt.Errorf("Invalid API key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	data := apiKey.Data()
+	secretHash, _ := data["secret_hash"].(string)
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return nil, fmt.Errorf("Invalid API key")
+	}
+	now := identity.now()
+	if expiresAt, _ := data["expires_at"].(string); expiresAt != "" {
+		expiry, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil || !now.Before(expiry) {
+			return nil, fmt.Errorf("API key has expired")
+		}
+	}
+	identity.touch(apiKeySchema, id, now)
+
+	tenantID, _ := data["tenant_id"].(string)
+	tenantName, err := identity.GetTenantName(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	roles := []string{}
+	rawRoles, _ := apiKey.Get("roles").([]interface{})
+	for _, role := range rawRoles {
+		if roleName, ok := role.(string); ok {
+			roles = append(roles, roleName)
+		}
+	}
+	return schema.NewAuthorization(tenantID, tenantName, token, roles, nil), nil
+}
+
+//touch records last use of the key, at most once per apiKeyLastUsedResolution
+func (identity *APIKeyIdentity) touch(apiKeySchema *schema.Schema, id string, now time.Time) {
+	identity.mutex.Lock()
+	if now.Sub(identity.lastUsed[id]) < apiKeyLastUsedResolution {
+		identity.mutex.Unlock()
+		return
+	}
+	identity.lastUsed[id] = now
+	identity.mutex.Unlock()
+
+	err := db.Within(identity.db, func(tx transaction.Transaction) error {
+		apiKey, err := tx.Fetch(apiKeySchema, transaction.IDFilter(id), nil)
+		if err != nil {
+			return err
+		}
+		apiKey.Data()["last_used_at"] = now.UTC().Format(time.RFC3339)
+		if err := tx.Update(apiKey); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		log.Warning("Failed to record use of API key %s: %s", id, err)
+	}
+}
+
+//GetTenantID maps the given tenant name to the tenant's ID using the inner identity service
+func (identity *APIKeyIdentity) GetTenantID(tenantName string) (string, error) {
+	if identity.inner == nil {
+		return tenantName, nil
+	}
+	return identity.inner.GetTenantID(tenantName)
+}
+
+//GetTenantName maps the given tenant ID to the tenant's name using the inner identity service
+func (identity *APIKeyIdentity) GetTenantName(tenantID string) (string, error) {
+	if identity.inner == nil {
+		return tenantID, nil
+	}
+	return identity.inner.GetTenantName(tenantID)
+}
+
+//GetServiceAuthorization returns the service authorization of the inner identity service
+func (identity *APIKeyIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	if identity.inner == nil {
+		return schema.NewAuthorization("admin", "admin", "", []string{"admin"}, nil), nil
+	}
+	return identity.inner.GetServiceAuthorization()
+}
+
+//GetClient returns the client of the inner identity service
+func (identity *APIKeyIdentity) GetClient() *gophercloud.ServiceClient {
+	if identity.inner == nil {
+		return nil
+	}
+	return identity.inner.GetClient()
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("API keys", func() {
+	ginkgo.It("generates keys which can be parsed back", func() {
+		key, secretHash, err := NewAPIKey("service-account")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(key).To(HavePrefix("gak_service-account."))
+
+		id, secret, ok := parseAPIKey(key)
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("service-account"))
+		Expect(hashAPIKeySecret(secret)).To(Equal(secretHash))
+		Expect(strings.Contains(secretHash, secret)).To(BeFalse())
+	})
+
+	ginkgo.It("rejects malformed keys", func() {
+		for _, key := range []string{"admin_token", "gak_", "gak_id", "gak_.secret", "gak_id."} {
+			_, _, ok := parseAPIKey(key)
+			Expect(ok).To(BeFalse(), key)
+		}
+	})
+})
@@ -1,16 +1,23 @@
 package middleware
 
 import (
+	"container/list"
+	"fmt"
+	gosync "sync"
 	"time"
 
+	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
-	"github.com/patrickmn/go-cache"
 	"github.com/rackspace/gophercloud"
 )
 
+//DefaultIdentityCacheSize is a default maximal number of entries in the cache of identity service
+const DefaultIdentityCacheSize = 10000
+
 type CachedIdentityService struct {
-	inner IdentityService
-	cache *cache.Cache
+	inner   IdentityService
+	tokens  *lruCache
+	tenants *lruCache
 }
 
 func (c *CachedIdentityService) GetTenantID(tenantName string) (string, error) {
@@ -18,7 +25,7 @@ func (c *CachedIdentityService) GetTenantID(tenantName string) (string, error) {
 }
 
 func (c *CachedIdentityService) GetTenantName(tenantID string) (string, error) {
-	i, ok := c.cache.Get(tenantID)
+	i, _, ok := c.tenants.get(tenantID)
 	if ok {
 		return i.(string), nil
 	}
@@ -26,20 +33,29 @@ func (c *CachedIdentityService) GetTenantName(tenantID string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	c.cache.Set(tenantID, name, cache.DefaultExpiration)
+	c.tenants.set(tenantID, name)
 	return name, nil
 }
 
+//VerifyToken returns cached authorization. Tokens cached before their tenant or user
+//has been revoked are rejected, as they were issued before the revocation too.
 func (c *CachedIdentityService) VerifyToken(token string) (schema.Authorization, error) {
-	i, ok := c.cache.Get(token)
+	i, verifiedAt, ok := c.tokens.get(token)
+	if ok && GetTokenRevocations().invalidatedSince(i.(schema.Authorization), verifiedAt) {
+		c.tokens.delete(token)
+		return nil, fmt.Errorf("Token has been revoked")
+	}
 	if ok {
+		metrics.UpdateCounter(1, "auth.cache.hit")
 		return i.(schema.Authorization), nil
 	}
+	metrics.UpdateCounter(1, "auth.cache.miss")
 	a, err := c.inner.VerifyToken(token)
 	if err != nil {
+		c.tokens.delete(token)
 		return nil, err
 	}
-	c.cache.Set(token, a, cache.DefaultExpiration)
+	c.tokens.set(token, a)
 	return a, nil
 }
 
@@ -51,10 +67,81 @@ func (c *CachedIdentityService) GetClient() *gophercloud.ServiceClient {
 	return c.inner.GetClient()
 }
 
-func NewCachedIdentityService(inner IdentityService, ttl time.Duration) IdentityService {
-	cleanupInterval := 4 * ttl
+//NewCachedIdentityService creates identity service caching at most maxSize tokens and tenant names for ttl
+func NewCachedIdentityService(inner IdentityService, ttl time.Duration, maxSize int) IdentityService {
 	return &CachedIdentityService{
-		inner: inner,
-		cache: cache.New(ttl, cleanupInterval),
+		inner:   inner,
+		tokens:  newLRUCache(ttl, maxSize),
+		tenants: newLRUCache(ttl, maxSize),
+	}
+}
+
+//lruCache keeps values for ttl and evicts the least recently used ones when it is full
+type lruCache struct {
+	ttl     time.Duration
+	maxSize int
+	now     func() time.Time
+
+	mutex   gosync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	setAt time.Time
+}
+
+func newLRUCache(ttl time.Duration, maxSize int) *lruCache {
+	return &lruCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
 	}
 }
+
+//get returns the value and the time it was stored at
+func (cache *lruCache) get(key string) (interface{}, time.Time, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	entry := element.Value.(*lruEntry)
+	if cache.now().Sub(entry.setAt) >= cache.ttl {
+		cache.remove(element)
+		return nil, time.Time{}, false
+	}
+	cache.order.MoveToFront(element)
+	return entry.value, entry.setAt, true
+}
+
+func (cache *lruCache) set(key string, value interface{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+	cache.entries[key] = cache.order.PushFront(&lruEntry{key: key, value: value, setAt: cache.now()})
+	for cache.maxSize > 0 && cache.order.Len() > cache.maxSize {
+		cache.remove(cache.order.Back())
+		metrics.UpdateCounter(1, "auth.cache.eviction")
+	}
+}
+
+func (cache *lruCache) delete(key string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+}
+
+func (cache *lruCache) remove(element *list.Element) {
+	cache.order.Remove(element)
+	delete(cache.entries, element.Value.(*lruEntry).key)
+}
@@ -26,7 +26,7 @@ var _ = ginkgo.Describe("Cached identity service", func() {
 	ginkgo.BeforeEach(func() {
 		ctrl = gomock.NewController(ginkgo.GinkgoT())
 		mockedIdentityService = NewMockIdentityService(ctrl)
-		cachedIdentityService = NewCachedIdentityService(mockedIdentityService, time.Second)
+		cachedIdentityService = NewCachedIdentityService(mockedIdentityService, time.Second, 2)
 		serviceClient = &gophercloud.ServiceClient{ProviderClient: &gophercloud.ProviderClient{TokenID: token}}
 		tenantID = "tenant-id"
 		tenantName = "tenant-name"
@@ -48,6 +48,35 @@ var _ = ginkgo.Describe("Cached identity service", func() {
 		Expect(err).To(BeNil())
 	})
 
+	ginkgo.It("Evicts least recently used authorizations", func() {
+		other := schema.NewAuthorization(tenantID, tenantName, "other", []string{}, nil)
+		third := schema.NewAuthorization(tenantID, tenantName, "third", []string{}, nil)
+		mockedIdentityService.EXPECT().VerifyToken(token).Return(auth, nil).Times(1)
+		mockedIdentityService.EXPECT().VerifyToken("other").Return(other, nil).Times(2)
+		mockedIdentityService.EXPECT().VerifyToken("third").Return(third, nil).Times(1)
+		for _, t := range []string{token, "other", token, "third", token, "other"} {
+			_, err := cachedIdentityService.VerifyToken(t)
+			Expect(err).To(BeNil())
+		}
+	})
+
+	ginkgo.It("Rejects cached token when its tenant or user has been revoked", func() {
+		userAuth := schema.NewUserAuthorization("user-id", tenantID, tenantName, token, []string{}, nil)
+		mockedIdentityService.EXPECT().VerifyToken(token).Return(userAuth, nil).Times(2)
+		for _, revoke := range []func() error{
+			func() error { return tokenRevocations.RevokeTenant(tenantID) },
+			func() error { return tokenRevocations.RevokeUser("user-id") },
+		} {
+			tokenRevocations = NewTokenRevocations(nil, time.Hour)
+			_, err := cachedIdentityService.VerifyToken(token)
+			Expect(err).To(BeNil())
+			Expect(revoke()).To(Succeed())
+			_, err = cachedIdentityService.VerifyToken(token)
+			Expect(err).To(MatchError(ContainSubstring("revoked")))
+		}
+		tokenRevocations = nil
+	})
+
 	ginkgo.It("Pass GetTenantID to inner service", func() {
 		mockedIdentityService.EXPECT().GetTenantID(tenantName).Return(tenantID, nil)
 		rv, err := cachedIdentityService.GetTenantID(tenantName)
@@ -0,0 +1,162 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+	"github.com/rackspace/gophercloud"
+)
+
+//CertificateVerifier is implemented by identity services which authenticate clients with TLS certificates
+type CertificateVerifier interface {
+	VerifyCertificate(cert *x509.Certificate) (schema.Authorization, error)
+}
+
+//CertificateMapping names certificate fields mapped to authorization.
+//Supported fields are subject.common_name, subject.organization, subject.organizational_unit,
+//san.dns, san.email and san.uri.
+type CertificateMapping struct {
+	TenantIDField   string
+	TenantNameField string
+	UserIDField     string
+	RolesField      string
+	DefaultRoles    []string
+}
+
+var certificateFields = map[string]func(cert *x509.Certificate) []string{
+	"subject.common_name": func(cert *x509.Certificate) []string {
+		if cert.Subject.CommonName == "" {
+			return nil
+		}
+		return []string{cert.Subject.CommonName}
+	},
+	"subject.organization":        func(cert *x509.Certificate) []string { return cert.Subject.Organization },
+	"subject.organizational_unit": func(cert *x509.Certificate) []string { return cert.Subject.OrganizationalUnit },
+	"san.dns":                     func(cert *x509.Certificate) []string { return cert.DNSNames },
+	"san.email":                   func(cert *x509.Certificate) []string { return cert.EmailAddresses },
+	"san.uri": func(cert *x509.Certificate) []string {
+		uris := []string{}
+		for _, uri := range cert.URIs {
+			uris = append(uris, uri.String())
+		}
+		return uris
+	},
+}
+
+//CertificateIdentity authenticates clients with verified TLS certificates.
+//Tokens are verified by the inner identity service, so certificates can be used together with other authentication.
+type CertificateIdentity struct {
+	inner   IdentityService
+	mapping CertificateMapping
+}
+
+//NewCertificateIdentity creates certificate identity service; inner may be nil when only certificates are accepted
+func NewCertificateIdentity(inner IdentityService, mapping CertificateMapping) (*CertificateIdentity, error) {
+	for _, field := range []string{mapping.TenantIDField, mapping.TenantNameField, mapping.UserIDField, mapping.RolesField} {
+		if _, ok := certificateFields[field]; field != "" && !ok {
+			return nil, fmt.Errorf("Unknown certificate field %s", field)
+		}
+	}
+	if mapping.TenantIDField == "" {
+		return nil, fmt.Errorf("Certificate field mapped to tenant ID is required")
+	}
+	return &CertificateIdentity{inner: inner, mapping: mapping}, nil
+}
+
+//NewCertificateIdentityFromConfig creates certificate identity service from tls/client_identity config
+func NewCertificateIdentityFromConfig(config *util.Config, inner IdentityService) (*CertificateIdentity, error) {
+	return NewCertificateIdentity(inner, CertificateMapping{
+		TenantIDField:   config.GetString("tls/client_identity/tenant_id", "subject.organization"),
+		TenantNameField: config.GetString("tls/client_identity/tenant_name", ""),
+		UserIDField:     config.GetString("tls/client_identity/user_id", "subject.common_name"),
+		RolesField:      config.GetString("tls/client_identity/roles", "subject.organizational_unit"),
+		DefaultRoles:    config.GetStringList("tls/client_identity/default_roles", []string{}),
+	})
+}
+
+func (identity *CertificateIdentity) field(cert *x509.Certificate, name string) []string {
+	if name == "" {
+		return nil
+	}
+	return certificateFields[name](cert)
+}
+
+func (identity *CertificateIdentity) firstField(cert *x509.Certificate, name string) string {
+	if values := identity.field(cert, name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+//VerifyCertificate maps fields of the verified client certificate to authorization
+func (identity *CertificateIdentity) VerifyCertificate(cert *x509.Certificate) (schema.Authorization, error) {
+	tenantID := identity.firstField(cert, identity.mapping.TenantIDField)
+	if tenantID == "" {
+		return nil, fmt.Errorf("Client certificate has no %s", identity.mapping.TenantIDField)
+	}
+	tenantName := identity.firstField(cert, identity.mapping.TenantNameField)
+	if tenantName == "" {
+		tenantName = tenantID
+	}
+	roles := append([]string{}, identity.mapping.DefaultRoles...)
+	roles = append(roles, identity.field(cert, identity.mapping.RolesField)...)
+	userID := identity.firstField(cert, identity.mapping.UserIDField)
+	return schema.WithIssuedAt(schema.NewUserAuthorization(userID, tenantID, tenantName, "", roles, nil), cert.NotBefore), nil
+}
+
+//VerifyToken verifies the token using the inner identity service
+func (identity *CertificateIdentity) VerifyToken(token string) (schema.Authorization, error) {
+	if identity.inner == nil {
+		return nil, fmt.Errorf("Client certificate is required")
+	}
+	return identity.inner.VerifyToken(token)
+}
+
+//GetTenantID maps the given tenant name to the tenant's ID using the inner identity service
+func (identity *CertificateIdentity) GetTenantID(tenantName string) (string, error) {
+	if identity.inner == nil {
+		return tenantName, nil
+	}
+	return identity.inner.GetTenantID(tenantName)
+}
+
+//GetTenantName maps the given tenant ID to the tenant's name using the inner identity service
+func (identity *CertificateIdentity) GetTenantName(tenantID string) (string, error) {
+	if identity.inner == nil {
+		return tenantID, nil
+	}
+	return identity.inner.GetTenantName(tenantID)
+}
+
+//GetServiceAuthorization returns the service authorization of the inner identity service
+func (identity *CertificateIdentity) GetServiceAuthorization() (schema.Authorization, error) {
+	if identity.inner == nil {
+		return schema.NewAuthorization("admin", "admin", "", []string{"admin"}, nil), nil
+	}
+	return identity.inner.GetServiceAuthorization()
+}
+
+//GetClient returns the client of the inner identity service
+func (identity *CertificateIdentity) GetClient() *gophercloud.ServiceClient {
+	if identity.inner == nil {
+		return nil
+	}
+	return identity.inner.GetClient()
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/go-martini/martini"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Certificate identity", func() {
+	var (
+		caKey    *ecdsa.PrivateKey
+		caCert   *x509.Certificate
+		identity *CertificateIdentity
+	)
+
+	newCertificate := func(subject pkix.Name, dnsNames []string) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(time.Now().UnixNano()),
+			Subject:      subject,
+			DNSNames:     dnsNames,
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "test-ca"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &caKey.PublicKey, caKey)
+		Expect(err).ToNot(HaveOccurred())
+		caCert, err = x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+
+		identity, err = NewCertificateIdentity(nil, CertificateMapping{
+			TenantIDField: "subject.organization",
+			UserIDField:   "subject.common_name",
+			RolesField:    "subject.organizational_unit",
+			DefaultRoles:  []string{"agent"},
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	ginkgo.It("rejects unknown fields", func() {
+		_, err := NewCertificateIdentity(nil, CertificateMapping{TenantIDField: "subject.country"})
+		Expect(err).To(MatchError(ContainSubstring("Unknown certificate field subject.country")))
+	})
+
+	ginkgo.It("maps certificate fields to authorization", func() {
+		cert := newCertificate(pkix.Name{
+			CommonName:         "agent-1",
+			Organization:       []string{"tenant-a"},
+			OrganizationalUnit: []string{"Member", "viewer"},
+		}, nil)
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		auth, err := identity.VerifyCertificate(parsed)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(auth.TenantID()).To(Equal("tenant-a"))
+		Expect(auth.TenantName()).To(Equal("tenant-a"))
+		Expect(schema.UserIDOf(auth)).To(Equal("agent-1"))
+		roles := []string{}
+		for _, role := range auth.Roles() {
+			roles = append(roles, role.Name)
+		}
+		Expect(roles).To(Equal([]string{"agent", "Member", "viewer"}))
+
+		noTenant := newCertificate(pkix.Name{CommonName: "agent-2"}, nil)
+		parsed, err = x509.ParseCertificate(noTenant.Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		_, err = identity.VerifyCertificate(parsed)
+		Expect(err).To(MatchError(ContainSubstring("has no subject.organization")))
+	})
+
+	ginkgo.It("authenticates requests with verified client certificates", func() {
+		m := martini.New()
+		m.MapTo(identity, (*IdentityService)(nil))
+		m.MapTo(NewNobodyResourceService(nil), (*NobodyResourceService)(nil))
+		m.Use(Authentication())
+		m.Action(func(res http.ResponseWriter, auth schema.Authorization) {
+			json.NewEncoder(res).Encode(map[string]string{"tenant_id": auth.TenantID()})
+		})
+		server := httptest.NewUnstartedServer(m)
+		pool := x509.NewCertPool()
+		pool.AddCert(caCert)
+		server.TLS = &tls.Config{
+			Certificates: []tls.Certificate{newCertificate(pkix.Name{CommonName: "127.0.0.1"}, []string{"localhost"})},
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+			ClientCAs:    pool,
+		}
+		server.StartTLS()
+		defer server.Close()
+
+		request := func(certificates ...tls.Certificate) *http.Response {
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+				RootCAs:      pool,
+				ServerName:   "localhost",
+				Certificates: certificates,
+			}}}
+			resp, err := client.Get(server.URL + "/v2.0/networks")
+			Expect(err).ToNot(HaveOccurred())
+			return resp
+		}
+
+		resp := request(newCertificate(pkix.Name{CommonName: "agent-1", Organization: []string{"tenant-a"}}, nil))
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		var body map[string]string
+		Expect(json.NewDecoder(resp.Body).Decode(&body)).To(Succeed())
+		Expect(body).To(HaveKeyWithValue("tenant_id", "tenant-a"))
+
+		resp = request()
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+	})
+})
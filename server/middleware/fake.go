@@ -166,9 +166,11 @@ func (*FakeIdentity) VerifyToken(tokenID string) (schema.Authorization, error) {
 	access, _ := rawToken.(map[string]interface{})["access"].(map[string]interface{})
 	tenantID := access["token"].(token).Tenant.ID
 	tenantName := access["token"].(token).Tenant.Name
-	role := access["user"].(map[string]interface{})["roles"].([]role)[0].Name
+	user := access["user"].(map[string]interface{})
+	role := user["roles"].([]role)[0].Name
+	userID, _ := user["id"].(string)
 
-	return schema.NewAuthorization(tenantID, tenantName, tokenID, []string{role}, nil), nil
+	return schema.NewUserAuthorization(userID, tenantID, tenantName, tokenID, []string{role}, nil), nil
 }
 
 // GetTenantID maps the given tenant name to the tenant's ID
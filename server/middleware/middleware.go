@@ -17,9 +17,11 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/x509"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -27,11 +29,14 @@ import (
 	"fmt"
 
 	"github.com/cloudwan/gohan/cloud"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/tracing"
 	"github.com/cloudwan/gohan/util"
 	"github.com/go-martini/martini"
 	"github.com/rackspace/gophercloud"
+	"github.com/twinj/uuid"
 )
 
 const webuiPATH = "/webui/"
@@ -62,6 +67,7 @@ func Logging() martini.Handler {
 			return
 		}
 		start := time.Now()
+		logger := l.WithRequestID(log, l.RequestIDFromContext(req.Context()))
 
 		addr := req.Header.Get("X-Real-IP")
 		if addr == "" {
@@ -75,10 +81,11 @@ func Logging() martini.Handler {
 		buff := ioutil.NopCloser(bytes.NewBuffer(reqData))
 		req.Body = buff
 
-		log.Info("Started %s %s for client %s data: %s",
-			req.Method, req.URL.String(), addr, string(reqData))
-		log.Debug("Request headers: %v", filterHeaders(req.Header))
-		log.Debug("Request body: %s", string(reqData))
+		loggedData := schema.GetManager().RedactSecretsInJSON(reqData)
+		logger.Info("Started %s %s for client %s data: %s",
+			req.Method, req.URL.String(), addr, string(loggedData))
+		logger.Debug("Request headers: %v", filterHeaders(req.Header))
+		logger.Debug("Request body: %s", string(loggedData))
 
 		rw := res.(martini.ResponseWriter)
 		rh := newResponseHijacker(rw)
@@ -88,10 +95,65 @@ func Logging() martini.Handler {
 		c.Next()
 
 		response, _ := ioutil.ReadAll(rh.Response)
-		log.Debug("Response headers: %v", rh.Header())
-		log.Debug("Response body: %s", string(response))
-		log.Info("Completed %v %s in %v", rw.Status(), http.StatusText(rw.Status()), time.Since(start))
+		logger.Debug("Response headers: %v", rh.Header())
+		logger.Debug("Response body: %s", string(schema.GetManager().RedactSecretsInJSON(response)))
+		duration := time.Since(start)
+		logger.Info("Completed %v %s in %v", rw.Status(), http.StatusText(rw.Status()), duration)
+		record := &l.AccessRecord{
+			RequestID:  l.RequestIDFromContext(req.Context()),
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			RemoteAddr: addr,
+			Status:     rw.Status(),
+			Duration:   float64(duration) / float64(time.Millisecond),
+		}
+		if auth := authorizationFromContext(c); auth != nil {
+			record.TenantID = auth.TenantID()
+			record.TenantName = auth.TenantName()
+		}
+		l.LogAccess(record)
+	}
+}
+
+//authorizationFromContext returns authorization mapped by Authentication or nil
+//when the request hasn't been authenticated yet
+func authorizationFromContext(c martini.Context) schema.Authorization {
+	auth := c.Get(reflect.TypeOf((*schema.Authorization)(nil)).Elem())
+	if !auth.IsValid() || auth.IsNil() {
+		return nil
+	}
+	return auth.Interface().(schema.Authorization)
+}
+
+//RequestIDHeader is a header carrying ID of the request
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 200
+
+//RequestID assigns ID to each request, so log records and events caused by the request can be correlated.
+//ID given by the client in X-Request-ID header is used if it is valid.
+func RequestID() martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		requestID := req.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewV4().String()
+		}
+		res.Header().Set(RequestIDHeader, requestID)
+		c.Map(req.WithContext(l.ContextWithRequestID(req.Context(), requestID)))
+		c.Next()
+	}
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
 	}
+	return true
 }
 
 func Metrics() martini.Handler {
@@ -109,6 +171,29 @@ func Metrics() martini.Handler {
 	}
 }
 
+//Tracing starts a span for each request, continuing trace given in traceparent header
+func Tracing() martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		span := tracing.StartSpan(tracing.Extract(req.Header), "HTTP "+req.Method, tracing.SpanKindServer)
+		if span == nil {
+			c.Next()
+			return
+		}
+		defer span.End()
+		span.SetAttribute("http.method", req.Method)
+		span.SetAttribute("http.target", req.URL.Path)
+		c.Map(req.WithContext(tracing.ContextWithSpan(req.Context(), span)))
+
+		c.Next()
+
+		rw := res.(martini.ResponseWriter)
+		span.SetAttribute("http.status_code", rw.Status())
+		if rw.Status() >= 500 {
+			span.SetError(fmt.Errorf("%s", http.StatusText(rw.Status())))
+		}
+	}
+}
+
 func filterHeaders(headers http.Header) http.Header {
 	filtered := http.Header{}
 	for k, v := range headers {
@@ -130,8 +215,12 @@ type IdentityService interface {
 	GetClient() *gophercloud.ServiceClient
 }
 
-// CreateIdentityServiceFromConfig creates keystone identity from config
+// CreateIdentityServiceFromConfig creates keystone or JWT identity from config
 func CreateIdentityServiceFromConfig(config *util.Config) (IdentityService, error) {
+	if config.GetBool("jwt/enabled", false) {
+		log.Info("JWT identity service configured")
+		return createJWTIdentityFromConfig(config)
+	}
 	//TODO(marcin) remove this
 	if config.GetBool("keystone/use_keystone", false) {
 		if config.GetBool("keystone/fake", false) {
@@ -158,13 +247,39 @@ func CreateIdentityServiceFromConfig(config *util.Config) (IdentityService, erro
 			if err != nil {
 				log.Fatal("Failed to parse keystone cache TTL")
 			}
-			keystoneIdentity = NewCachedIdentityService(keystoneIdentity, ttl)
+			keystoneIdentity = NewCachedIdentityService(keystoneIdentity, ttl,
+				config.GetInt("keystone/cache_size", DefaultIdentityCacheSize))
 		}
 		return keystoneIdentity, nil
 	}
 	return nil, fmt.Errorf("No identity service defined in config")
 }
 
+func createJWTIdentityFromConfig(config *util.Config) (IdentityService, error) {
+	refreshInterval, err := time.ParseDuration(config.GetString("jwt/jwks_refresh_interval", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse JWKS refresh interval: %s", err)
+	}
+	leeway, err := time.ParseDuration(config.GetString("jwt/leeway", "30s"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse JWT leeway: %s", err)
+	}
+	return cloud.NewJWTIdentity(cloud.JWTConfig{
+		JWKSFile:            config.GetString("jwt/jwks_file", ""),
+		JWKSURL:             config.GetString("jwt/jwks_url", ""),
+		JWKSRefreshInterval: refreshInterval,
+		Issuer:              config.GetString("jwt/issuer", ""),
+		Audience:            config.GetString("jwt/audience", ""),
+		Leeway:              leeway,
+		TenantIDClaim:       config.GetString("jwt/claims/tenant_id", "tenant_id"),
+		TenantNameClaim:     config.GetString("jwt/claims/tenant_name", "tenant_name"),
+		RolesClaim:          config.GetString("jwt/claims/roles", "roles"),
+		ServiceTenantID:     config.GetString("jwt/service/tenant_id", "admin"),
+		ServiceTenantName:   config.GetString("jwt/service/tenant_name", "admin"),
+		ServiceRoles:        config.GetStringList("jwt/service/roles", []string{"admin"}),
+	})
+}
+
 //NobodyResourceService contains a definition of nobody resources (that do not require authorization)
 type NobodyResourceService interface {
 	VerifyResourcePath(string) bool
@@ -262,6 +377,24 @@ func HTTPJSONError(res http.ResponseWriter, err string, code int) {
 	http.Error(res, string(responseJSON), code)
 }
 
+//tokenFromAuthorizationHeader returns the token of Bearer or ApiKey authorization scheme
+func tokenFromAuthorizationHeader(header string) string {
+	for _, scheme := range []string{"Bearer ", "ApiKey "} {
+		if strings.HasPrefix(header, scheme) {
+			return strings.TrimSpace(strings.TrimPrefix(header, scheme))
+		}
+	}
+	return ""
+}
+
+//clientCertificate returns the client certificate verified during TLS handshake or nil
+func clientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return req.TLS.VerifiedChains[0][0]
+}
+
 //Authentication authenticates user using keystone
 func Authentication() martini.Handler {
 	return func(res http.ResponseWriter, req *http.Request, identityService IdentityService, nobodyResourceService NobodyResourceService, c martini.Context) {
@@ -291,9 +424,27 @@ func Authentication() martini.Handler {
 		}
 
 		authToken := req.Header.Get("X-Auth-Token")
+		if authToken == "" {
+			authToken = tokenFromAuthorizationHeader(req.Header.Get("Authorization"))
+		}
 
 		var targetIdentityService IdentityService
 
+		if verifier, ok := identityService.(CertificateVerifier); ok && authToken == "" && clientCertificate(req) != nil {
+			auth, err := verifier.VerifyCertificate(clientCertificate(req))
+			if err != nil {
+				HTTPJSONError(res, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if GetTokenRevocations().IsAuthorizationRevoked(auth) {
+				HTTPJSONError(res, "Certificate has been revoked", http.StatusUnauthorized)
+				return
+			}
+			c.Map(auth)
+			c.Next()
+			return
+		}
+
 		if authToken == "" {
 			if nobodyResourceService.VerifyResourcePath(req.URL.Path) {
 				targetIdentityService = &NobodyIdentityService{}
@@ -301,6 +452,9 @@ func Authentication() martini.Handler {
 				HTTPJSONError(res, "No X-Auth-Token", http.StatusUnauthorized)
 				return
 			}
+		} else if GetTokenRevocations().IsRevoked(authToken) {
+			HTTPJSONError(res, "Token has been revoked", http.StatusUnauthorized)
+			return
 		} else {
 			targetIdentityService = identityService
 		}
@@ -311,6 +465,11 @@ func Authentication() martini.Handler {
 			HTTPJSONError(res, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		// tokens of revoked tenants and users are valid for the identity service until they expire
+		if GetTokenRevocations().IsAuthorizationRevoked(auth) {
+			HTTPJSONError(res, "Token has been revoked", http.StatusUnauthorized)
+			return
+		}
 
 		c.Map(auth)
 		c.Next()
@@ -0,0 +1,313 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/util"
+	"github.com/go-martini/martini"
+)
+
+const (
+	rateLimitPath            = "/gohan/rate_limit/"
+	rateLimitSwapAttempts    = 10
+	rateLimitCleanupInterval = time.Minute
+)
+
+//rateLimitRule describes a token bucket; rate is a number of tokens added per second
+type rateLimitRule struct {
+	name   string
+	method string
+	path   *regexp.Regexp
+	rate   float64
+	burst  float64
+}
+
+func (rule *rateLimitRule) matches(req *http.Request) bool {
+	if rule.method != "" && !strings.EqualFold(rule.method, req.Method) {
+		return false
+	}
+	return rule.path == nil || rule.path.MatchString(req.URL.Path)
+}
+
+//tokenBucket is a state of the bucket, stored in JSON in shared mode
+type tokenBucket struct {
+	Tokens  float64 `json:"tokens"`
+	Updated int64   `json:"updated"`
+}
+
+//take refills the bucket and takes a token from it.
+//It returns number of the remaining tokens and time to wait for the next one when the bucket is empty.
+func (bucket *tokenBucket) take(rule *rateLimitRule, now time.Time) (bool, float64, time.Duration) {
+	if bucket.Updated == 0 {
+		bucket.Tokens = rule.burst
+	} else if elapsed := now.Sub(time.Unix(0, bucket.Updated)).Seconds(); elapsed > 0 {
+		bucket.Tokens = math.Min(rule.burst, bucket.Tokens+elapsed*rule.rate)
+	}
+	bucket.Updated = now.UnixNano()
+	if bucket.Tokens < 1 {
+		wait := time.Duration((1 - bucket.Tokens) / rule.rate * float64(time.Second))
+		return false, bucket.Tokens, wait
+	}
+	bucket.Tokens--
+	return true, bucket.Tokens, 0
+}
+
+//refillTime returns time in which empty bucket of the rule gets full again
+func (rule *rateLimitRule) refillTime() time.Duration {
+	return time.Duration(rule.burst / rule.rate * float64(time.Second))
+}
+
+//bucketStore keeps token buckets
+type bucketStore interface {
+	take(key string, rule *rateLimitRule, now time.Time) (bool, float64, time.Duration, error)
+}
+
+//memoryBucketStore keeps buckets of this process
+type memoryBucketStore struct {
+	mutex       gosync.Mutex
+	buckets     map[string]*tokenBucket
+	lastCleanup time.Time
+}
+
+func newMemoryBucketStore() *memoryBucketStore {
+	return &memoryBucketStore{buckets: map[string]*tokenBucket{}, lastCleanup: time.Now()}
+}
+
+func (store *memoryBucketStore) take(key string, rule *rateLimitRule, now time.Time) (bool, float64, time.Duration, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if now.Sub(store.lastCleanup) > rateLimitCleanupInterval {
+		store.cleanup(now)
+	}
+	bucket, ok := store.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{}
+		store.buckets[key] = bucket
+	}
+	allowed, remaining, wait := bucket.take(rule, now)
+	return allowed, remaining, wait, nil
+}
+
+//cleanup removes buckets which has been idle long enough to be full again
+func (store *memoryBucketStore) cleanup(now time.Time) {
+	for key, bucket := range store.buckets {
+		if now.Sub(time.Unix(0, bucket.Updated)) > rateLimitCleanupInterval {
+			delete(store.buckets, key)
+		}
+	}
+	store.lastCleanup = now
+}
+
+//syncBucketStore keeps buckets in sync backend, so they are shared by all the gohan processes.
+//Buckets expire once they are full again, as a missing bucket is taken as full one.
+type syncBucketStore struct {
+	sync sync.Sync
+}
+
+func (store *syncBucketStore) take(key string, rule *rateLimitRule, now time.Time) (bool, float64, time.Duration, error) {
+	path := rateLimitPath + key
+	for attempt := 0; attempt < rateLimitSwapAttempts; attempt++ {
+		bucket := &tokenBucket{}
+		var revision int64
+		if node, err := store.sync.Fetch(path); err == nil && node != nil && node.Value != "" {
+			if err := json.Unmarshal([]byte(node.Value), bucket); err != nil {
+				return false, 0, 0, err
+			}
+			revision = node.Revision
+		}
+		allowed, remaining, wait := bucket.take(rule, now)
+		data, err := json.Marshal(bucket)
+		if err != nil {
+			return false, 0, 0, err
+		}
+		swapped, err := store.sync.CompareAndSwap(path, string(data), revision, rule.refillTime())
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if swapped {
+			return allowed, remaining, wait, nil
+		}
+	}
+	return false, 0, 0, fmt.Errorf("bucket %s is modified concurrently", key)
+}
+
+//RateLimiter limits rate of API requests using token buckets per tenant or user and route
+type RateLimiter struct {
+	key    string
+	rules  []*rateLimitRule
+	store  bucketStore
+	now    func() time.Time
+	shared bool
+}
+
+//NewRateLimiterFromConfig creates rate limiter from rate_limit configuration.
+//It returns nil when rate limiting is disabled.
+func NewRateLimiterFromConfig(config *util.Config, syncConn sync.Sync) (*RateLimiter, error) {
+	if !config.GetBool("rate_limit/enabled", false) {
+		return nil, nil
+	}
+	limiter := &RateLimiter{
+		key: config.GetString("rate_limit/key", "tenant"),
+		now: time.Now,
+	}
+	if limiter.key != "tenant" && limiter.key != "user" {
+		return nil, fmt.Errorf("rate_limit/key should be tenant or user, got %s", limiter.key)
+	}
+	for i, routeRaw := range config.GetList("rate_limit/routes", nil) {
+		route, ok := routeRaw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("rate_limit/routes should contain maps")
+		}
+		rule, err := newRateLimitRule(fmt.Sprintf("route%d", i), route)
+		if err != nil {
+			return nil, err
+		}
+		limiter.rules = append(limiter.rules, rule)
+	}
+	if config.GetParam("rate_limit/rate", nil) != nil {
+		rule, err := newRateLimitRule("default", map[string]interface{}{
+			"rate":  config.GetParam("rate_limit/rate", nil),
+			"burst": config.GetParam("rate_limit/burst", nil),
+		})
+		if err != nil {
+			return nil, err
+		}
+		limiter.rules = append(limiter.rules, rule)
+	}
+	if config.GetBool("rate_limit/shared", false) {
+		if syncConn == nil {
+			return nil, fmt.Errorf("rate_limit/shared requires sync backend")
+		}
+		limiter.store = &syncBucketStore{sync: syncConn}
+		limiter.shared = true
+	} else {
+		limiter.store = newMemoryBucketStore()
+	}
+	return limiter, nil
+}
+
+func newRateLimitRule(name string, config map[string]interface{}) (*rateLimitRule, error) {
+	rate, ok := toFloat(config["rate"])
+	if !ok || rate <= 0 {
+		return nil, fmt.Errorf("rate limit %s: rate should be a positive number", name)
+	}
+	burst := math.Max(1, rate)
+	if burstRaw, found := config["burst"]; found && burstRaw != nil {
+		if burst, ok = toFloat(burstRaw); !ok || burst < 1 {
+			return nil, fmt.Errorf("rate limit %s: burst should be a number not less than 1", name)
+		}
+	}
+	rule := &rateLimitRule{name: name, rate: rate, burst: burst}
+	rule.method, _ = config["method"].(string)
+	if path, _ := config["path"].(string); path != "" {
+		var err error
+		if rule.path, err = regexp.Compile(path); err != nil {
+			return nil, fmt.Errorf("rate limit %s: invalid path: %s", name, err)
+		}
+	}
+	return rule, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//allow takes a token from the bucket of the first rule matching the request.
+//It returns false and time to wait when the limit is exceeded.
+func (limiter *RateLimiter) allow(req *http.Request, auth schema.Authorization) (bool, *rateLimitRule, float64, time.Duration) {
+	for _, rule := range limiter.rules {
+		if !rule.matches(req) {
+			continue
+		}
+		allowed, remaining, wait, err := limiter.store.take(limiter.bucketKey(req, auth, rule), rule, limiter.now())
+		if err != nil {
+			log.Warning("Rate limiter failed, request is allowed: %s", err)
+			return true, rule, 0, 0
+		}
+		return allowed, rule, remaining, wait
+	}
+	return true, nil, 0, 0
+}
+
+func (limiter *RateLimiter) bucketKey(req *http.Request, auth schema.Authorization, rule *rateLimitRule) string {
+	var identity string
+	switch {
+	case auth == nil:
+		identity = "addr:" + remoteHost(req)
+	case limiter.key == "user":
+		//authorization doesn't carry user ID, so users are told apart by their tokens
+		hash := sha1.Sum([]byte(auth.AuthToken()))
+		identity = "user:" + hex.EncodeToString(hash[:])
+	default:
+		identity = "tenant:" + auth.TenantID()
+	}
+	if limiter.shared {
+		identity = strings.Replace(identity, "/", "_", -1)
+	}
+	return identity + "/" + rule.name
+}
+
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+//RateLimit rejects requests exceeding the rate limit with 429 status
+func RateLimit(limiter *RateLimiter) martini.Handler {
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		allowed, rule, remaining, wait := limiter.allow(req, authorizationFromContext(c))
+		if rule != nil {
+			res.Header().Set("X-RateLimit-Limit", strconv.FormatFloat(rule.burst, 'f', -1, 64))
+			res.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		}
+		if allowed {
+			c.Next()
+			return
+		}
+		metrics.UpdateCounter(1, "req.rate_limited")
+		retryAfter := int(math.Ceil(wait.Seconds()))
+		res.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		HTTPJSONError(res, fmt.Sprintf("Rate limit exceeded, retry after %d seconds", retryAfter), http.StatusTooManyRequests)
+	}
+}
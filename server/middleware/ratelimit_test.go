@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	mock_sync "github.com/cloudwan/gohan/sync/mocks"
+	"github.com/cloudwan/gohan/util"
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Rate limiter", func() {
+
+	var (
+		limiter *RateLimiter
+		now     time.Time
+		tenantA schema.Authorization
+		tenantB schema.Authorization
+	)
+
+	readConfig := func(configYAML string) *util.Config {
+		dir, err := ioutil.TempDir("", "gohan_rate_limit")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(dir)
+		configFile := filepath.Join(dir, "config.yaml")
+		Expect(ioutil.WriteFile(configFile, []byte(configYAML), 0644)).To(Succeed())
+		config := util.GetConfig()
+		Expect(config.ReadConfig(configFile)).To(Succeed())
+		return config
+	}
+
+	newLimiter := func(configYAML string, syncConn sync.Sync) *RateLimiter {
+		limiter, err := NewRateLimiterFromConfig(readConfig(configYAML), syncConn)
+		Expect(err).ToNot(HaveOccurred())
+		if limiter != nil {
+			limiter.now = func() time.Time { return now }
+		}
+		return limiter
+	}
+
+	request := func(method, path string) *http.Request {
+		req, err := http.NewRequest(method, "http://localhost"+path, nil)
+		Expect(err).ToNot(HaveOccurred())
+		req.RemoteAddr = "127.0.0.1:12345"
+		return req
+	}
+
+	ginkgo.BeforeEach(func() {
+		now = time.Unix(1500000000, 0)
+		tenantA = schema.NewAuthorization("tenant-a", "tenant-a", "token-a", []string{}, nil)
+		tenantB = schema.NewAuthorization("tenant-b", "tenant-b", "token-b", []string{}, nil)
+	})
+
+	ginkgo.It("returns nil when disabled", func() {
+		Expect(newLimiter("rate_limit:\n  enabled: false\n", nil)).To(BeNil())
+	})
+
+	ginkgo.It("rejects invalid configuration", func() {
+		_, err := NewRateLimiterFromConfig(readConfig("rate_limit:\n  enabled: true\n  rate: -1\n"), nil)
+		Expect(err).To(MatchError(ContainSubstring("rate should be a positive number")))
+	})
+
+	ginkgo.Context("In memory", func() {
+		ginkgo.BeforeEach(func() {
+			limiter = newLimiter(`rate_limit:
+  enabled: true
+  rate: 1
+  burst: 2
+  routes:
+    - method: POST
+      path: ^/v2.0/networks
+      rate: 0.5
+      burst: 1
+`, nil)
+		})
+
+		ginkgo.It("allows bursts and refills tokens over time", func() {
+			allowed, _, _, _ := limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+			allowed, _, _, _ = limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+			allowed, _, _, wait := limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeFalse())
+			Expect(wait).To(Equal(time.Second))
+
+			now = now.Add(time.Second)
+			allowed, _, _, _ = limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+		})
+
+		ginkgo.It("keeps separate buckets for tenants", func() {
+			for i := 0; i < 2; i++ {
+				allowed, _, _, _ := limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+				Expect(allowed).To(BeTrue())
+			}
+			allowed, _, _, _ := limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeFalse())
+			allowed, _, _, _ = limiter.allow(request("GET", "/v2.0/networks"), tenantB)
+			Expect(allowed).To(BeTrue())
+		})
+
+		ginkgo.It("applies limit of the matching route", func() {
+			allowed, rule, _, _ := limiter.allow(request("POST", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+			Expect(rule.name).To(Equal("route0"))
+			allowed, _, _, wait := limiter.allow(request("POST", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeFalse())
+			Expect(wait).To(Equal(2 * time.Second))
+
+			allowed, rule, _, _ = limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+			Expect(rule.name).To(Equal("default"))
+		})
+
+		ginkgo.It("limits unauthenticated requests by remote address", func() {
+			Expect(limiter.bucketKey(request("GET", "/v2.0/tokens"), nil, limiter.rules[1])).To(Equal("addr:127.0.0.1/default"))
+		})
+	})
+
+	ginkgo.Context("Shared", func() {
+		var (
+			ctrl     *gomock.Controller
+			mockSync *mock_sync.MockSync
+		)
+
+		ginkgo.BeforeEach(func() {
+			ctrl = gomock.NewController(ginkgo.GinkgoT())
+			mockSync = mock_sync.NewMockSync(ctrl)
+			limiter = newLimiter("rate_limit:\n  enabled: true\n  shared: true\n  rate: 1\n  burst: 1\n", mockSync)
+		})
+
+		ginkgo.AfterEach(func() {
+			ctrl.Finish()
+		})
+
+		ginkgo.It("retries when the bucket is modified concurrently", func() {
+			path := "/gohan/rate_limit/tenant:tenant-a/default"
+			gomock.InOrder(
+				mockSync.EXPECT().Fetch(path).Return(nil, nil),
+				mockSync.EXPECT().CompareAndSwap(path, gomock.Any(), int64(0), time.Second).Return(false, nil),
+				mockSync.EXPECT().Fetch(path).Return(&sync.Node{
+					Key:      path,
+					Value:    `{"tokens":1,"updated":1500000000000000000}`,
+					Revision: 7,
+				}, nil),
+				mockSync.EXPECT().CompareAndSwap(path, `{"tokens":0,"updated":1500000000000000000}`, int64(7), time.Second).Return(true, nil),
+			)
+			allowed, _, _, _ := limiter.allow(request("GET", "/v2.0/networks"), tenantA)
+			Expect(allowed).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,250 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	"github.com/cloudwan/gohan/util"
+	"github.com/twinj/uuid"
+)
+
+//TokenRevocationPath is a sync path revocations are propagated through to all Gohan nodes
+const TokenRevocationPath = "/gohan/token_revocation"
+
+const tokenRevocationWatchRetryInterval = 5 * time.Second
+
+var (
+	tokenRevocationsMutex gosync.RWMutex
+	tokenRevocations      *TokenRevocations
+)
+
+//TokenRevocation revokes a single token or invalidates all tokens of a tenant or a user
+type TokenRevocation struct {
+	TokenHash string    `json:"token_hash,omitempty"`
+	TenantID  string    `json:"tenant_id,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+//TokenRevocations keeps revocations issued on any Gohan node for the configured time
+type TokenRevocations struct {
+	sync sync.Sync
+	ttl  time.Duration
+	now  func() time.Time
+
+	mutex   gosync.RWMutex
+	tokens  map[string]time.Time
+	tenants map[string]time.Time
+	users   map[string]time.Time
+}
+
+//NewTokenRevocations creates revocations kept for ttl and propagated through the sync backend, which may be nil
+func NewTokenRevocations(syncConn sync.Sync, ttl time.Duration) *TokenRevocations {
+	return &TokenRevocations{
+		sync:    syncConn,
+		ttl:     ttl,
+		now:     time.Now,
+		tokens:  map[string]time.Time{},
+		tenants: map[string]time.Time{},
+		users:   map[string]time.Time{},
+	}
+}
+
+//SetupTokenRevocations creates revocations from config and makes them available with GetTokenRevocations
+func SetupTokenRevocations(config *util.Config, syncConn sync.Sync) (*TokenRevocations, error) {
+	ttl, err := time.ParseDuration(config.GetString("token_revocation/ttl", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse token revocation TTL: %s", err)
+	}
+	revocations := NewTokenRevocations(syncConn, ttl)
+	tokenRevocationsMutex.Lock()
+	defer tokenRevocationsMutex.Unlock()
+	tokenRevocations = revocations
+	return revocations, nil
+}
+
+//GetTokenRevocations returns revocations of the server or nil when they aren't set up
+func GetTokenRevocations() *TokenRevocations {
+	tokenRevocationsMutex.RLock()
+	defer tokenRevocationsMutex.RUnlock()
+	return tokenRevocations
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+//RevokeToken rejects the token on all nodes
+func (revocations *TokenRevocations) RevokeToken(token string) error {
+	return revocations.Revoke(TokenRevocation{TokenHash: hashToken(token)})
+}
+
+//RevokeTenant rejects all tokens of the tenant issued before on all nodes
+func (revocations *TokenRevocations) RevokeTenant(tenantID string) error {
+	return revocations.Revoke(TokenRevocation{TenantID: tenantID})
+}
+
+//RevokeUser rejects all tokens of the user issued before on all nodes
+func (revocations *TokenRevocations) RevokeUser(userID string) error {
+	return revocations.Revoke(TokenRevocation{UserID: userID})
+}
+
+//Revoke applies the revocation locally and propagates it to other nodes
+func (revocations *TokenRevocations) Revoke(revocation TokenRevocation) error {
+	if revocation.TokenHash == "" && revocation.TenantID == "" && revocation.UserID == "" {
+		return fmt.Errorf("token, tenant ID or user ID has to be given")
+	}
+	revocation.RevokedAt = revocations.now().UTC()
+	revocations.apply(revocation)
+	metrics.UpdateCounter(1, "auth.revocation")
+	if revocations.sync == nil {
+		return nil
+	}
+	data, err := json.Marshal(revocation)
+	if err != nil {
+		return err
+	}
+	if err = revocations.sync.Update(TokenRevocationPath+"/"+uuid.NewV4().String(), string(data)); err != nil {
+		return fmt.Errorf("Failed to propagate token revocation to other nodes: %s", err)
+	}
+	return nil
+}
+
+func (revocations *TokenRevocations) apply(revocation TokenRevocation) {
+	expiry := revocation.RevokedAt.Add(revocations.ttl)
+	if !revocations.now().Before(expiry) {
+		return
+	}
+	revocations.mutex.Lock()
+	defer revocations.mutex.Unlock()
+	revocations.removeExpired()
+	if revocation.TokenHash != "" {
+		revocations.tokens[revocation.TokenHash] = expiry
+	}
+	if revocation.TenantID != "" && revocations.tenants[revocation.TenantID].Before(revocation.RevokedAt) {
+		revocations.tenants[revocation.TenantID] = revocation.RevokedAt
+	}
+	if revocation.UserID != "" && revocations.users[revocation.UserID].Before(revocation.RevokedAt) {
+		revocations.users[revocation.UserID] = revocation.RevokedAt
+	}
+}
+
+//removeExpired forgets revocations older than ttl; it has to be called with the mutex locked
+func (revocations *TokenRevocations) removeExpired() {
+	now := revocations.now()
+	for hash, expiry := range revocations.tokens {
+		if !now.Before(expiry) {
+			delete(revocations.tokens, hash)
+		}
+	}
+	for _, revoked := range []map[string]time.Time{revocations.tenants, revocations.users} {
+		for id, revokedAt := range revoked {
+			if !now.Before(revokedAt.Add(revocations.ttl)) {
+				delete(revoked, id)
+			}
+		}
+	}
+}
+
+//IsRevoked checks whether the token has been revoked
+func (revocations *TokenRevocations) IsRevoked(token string) bool {
+	if revocations == nil {
+		return false
+	}
+	revocations.mutex.RLock()
+	defer revocations.mutex.RUnlock()
+	expiry, ok := revocations.tokens[hashToken(token)]
+	return ok && revocations.now().Before(expiry)
+}
+
+//IsAuthorizationRevoked checks whether tenant or user of the authorization has been revoked since its
+//credentials were issued. Authorizations which don't know their issue time, e.g. of API keys,
+//are rejected until the revocation expires.
+func (revocations *TokenRevocations) IsAuthorizationRevoked(auth schema.Authorization) bool {
+	return revocations.invalidatedSince(auth, schema.IssuedAtOf(auth))
+}
+
+//invalidatedSince checks whether tenant or user of the authorization has been revoked since the given time
+func (revocations *TokenRevocations) invalidatedSince(auth schema.Authorization, since time.Time) bool {
+	if revocations == nil {
+		return false
+	}
+	revocations.mutex.RLock()
+	defer revocations.mutex.RUnlock()
+	if revokedAt, ok := revocations.tenants[auth.TenantID()]; ok && revocations.revokedSince(revokedAt, since) {
+		return true
+	}
+	userID := schema.UserIDOf(auth)
+	if revokedAt, ok := revocations.users[userID]; ok && userID != "" && revocations.revokedSince(revokedAt, since) {
+		return true
+	}
+	return false
+}
+
+func (revocations *TokenRevocations) revokedSince(revokedAt, since time.Time) bool {
+	return !revokedAt.Before(since) && revocations.now().Before(revokedAt.Add(revocations.ttl))
+}
+
+//Run applies revocations issued on other nodes until the context is canceled
+func (revocations *TokenRevocations) Run(ctx context.Context) {
+	for {
+		for event := range revocations.sync.WatchContext(ctx, TokenRevocationPath, sync.RevisionCurrent) {
+			if event.Err != nil {
+				log.Warning("Watching token revocations failed: %s", event.Err)
+				break
+			}
+			revocations.handleEvent(event)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(tokenRevocationWatchRetryInterval):
+		}
+	}
+}
+
+func (revocations *TokenRevocations) handleEvent(event *sync.Event) {
+	if event.Action == "delete" || event.Data == nil {
+		return
+	}
+	var revocation TokenRevocation
+	data, err := json.Marshal(event.Data)
+	if err == nil {
+		err = json.Unmarshal(data, &revocation)
+	}
+	if err != nil {
+		log.Warning("Invalid token revocation %s: %s", event.Key, err)
+		return
+	}
+	if !revocations.now().Before(revocation.RevokedAt.Add(revocations.ttl)) {
+		if err := revocations.sync.Delete(event.Key, false); err != nil {
+			log.Debug("Failed to delete expired token revocation %s: %s", event.Key, err)
+		}
+		return
+	}
+	revocations.apply(revocation)
+}
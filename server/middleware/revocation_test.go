@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	mock_sync "github.com/cloudwan/gohan/sync/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Token revocations", func() {
+	var (
+		ctrl        *gomock.Controller
+		mockSync    *mock_sync.MockSync
+		revocations *TokenRevocations
+		now         time.Time
+	)
+
+	ginkgo.BeforeEach(func() {
+		ctrl = gomock.NewController(ginkgo.GinkgoT())
+		mockSync = mock_sync.NewMockSync(ctrl)
+		now = time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+		revocations = NewTokenRevocations(mockSync, time.Hour)
+		revocations.now = func() time.Time { return now }
+	})
+
+	ginkgo.AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	ginkgo.It("rejects revoked token until revocation expires", func() {
+		mockSync.EXPECT().Update(gomock.Any(), gomock.Any()).Do(func(path, data string) {
+			Expect(path).To(HavePrefix(TokenRevocationPath + "/"))
+			Expect(data).ToNot(ContainSubstring("secret-token"))
+			Expect(data).To(ContainSubstring(hashToken("secret-token")))
+		}).Return(nil)
+		Expect(revocations.RevokeToken("secret-token")).To(Succeed())
+		Expect(revocations.IsRevoked("secret-token")).To(BeTrue())
+		Expect(revocations.IsRevoked("other-token")).To(BeFalse())
+
+		now = now.Add(time.Hour)
+		Expect(revocations.IsRevoked("secret-token")).To(BeFalse())
+	})
+
+	ginkgo.It("rejects authorizations of revoked tenant or user issued before revocation", func() {
+		mockSync.EXPECT().Update(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+		tenantAuth := schema.NewAuthorization("tenant-id", "tenant", "token", nil, nil)
+		userAuth := schema.NewUserAuthorization("user-id", "other-tenant-id", "other", "token", nil, nil)
+		Expect(revocations.IsAuthorizationRevoked(tenantAuth)).To(BeFalse())
+		Expect(revocations.RevokeTenant("tenant-id")).To(Succeed())
+		Expect(revocations.RevokeUser("user-id")).To(Succeed())
+
+		Expect(revocations.IsAuthorizationRevoked(tenantAuth)).To(BeTrue())
+		Expect(revocations.IsAuthorizationRevoked(userAuth)).To(BeTrue())
+		Expect(revocations.IsAuthorizationRevoked(schema.WithIssuedAt(userAuth, now.Add(-time.Minute)))).To(BeTrue())
+		Expect(revocations.IsAuthorizationRevoked(schema.WithIssuedAt(userAuth, now.Add(time.Minute)))).To(BeFalse())
+
+		now = now.Add(time.Hour)
+		Expect(revocations.IsAuthorizationRevoked(tenantAuth)).To(BeFalse())
+	})
+
+	ginkgo.It("requires token, tenant or user", func() {
+		Expect(revocations.Revoke(TokenRevocation{})).To(MatchError(ContainSubstring("has to be given")))
+	})
+
+	ginkgo.It("applies revocations issued on other nodes", func() {
+		revocations.handleEvent(&sync.Event{
+			Action: "set",
+			Key:    TokenRevocationPath + "/1",
+			Data: map[string]interface{}{
+				"token_hash": hashToken("remote-token"),
+				"revoked_at": now.Add(-time.Minute).Format(time.RFC3339),
+			},
+		})
+		Expect(revocations.IsRevoked("remote-token")).To(BeTrue())
+
+		mockSync.EXPECT().Delete(TokenRevocationPath+"/2", false).Return(nil)
+		revocations.handleEvent(&sync.Event{
+			Action: "set",
+			Key:    TokenRevocationPath + "/2",
+			Data: map[string]interface{}{
+				"token_hash": hashToken("expired-token"),
+				"revoked_at": now.Add(-2 * time.Hour).Format(time.RFC3339),
+			},
+		})
+		Expect(revocations.IsRevoked("expired-token")).To(BeFalse())
+	})
+})
@@ -0,0 +1,60 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/drone/routes"
+)
+
+const policyExplainURL = "/gohan/v0.1/policy_explain"
+
+type policyExplainRequest struct {
+	Action     string                 `json:"action"`
+	Path       string                 `json:"path"`
+	TenantID   string                 `json:"tenant_id"`
+	TenantName string                 `json:"tenant_name"`
+	UserID     string                 `json:"user_id"`
+	Roles      []string               `json:"roles"`
+	Resource   map[string]interface{} `json:"resource"`
+	Update     map[string]interface{} `json:"update"`
+}
+
+//addPolicyExplainRoute adds route explaining which policies apply to the given principal, action and path
+func (server *Server) addPolicyExplainRoute() {
+	server.martini.Post(policyExplainURL, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization) {
+		manager := schema.GetManager()
+		if policy, _ := manager.PolicyValidate(schema.ActionCreate, policyExplainURL, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Not authorized to explain policies", http.StatusForbidden)
+			return
+		}
+		var request policyExplainRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Action == "" || request.Path == "" {
+			middleware.HTTPJSONError(w, "action and path have to be given", http.StatusBadRequest)
+			return
+		}
+		explainedAuth := schema.NewUserAuthorization(request.UserID, request.TenantID, request.TenantName, "", request.Roles, nil)
+		routes.ServeJson(w, manager.ExplainPolicy(request.Action, request.Path, explainedAuth, request.Resource, request.Update))
+	})
+}
@@ -0,0 +1,511 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	gohan_sync "github.com/cloudwan/gohan/sync"
+	"github.com/go-martini/martini"
+)
+
+const (
+	resourceWatchBufferSize = 100
+	resourceWatchKeepAlive  = 30 * time.Second
+
+	//resourceEventPath is a sync path SyncWriter publishes resource events to, so they reach watchers on all nodes
+	resourceEventPath               = "/gohan/cluster/resource_event"
+	resourceEventWatchRetryInterval = 5 * time.Second
+	stateUpdateEventType            = "state_update"
+)
+
+var (
+	resourceWatchHub     *resourceWatchers
+	resourceWatchHubOnce sync.Once
+)
+
+//ResourceEvent describes a committed change of a resource
+type ResourceEvent struct {
+	Type     string
+	Schema   *schema.Schema
+	ID       string
+	Data     map[string]interface{}
+	Version  int64
+	State    *transaction.ResourceState
+	Sequence uint64
+}
+
+type resourceSubscriber struct {
+	schemaID   string
+	resourceID string
+	events     chan *ResourceEvent
+}
+
+//resourceWatchers dispatches resource events to subscribed clients.
+//Events are published by ResourceEventWatcher when sync is configured, and by DbWatchWrapper otherwise.
+type resourceWatchers struct {
+	mutex       sync.Mutex
+	sequence    uint64
+	subscribers map[*resourceSubscriber]bool
+}
+
+func getResourceWatchers() *resourceWatchers {
+	resourceWatchHubOnce.Do(func() {
+		resourceWatchHub = &resourceWatchers{subscribers: map[*resourceSubscriber]bool{}}
+	})
+	return resourceWatchHub
+}
+
+//subscribe registers subscriber of events of the schema.
+//Only events of a single resource are delivered when resourceID is not empty.
+func (watchers *resourceWatchers) subscribe(schemaID, resourceID string) *resourceSubscriber {
+	subscriber := &resourceSubscriber{
+		schemaID:   schemaID,
+		resourceID: resourceID,
+		events:     make(chan *ResourceEvent, resourceWatchBufferSize),
+	}
+	watchers.mutex.Lock()
+	defer watchers.mutex.Unlock()
+	watchers.subscribers[subscriber] = true
+	return subscriber
+}
+
+func (watchers *resourceWatchers) unsubscribe(subscriber *resourceSubscriber) {
+	watchers.mutex.Lock()
+	defer watchers.mutex.Unlock()
+	if watchers.subscribers[subscriber] {
+		delete(watchers.subscribers, subscriber)
+		close(subscriber.events)
+	}
+}
+
+//watched returns whether there is a subscriber of events of the schema
+func (watchers *resourceWatchers) watched(schemaID string) bool {
+	watchers.mutex.Lock()
+	defer watchers.mutex.Unlock()
+	for subscriber := range watchers.subscribers {
+		if subscriber.schemaID == schemaID {
+			return true
+		}
+	}
+	return false
+}
+
+//publish sends events to the matching subscribers.
+//Subscribers which can't keep up are disconnected, so that they can resynchronize.
+func (watchers *resourceWatchers) publish(events []*ResourceEvent) {
+	watchers.mutex.Lock()
+	defer watchers.mutex.Unlock()
+	for _, event := range events {
+		watchers.sequence++
+		event.Sequence = watchers.sequence
+		for subscriber := range watchers.subscribers {
+			if subscriber.schemaID != event.Schema.ID {
+				continue
+			}
+			if subscriber.resourceID != "" && subscriber.resourceID != event.ID {
+				continue
+			}
+			select {
+			case subscriber.events <- event:
+			default:
+				log.Warning("resource watcher of %s is too slow, disconnecting", subscriber.schemaID)
+				delete(watchers.subscribers, subscriber)
+				close(subscriber.events)
+			}
+		}
+	}
+}
+
+//resourceEventMessage is a resource event as published to the sync backend
+type resourceEventMessage struct {
+	Type      string                     `json:"type"`
+	Path      string                     `json:"path"`
+	Version   int64                      `json:"version"`
+	RequestID string                     `json:"request_id,omitempty"`
+	Data      map[string]interface{}     `json:"data"`
+	State     *transaction.ResourceState `json:"state,omitempty"`
+}
+
+//stateUpdateEventBody is the body of state_update events in the event table
+type stateUpdateEventBody struct {
+	Resource map[string]interface{}     `json:"resource"`
+	State    *transaction.ResourceState `json:"state"`
+}
+
+//publishResourceEvent writes an event of the event table to the sync backend for ResourceEventWatcher of every node
+func publishResourceEvent(sync gohan_sync.Sync, requestID, eventType, path string, version int64, body string) error {
+	message := resourceEventMessage{
+		Type:      eventType,
+		Path:      path,
+		Version:   version,
+		RequestID: requestID,
+	}
+	if eventType == stateUpdateEventType {
+		var stateBody stateUpdateEventBody
+		if err := json.Unmarshal([]byte(body), &stateBody); err != nil {
+			return err
+		}
+		message.Data = stateBody.Resource
+		message.State = stateBody.State
+	} else if err := json.Unmarshal([]byte(body), &message.Data); err != nil {
+		return err
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	return sync.Update(resourceEventPath, string(data))
+}
+
+//ResourceEventWatcher publishes resource events written to the sync backend by SyncWriter
+//to resource watchers of this node, so clients see changes committed on any node.
+type ResourceEventWatcher struct {
+	sync     gohan_sync.Sync
+	watchers *resourceWatchers
+}
+
+//NewResourceEventWatcher creates a new instance of ResourceEventWatcher
+func NewResourceEventWatcher(sync gohan_sync.Sync) *ResourceEventWatcher {
+	return &ResourceEventWatcher{
+		sync:     sync,
+		watchers: getResourceWatchers(),
+	}
+}
+
+//Run publishes resource events until the context is canceled
+func (watcher *ResourceEventWatcher) Run(ctx context.Context) {
+	for {
+		for event := range watcher.sync.WatchContext(ctx, resourceEventPath, gohan_sync.RevisionCurrent) {
+			if event.Err != nil {
+				log.Warning("Watching resource events failed: %s", event.Err)
+				break
+			}
+			watcher.handleEvent(event)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resourceEventWatchRetryInterval):
+		}
+	}
+}
+
+func (watcher *ResourceEventWatcher) handleEvent(event *gohan_sync.Event) {
+	// the current value was published before the watch started
+	if event.Action == "get" || event.Action == "delete" || event.Data == nil {
+		return
+	}
+	var message resourceEventMessage
+	data, err := json.Marshal(event.Data)
+	if err == nil {
+		err = json.Unmarshal(data, &message)
+	}
+	if err != nil {
+		log.Warning("Invalid resource event %s: %s", event.Key, err)
+		return
+	}
+	resourceSchema := schema.GetSchemaByURLPath(message.Path)
+	if resourceSchema == nil || !watcher.watchers.watched(resourceSchema.ID) {
+		return
+	}
+	id, _ := message.Data["id"].(string)
+	watcher.watchers.publish([]*ResourceEvent{{
+		Type:    message.Type,
+		Schema:  resourceSchema,
+		ID:      id,
+		Data:    message.Data,
+		Version: message.Version,
+		State:   message.State,
+	}})
+}
+
+//DbWatchWrapper wraps db.DB so committed changes are published to resource watchers.
+//When Synced is set, only changes of nosync schemas are published, others are
+//published by ResourceEventWatcher once SyncWriter writes them to the sync backend.
+type DbWatchWrapper struct {
+	db.DB
+	Synced bool
+}
+
+//Begin wraps transaction object with resource event notifier
+func (ww *DbWatchWrapper) Begin() (transaction.Transaction, error) {
+	tx, err := ww.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &transactionEventNotifier{Transaction: tx, watchers: getResourceWatchers(), synced: ww.Synced}, nil
+}
+
+//BeginTx wraps transaction object with resource event notifier
+func (ww *DbWatchWrapper) BeginTx(ctx context.Context, options *transaction.TxOptions) (transaction.Transaction, error) {
+	tx, err := ww.DB.BeginTx(ctx, options)
+	if err != nil {
+		return nil, err
+	}
+	return &transactionEventNotifier{Transaction: tx, watchers: getResourceWatchers(), synced: ww.Synced}, nil
+}
+
+//transactionEventNotifier collects changes made in the transaction
+//and publishes them once the transaction is committed
+type transactionEventNotifier struct {
+	transaction.Transaction
+	watchers *resourceWatchers
+	synced   bool
+	events   []*ResourceEvent
+}
+
+//watched returns whether events of the schema should be published by this transaction
+func (tn *transactionEventNotifier) watched(s *schema.Schema) bool {
+	if tn.synced && s.Metadata["nosync"] != true {
+		return false
+	}
+	return tn.watchers.watched(s.ID)
+}
+
+func (tn *transactionEventNotifier) addEvent(eventType string, resource *schema.Resource, version int64, state *transaction.ResourceState) {
+	data := map[string]interface{}{}
+	for key, value := range resource.Data() {
+		data[key] = value
+	}
+	tn.events = append(tn.events, &ResourceEvent{
+		Type:    eventType,
+		Schema:  resource.Schema(),
+		ID:      resource.ID(),
+		Data:    data,
+		Version: version,
+		State:   state,
+	})
+}
+
+func (tn *transactionEventNotifier) configVersion(ctx context.Context, s *schema.Schema, resourceID interface{}) (int64, error) {
+	if !s.StateVersioning() {
+		return 0, nil
+	}
+	state, err := tn.StateFetchContext(ctx, s, transaction.IDFilter(resourceID))
+	if err != nil {
+		return 0, err
+	}
+	return state.ConfigVersion, nil
+}
+
+func (tn *transactionEventNotifier) Create(resource *schema.Resource) error {
+	return tn.CreateContext(context.Background(), resource)
+}
+
+func (tn *transactionEventNotifier) CreateContext(ctx context.Context, resource *schema.Resource) error {
+	if err := tn.Transaction.CreateContext(ctx, resource); err != nil {
+		return err
+	}
+	if tn.watched(resource.Schema()) {
+		tn.addEvent("create", resource, 1, nil)
+	}
+	return nil
+}
+
+func (tn *transactionEventNotifier) Update(resource *schema.Resource) error {
+	return tn.UpdateContext(context.Background(), resource)
+}
+
+func (tn *transactionEventNotifier) UpdateContext(ctx context.Context, resource *schema.Resource) error {
+	if err := tn.Transaction.UpdateContext(ctx, resource); err != nil {
+		return err
+	}
+	if !tn.watched(resource.Schema()) {
+		return nil
+	}
+	version, err := tn.configVersion(ctx, resource.Schema(), resource.ID())
+	if err != nil {
+		return err
+	}
+	if resource.Deleted() {
+		tn.addEvent("delete", resource, version, nil)
+	} else {
+		tn.addEvent("update", resource, version, nil)
+	}
+	return nil
+}
+
+func (tn *transactionEventNotifier) StateUpdate(resource *schema.Resource, state *transaction.ResourceState) error {
+	return tn.StateUpdateContext(context.Background(), resource, state)
+}
+
+func (tn *transactionEventNotifier) StateUpdateContext(ctx context.Context, resource *schema.Resource, state *transaction.ResourceState) error {
+	if err := tn.Transaction.StateUpdateContext(ctx, resource, state); err != nil {
+		return err
+	}
+	if !tn.watched(resource.Schema()) {
+		return nil
+	}
+	version, err := tn.configVersion(ctx, resource.Schema(), resource.ID())
+	if err != nil {
+		return err
+	}
+	tn.addEvent("state_update", resource, version, state)
+	return nil
+}
+
+func (tn *transactionEventNotifier) Delete(s *schema.Schema, resourceID interface{}) error {
+	return tn.DeleteContext(context.Background(), s, resourceID)
+}
+
+func (tn *transactionEventNotifier) DeleteContext(ctx context.Context, s *schema.Schema, resourceID interface{}) error {
+	if !tn.watched(s) {
+		return tn.Transaction.DeleteContext(ctx, s, resourceID)
+	}
+	resource, err := tn.FetchContext(ctx, s, transaction.IDFilter(resourceID), nil)
+	if err == transaction.ErrResourceNotFound && s.SoftDelete() {
+		// watchers were notified when the purged resource was soft deleted
+		return tn.Transaction.DeleteContext(ctx, s, resourceID)
+	}
+	if err != nil {
+		return err
+	}
+	version, err := tn.configVersion(ctx, s, resourceID)
+	if err != nil {
+		return err
+	}
+	if err := tn.Transaction.DeleteContext(ctx, s, resourceID); err != nil {
+		return err
+	}
+	tn.addEvent("delete", resource, version, nil)
+	return nil
+}
+
+func (tn *transactionEventNotifier) Commit() error {
+	if err := tn.Transaction.Commit(); err != nil {
+		return err
+	}
+	if len(tn.events) > 0 {
+		tn.watchers.publish(tn.events)
+		tn.events = nil
+	}
+	return nil
+}
+
+//filterResourceEvent returns event data visible to the watching client, or nil if the event should not be sent
+func filterResourceEvent(event *ResourceEvent, policy *schema.Policy, auth schema.Authorization) map[string]interface{} {
+	if tenantIDs := policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID()); tenantIDs != nil {
+		tenantID, _ := event.Data["tenant_id"].(string)
+		allowed := false
+		for _, id := range tenantIDs {
+			if id == tenantID {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil
+		}
+	}
+	data := map[string]interface{}{}
+	for key, value := range event.Data {
+		data[key] = value
+	}
+	if err := policy.ApplyPropertyConditionFilter(schema.ActionRead, data, nil); err != nil {
+		return nil
+	}
+	if err := policy.ApplyExpressionConditionFilter(schema.ActionRead, auth, data, nil); err != nil {
+		return nil
+	}
+	message := map[string]interface{}{
+		"event":               event.Type,
+		"version":             event.Version,
+		event.Schema.Singular: event.Schema.RemoveSecretProperties(policy.RemoveHiddenProperty(data)),
+	}
+	if event.State != nil {
+		message["state"] = map[string]interface{}{
+			"state_version":    event.State.StateVersion,
+			"state_error":      event.State.Error,
+			"state":            event.State.State,
+			"state_monitoring": event.State.Monitoring,
+		}
+	}
+	return message
+}
+
+//watchResourcesFunc returns handler streaming events of the schema resources as server-sent events
+func watchResourcesFunc(server *Server, s *schema.Schema) func(http.ResponseWriter, *http.Request, martini.Params, schema.Authorization) {
+	return func(w http.ResponseWriter, r *http.Request, p martini.Params, auth schema.Authorization) {
+		resourceID := p["id"]
+		path := s.GetPluralURL()
+		if resourceID != "" {
+			path = s.GetSingleURL()
+		}
+		policy, _ := authorization(w, r, schema.ActionRead, path, s, auth)
+		if policy == nil {
+			middleware.HTTPJSONError(w, fmt.Sprintf("No matching policy: %s %s", schema.ActionRead, path), http.StatusUnauthorized)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			middleware.HTTPJSONError(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		watchers := getResourceWatchers()
+		subscriber := watchers.subscribe(s.ID, resourceID)
+		defer watchers.unsubscribe(subscriber)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		done := make(<-chan struct{})
+		if server.masterCtx != nil {
+			done = server.masterCtx.Done()
+		}
+		keepAlive := time.NewTicker(resourceWatchKeepAlive)
+		defer keepAlive.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-done:
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keepalive\n\n")
+			case event, ok := <-subscriber.events:
+				if !ok {
+					fmt.Fprint(w, "event: error\ndata: {\"error\": \"Client is too slow, events have been dropped\"}\n\n")
+					flusher.Flush()
+					return
+				}
+				message := filterResourceEvent(event, policy, auth)
+				if message == nil {
+					continue
+				}
+				data, err := json.Marshal(message)
+				if err != nil {
+					log.Error("Failed to encode resource event: %s", err)
+					continue
+				}
+				fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+//AggregationsKey is the response key of aggregation results
+const AggregationsKey = "aggregations"
+
+//AggregateResources computes aggregations of resources grouped by values of the group_by properties.
+//Resources are filtered the same way as by GetMultipleResources, including tenant restrictions of the policy.
+//Aggregation is refused when the policy filters resources by property or expression conditions,
+//which can't be applied to aggregated groups.
+func AggregateResources(ctx middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, queryParameters map[string][]string) error {
+	defer measureRequestTime(time.Now(), "get.resources.aggregate", resourceSchema.ID)
+	auth := ctx["auth"].(schema.Authorization)
+	policy, err := loadPolicy(ctx, "read", resourceSchema.GetPluralURL(), auth)
+	if err != nil {
+		return err
+	}
+	if policy.HasConditionFilter(schema.ActionRead) {
+		err := fmt.Errorf("Resource '%s' can't be aggregated, reading it is restricted by policy conditions", resourceSchema.ID)
+		return ResourceError{err, err.Error(), Unauthorized}
+	}
+	groupBy, aggregations, err := aggregationFromQueryParameter(resourceSchema, policy, queryParameters)
+	if err != nil {
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	filter, err := readFilter(resourceSchema, policy, auth, queryParameters)
+	if err != nil {
+		return err
+	}
+	ctx["policy"] = policy
+
+	return resourceTransactionWithContext(
+		ctx, dataStore,
+		transaction.GetTxOptions(resourceSchema, schema.ActionRead),
+		func() error {
+			mainTransaction := ctx["transaction"].(transaction.Transaction)
+			groups, err := mainTransaction.Aggregate(context.Background(), resourceSchema, filter, groupBy, aggregations)
+			if err != nil {
+				return err
+			}
+			ctx["response"] = map[string]interface{}{AggregationsKey: groups}
+			return nil
+		},
+	)
+}
+
+//aggregationFromQueryParameter parses group_by and aggregate query parameters; resources are counted by default
+func aggregationFromQueryParameter(resourceSchema *schema.Schema, policy *schema.Policy,
+	queryParameters map[string][]string) ([]string, []transaction.Aggregation, error) {
+	query := url.Values(queryParameters)
+	groupBy := query["group_by"]
+	aggregations := []transaction.Aggregation{}
+	for _, key := range query["aggregate"] {
+		aggregation, err := transaction.ParseAggregation(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		aggregations = append(aggregations, aggregation)
+	}
+	if len(aggregations) == 0 {
+		aggregations = append(aggregations, transaction.Aggregation{Function: transaction.AggregateCount})
+	}
+	if err := transaction.ValidateAggregation(resourceSchema, groupBy, aggregations); err != nil {
+		return nil, nil, err
+	}
+	used := map[string]interface{}{}
+	for _, id := range groupBy {
+		used[id] = true
+	}
+	for _, aggregation := range aggregations {
+		if aggregation.Property != "" {
+			used[aggregation.Property] = true
+		}
+	}
+	for id := range used {
+		if property, err := resourceSchema.GetPropertyByID(id); err == nil && property.Secret {
+			return nil, nil, fmt.Errorf("Resource '%s' can't be aggregated by secret property %s", resourceSchema.ID, id)
+		}
+	}
+	if len(policy.RemoveHiddenProperty(used)) != len(used) {
+		return nil, nil, fmt.Errorf("Resource '%s' can't be aggregated by hidden properties", resourceSchema.ID)
+	}
+	return groupBy, aggregations, nil
+}
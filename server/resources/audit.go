@@ -0,0 +1,251 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+	"github.com/twinj/uuid"
+)
+
+const (
+	//AuditLogSchemaID is ID of the schema audit records are stored with
+	AuditLogSchemaID = "audit_log"
+
+	deleteBatchSize = 1000
+)
+
+var (
+	auditMutex sync.RWMutex
+	audit      *Audit
+)
+
+//Audit records who changed resources and how
+type Audit struct {
+	retention       time.Duration
+	cleanupInterval time.Duration
+}
+
+//SetupAudit reads audit configuration from config. Audit is disabled unless enabled in config.
+func SetupAudit(config *util.Config) error {
+	var newAudit *Audit
+	if config.GetBool("audit/enabled", false) {
+		newAudit = &Audit{}
+		var err error
+		if newAudit.retention, err = parseConfigDuration(config, "audit/retention", ""); err != nil {
+			return err
+		}
+		if newAudit.cleanupInterval, err = parseConfigDuration(config, "audit/cleanup_interval", "1h"); err != nil {
+			return err
+		}
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	audit = newAudit
+	return nil
+}
+
+func parseConfigDuration(config *util.Config, key, defaultValue string) (time.Duration, error) {
+	value := config.GetString(key, defaultValue)
+	if value == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s should be a duration: %s", key, err)
+	}
+	return duration, nil
+}
+
+//GetAudit returns configured audit or nil when it is disabled
+func GetAudit() *Audit {
+	auditMutex.RLock()
+	defer auditMutex.RUnlock()
+	return audit
+}
+
+//Record stores audit record of the action in the transaction.
+//Before and after are the resource data preceding and following the change.
+func (a *Audit) Record(tx transaction.Transaction, context middleware.Context, resourceSchema *schema.Schema,
+	action, resourceID string, before, after, input map[string]interface{}) error {
+	if a == nil || resourceSchema.ID == AuditLogSchemaID {
+		return nil
+	}
+	auditSchema, ok := schema.GetManager().Schema(AuditLogSchemaID)
+	if !ok {
+		return nil
+	}
+	secrets := schema.SecretPropertyIDs([]*schema.Schema{resourceSchema})
+	record := map[string]interface{}{
+		"id":          uuid.NewV4().String(),
+		"timestamp":   time.Now().UTC().Format(util.TimestampFormat),
+		"request_id":  util.MaybeString(context["request_id"]),
+		"action":      action,
+		"schema_id":   resourceSchema.ID,
+		"resource_id": resourceID,
+		"path":        util.MaybeString(context["path"]),
+		"diff":        AuditDiff(before, after, secrets),
+		"input":       nil,
+	}
+	if input != nil {
+		record["input"] = schema.RedactSecrets(input, secrets)
+	}
+	if auth, ok := context["auth"].(schema.Authorization); ok {
+		record["user_id"] = schema.UserIDOf(auth)
+		record["tenant_id"] = auth.TenantID()
+		record["tenant_name"] = auth.TenantName()
+	}
+	resource, err := schema.NewResource(auditSchema, record)
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(resource); err != nil {
+		return fmt.Errorf("Failed to store audit record: %s", err)
+	}
+	return nil
+}
+
+//RecordWithin stores audit record of the action in a new transaction
+func (a *Audit) RecordWithin(dataStore db.DB, context middleware.Context, resourceSchema *schema.Schema,
+	action, resourceID string, input map[string]interface{}) error {
+	if a == nil {
+		return nil
+	}
+	return db.Within(dataStore, func(tx transaction.Transaction) error {
+		if err := a.Record(tx, context, resourceSchema, action, resourceID, nil, nil, input); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+//AuditDiff returns properties which differ between before and after
+//as a map of {"old": value, "new": value}; values of secret properties are redacted.
+//Nil is returned when nothing changed.
+func AuditDiff(before, after map[string]interface{}, secrets map[string]bool) map[string]interface{} {
+	diff := map[string]interface{}{}
+	addChange := func(key string, oldValue, newValue interface{}, oldOK, newOK bool) {
+		if oldOK && newOK && reflect.DeepEqual(oldValue, newValue) {
+			return
+		}
+		change := map[string]interface{}{}
+		if oldOK {
+			change["old"] = oldValue
+		}
+		if newOK {
+			change["new"] = newValue
+		}
+		if secrets[key] {
+			for side := range change {
+				change[side] = schema.RedactedValue
+			}
+		}
+		diff[key] = change
+	}
+	for key, oldValue := range before {
+		newValue, ok := after[key]
+		addChange(key, oldValue, newValue, true, ok)
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			addChange(key, nil, newValue, false, true)
+		}
+	}
+	if len(diff) == 0 {
+		return nil
+	}
+	return diff
+}
+
+//Expire deletes audit records older than the retention period
+func (a *Audit) Expire(dataStore db.DB) (int, error) {
+	if a == nil || a.retention <= 0 {
+		return 0, nil
+	}
+	auditSchema, ok := schema.GetManager().Schema(AuditLogSchemaID)
+	if !ok {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().Add(-a.retention).Format(util.TimestampFormat)
+	filter := transaction.Filter{
+		"timestamp": transaction.Conditions{{Operator: transaction.LessThan, Value: cutoff}},
+	}
+	return deleteInBatches(dataStore, auditSchema, filter, "timestamp")
+}
+
+//deleteInBatches deletes resources matching the filter in order of the key, one batch per transaction
+func deleteInBatches(dataStore db.DB, s *schema.Schema, filter transaction.Filter, key string) (int, error) {
+	deleted := 0
+	for {
+		count := 0
+		err := db.Within(dataStore, func(tx transaction.Transaction) error {
+			paginator, err := pagination.NewPaginator(s, key, pagination.ASC, deleteBatchSize, 0)
+			if err != nil {
+				return err
+			}
+			resources, _, err := tx.List(s, filter, nil, paginator)
+			if err != nil {
+				return err
+			}
+			for _, resource := range resources {
+				if err := tx.Delete(s, resource.ID()); err != nil {
+					return err
+				}
+			}
+			count = len(resources)
+			return tx.Commit()
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += count
+		if count < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+//RunExpiration periodically deletes expired audit records until the context is done
+func (a *Audit) RunExpiration(ctx context.Context, dataStore db.DB) {
+	if a == nil || a.retention <= 0 || a.cleanupInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(a.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		deleted, err := a.Expire(dataStore)
+		if err != nil {
+			log.Error("Failed to delete expired audit records: %s", err)
+		} else if deleted > 0 {
+			log.Info("Deleted %d expired audit records", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
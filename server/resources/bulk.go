@@ -0,0 +1,225 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"fmt"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+const (
+	//BulkCreate is a bulk operation creating a resource
+	BulkCreate = "create"
+	//BulkUpdate is a bulk operation updating a resource
+	BulkUpdate = "update"
+	//BulkDelete is a bulk operation deleting a resource
+	BulkDelete = "delete"
+)
+
+//isolationLevels lists transaction isolation levels from the weakest to the strictest
+var isolationLevels = []transaction.Type{
+	transaction.ReadUncommitted,
+	transaction.ReadCommited,
+	transaction.RepeatableRead,
+	transaction.Serializable,
+}
+
+//BulkOperation is a single operation of a bulk request.
+//Each operation is handled with its own context.
+type BulkOperation struct {
+	Context  middleware.Context
+	Schema   *schema.Schema
+	Method   string
+	ID       string
+	Resource map[string]interface{}
+
+	resource *schema.Resource
+}
+
+//BulkOperationsFromJSON parses operations of a bulk request.
+//When resourceSchema is nil, schema ID has to be given in each of the operations.
+func BulkOperationsFromJSON(dataMap map[string]interface{}, resourceSchema *schema.Schema) ([]*BulkOperation, error) {
+	rawOperations, ok := dataMap["operations"].([]interface{})
+	if !ok {
+		err := fmt.Errorf("operations should be a list")
+		return nil, ResourceError{err, err.Error(), WrongData}
+	}
+	manager := schema.GetManager()
+	operations := make([]*BulkOperation, 0, len(rawOperations))
+	for i, rawOperation := range rawOperations {
+		operationMap, ok := rawOperation.(map[string]interface{})
+		if !ok {
+			err := fmt.Errorf("Operation %d: operation should be an object", i)
+			return nil, ResourceError{err, err.Error(), WrongData}
+		}
+		operation := &BulkOperation{Schema: resourceSchema}
+		if schemaID, ok := operationMap["schema"].(string); ok {
+			if resourceSchema != nil && schemaID != resourceSchema.ID {
+				err := fmt.Errorf("Operation %d: schema %s does not match %s", i, schemaID, resourceSchema.ID)
+				return nil, ResourceError{err, err.Error(), WrongData}
+			}
+			operation.Schema, _ = manager.Schema(schemaID)
+		}
+		if operation.Schema == nil || operation.Schema.IsAbstract() {
+			err := fmt.Errorf("Operation %d: unknown schema %v", i, operationMap["schema"])
+			return nil, ResourceError{err, err.Error(), WrongData}
+		}
+		operation.Method, _ = operationMap["method"].(string)
+		operation.ID, _ = operationMap["id"].(string)
+		if rawResource, ok := operationMap["resource"]; ok {
+			if operation.Resource, ok = rawResource.(map[string]interface{}); !ok {
+				err := fmt.Errorf("Operation %d: resource should be an object", i)
+				return nil, ResourceError{err, err.Error(), WrongData}
+			}
+		}
+		switch operation.Method {
+		case BulkCreate:
+			if operation.Resource == nil {
+				operation.Resource = map[string]interface{}{}
+			}
+			if operation.ID != "" {
+				operation.Resource["id"] = operation.ID
+			}
+		case BulkUpdate:
+			if operation.ID == "" || operation.Resource == nil {
+				err := fmt.Errorf("Operation %d: update requires id and resource", i)
+				return nil, ResourceError{err, err.Error(), WrongData}
+			}
+		case BulkDelete:
+			if operation.ID == "" {
+				err := fmt.Errorf("Operation %d: delete requires id", i)
+				return nil, ResourceError{err, err.Error(), WrongData}
+			}
+		default:
+			err := fmt.Errorf("Operation %d: unknown method %v", i, operationMap["method"])
+			return nil, ResourceError{err, err.Error(), WrongData}
+		}
+		operations = append(operations, operation)
+	}
+	return operations, nil
+}
+
+//BulkResources executes all the operations in a single transaction.
+//Policies are checked and extension events are handled for each operation as for a single resource request.
+//Either all the operations succeed or none of them is applied.
+//Note that pre_delete events are handled before the transaction, so resources created
+//in the same bulk request can't be deleted by it.
+func BulkResources(dataStore db.DB, identityService middleware.IdentityService, operations []*BulkOperation) error {
+	if len(operations) == 0 {
+		return nil
+	}
+	for i, operation := range operations {
+		if err := prepareBulkOperation(dataStore, identityService, operation); err != nil {
+			return bulkOperationError(operation.Context, i, err)
+		}
+	}
+
+	contexts := make([]middleware.Context, 0, len(operations))
+	level := 0
+	for _, operation := range operations {
+		contexts = append(contexts, operation.Context)
+		operationLevel := transaction.GetIsolationLevel(operation.Schema, bulkAction(operation.Method))
+		for l := level + 1; l < len(isolationLevels); l++ {
+			if isolationLevels[l] == operationLevel {
+				level = l
+			}
+		}
+	}
+
+	if err := resourceTransactionWithContexts(
+		contexts, dataStore, &transaction.TxOptions{IsolationLevel: isolationLevels[level]},
+		func() error {
+			for i, operation := range operations {
+				if err := executeBulkOperation(operation); err != nil {
+					return bulkOperationError(operation.Context, i, err)
+				}
+			}
+			return nil
+		},
+	); err != nil {
+		return err
+	}
+
+	for i, operation := range operations {
+		if err := finishBulkOperation(operation); err != nil {
+			return bulkOperationError(operation.Context, i, err)
+		}
+	}
+	return nil
+}
+
+func bulkAction(method string) string {
+	switch method {
+	case BulkCreate:
+		return schema.ActionCreate
+	case BulkUpdate:
+		return schema.ActionUpdate
+	}
+	return schema.ActionDelete
+}
+
+func prepareBulkOperation(dataStore db.DB, identityService middleware.IdentityService, operation *BulkOperation) (err error) {
+	switch operation.Method {
+	case BulkCreate:
+		operation.resource, err = prepareCreateResource(operation.Context, identityService, operation.Schema, operation.Resource)
+	case BulkUpdate:
+		operation.Resource, err = prepareUpdateResource(operation.Context, identityService, operation.Schema, operation.ID, operation.Resource)
+	case BulkDelete:
+		err = prepareDeleteResource(operation.Context, dataStore, operation.Schema, operation.ID)
+	}
+	return
+}
+
+func executeBulkOperation(operation *BulkOperation) error {
+	switch operation.Method {
+	case BulkCreate:
+		return CreateResourceInTransaction(operation.Context, operation.Schema, operation.resource)
+	case BulkUpdate:
+		auth := operation.Context["auth"].(schema.Authorization)
+		policy := operation.Context["policy"].(*schema.Policy)
+		tenantIDs := policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID())
+		err := UpdateResourceInTransaction(operation.Context, operation.Schema, operation.ID, operation.Resource, tenantIDs)
+		if resourceErr, ok := err.(ResourceError); ok && resourceErr.error == transaction.ErrResourceNotFound {
+			// updates of missing resources are reported as not found, same as deletes of them
+			return ResourceError{resourceErr.error, "Resource not found", NotFound}
+		}
+		return err
+	}
+	return DeleteResourceInTransaction(operation.Context, operation.Schema, operation.ID)
+}
+
+func finishBulkOperation(operation *BulkOperation) error {
+	switch operation.Method {
+	case BulkCreate:
+		return finishCreateResource(operation.Context, operation.Schema)
+	case BulkUpdate:
+		return finishUpdateResource(operation.Context, operation.Schema)
+	}
+	return finishDeleteResource(operation.Context, operation.Schema)
+}
+
+//bulkOperationError adds index of the failed operation to the error message
+func bulkOperationError(context middleware.Context, index int, err error) error {
+	contextLog(context).Warning("Bulk operation %d failed: %s", index, err)
+	if resourceErr, ok := err.(ResourceError); ok {
+		return ResourceError{resourceErr.error, fmt.Sprintf("Operation %d: %s", index, resourceErr.Message), resourceErr.Problem}
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+//MatchETag checks whether etag matches value of If-Match header.
+//Strong comparison is used, so weak entity tags never match.
+func MatchETag(header, etag string) bool {
+	return matchETag(header, etag, false)
+}
+
+//MatchETagWeak checks whether etag matches value of If-None-Match header using the weak comparison
+func MatchETagWeak(header, etag string) bool {
+	return matchETag(header, etag, true)
+}
+
+func matchETag(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+//setETag stores entity tag of the resource in the context.
+//Nothing is stored when the resource is not found in the db.
+func setETag(ctx middleware.Context, resourceSchema *schema.Schema, resourceID string, tenantIDs []string) error {
+	mainTransaction := ctx["transaction"].(transaction.Transaction)
+	filter := transaction.IDFilter(resourceID)
+	if tenantIDs != nil {
+		filter["tenant_id"] = tenantIDs
+	}
+	resource, err := mainTransaction.Fetch(resourceSchema, filter, nil)
+	if err == transaction.ErrResourceNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	etag, err := transaction.ResourceETag(context.Background(), mainTransaction, resourceSchema, resource)
+	if err != nil {
+		return err
+	}
+	ctx["etag"] = etag
+	return nil
+}
+
+//checkPreconditions verifies If-Match and If-None-Match request headers against the stored resource.
+//The resource is locked, so it can't be modified by others until the transaction ends.
+func checkPreconditions(ctx middleware.Context, resourceSchema *schema.Schema, resourceID string, tenantIDs []string) error {
+	r, ok := ctx["http_request"].(*http.Request)
+	if !ok {
+		return nil
+	}
+	ifMatch := r.Header.Get("If-Match")
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	mainTransaction := ctx["transaction"].(transaction.Transaction)
+	filter := transaction.IDFilter(resourceID)
+	if tenantIDs != nil {
+		filter["tenant_id"] = tenantIDs
+	}
+	var etag string
+	resource, err := mainTransaction.LockFetch(resourceSchema, filter, schema.SkipRelatedResources, nil)
+	switch err {
+	case nil:
+		etag, err = transaction.ResourceETag(context.Background(), mainTransaction, resourceSchema, resource)
+		if err != nil {
+			return err
+		}
+	case transaction.ErrResourceNotFound:
+	default:
+		return err
+	}
+
+	if ifMatch != "" && !MatchETag(ifMatch, etag) {
+		err := fmt.Errorf("Resource %s does not match %s", resourceID, ifMatch)
+		return ResourceError{err, "Resource has been modified", PreconditionFailed}
+	}
+	if ifNoneMatch != "" && MatchETagWeak(ifNoneMatch, etag) {
+		err := fmt.Errorf("Resource %s matches %s", resourceID, ifNoneMatch)
+		return ResourceError{err, "Resource matches If-None-Match condition", PreconditionFailed}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/transaction"
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+	"github.com/twinj/uuid"
+)
+
+//RecordRevision stores the next revision of the resource in the transaction.
+//Data is nil when the resource is deleted.
+func RecordRevision(ctx context.Context, tx transaction.Transaction, resourceSchema *schema.Schema,
+	action, resourceID string, data map[string]interface{}) error {
+	if !resourceSchema.History() {
+		return nil
+	}
+	historySchema, ok := schema.GetManager().Schema(resourceSchema.HistorySchemaID())
+	if !ok {
+		return nil
+	}
+	// the latest revision stays locked, so that concurrent changes can't take the same revision number
+	latest, err := latestRevision(ctx, tx, historySchema, transaction.Filter{"resource_id": resourceID}, true)
+	if err != nil && err != transaction.ErrResourceNotFound {
+		return err
+	}
+	record := map[string]interface{}{
+		"id":          uuid.NewV4().String(),
+		"resource_id": resourceID,
+		"revision":    1,
+		"action":      action,
+		"timestamp":   time.Now().UTC().Format(util.TimestampFormat),
+		"request_id":  l.RequestIDFromContext(ctx),
+		"data":        nil,
+		"tenant_id":   nil,
+	}
+	if latest != nil {
+		record["revision"] = revisionNumber(latest) + 1
+		record["tenant_id"] = latest.Get("tenant_id")
+	}
+	if data != nil {
+		// only own properties are kept; secrets never go to history
+		snapshot := map[string]interface{}{}
+		for _, property := range resourceSchema.Properties {
+			if value, ok := data[property.ID]; ok && !property.Secret {
+				snapshot[property.ID] = value
+			}
+		}
+		record["data"] = snapshot
+		if tenantID, ok := snapshot["tenant_id"]; ok {
+			record["tenant_id"] = tenantID
+		}
+	}
+	revision, err := schema.NewResource(historySchema, record)
+	if err != nil {
+		return err
+	}
+	if err := tx.CreateContext(ctx, revision); err != nil {
+		return fmt.Errorf("Failed to store revision of %s %s: %s", resourceSchema.ID, resourceID, err)
+	}
+	return nil
+}
+
+func latestRevision(ctx context.Context, tx transaction.Transaction, historySchema *schema.Schema,
+	filter transaction.Filter, lock bool) (*schema.Resource, error) {
+	paginator, err := pagination.NewPaginator(historySchema, "revision", pagination.DESC, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	var list []*schema.Resource
+	if lock {
+		list, _, err = tx.LockListContext(ctx, historySchema, filter, nil, paginator, schema.SkipRelatedResources)
+	} else {
+		list, _, err = tx.ListContext(ctx, historySchema, filter, nil, paginator)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, transaction.ErrResourceNotFound
+	}
+	return list[0], nil
+}
+
+func revisionNumber(revision *schema.Resource) int {
+	switch number := revision.Get("revision").(type) {
+	case int:
+		return number
+	case int64:
+		return int(number)
+	case float64:
+		return int(number)
+	}
+	return 0
+}
+
+//FetchRevision returns revision of the resource current as of asOf,
+//which is either a revision number or an RFC 3339 time
+func FetchRevision(tx transaction.Transaction, resourceSchema *schema.Schema, resourceID, asOf string) (*schema.Resource, error) {
+	historySchema, ok := schema.GetManager().Schema(resourceSchema.HistorySchemaID())
+	if !ok {
+		return nil, fmt.Errorf("History of %s is not recorded", resourceSchema.ID)
+	}
+	filter := transaction.Filter{"resource_id": resourceID}
+	if revision, err := strconv.Atoi(asOf); err == nil {
+		filter["revision"] = revision
+	} else {
+		asOfTime, err := time.Parse(time.RFC3339Nano, asOf)
+		if err != nil {
+			return nil, ResourceError{err, fmt.Sprintf("as_of should be a revision number or an RFC 3339 time: %s", asOf), WrongQuery}
+		}
+		filter["timestamp"] = transaction.Condition{
+			Operator: transaction.LessThanOrEqual,
+			Value:    asOfTime.UTC().Format(util.TimestampFormat),
+		}
+	}
+	return latestRevision(context.Background(), tx, historySchema, filter, false)
+}
+
+//GetResourceRevision returns the resource as it was at the revision or time given by asOf
+func GetResourceRevision(context middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, resourceID, asOf string) error {
+	defer measureRequestTime(time.Now(), "get.revision", resourceSchema.ID)
+	auth := context["auth"].(schema.Authorization)
+	policy, err := loadPolicy(context, "read", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
+	if err != nil {
+		return err
+	}
+	context["policy"] = policy
+
+	var revision *schema.Resource
+	if err := db.Within(dataStore, func(tx transaction.Transaction) error {
+		if revision, err = FetchRevision(tx, resourceSchema, resourceID, asOf); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		if err == transaction.ErrResourceNotFound {
+			return ResourceError{err, "Revision not found", NotFound}
+		}
+		return err
+	}
+	data, _ := revision.Get("data").(map[string]interface{})
+	if data == nil || !revisionVisible(policy, auth, revision) {
+		err := fmt.Errorf("Resource %s did not exist as of %s", resourceID, asOf)
+		return ResourceError{err, err.Error(), NotFound}
+	}
+	context["response"] = map[string]interface{}{resourceSchema.Singular: data}
+	return ApplyPolicyForResource(context, resourceSchema)
+}
+
+//GetRevisions lists revisions of the resource, oldest first unless sorted otherwise
+func GetRevisions(context middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, resourceID string, queryParameters url.Values) error {
+	defer measureRequestTime(time.Now(), "get.revisions", resourceSchema.ID)
+	historySchema, ok := schema.GetManager().Schema(resourceSchema.HistorySchemaID())
+	if !ok {
+		return fmt.Errorf("History of %s is not recorded", resourceSchema.ID)
+	}
+	auth := context["auth"].(schema.Authorization)
+	policy, err := loadPolicy(context, "read", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
+	if err != nil {
+		return err
+	}
+	context["policy"] = policy
+
+	query := url.Values{"sort_key": {"revision"}}
+	for key, values := range queryParameters {
+		query[key] = values
+	}
+	paginator, err := pagination.FromURLQuery(historySchema, query)
+	if err != nil {
+		return ResourceError{err, err.Error(), WrongQuery}
+	}
+	filter := transaction.Filter{"resource_id": resourceID}
+	if tenantIDs := policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID()); tenantIDs != nil {
+		filter["tenant_id"] = tenantIDs
+	}
+	var list []*schema.Resource
+	var total uint64
+	if err := db.Within(dataStore, func(tx transaction.Transaction) error {
+		if list, total, err = tx.List(historySchema, filter, nil, paginator); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		return err
+	}
+	if total == 0 {
+		return ResourceError{transaction.ErrResourceNotFound, "Resource not found", NotFound}
+	}
+	// snapshots are filtered by conditions of the policy as resources in list responses are
+	revisions := []interface{}{}
+	for _, revision := range list {
+		record := revision.Data()
+		if data, ok := record["data"].(map[string]interface{}); ok {
+			if err := policy.ApplyPropertyConditionFilter(schema.ActionRead, data, nil); err != nil {
+				continue
+			}
+			if err := policy.ApplyExpressionConditionFilter(schema.ActionRead, auth, data, nil); err != nil {
+				continue
+			}
+			record["data"] = resourceSchema.RemoveSecretProperties(policy.RemoveHiddenProperty(data))
+		}
+		revisions = append(revisions, record)
+	}
+	context["response"] = map[string]interface{}{historySchema.Plural: revisions}
+	context["total"] = total
+	nextMarker, err := paginator.NextMarker(list)
+	if err != nil {
+		return err
+	}
+	if nextMarker != "" {
+		context["next_marker"] = nextMarker
+	}
+	return nil
+}
+
+func revisionVisible(policy *schema.Policy, auth schema.Authorization, revision *schema.Resource) bool {
+	tenantIDs := policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
+	return tenantIDs == nil || util.ContainsString(tenantIDs, util.MaybeString(revision.Get("tenant_id")))
+}
+
+//RevertResource updates the resource with data of its earlier revision.
+//The update goes through the usual validation and extensions; properties which
+//can't be updated are left as they are.
+func RevertResource(context middleware.Context, dataStore db.DB, identityService middleware.IdentityService,
+	resourceSchema *schema.Schema, resourceID string, number int) error {
+	var revision *schema.Resource
+	if err := db.Within(dataStore, func(tx transaction.Transaction) error {
+		var err error
+		if revision, err = FetchRevision(tx, resourceSchema, resourceID, strconv.Itoa(number)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}); err != nil {
+		if err == transaction.ErrResourceNotFound {
+			return ResourceError{err, "Revision not found", NotFound}
+		}
+		return err
+	}
+	data, _ := revision.Get("data").(map[string]interface{})
+	if data == nil {
+		err := fmt.Errorf("Revision %d of %s is its deletion", number, resourceID)
+		return ResourceError{err, err.Error(), WrongData}
+	}
+	updatable := permittedProperties(resourceSchema.JSONSchemaOnUpdate)
+	dataMap := map[string]interface{}{}
+	for key, value := range data {
+		if _, ok := updatable[key]; ok {
+			dataMap[key] = value
+		}
+	}
+	return UpdateResource(context, dataStore, identityService, resourceSchema, resourceID, dataMap)
+}
@@ -17,6 +17,13 @@ package resources
 
 import (
 	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
 )
 
 var log = l.NewLogger()
+
+//contextLog returns logger prefixing records with ID of the request the context was created for
+func contextLog(context middleware.Context) l.Logger {
+	return l.WithRequestID(log, util.MaybeString(context["request_id"]))
+}
@@ -0,0 +1,164 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/util"
+)
+
+var (
+	quotaMutex sync.RWMutex
+	quotas     *Quotas
+)
+
+//Quotas limits number of resources of each schema a tenant can own
+type Quotas struct {
+	defaults map[string]int
+	tenants  map[string]map[string]int
+}
+
+//SetupQuotas reads resource quotas from config. Quotas are disabled when none are configured.
+func SetupQuotas(config *util.Config) error {
+	newQuotas := &Quotas{tenants: map[string]map[string]int{}}
+	var err error
+	if newQuotas.defaults, err = readQuotaLimits("quota/default", config.GetParam("quota/default", nil)); err != nil {
+		return err
+	}
+	tenantsRaw := config.GetParam("quota/tenants", nil)
+	if tenantsRaw != nil {
+		tenants, ok := tenantsRaw.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("quota/tenants should be a map of tenant IDs to limits")
+		}
+		for tenantID, limitsRaw := range tenants {
+			if newQuotas.tenants[tenantID], err = readQuotaLimits("quota/tenants/"+tenantID, limitsRaw); err != nil {
+				return err
+			}
+		}
+	}
+	if len(newQuotas.defaults) == 0 && len(newQuotas.tenants) == 0 {
+		newQuotas = nil
+	}
+	quotaMutex.Lock()
+	defer quotaMutex.Unlock()
+	quotas = newQuotas
+	return nil
+}
+
+func readQuotaLimits(key string, limitsRaw interface{}) (map[string]int, error) {
+	limits := map[string]int{}
+	if limitsRaw == nil {
+		return limits, nil
+	}
+	limitsMap, ok := limitsRaw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s should be a map of schema IDs to limits", key)
+	}
+	for schemaID, limitRaw := range limitsMap {
+		switch limit := limitRaw.(type) {
+		case int:
+			limits[schemaID] = limit
+		case float64:
+			limits[schemaID] = int(limit)
+		default:
+			return nil, fmt.Errorf("%s/%s should be an integer", key, schemaID)
+		}
+	}
+	return limits, nil
+}
+
+//GetQuotas returns configured quotas or nil when there are none
+func GetQuotas() *Quotas {
+	quotaMutex.RLock()
+	defer quotaMutex.RUnlock()
+	return quotas
+}
+
+//Limit returns maximal number of resources of the schema the tenant can own.
+//Negative limit or no limit configured means the number is unlimited.
+func (q *Quotas) Limit(tenantID, schemaID string) (int, bool) {
+	if q == nil {
+		return 0, false
+	}
+	limit, ok := q.tenants[tenantID][schemaID]
+	if !ok {
+		limit, ok = q.defaults[schemaID]
+	}
+	if !ok || limit < 0 {
+		return 0, false
+	}
+	return limit, true
+}
+
+//quotaLimit returns tenant of the resource and the number of resources of the schema it can own
+func quotaLimit(resourceSchema *schema.Schema, resource *schema.Resource) (string, int, bool) {
+	if _, err := resourceSchema.GetPropertyByID("tenant_id"); err != nil {
+		return "", 0, false
+	}
+	tenantID, _ := resource.Get("tenant_id").(string)
+	limit, ok := GetQuotas().Limit(tenantID, resourceSchema.ID)
+	return tenantID, limit, ok
+}
+
+//checkQuota verifies whether tenant of the resource can create another resource of the schema.
+//Resources of the tenant are locked, so concurrent creations of its resources are serialized.
+func checkQuota(tx transaction.Transaction, resourceSchema *schema.Schema, resource *schema.Resource) error {
+	tenantID, limit, ok := quotaLimit(resourceSchema, resource)
+	if !ok {
+		return nil
+	}
+	_, count, err := tx.LockListContext(context.Background(), resourceSchema, transaction.Filter{"tenant_id": tenantID},
+		&transaction.ViewOptions{Fields: []string{"id"}}, nil, schema.SkipRelatedResources)
+	if err != nil {
+		return err
+	}
+	if count >= uint64(limit) {
+		return quotaExceeded(resourceSchema, tenantID, limit)
+	}
+	return nil
+}
+
+//recheckQuota verifies the quota once the resource is created. Nothing is locked by checkQuota
+//until the tenant owns a resource of the schema, so concurrent creations of its first resources
+//are detected only here.
+func recheckQuota(tx transaction.Transaction, resourceSchema *schema.Schema, resource *schema.Resource) error {
+	tenantID, limit, ok := quotaLimit(resourceSchema, resource)
+	if !ok {
+		return nil
+	}
+	count, err := tx.CountContext(context.Background(), resourceSchema, transaction.Filter{"tenant_id": tenantID})
+	if err != nil {
+		return err
+	}
+	if count > uint64(limit) {
+		return quotaExceeded(resourceSchema, tenantID, limit)
+	}
+	return nil
+}
+
+func quotaExceeded(resourceSchema *schema.Schema, tenantID string, limit int) error {
+	err := fmt.Errorf("quota of %s exceeded for tenant %s", resourceSchema.ID, tenantID)
+	return ResourceError{
+		err,
+		fmt.Sprintf("Quota exceeded: tenant %s may own at most %d %s resources", tenantID, limit, resourceSchema.ID),
+		QuotaExceeded}
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
+	l "github.com/cloudwan/gohan/log"
 
 	"context"
 	"net/http"
@@ -34,9 +35,12 @@ import (
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/tracing"
+	"github.com/cloudwan/gohan/util"
 	"github.com/mattn/go-sqlite3"
 	"github.com/twinj/uuid"
 	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
 )
 
 //ResourceProblem describes the kind of problem that occurred during resource manipulation.
@@ -53,6 +57,8 @@ const (
 	UpdateFailed
 	Unauthorized
 	ForeignKeyFailed
+	PreconditionFailed
+	QuotaExceeded
 )
 
 // ResourceError is created when an anticipated problem has occurred during resource manipulations.
@@ -86,6 +92,11 @@ func isForeignKeyFailed(err error) bool {
 			return true
 		}
 	}
+	if postgresError, ok := err.(*pq.Error); ok {
+		if postgresError.Code == "23503" {
+			return true
+		}
+	}
 	return false
 }
 
@@ -94,30 +105,41 @@ func measureRequestTime(timeStarted time.Time, requestType string, schemaID stri
 }
 
 //resourceTransactionWithContext executes function in the db transaction and set it to the context
-func resourceTransactionWithContext(ctx middleware.Context, dataStore db.DB, level transaction.Type, fn func() error) error {
-	if ctx["transaction"] != nil {
-		return fmt.Errorf("cannot create nested transaction")
-	}
+func resourceTransactionWithContext(ctx middleware.Context, dataStore db.DB, options *transaction.TxOptions, fn func() error) error {
+	return resourceTransactionWithContexts([]middleware.Context{ctx}, dataStore, options, fn)
+}
 
+//resourceTransactionWithContexts executes function in the db transaction and set it to all the contexts
+func resourceTransactionWithContexts(ctxs []middleware.Context, dataStore db.DB, options *transaction.TxOptions, fn func() error) error {
 	// note:
 	// context must stay the same for each retried transaction
 	// so it is stored in a temporary variable and restored before each iteration
-	originalCtx := middleware.Context{}
+	originalCtxs := make([]middleware.Context, len(ctxs))
 
-	for k, v := range ctx {
-		originalCtx[k] = v
+	for i, ctx := range ctxs {
+		if ctx["transaction"] != nil {
+			return fmt.Errorf("cannot create nested transaction")
+		}
+		originalCtxs[i] = middleware.Context{}
+		for k, v := range ctx {
+			originalCtxs[i][k] = v
+		}
 	}
 
-	return db.WithinTx(context.Background(), dataStore, &transaction.TxOptions{IsolationLevel: level}, func(tx transaction.Transaction) error {
-		for k := range ctx {
-			delete(ctx, k)
-		}
+	txCtx := tracing.ContextWithSpan(context.Background(), tracing.SpanFromMap(ctxs[0]))
+	txCtx = l.ContextWithRequestID(txCtx, util.MaybeString(ctxs[0]["request_id"]))
+	return db.WithinTx(txCtx, dataStore, options, func(tx transaction.Transaction) error {
+		for i, ctx := range ctxs {
+			for k := range ctx {
+				delete(ctx, k)
+			}
 
-		for k, v := range originalCtx {
-			ctx[k] = v
-		}
+			for k, v := range originalCtxs[i] {
+				ctx[k] = v
+			}
 
-		ctx["transaction"] = tx
+			ctx["transaction"] = tx
+		}
 
 		if err := fn(); err != nil {
 			return err
@@ -127,7 +149,9 @@ func resourceTransactionWithContext(ctx middleware.Context, dataStore db.DB, lev
 			return err
 		}
 
-		delete(ctx, "transaction")
+		for _, ctx := range ctxs {
+			delete(ctx, "transaction")
+		}
 		return nil
 	})
 }
@@ -147,13 +171,17 @@ func ApplyPolicyForResources(context middleware.Context, resourceSchema *schema.
 	if !ok {
 		return nil
 	}
+	auth, _ := context["auth"].(schema.Authorization)
 	data := []interface{}{}
 	for _, resource := range resources {
 		resourceMap := resource.(map[string]interface{})
 		if err := policy.ApplyPropertyConditionFilter(schema.ActionRead, resourceMap, nil); err != nil {
 			continue
 		}
-		data = append(data, policy.RemoveHiddenProperty(resourceMap))
+		if err := policy.ApplyExpressionConditionFilter(schema.ActionRead, auth, resourceMap, nil); err != nil {
+			continue
+		}
+		data = append(data, resourceSchema.RemoveSecretProperties(policy.RemoveHiddenProperty(resourceMap)))
 	}
 	response[resourceSchema.Plural] = data
 	return nil
@@ -178,7 +206,11 @@ func ApplyPolicyForResource(context middleware.Context, resourceSchema *schema.S
 	if err := policy.ApplyPropertyConditionFilter(schema.ActionRead, resourceMap, nil); err != nil {
 		return err
 	}
-	response[resourceSchema.Singular] = policy.RemoveHiddenProperty(resourceMap)
+	auth, _ := context["auth"].(schema.Authorization)
+	if err := policy.ApplyExpressionConditionFilter(schema.ActionRead, auth, resourceMap, nil); err != nil {
+		return err
+	}
+	response[resourceSchema.Singular] = resourceSchema.RemoveSecretProperties(policy.RemoveHiddenProperty(resourceMap))
 
 	return nil
 }
@@ -188,7 +220,7 @@ func GetResources(context middleware.Context, dataStore db.DB, resourceSchema *s
 	defer measureRequestTime(time.Now(), "get.resources", resourceSchema.ID)
 	return resourceTransactionWithContext(
 		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionRead),
+		transaction.GetTxOptions(resourceSchema, schema.ActionRead),
 		func() error {
 			return GetResourcesInTransaction(context, resourceSchema, filter, paginator)
 		},
@@ -237,6 +269,15 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 	context["response"] = response
 	context["total"] = total
 
+	nextMarker, err := paginator.NextMarker(list)
+	if err != nil {
+		return err
+	}
+	//markers can't point into results ordered by search relevance
+	if nextMarker != "" && paginator.Key != "" {
+		context["next_marker"] = nextMarker
+	}
+
 	if err := extension.HandleEvent(context, environment, "post_list_in_transaction", resourceSchema.ID); err != nil {
 		return err
 	}
@@ -244,16 +285,128 @@ func GetResourcesInTransaction(context middleware.Context, resourceSchema *schem
 }
 
 //FilterFromQueryParameter makes list filter from query.
-func FilterFromQueryParameter(resourceSchema *schema.Schema, queryParameters map[string][]string) transaction.Filter {
+//Besides exact matches (property=value), operator conditions
+//can be specified as property[operator]=value, e.g. size[gt]=10.
+func FilterFromQueryParameter(resourceSchema *schema.Schema, queryParameters map[string][]string) (transaction.Filter, error) {
 	filter := transaction.Filter{}
+	conditions := map[string]transaction.Conditions{}
 	for key, value := range queryParameters {
-		if _, err := resourceSchema.GetPropertyByID(key); err != nil {
-			log.Debug("Resource '%s' does not have %q property, ignoring filter", resourceSchema.ID, key)
-		} else {
+		propertyID, operatorName := splitFilterKey(key)
+		property, err := resourceSchema.GetPropertyByID(propertyID)
+		if err != nil {
+			log.Debug("Resource '%s' does not have %q property, ignoring filter", resourceSchema.ID, propertyID)
+			continue
+		}
+		if operatorName == "" {
 			filter[key] = value
+			continue
+		}
+		operator, err := transaction.ParseOperator(operatorName)
+		if err != nil {
+			return nil, err
+		}
+		condition, err := conditionFromQueryParameter(property, operator, value)
+		if err != nil {
+			return nil, err
+		}
+		conditions[propertyID] = append(conditions[propertyID], condition)
+	}
+	for propertyID, propertyConditions := range conditions {
+		if value, ok := filter[propertyID]; ok {
+			propertyConditions = append(propertyConditions, transaction.Condition{Operator: transaction.Equal, Value: value})
+		}
+		filter[propertyID] = propertyConditions
+	}
+	return filter, nil
+}
+
+//readFilter makes filter of resources listed with the query parameters.
+//Tenant restrictions of the policy are applied and hidden properties can't be filtered by.
+func readFilter(resourceSchema *schema.Schema, policy *schema.Policy, auth schema.Authorization,
+	queryParameters map[string][]string) (transaction.Filter, error) {
+	filter, err := FilterFromQueryParameter(resourceSchema, queryParameters)
+	if err != nil {
+		return nil, ResourceError{err, err.Error(), WrongQuery}
+	}
+	if policy.RequireOwner() {
+		filter["tenant_id"] = policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
+	}
+	filter = policy.RemoveHiddenProperty(filter)
+	if resourceSchema.SoftDelete() && parseBool(url.Values(queryParameters).Get("deleted"), false) {
+		filter = transaction.OnlyDeleted(filter)
+	}
+	if search := url.Values(queryParameters).Get("q"); search != "" {
+		if err := addSearchToFilter(resourceSchema, policy, filter, search); err != nil {
+			return nil, ResourceError{err, err.Error(), WrongQuery}
+		}
+	}
+	return filter, nil
+}
+
+//addSearchToFilter adds full-text search to the filter.
+//Searching is refused when the policy hides any of the searched properties.
+func addSearchToFilter(resourceSchema *schema.Schema, policy *schema.Policy, filter transaction.Filter, search string) error {
+	properties := resourceSchema.SearchProperties()
+	if len(properties) == 0 {
+		return fmt.Errorf("Resource '%s' can't be searched, it has no full-text index", resourceSchema.ID)
+	}
+	searched := map[string]interface{}{}
+	for _, property := range properties {
+		if schemaProperty, err := resourceSchema.GetPropertyByID(property); err == nil && schemaProperty.Secret {
+			return fmt.Errorf("Resource '%s' can't be searched, its searched property %s is secret", resourceSchema.ID, property)
+		}
+		searched[property] = true
+	}
+	if len(policy.RemoveHiddenProperty(searched)) != len(searched) {
+		return fmt.Errorf("Resource '%s' can't be searched, some of its searched properties are hidden", resourceSchema.ID)
+	}
+	filter[transaction.SearchKey] = search
+	return nil
+}
+
+func splitFilterKey(key string) (string, string) {
+	start := strings.Index(key, "[")
+	if start < 0 || !strings.HasSuffix(key, "]") {
+		return key, ""
+	}
+	return key[:start], key[start+1 : len(key)-1]
+}
+
+func conditionFromQueryParameter(property *schema.Property, operator transaction.Operator, values []string) (transaction.Condition, error) {
+	condition := transaction.Condition{Operator: operator, Value: values}
+	switch operator {
+	case transaction.IsNull:
+		if len(values) != 1 {
+			return condition, fmt.Errorf("Filter %s[%s] requires a single value", property.ID, operator)
+		}
+		isNull, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return condition, fmt.Errorf("Filter %s[%s] requires a boolean value", property.ID, operator)
+		}
+		condition.Value = isNull
+	case transaction.LessThan, transaction.LessThanOrEqual, transaction.GreaterThan, transaction.GreaterThanOrEqual:
+		if len(values) != 1 {
+			return condition, fmt.Errorf("Filter %s[%s] requires a single value", property.ID, operator)
 		}
+		value, err := parseFilterValue(property, values[0])
+		if err != nil {
+			return condition, fmt.Errorf("Filter %s[%s] has invalid value: %s", property.ID, operator, err)
+		}
+		condition.Value = value
+	}
+	return condition, condition.Validate()
+}
+
+func parseFilterValue(property *schema.Property, value string) (interface{}, error) {
+	switch property.Type {
+	case "integer":
+		return strconv.Atoi(value)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
 	}
-	return filter
+	return value, nil
 }
 
 func listOptionsFromQueryParameter(v url.Values) *transaction.ViewOptions {
@@ -279,21 +432,27 @@ func parseBool(s string, d bool) bool {
 // GetMultipleResources returns all resources specified by the schema and query parameters
 func GetMultipleResources(context middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, queryParameters map[string][]string) error {
 	defer measureRequestTime(time.Now(), "get.resources.multiple", resourceSchema.ID)
-	log.Debug("Start get multiple resources!!")
+	contextLog(context).Debug("Start get multiple resources!!")
 	auth := context["auth"].(schema.Authorization)
 	policy, err := loadPolicy(context, "read", resourceSchema.GetPluralURL(), auth)
 	if err != nil {
 		return err
 	}
-	filter := FilterFromQueryParameter(resourceSchema, queryParameters)
-	if policy.RequireOwner() {
-		filter["tenant_id"] = policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
+	filter, err := readFilter(resourceSchema, policy, auth, queryParameters)
+	if err != nil {
+		return err
 	}
-	filter = policy.RemoveHiddenProperty(filter)
 	paginator, err := pagination.FromURLQuery(resourceSchema, queryParameters)
 	if err != nil {
 		return ResourceError{err, err.Error(), WrongQuery}
 	}
+	if url.Values(queryParameters).Get("q") != "" && url.Values(queryParameters).Get("sort_key") == "" {
+		if paginator.Marker != "" {
+			err := fmt.Errorf("Marker requires sort_key when searching, results are ordered by relevance otherwise")
+			return ResourceError{err, err.Error(), WrongQuery}
+		}
+		paginator.Key = ""
+	}
 	context["policy"] = policy
 
 	environmentManager := extension.GetManager()
@@ -355,9 +514,13 @@ func GetSingleResource(context middleware.Context, dataStore db.DB, resourceSche
 
 	if err := resourceTransactionWithContext(
 		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionRead),
+		transaction.GetTxOptions(resourceSchema, schema.ActionRead),
 		func() error {
-			return GetSingleResourceInTransaction(context, resourceSchema, resourceID, policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID()))
+			tenantIDs := policy.GetTenantIDFilter(schema.ActionRead, auth.TenantID())
+			if err := GetSingleResourceInTransaction(context, resourceSchema, resourceID, tenantIDs); err != nil {
+				return err
+			}
+			return setETag(context, resourceSchema, resourceID, tenantIDs)
 		},
 	); err != nil {
 		return err
@@ -405,10 +568,10 @@ func GetSingleResourceInTransaction(context middleware.Context, resourceSchema *
 	if object == nil {
 		switch err {
 		case transaction.ErrResourceNotFound:
-			log.Info("Fetch failed: %v", err)
+			contextLog(context).Info("Fetch failed: %v", err)
 			return ResourceError{err, "Resource not found", NotFound}
 		default:
-			log.Error("Fetch failed: %v", err)
+			contextLog(context).Error("Fetch failed: %v", err)
 			return ResourceError{err, "Error when fetching resource", InternalServerError}
 		}
 	}
@@ -457,6 +620,11 @@ func CreateOrUpdateResource(
 		return false, preTxErr
 	}
 
+	if r, ok := context["http_request"].(*http.Request); ok && !exists && r.Header.Get("If-Match") != "" {
+		err := fmt.Errorf("Resource %s does not exist", resourceID)
+		return false, ResourceError{err, "Resource has been modified", PreconditionFailed}
+	}
+
 	if !exists {
 		dataMap["id"] = resourceID
 		if err := CreateResource(context, dataStore, identityService, resourceSchema, dataMap); err != nil {
@@ -477,20 +645,45 @@ func CreateResource(
 	dataMap map[string]interface{},
 ) error {
 	defer measureRequestTime(time.Now(), "create", resourceSchema.ID)
+	resource, err := prepareCreateResource(context, identityService, resourceSchema, dataMap)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceTransactionWithContext(
+		context, dataStore,
+		transaction.GetTxOptions(resourceSchema, schema.ActionCreate),
+		func() error {
+			return CreateResourceInTransaction(context, resourceSchema, resource)
+		},
+	); err != nil {
+		return err
+	}
+
+	return finishCreateResource(context, resourceSchema)
+}
+
+//prepareCreateResource checks policy and handles events preceding resource creation transaction
+func prepareCreateResource(
+	context middleware.Context,
+	identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	dataMap map[string]interface{},
+) (*schema.Resource, error) {
 	manager := schema.GetManager()
 	// Load environment
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
 
 	if !ok {
-		return fmt.Errorf("No environment for schema")
+		return nil, fmt.Errorf("No environment for schema")
 	}
 	auth := context["auth"].(schema.Authorization)
 
 	//LoadPolicy
 	policy, err := loadPolicy(context, "create", resourceSchema.GetPluralURL(), auth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	_, err = resourceSchema.GetPropertyByID("tenant_id")
@@ -501,21 +694,25 @@ func CreateResource(
 	if tenantID, ok := dataMap["tenant_id"]; ok && tenantID != nil {
 		dataMap["tenant_name"], err = identityService.GetTenantName(tenantID.(string))
 		if err != nil {
-			return ResourceError{err, err.Error(), Unauthorized}
+			return nil, ResourceError{err, err.Error(), Unauthorized}
 		}
 	}
 
 	//Apply policy for api input
 	err = policy.Check(schema.ActionCreate, auth, dataMap)
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	delete(dataMap, "tenant_name")
 
 	// apply property filter
 	err = policy.ApplyPropertyConditionFilter(schema.ActionCreate, dataMap, nil)
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
+	}
+	err = policy.ApplyExpressionConditionFilter(schema.ActionCreate, auth, dataMap, nil)
+	if err != nil {
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	context["resource"] = dataMap
 	if id, ok := dataMap["id"]; !ok || id == "" {
@@ -525,7 +722,7 @@ func CreateResource(
 	context["schema_id"] = resourceSchema.ID
 
 	if err := extension.HandleEvent(context, environment, "pre_create", resourceSchema.ID); err != nil {
-		return err
+		return nil, err
 	}
 
 	if resourceData, ok := context["resource"].(map[string]interface{}); ok {
@@ -537,36 +734,35 @@ func CreateResource(
 	if _, ok := context["go_validation"]; ok {
 		err = resourceSchema.ValidateGoOnCreate(dataMap)
 		if err != nil {
-			return ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
+			return nil, ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
 		}
 	} else {
 		err = resourceSchema.ValidateOnCreate(dataMap)
 		if err != nil {
-			return ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
+			return nil, ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
 		}
 	}
 
 	resource, err := manager.LoadResource(resourceSchema.ID, dataMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	//Fillup default
 	err = resource.PopulateDefaults()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	context["resource"] = resource.Data()
+	return resource, nil
+}
 
-	if err := resourceTransactionWithContext(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionCreate),
-		func() error {
-			return CreateResourceInTransaction(context, resourceSchema, resource)
-		},
-	); err != nil {
-		return err
+//finishCreateResource handles events following resource creation transaction
+func finishCreateResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environment, ok := extension.GetManager().GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
 	}
 
 	if err := extension.HandleEvent(context, environment, "post_create", resourceSchema.ID); err != nil {
@@ -600,8 +796,11 @@ func CreateResourceInTransaction(context middleware.Context, resourceSchema *sch
 			return fmt.Errorf("Loading resource failed: %s", err)
 		}
 	}
+	if err := checkQuota(mainTransaction, resourceSchema, resource); err != nil {
+		return err
+	}
 	if err := mainTransaction.Create(resource); err != nil {
-		log.Debug("%s transaction error", err)
+		contextLog(context).Debug("%s transaction error", err)
 		if isForeignKeyFailed(err) {
 			return ResourceError{
 				err,
@@ -613,6 +812,13 @@ func CreateResourceInTransaction(context middleware.Context, resourceSchema *sch
 			fmt.Sprintf("Failed to store data in database: %v", err),
 			CreateFailed}
 	}
+	if err := recheckQuota(mainTransaction, resourceSchema, resource); err != nil {
+		return err
+	}
+	if err := GetAudit().Record(mainTransaction, context, resourceSchema, schema.ActionCreate, resource.ID(),
+		nil, resource.Data(), nil); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
@@ -633,13 +839,47 @@ func UpdateResource(
 	resourceID string, dataMap map[string]interface{},
 ) error {
 	defer measureRequestTime(time.Now(), "update", resourceSchema.ID)
+	dataMap, err := prepareUpdateResource(context, identityService, resourceSchema, resourceID, dataMap)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceTransactionWithContext(
+		context, dataStore,
+		transaction.GetTxOptions(resourceSchema, schema.ActionUpdate),
+		func() error {
+			auth := context["auth"].(schema.Authorization)
+			policy := context["policy"].(*schema.Policy)
+			tenantIDs := policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID())
+			if err := checkPreconditions(context, resourceSchema, resourceID, tenantIDs); err != nil {
+				return err
+			}
+			if err := UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, tenantIDs); err != nil {
+				return err
+			}
+			return setETag(context, resourceSchema, resourceID, tenantIDs)
+		},
+	); err != nil {
+		return err
+	}
+
+	return finishUpdateResource(context, resourceSchema)
+}
+
+//prepareUpdateResource checks policy and handles events preceding resource update transaction
+func prepareUpdateResource(
+	context middleware.Context,
+	identityService middleware.IdentityService,
+	resourceSchema *schema.Schema,
+	resourceID string, dataMap map[string]interface{},
+) (map[string]interface{}, error) {
 	context["id"] = resourceID
 
 	//load environment
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
 	if !ok {
-		return fmt.Errorf("No environment for schema")
+		return nil, fmt.Errorf("No environment for schema")
 	}
 
 	auth := context["auth"].(schema.Authorization)
@@ -647,7 +887,7 @@ func UpdateResource(
 	//load policy
 	policy, err := loadPolicy(context, "update", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	context["policy"] = policy
 
@@ -656,14 +896,14 @@ func UpdateResource(
 		dataMap["tenant_name"], err = identityService.GetTenantName(tenantID.(string))
 	}
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 
 	//check policy
 	err = policy.Check(schema.ActionUpdate, auth, dataMap)
 	delete(dataMap, "tenant_name")
 	if err != nil {
-		return ResourceError{err, err.Error(), Unauthorized}
+		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	needsDelete := false
 	if _, ok := dataMap["id"]; !ok {
@@ -673,7 +913,7 @@ func UpdateResource(
 	context["resource"] = dataMap
 
 	if err := extension.HandleEvent(context, environment, "pre_update", resourceSchema.ID); err != nil {
-		return err
+		return nil, err
 	}
 
 	if resourceData, ok := context["resource"].(map[string]interface{}); ok {
@@ -682,15 +922,14 @@ func UpdateResource(
 		}
 		dataMap = resourceData
 	}
+	return dataMap, nil
+}
 
-	if err := resourceTransactionWithContext(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionUpdate),
-		func() error {
-			return UpdateResourceInTransaction(context, resourceSchema, resourceID, dataMap, policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()))
-		},
-	); err != nil {
-		return err
+//finishUpdateResource handles events following resource update transaction
+func finishUpdateResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environment, ok := extension.GetManager().GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
 	}
 
 	if err := extension.HandleEvent(context, environment, "post_update", resourceSchema.ID); err != nil {
@@ -743,7 +982,16 @@ func UpdateResourceInTransaction(
 	if err != nil {
 		return ResourceError{err, "", Unauthorized}
 	}
+	auth, _ := context["auth"].(schema.Authorization)
+	err = policy.ApplyExpressionConditionFilter(schema.ActionUpdate, auth, resource.Data(), dataMap)
+	if err != nil {
+		return ResourceError{err, "", Unauthorized}
+	}
 
+	before := map[string]interface{}{}
+	for key, value := range resource.Data() {
+		before[key] = value
+	}
 	err = resource.Update(dataMap)
 	if err != nil {
 		return ResourceError{err, err.Error(), WrongData}
@@ -777,6 +1025,10 @@ func UpdateResourceInTransaction(
 			UpdateFailed,
 		}
 	}
+	if err := GetAudit().Record(mainTransaction, context, resourceSchema, schema.ActionUpdate, resourceID,
+		before, resource.Data(), nil); err != nil {
+		return err
+	}
 
 	response := map[string]interface{}{}
 	response[resourceSchema.Singular] = resource.Data()
@@ -796,6 +1048,33 @@ func DeleteResource(context middleware.Context,
 	resourceID string,
 ) error {
 	defer measureRequestTime(time.Now(), "delete", resourceSchema.ID)
+	if err := prepareDeleteResource(context, dataStore, resourceSchema, resourceID); err != nil {
+		return err
+	}
+	if err := resourceTransactionWithContext(
+		context, dataStore,
+		transaction.GetTxOptions(resourceSchema, schema.ActionDelete),
+		func() error {
+			auth := context["auth"].(schema.Authorization)
+			policy := context["policy"].(*schema.Policy)
+			tenantIDs := policy.GetTenantIDFilter(schema.ActionDelete, auth.TenantID())
+			if err := checkPreconditions(context, resourceSchema, resourceID, tenantIDs); err != nil {
+				return err
+			}
+			return DeleteResourceInTransaction(context, resourceSchema, resourceID)
+		},
+	); err != nil {
+		return err
+	}
+	return finishDeleteResource(context, resourceSchema)
+}
+
+//prepareDeleteResource checks policy and handles events preceding resource deletion transaction
+func prepareDeleteResource(context middleware.Context,
+	dataStore db.DB,
+	resourceSchema *schema.Schema,
+	resourceID string,
+) error {
 	context["id"] = resourceID
 	environmentManager := extension.GetManager()
 	environment, ok := environmentManager.GetEnvironment(resourceSchema.ID)
@@ -834,28 +1113,25 @@ func DeleteResource(context middleware.Context,
 	if resource == nil {
 		switch fetchErr {
 		case transaction.ErrResourceNotFound:
-			log.Info("Fetch failed: %v", fetchErr)
+			contextLog(context).Info("Fetch failed: %v", fetchErr)
 			return ResourceError{fetchErr, "Resource not found", NotFound}
 		default:
-			log.Error("Fetch failed: %v", fetchErr)
+			contextLog(context).Error("Fetch failed: %v", fetchErr)
 			return ResourceError{fetchErr, "Error when fetching resource", InternalServerError}
 		}
 	}
-	if err := resourceTransactionWithContext(
-		context, dataStore,
-		transaction.GetIsolationLevel(resourceSchema, schema.ActionDelete),
-		func() error {
-			return DeleteResourceInTransaction(context, resourceSchema, resourceID)
-		},
-	); err != nil {
-		return err
-	}
-	if err := extension.HandleEvent(context, environment, "post_delete", resourceSchema.ID); err != nil {
-		return err
-	}
 	return nil
 }
 
+//finishDeleteResource handles events following resource deletion transaction
+func finishDeleteResource(context middleware.Context, resourceSchema *schema.Schema) error {
+	environment, ok := extension.GetManager().GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
+	}
+	return extension.HandleEvent(context, environment, "post_delete", resourceSchema.ID)
+}
+
 //DeleteResourceInTransaction deletes resources in a transaction
 func DeleteResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string) error {
 	defer measureRequestTime(time.Now(), "delete.in_tx", resourceSchema.ID)
@@ -896,15 +1172,30 @@ func DeleteResourceInTransaction(context middleware.Context, resourceSchema *sch
 	if err != nil {
 		return ResourceError{err, "", Unauthorized}
 	}
+	err = policy.ApplyExpressionConditionFilter(schema.ActionDelete, auth, resource.Data(), nil)
+	if err != nil {
+		return ResourceError{err, "", Unauthorized}
+	}
 
 	if err := extension.HandleEvent(context, environment, "pre_delete_in_transaction", resourceSchema.ID); err != nil {
 		return err
 	}
 
-	err = mainTransaction.Delete(resourceSchema, resourceID)
+	if resourceSchema.SoftDelete() {
+		err = softDeleteResource(mainTransaction, resource)
+	} else {
+		err = mainTransaction.Delete(resourceSchema, resourceID)
+	}
+	if _, ok := err.(ResourceError); ok {
+		return err
+	}
 	if err != nil {
 		return ResourceError{err, "", DeleteFailed}
 	}
+	if err := GetAudit().Record(mainTransaction, context, resourceSchema, schema.ActionDelete, resourceID,
+		resource.Data(), nil, nil); err != nil {
+		return err
+	}
 
 	if err := extension.HandleEvent(context, environment, "post_delete_in_transaction", resourceSchema.ID); err != nil {
 		return err
@@ -939,18 +1230,26 @@ func ActionResource(context middleware.Context, dataStore db.DB, identityService
 		return err
 	}
 
-	if _, ok := context["response"]; ok {
-		return nil
+	if _, ok := context["response"]; !ok {
+		return fmt.Errorf("no response")
 	}
 
-	return fmt.Errorf("no response")
+	input, _ := data.(map[string]interface{})
+	if err := GetAudit().RecordWithin(dataStore, context, resourceSchema, action.ID, resourceID, input); err != nil {
+		contextLog(context).Error("Failed to record audit of action %s: %s", action.ID, err)
+	}
+	return nil
 }
 
 func loadPolicy(context middleware.Context, action, path string, auth schema.Authorization) (*schema.Policy, error) {
+	span := tracing.StartSpan(tracing.SpanFromMap(context), "policy "+action, tracing.SpanKindInternal)
+	span.SetAttribute("gohan.path", path)
+	defer span.End()
 	manager := schema.GetManager()
 	policy, role := manager.PolicyValidate(action, path, auth)
 	if policy == nil {
 		err := fmt.Errorf(fmt.Sprintf("No matching policy: %s %s", action, path))
+		span.SetError(err)
 		return nil, ResourceError{err, err.Error(), Unauthorized}
 	}
 	context["policy"] = policy
@@ -0,0 +1,375 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/pagination"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/util"
+)
+
+//ActionRestore is the audited action of restoring soft deleted resources
+const ActionRestore = "restore"
+
+var (
+	trashMutex sync.RWMutex
+	trash      *Trash
+)
+
+//Trash purges soft deleted resources once they are older than the retention period
+type Trash struct {
+	retention     time.Duration
+	purgeInterval time.Duration
+}
+
+//SetupTrash reads soft delete configuration from config. Soft deleted resources are kept forever
+//unless retention is configured.
+func SetupTrash(config *util.Config) error {
+	newTrash := &Trash{}
+	var err error
+	if newTrash.retention, err = parseConfigDuration(config, "soft_delete/retention", ""); err != nil {
+		return err
+	}
+	if newTrash.purgeInterval, err = parseConfigDuration(config, "soft_delete/purge_interval", "1h"); err != nil {
+		return err
+	}
+	trashMutex.Lock()
+	defer trashMutex.Unlock()
+	trash = newTrash
+	return nil
+}
+
+//GetTrash returns configured trash or nil when it was not set up
+func GetTrash() *Trash {
+	trashMutex.RLock()
+	defer trashMutex.RUnlock()
+	return trash
+}
+
+//Purge permanently deletes resources of all schemas soft deleted before the retention period.
+//Resources still referred to by other resources are kept until those are purged too.
+//A failure is logged and purging goes on with the other schemas.
+func (t *Trash) Purge(dataStore db.DB) (int, error) {
+	if t == nil || t.retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().Add(-t.retention).Format(util.TimestampFormat)
+	filter := transaction.Filter{
+		schema.DeletedAtPropertyID: transaction.Conditions{
+			{Operator: transaction.IsNull, Value: false},
+			{Operator: transaction.LessThan, Value: cutoff},
+		},
+	}
+	purged := 0
+	failed := []string{}
+	schemas := schema.GetManager().OrderedSchemas()
+	// children go first, so that they are not removed by cascades before being accounted for
+	for i := len(schemas) - 1; i >= 0; i-- {
+		s := schemas[i]
+		if s.IsAbstract() || !s.SoftDelete() {
+			continue
+		}
+		deleted, err := purgeInBatches(dataStore, s, filter, referencesTo(schemas, s))
+		purged += deleted
+		if err != nil {
+			log.Error("Failed to purge %s: %s", s.ID, err)
+			failed = append(failed, s.ID)
+		}
+	}
+	if len(failed) > 0 {
+		return purged, fmt.Errorf("Failed to purge %s", strings.Join(failed, ", "))
+	}
+	return purged, nil
+}
+
+//reference is a property of a schema relating to another schema
+type reference struct {
+	schema   *schema.Schema
+	property schema.Property
+}
+
+func referencesTo(schemas []*schema.Schema, related *schema.Schema) []reference {
+	references := []reference{}
+	for _, s := range schemas {
+		if s.IsAbstract() {
+			continue
+		}
+		for _, property := range s.Properties {
+			if property.Relation == related.ID {
+				references = append(references, reference{schema: s, property: property})
+			}
+		}
+	}
+	return references
+}
+
+//isReferred checks if another resource refers to the resource. Soft deleted resources count too,
+//as they keep their references until they are purged.
+func isReferred(tx transaction.Transaction, resource *schema.Resource, references []reference) (bool, error) {
+	return countReferences(tx, resource, references, true)
+}
+
+//isReferredByLive checks if a resource which isn't soft deleted refers to the resource
+func isReferredByLive(tx transaction.Transaction, resource *schema.Resource, references []reference) (bool, error) {
+	return countReferences(tx, resource, references, false)
+}
+
+func countReferences(tx transaction.Transaction, resource *schema.Resource, references []reference, withDeleted bool) (bool, error) {
+	for _, ref := range references {
+		column := ref.property.RelationColumn
+		if column == "" {
+			column = "id"
+		}
+		filters := []transaction.Filter{{ref.property.ID: resource.Get(column)}}
+		if withDeleted && ref.schema.SoftDelete() {
+			filters = append(filters, transaction.OnlyDeleted(filters[0]))
+		}
+		for _, filter := range filters {
+			count, err := tx.CountContext(context.Background(), ref.schema, filter)
+			if err != nil {
+				return false, err
+			}
+			if count > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+//purgeInBatches deletes resources matching the filter unless other resources refer to them
+func purgeInBatches(dataStore db.DB, s *schema.Schema, filter transaction.Filter, references []reference) (int, error) {
+	deleted, kept := 0, 0
+	for {
+		count, batchDeleted := 0, 0
+		err := db.Within(dataStore, func(tx transaction.Transaction) error {
+			// kept resources stay first in ID order, so they are skipped by the offset
+			paginator, err := pagination.NewPaginator(s, "id", pagination.ASC, deleteBatchSize, uint64(kept))
+			if err != nil {
+				return err
+			}
+			resources, _, err := tx.List(s, filter, nil, paginator)
+			if err != nil {
+				return err
+			}
+			for _, resource := range resources {
+				referred, err := isReferred(tx, resource, references)
+				if err != nil {
+					return err
+				}
+				if referred {
+					continue
+				}
+				if err := tx.Delete(s, resource.ID()); err != nil {
+					return err
+				}
+				batchDeleted++
+			}
+			count = len(resources)
+			return tx.Commit()
+		})
+		if err != nil {
+			return deleted, err
+		}
+		deleted += batchDeleted
+		kept += count - batchDeleted
+		if count < deleteBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+//RunPurge periodically purges soft deleted resources until the context is done
+func (t *Trash) RunPurge(ctx context.Context, dataStore db.DB) {
+	if t == nil || t.retention <= 0 || t.purgeInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(t.purgeInterval)
+	defer ticker.Stop()
+	for {
+		purged, err := t.Purge(dataStore)
+		if err != nil {
+			log.Error("Failed to purge soft deleted resources: %s", err)
+		}
+		if purged > 0 {
+			log.Info("Purged %d soft deleted resources", purged)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+//softDeleteResource marks the resource as deleted instead of removing it.
+//Resources still referred by live ones can't be soft deleted, as the references would point at a hidden resource.
+func softDeleteResource(tx transaction.Transaction, resource *schema.Resource) error {
+	references := referencesTo(schema.GetManager().OrderedSchemas(), resource.Schema())
+	referred, err := isReferredByLive(tx, resource, references)
+	if err != nil {
+		return err
+	}
+	if referred {
+		return ResourceError{fmt.Errorf("%s %s is referred", resource.Schema().ID, resource.ID()),
+			fmt.Sprintf("Resource %s is referred by other resources", resource.ID()), DeleteFailed}
+	}
+	deleted, err := schema.NewResource(resource.Schema(), copyResourceData(resource.Data()))
+	if err != nil {
+		return err
+	}
+	deleted.MarkDeleted(time.Now())
+	return tx.Update(deleted)
+}
+
+func copyResourceData(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		result[key] = value
+	}
+	return result
+}
+
+//RestoreResource restores the soft deleted resource specified by the schema and ID
+func RestoreResource(context middleware.Context, dataStore db.DB, resourceSchema *schema.Schema, resourceID string) error {
+	defer measureRequestTime(time.Now(), "restore", resourceSchema.ID)
+	context["id"] = resourceID
+	auth := context["auth"].(schema.Authorization)
+	policy, err := loadPolicy(context, "update", strings.Replace(resourceSchema.GetSingleURL(), ":id", resourceID, 1), auth)
+	if err != nil {
+		return err
+	}
+	context["policy"] = policy
+	if err := resourceTransactionWithContext(
+		context, dataStore,
+		transaction.GetTxOptions(resourceSchema, schema.ActionUpdate),
+		func() error {
+			return RestoreResourceInTransaction(context, resourceSchema, resourceID)
+		},
+	); err != nil {
+		return err
+	}
+	return ApplyPolicyForResource(context, resourceSchema)
+}
+
+//RestoreResourceInTransaction restores soft deleted resource in a transaction.
+//The resource is validated again and its related resources have to exist.
+func RestoreResourceInTransaction(context middleware.Context, resourceSchema *schema.Schema, resourceID string) error {
+	defer measureRequestTime(time.Now(), "restore.in_tx", resourceSchema.ID)
+	mainTransaction := context["transaction"].(transaction.Transaction)
+	environment, ok := extension.GetManager().GetEnvironment(resourceSchema.ID)
+	if !ok {
+		return fmt.Errorf("No environment for schema")
+	}
+
+	auth := context["auth"].(schema.Authorization)
+	policy := context["policy"].(*schema.Policy)
+	filter := transaction.OnlyDeleted(transaction.IDFilter(resourceID))
+	if tenantIDs := policy.GetTenantIDFilter(schema.ActionUpdate, auth.TenantID()); tenantIDs != nil {
+		filter["tenant_id"] = tenantIDs
+	}
+	resource, err := mainTransaction.Fetch(resourceSchema, filter, &transaction.ViewOptions{Details: false})
+	switch err {
+	case nil:
+	case transaction.ErrResourceNotFound:
+		return ResourceError{err, "Deleted resource not found", NotFound}
+	default:
+		return ResourceError{err, "Error when fetching resource", InternalServerError}
+	}
+	if err := policy.ApplyExpressionConditionFilter(schema.ActionUpdate, auth, resource.Data(), nil); err != nil {
+		return ResourceError{err, "", Unauthorized}
+	}
+
+	data := copyResourceData(resource.Data())
+	data[schema.DeletedAtPropertyID] = nil
+	if err := validateRestoredResource(mainTransaction, resourceSchema, data); err != nil {
+		return err
+	}
+	context["resource"] = data
+
+	if err := extension.HandleEvent(context, environment, "pre_restore_in_transaction", resourceSchema.ID); err != nil {
+		return err
+	}
+
+	restored, err := schema.NewResource(resourceSchema, data)
+	if err != nil {
+		return err
+	}
+	if err := mainTransaction.Update(restored); err != nil {
+		return ResourceError{err, fmt.Sprintf("Failed to store data in database: %v", err), UpdateFailed}
+	}
+	if err := GetAudit().Record(mainTransaction, context, resourceSchema, ActionRestore, resourceID,
+		resource.Data(), restored.Data(), nil); err != nil {
+		return err
+	}
+	context["response"] = map[string]interface{}{resourceSchema.Singular: restored.Data()}
+
+	return extension.HandleEvent(context, environment, "post_restore_in_transaction", resourceSchema.ID)
+}
+
+//validateRestoredResource validates stored data the same way as on creation
+//and checks that related resources still exist
+func validateRestoredResource(tx transaction.Transaction, resourceSchema *schema.Schema, data map[string]interface{}) error {
+	creatable := permittedProperties(resourceSchema.JSONSchemaOnCreate)
+	input := map[string]interface{}{}
+	for key, value := range data {
+		if _, ok := creatable[key]; ok && value != nil {
+			input[key] = value
+		}
+	}
+	if err := resourceSchema.ValidateOnCreate(input); err != nil {
+		return ResourceError{err, fmt.Sprintf("Validation error: %s", err), WrongData}
+	}
+	for _, property := range resourceSchema.Properties {
+		value := data[property.ID]
+		if property.Relation == "" || value == nil {
+			continue
+		}
+		relatedSchema, ok := schema.GetManager().Schema(property.Relation)
+		if !ok {
+			continue
+		}
+		column := property.RelationColumn
+		if column == "" {
+			column = "id"
+		}
+		_, err := tx.Fetch(relatedSchema, transaction.Filter{column: value}, &transaction.ViewOptions{Details: false})
+		switch err {
+		case nil:
+		case transaction.ErrResourceNotFound:
+			return ResourceError{err, fmt.Sprintf("Related %s %v not found", property.Relation, value), ForeignKeyFailed}
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+//permittedProperties returns properties of JSON schema filtered by permission
+func permittedProperties(jsonSchema map[string]interface{}) map[string]map[string]interface{} {
+	properties, _ := jsonSchema["properties"].(map[string]map[string]interface{})
+	return properties
+}
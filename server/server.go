@@ -32,18 +32,20 @@ import (
 	"time"
 
 	"github.com/braintree/manners"
+	"github.com/cloudwan/gohan/cloud"
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/migration"
 	"github.com/cloudwan/gohan/db/options"
-	"github.com/cloudwan/gohan/db/transaction"
 	"github.com/cloudwan/gohan/extension"
 	"github.com/cloudwan/gohan/job"
 	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/metrics"
 	"github.com/cloudwan/gohan/schema"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
 	sync_util "github.com/cloudwan/gohan/sync/util"
+	"github.com/cloudwan/gohan/tracing"
 	"github.com/cloudwan/gohan/util"
 	"github.com/cloudwan/gohan/version"
 	"github.com/drone/routes"
@@ -52,11 +54,6 @@ import (
 	"github.com/martini-contrib/staticbin"
 )
 
-type tlsConfig struct {
-	CertFile string
-	KeyFile  string
-}
-
 //Server is a struct for GohanAPIServer
 type Server struct {
 	address          string
@@ -68,63 +65,50 @@ type Server struct {
 	martini          *martini.ClassicMartini
 	extensions       []string
 	keystoneIdentity middleware.IdentityService
+	jwtIdentity      *cloud.JWTIdentity
+	tokenRevocations *middleware.TokenRevocations
+	storedConfig     *StoredConfigReloader
+	namespaceRoutes  map[string]bool
 	queue            *job.Queue
 
 	masterCtx       context.Context
 	masterCtxCancel context.CancelFunc
 }
 
+//mapNamespaceRoutes maps routes of namespaces which haven't been mapped yet.
+//Namespaces are looked up on each request, so routes of removed namespaces respond with 404.
+func (server *Server) mapNamespaceRoutes() {
+	if server.namespaceRoutes == nil {
+		server.namespaceRoutes = map[string]bool{}
+	}
+	for _, namespace := range schema.GetManager().Namespaces() {
+		pattern := namespaceRoutePattern(namespace)
+		if server.namespaceRoutes[pattern] {
+			continue
+		}
+		server.namespaceRoutes[pattern] = true
+		mapNamespaceRoute(server.martini, namespace)
+	}
+}
+
 func (server *Server) mapRoutes() {
 	config := util.GetConfig()
 	schemaManager := schema.GetManager()
-	MapNamespacesRoutes(server.martini)
+	if coreSchema, _ := schemaManager.Schema("schema"); coreSchema == nil {
+		log.Fatal("Gohan core schema not found")
+	}
+	if err := loadStoredConfig(server.db); err != nil {
+		log.Warning("failed to load stored config: %s", err)
+	}
+	server.mapNamespaceRoutes()
 	MapRouteBySchemas(server, server.db)
 
-	if txErr := db.Within(server.db, func(tx transaction.Transaction) error {
-		coreSchema, _ := schemaManager.Schema("schema")
-		if coreSchema == nil {
-			log.Fatal("Gohan core schema not found")
-			return nil
-		}
-
-		policySchema, _ := schemaManager.Schema("policy")
-		policyList, _, err := tx.List(policySchema, nil, nil, nil)
-		if err != nil {
-			log.Info(err.Error())
-		}
-		schemaManager.LoadPolicies(policyList)
-
-		extensionSchema, _ := schemaManager.Schema("extension")
-		extensionList, _, err := tx.List(extensionSchema, nil, nil, nil)
-		if err != nil {
-			log.Info(err.Error())
-		}
-		if err := schemaManager.LoadExtensions(extensionList); err != nil {
-			log.Warning("failed to load extensions: %s", err)
-		}
-
-		namespaceSchema, _ := schemaManager.Schema("namespace")
-		if namespaceSchema == nil {
-			log.Error("No gohan schema. Disabling schema editing mode")
-			return nil
-		}
-		namespaceList, _, err := tx.List(namespaceSchema, nil, nil, nil)
-		if err != nil {
-			log.Info(err.Error())
-		}
-		err = tx.Commit()
-		if err != nil {
-			log.Info(err.Error())
-		}
-		schemaManager.LoadNamespaces(namespaceList)
-
-		if config.GetBool("keystone/fake", false) {
-			middleware.FakeKeystone(server.martini)
-		}
-
-		return nil
-	}); txErr != nil {
-		log.Fatal(txErr)
+	if namespaceSchema, _ := schemaManager.Schema("namespace"); namespaceSchema == nil {
+		log.Error("No gohan schema. Disabling schema editing mode")
+		return
+	}
+	if config.GetBool("keystone/fake", false) {
+		middleware.FakeKeystone(server.martini)
 	}
 }
 
@@ -149,6 +133,18 @@ func (server *Server) addPprofRoutes() {
 	})
 }
 
+//prometheusMetrics serves runtime metrics in Prometheus text format on the given path
+func prometheusMetrics(path string) martini.Handler {
+	handler := metrics.PrometheusHandler()
+	return func(res http.ResponseWriter, req *http.Request, c martini.Context) {
+		if req.Method != "GET" || req.URL.Path != path {
+			c.Next()
+			return
+		}
+		handler.ServeHTTP(res, req)
+	}
+}
+
 func (server *Server) resetRouter() {
 	router := martini.NewRouter()
 	server.martini.Router = router
@@ -167,10 +163,11 @@ func (server *Server) connectDB() error {
 	}
 	config := util.GetConfig()
 	dbConn, err := db.CreateFromConfig(config)
+	historyConn := &DbHistoryWrapper{dbConn}
 	if server.sync == nil {
-		server.db = dbConn
+		server.db = &DbWatchWrapper{DB: historyConn}
 	} else {
-		server.db = &DbSyncWrapper{dbConn}
+		server.db = &DbWatchWrapper{DB: &DbSyncWrapper{historyConn}, Synced: true}
 	}
 	return err
 }
@@ -218,8 +215,10 @@ func NewServer(configFile string) (*Server, error) {
 
 	m := martini.Classic()
 	m.Handlers()
+	m.Use(middleware.RequestID())
 	m.Use(middleware.Logging())
 	m.Use(middleware.Metrics())
+	m.Use(middleware.Tracing())
 	m.Use(martini.Recovery())
 	m.Use(middleware.JSONURLs())
 	m.Use(middleware.WithContext())
@@ -233,6 +232,8 @@ func NewServer(configFile string) (*Server, error) {
 	}
 
 	setupEditor(server)
+	setupAPIKeys()
+	setupStoredConfigReload(server)
 
 	server.extensions = config.GetStringList("extension/use", []string{
 		"goext",
@@ -242,6 +243,12 @@ func NewServer(configFile string) (*Server, error) {
 	})
 	schema.DefaultExtension = config.GetString("extension/default", "javascript")
 
+	roleGraph, err := schema.NewRoleGraphFromConfig(config.GetParam("roles", nil))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid roles configuration: %s", err)
+	}
+	manager.SetRoleGraph(roleGraph)
+
 	manager.TimeLimit = time.Duration(config.GetInt("extension/timelimit", 30)) * time.Second
 
 	if config.GetList("extension/timelimits", nil) != nil {
@@ -263,9 +270,9 @@ func NewServer(configFile string) (*Server, error) {
 	server.address = config.GetString("address", ":"+port)
 	if config.GetBool("tls/enabled", false) {
 		log.Info("TLS enabled")
-		server.tls = &tlsConfig{
-			KeyFile:  config.GetString("tls/key_file", "./etc/key.pem"),
-			CertFile: config.GetString("tls/cert_file", "./etc/cert.pem"),
+		server.tls, err = newTLSConfig(config)
+		if err != nil {
+			return nil, err
 		}
 	}
 
@@ -278,6 +285,7 @@ func NewServer(configFile string) (*Server, error) {
 	if dbErr := server.connectDB(); dbErr != nil {
 		log.Fatalf("Error while connecting to DB: %s", dbErr)
 	}
+	server.storedConfig = NewStoredConfigReloader(server, server.sync)
 
 	schemaFiles := config.GetStringList("schemas", nil)
 	if schemaFiles == nil {
@@ -297,6 +305,10 @@ func NewServer(configFile string) (*Server, error) {
 		return nil, err
 	}
 
+	if err = tracing.SetupTracing(config); err != nil {
+		return nil, err
+	}
+
 	if config.GetList("database/initial_data", nil) != nil {
 		initialDataList := config.GetList("database/initial_data", nil)
 		for _, initialData := range initialDataList {
@@ -312,10 +324,41 @@ func NewServer(configFile string) (*Server, error) {
 		}
 	}
 
+	prometheusConfig := metrics.GetPrometheusConfig()
+	if prometheusConfig != nil && !prometheusConfig.Authenticated {
+		m.Use(prometheusMetrics(prometheusConfig.Path))
+	}
+
 	m.Map(middleware.NewNobodyResourceService(manager.NobodyResourcePaths()))
 
-	if config.GetBool("keystone/use_keystone", false) {
-		server.keystoneIdentity, err = middleware.CreateIdentityServiceFromConfig(config)
+	server.tokenRevocations, err = middleware.SetupTokenRevocations(config, server.sync)
+	if err != nil {
+		return nil, err
+	}
+
+	useIdentityService := config.GetBool("keystone/use_keystone", false) || config.GetBool("jwt/enabled", false)
+	useAPIKeys := config.GetBool("api_key/enabled", false)
+	useCertificates := config.GetBool("tls/client_identity/enabled", false)
+	if useCertificates && server.tls == nil {
+		return nil, fmt.Errorf("tls/client_identity requires tls/enabled")
+	}
+	if useIdentityService || useAPIKeys || useCertificates {
+		if useIdentityService {
+			server.keystoneIdentity, err = middleware.CreateIdentityServiceFromConfig(config)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create identity service: %s", err)
+			}
+			server.jwtIdentity, _ = server.keystoneIdentity.(*cloud.JWTIdentity)
+		}
+		if useAPIKeys {
+			server.keystoneIdentity = middleware.NewAPIKeyIdentity(server.keystoneIdentity, server.db)
+		}
+		if useCertificates {
+			server.keystoneIdentity, err = middleware.NewCertificateIdentityFromConfig(config, server.keystoneIdentity)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to create certificate identity service: %s", err)
+			}
+		}
 		m.MapTo(server.keystoneIdentity, (*middleware.IdentityService)(nil))
 		m.Use(middleware.Authentication())
 	} else {
@@ -323,13 +366,40 @@ func NewServer(configFile string) (*Server, error) {
 		m.Map(schema.NewAuthorization("admin", "admin", "admin_token", []string{"admin"}, nil))
 	}
 
+	if prometheusConfig != nil && prometheusConfig.Authenticated {
+		m.Use(prometheusMetrics(prometheusConfig.Path))
+	}
+
 	if err != nil {
 		return nil, fmt.Errorf("invalid base dir: %s", err)
 	}
 
+	rateLimiter, err := middleware.NewRateLimiterFromConfig(config, server.sync)
+	if err != nil {
+		return nil, err
+	}
+	if rateLimiter != nil {
+		m.Use(middleware.RateLimit(rateLimiter))
+	}
+
+	if err = resources.SetupQuotas(config); err != nil {
+		return nil, err
+	}
+
+	if err = resources.SetupAudit(config); err != nil {
+		return nil, err
+	}
+
+	if err = resources.SetupTrash(config); err != nil {
+		return nil, err
+	}
+
 	if config.GetBool("profiling/enabled", false) {
 		server.addPprofRoutes()
 	}
+	server.addTokenRevocationRoute(server.tokenRevocations)
+	server.addPolicyExplainRoute()
+	server.addAuditExportRoute()
 	server.addOptionsRoute()
 	cors := config.GetString("cors", "")
 	if cors != "" {
@@ -339,8 +409,8 @@ func NewServer(configFile string) (*Server, error) {
 		}
 		server.martini.Use(func(rw http.ResponseWriter, r *http.Request) {
 			rw.Header().Add("Access-Control-Allow-Origin", cors)
-			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Content-Type")
-			rw.Header().Add("Access-Control-Expose-Headers", "X-Total-Count")
+			rw.Header().Add("Access-Control-Allow-Headers", "X-Auth-Token, Authorization, Content-Type, If-Match, If-None-Match")
+			rw.Header().Add("Access-Control-Expose-Headers", "X-Total-Count, Link, ETag")
 			rw.Header().Add("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE")
 		})
 	}
@@ -439,13 +509,11 @@ func (server *Server) Start() (err error) {
 		l = listeners[0]
 	}
 	if server.tls != nil {
-		config := &tls.Config{ClientAuth: tls.VerifyClientCertIfGiven}
-		config.Certificates = make([]tls.Certificate, 1)
-		config.Certificates[0], err = tls.LoadX509KeyPair(server.tls.CertFile, server.tls.KeyFile)
+		reloader, err := newCertificateReloader(server.tls)
 		if err != nil {
 			return err
 		}
-		l = tls.NewListener(l, config)
+		l = tls.NewListener(l, reloader.listenerConfig())
 	}
 	return manners.Serve(l, server.martini)
 }
@@ -464,6 +532,10 @@ func (server *Server) Stop() {
 	stopCRONProcess(server)
 	manners.Close()
 	server.queue.Stop()
+	if server.jwtIdentity != nil {
+		server.jwtIdentity.Stop()
+	}
+	tracing.StopTracing()
 }
 
 //Queue returns servers build-in queue
@@ -504,6 +576,8 @@ func RunServer(configFile string) {
 	}()
 	server.running = true
 	server.masterCtx, server.masterCtxCancel = context.WithCancel(context.Background())
+	go resources.GetAudit().RunExpiration(server.masterCtx, server.db)
+	go resources.GetTrash().RunPurge(server.masterCtx, server.db)
 
 	if server.sync != nil {
 		stateWatcher := NewStateWatcher(server.sync, server.db, server.keystoneIdentity)
@@ -512,6 +586,12 @@ func RunServer(configFile string) {
 		syncWriter := NewSyncWriter(server.sync, server.db)
 		go syncWriter.Run(server.masterCtx)
 
+		resourceEventWatcher := NewResourceEventWatcher(server.sync)
+		go resourceEventWatcher.Run(server.masterCtx)
+
+		go server.tokenRevocations.Run(server.masterCtx)
+		go server.storedConfig.Run(server.masterCtx)
+
 		config := util.GetConfig()
 		keys := config.GetStringList("watch/keys", []string{})
 		events := config.GetStringList("watch/events", []string{})
@@ -16,15 +16,20 @@
 package server_test
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,24 +41,32 @@ import (
 	"github.com/cloudwan/gohan/schema"
 	srv "github.com/cloudwan/gohan/server"
 	"github.com/cloudwan/gohan/server/middleware"
+	"github.com/cloudwan/gohan/server/resources"
 	"github.com/cloudwan/gohan/sync"
+	mock_sync "github.com/cloudwan/gohan/sync/mocks"
 	sync_util "github.com/cloudwan/gohan/sync/util"
 	"github.com/cloudwan/gohan/util"
+	"github.com/golang/mock/gomock"
 )
 
 var (
-	server            *srv.Server
-	baseURL           = "http://localhost:19090"
-	schemaURL         = baseURL + "/gohan/v0.1/schemas"
-	networkPluralURL  = baseURL + "/v2.0/networks"
-	subnetPluralURL   = baseURL + "/v2.0/subnets"
-	serverPluralURL   = baseURL + "/v2.0/servers"
-	testPluralURL     = baseURL + "/v2.0/tests"
-	parentsPluralURL  = baseURL + "/v1.0/parents"
-	childrenPluralURL = baseURL + "/v1.0/children"
-	schoolsPluralURL  = baseURL + "/v1.0/schools"
-	citiesPluralURL   = baseURL + "/v1.0/cities"
-	profilingURL      = baseURL + "/debug/pprof/"
+	server             *srv.Server
+	baseURL            = "http://localhost:19090"
+	schemaURL          = baseURL + "/gohan/v0.1/schemas"
+	networkPluralURL   = baseURL + "/v2.0/networks"
+	subnetPluralURL    = baseURL + "/v2.0/subnets"
+	serverPluralURL    = baseURL + "/v2.0/servers"
+	testPluralURL      = baseURL + "/v2.0/tests"
+	parentsPluralURL   = baseURL + "/v1.0/parents"
+	childrenPluralURL  = baseURL + "/v1.0/children"
+	schoolsPluralURL   = baseURL + "/v1.0/schools"
+	citiesPluralURL    = baseURL + "/v1.0/cities"
+	foldersPluralURL   = baseURL + "/v1.0/folders"
+	documentsPluralURL = baseURL + "/v1.0/documents"
+	articlesPluralURL  = baseURL + "/v1.0/articles"
+	notesPluralURL     = baseURL + "/v1.0/notes"
+	profilingURL       = baseURL + "/debug/pprof/"
+	metricsURL         = baseURL + "/metrics"
 )
 
 var _ = Describe("Server package test", func() {
@@ -265,11 +278,224 @@ var _ = Describe("Server package test", func() {
 			testURL("GET", networkPluralURL+"?sort_order=bad_order", adminTokenID, nil, http.StatusBadRequest)
 
 			Expect(resp.Header.Get("X-Total-Count")).To(Equal("2"))
+
+			By("assuring marker pagination works")
+			result, resp = httpRequest("GET", networkPluralURL+"?limit=1&sort_order=desc", adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			networks = result.(map[string]interface{})["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).To(HaveKeyWithValue("id", "networkred"))
+			link := regexp.MustCompile(`^<([^>]+)>; rel="next"$`).FindStringSubmatch(resp.Header.Get("Link"))
+			Expect(link).To(HaveLen(2))
+
+			result, resp = httpRequest("GET", baseURL+link[1], adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			networks = result.(map[string]interface{})["networks"].([]interface{})
+			Expect(networks).To(HaveLen(1))
+			Expect(networks[0]).To(HaveKeyWithValue("id", "networkblue"))
+			Expect(resp.Header.Get("X-Total-Count")).To(Equal("2"))
+
+			testURL("GET", networkPluralURL+"?marker=bad_marker", adminTokenID, nil, http.StatusBadRequest)
+
 			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
 			testURL("DELETE", getNetworkSingularURL("blue"), adminTokenID, nil, http.StatusNoContent)
 		})
 	})
 
+	Describe("ConditionalRequests", func() {
+		It("should work", func() {
+			network := getNetwork("red", "red")
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+			defer testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
+
+			By("returning entity tag of the resource")
+			_, resp := httpRequest("GET", getNetworkSingularURL("red"), adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			etag := resp.Header.Get("ETag")
+			Expect(etag).ToNot(BeEmpty())
+
+			_, resp = conditionalRequest("GET", getNetworkSingularURL("red"), "If-None-Match", etag, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+			_, resp = conditionalRequest("GET", getNetworkSingularURL("red"), "If-None-Match", "W/"+etag, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNotModified))
+
+			By("rejecting weak entity tags in If-Match")
+			_, resp = conditionalRequest("PATCH", getNetworkSingularURL("red"), "If-Match", "W/"+etag, map[string]interface{}{"description": "Weak"})
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+
+			By("updating the resource with matching entity tag")
+			update := map[string]interface{}{"description": "Updated"}
+			_, resp = conditionalRequest("PATCH", getNetworkSingularURL("red"), "If-Match", etag, update)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			newETag := resp.Header.Get("ETag")
+			Expect(newETag).ToNot(BeEmpty())
+			Expect(newETag).ToNot(Equal(etag))
+
+			By("rejecting updates with stale entity tag")
+			_, resp = conditionalRequest("PUT", getNetworkSingularURL("red"), "If-Match", etag, update)
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+			_, resp = conditionalRequest("PUT", getNetworkSingularURL("red"), "If-None-Match", "*", update)
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+			_, resp = conditionalRequest("DELETE", getNetworkSingularURL("red"), "If-Match", etag, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+			_, resp = conditionalRequest("PUT", getNetworkSingularURL("blue"), "If-Match", newETag, getNetwork("blue", "red"))
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+
+			result, resp := httpRequest("GET", getNetworkSingularURL("red"), adminTokenID, nil)
+			Expect(resp.Header.Get("ETag")).To(Equal(newETag))
+			Expect(result).To(HaveKeyWithValue("network", HaveKeyWithValue("description", "Updated")))
+		})
+	})
+
+	Describe("BulkRequests", func() {
+		It("should apply all operations in a single transaction", func() {
+			network := getNetwork("red", "red")
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+
+			By("creating and updating networks")
+			bulk := map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"method": "create", "resource": getNetwork("blue", "red")},
+					map[string]interface{}{"method": "update", "id": "networkred", "resource": map[string]interface{}{"description": "Updated"}},
+				},
+			}
+			result := testURL("POST", networkPluralURL+"/_bulk", adminTokenID, bulk, http.StatusOK)
+			results := result.(map[string]interface{})["results"].([]interface{})
+			Expect(results).To(HaveLen(2))
+			Expect(results[0]).To(HaveKeyWithValue("status", float64(http.StatusCreated)))
+			Expect(results[0]).To(HaveKeyWithValue("network", HaveKeyWithValue("id", "networkblue")))
+			Expect(results[1]).To(HaveKeyWithValue("status", float64(http.StatusOK)))
+			Expect(results[1]).To(HaveKeyWithValue("network", HaveKeyWithValue("description", "Updated")))
+
+			By("rolling back all operations when one of them fails")
+			bulk = map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"schema": "subnet", "method": "create", "resource": getSubnet("red", "red", "networkred")},
+					map[string]interface{}{"schema": "network", "method": "update", "id": "networkgreen", "resource": map[string]interface{}{"description": "Updated"}},
+				},
+			}
+			result = testURL("POST", baseURL+"/_bulk", adminTokenID, bulk, http.StatusNotFound)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("Operation 1")))
+			testURL("GET", getSubnetSingularURL("red"), adminTokenID, nil, http.StatusNotFound)
+
+			By("deleting resources of different schemas")
+			bulk = map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"schema": "network", "method": "delete", "id": "networkred"},
+					map[string]interface{}{"schema": "network", "method": "delete", "id": "networkblue"},
+				},
+			}
+			result = testURL("POST", baseURL+"/_bulk", adminTokenID, bulk, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("results", ConsistOf(
+				HaveKeyWithValue("status", float64(http.StatusNoContent)),
+				HaveKeyWithValue("status", float64(http.StatusNoContent)),
+			)))
+			testURL("GET", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNotFound)
+			testURL("GET", getNetworkSingularURL("blue"), adminTokenID, nil, http.StatusNotFound)
+		})
+
+		It("should reject malformed operations", func() {
+			bulk := map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"method": "replace", "id": "networkred"},
+				},
+			}
+			testURL("POST", networkPluralURL+"/_bulk", adminTokenID, bulk, http.StatusBadRequest)
+			bulk = map[string]interface{}{
+				"operations": []interface{}{
+					map[string]interface{}{"schema": "subnet", "method": "delete", "id": "subnetred"},
+				},
+			}
+			testURL("POST", networkPluralURL+"/_bulk", adminTokenID, bulk, http.StatusBadRequest)
+		})
+	})
+
+	Describe("WatchResources", func() {
+		var cancel context.CancelFunc
+
+		BeforeEach(func() {
+			var ctx context.Context
+			ctx, cancel = context.WithCancel(context.Background())
+			if syncConn := server.GetSync(); syncConn != nil {
+				go srv.NewSyncWriterFromServer(server).Run(ctx)
+				go srv.NewResourceEventWatcher(syncConn).Run(ctx)
+				// wait for the watch of resource events to start
+				time.Sleep(time.Second)
+			}
+		})
+
+		AfterEach(func() {
+			cancel()
+		})
+
+		It("should stream committed changes visible to the client", func() {
+			adminEvents, closeAdmin := watchResources(networkPluralURL+"/_watch", adminTokenID)
+			defer closeAdmin()
+			memberEvents, closeMember := watchResources(networkPluralURL+"/_watch", memberTokenID)
+			defer closeMember()
+			singleEvents, closeSingle := watchResources(getNetworkSingularURL("red")+"/_watch", adminTokenID)
+			defer closeSingle()
+
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("red", "red"), http.StatusCreated)
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("blue", memberTenantID), http.StatusCreated)
+			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
+
+			By("sending all events to admin")
+			Eventually(adminEvents).Should(Receive(SatisfyAll(
+				HaveKeyWithValue("event", "create"),
+				HaveKeyWithValue("network", HaveKeyWithValue("id", "networkred")))))
+			Eventually(adminEvents).Should(Receive(SatisfyAll(
+				HaveKeyWithValue("event", "create"),
+				HaveKeyWithValue("network", HaveKeyWithValue("id", "networkblue")))))
+			Eventually(adminEvents).Should(Receive(SatisfyAll(
+				HaveKeyWithValue("event", "delete"),
+				HaveKeyWithValue("network", HaveKeyWithValue("id", "networkred")))))
+
+			By("sending events of the watched resource only")
+			Eventually(singleEvents).Should(Receive(HaveKeyWithValue("event", "create")))
+			Eventually(singleEvents).Should(Receive(HaveKeyWithValue("event", "delete")))
+
+			By("filtering out resources of other tenants")
+			Eventually(memberEvents).Should(Receive(HaveKeyWithValue("network", HaveKeyWithValue("id", "networkblue"))))
+			Consistently(memberEvents).ShouldNot(Receive())
+		})
+
+		It("should stream events published through the sync backend by other nodes", func() {
+			ctrl := gomock.NewController(GinkgoT())
+			defer ctrl.Finish()
+			syncEvents := make(chan *sync.Event, 2)
+			mockSync := mock_sync.NewMockSync(ctrl)
+			mockSync.EXPECT().WatchContext(gomock.Any(), "/gohan/cluster/resource_event", int64(sync.RevisionCurrent)).Return((<-chan *sync.Event)(syncEvents)).AnyTimes()
+
+			ctx, cancelWatch := context.WithCancel(context.Background())
+			defer cancelWatch()
+			go srv.NewResourceEventWatcher(mockSync).Run(ctx)
+
+			events, closeEvents := watchResources(networkPluralURL+"/_watch", adminTokenID)
+			defer closeEvents()
+
+			syncEvents <- &sync.Event{Action: "get", Key: "/gohan/cluster/resource_event", Data: map[string]interface{}{
+				"type": "create",
+				"path": "/v2.0/networks/networkblue",
+				"data": map[string]interface{}{"id": "networkblue", "tenant_id": adminTenantID},
+			}}
+			syncEvents <- &sync.Event{Action: "set", Key: "/gohan/cluster/resource_event", Data: map[string]interface{}{
+				"type":    "state_update",
+				"path":    "/v2.0/networks/networkred",
+				"version": float64(2),
+				"data":    map[string]interface{}{"id": "networkred", "tenant_id": adminTenantID},
+				"state":   map[string]interface{}{"ConfigVersion": float64(2), "StateVersion": float64(2), "State": "up"},
+			}}
+
+			var event map[string]interface{}
+			Eventually(events).Should(Receive(&event))
+			Expect(event).To(HaveKeyWithValue("event", "state_update"))
+			Expect(event).To(HaveKeyWithValue("version", float64(2)))
+			Expect(event).To(HaveKeyWithValue("network", HaveKeyWithValue("id", "networkred")))
+			Expect(event).To(HaveKeyWithValue("state", HaveKeyWithValue("state", "up")))
+		})
+	})
+
 	Describe("TwoSameResourceRelations", func() {
 		It("should work", func() {
 			By("creating 2 cities")
@@ -819,6 +1045,585 @@ var _ = Describe("Server package test", func() {
 		})
 	})
 
+	Describe("Prometheus metrics", func() {
+		It("should expose metrics to authenticated clients", func() {
+			testURL("GET", networkPluralURL, adminTokenID, nil, http.StatusOK)
+			testURL("GET", metricsURL, "", nil, http.StatusUnauthorized)
+
+			request, err := http.NewRequest("GET", metricsURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(ContainSubstring(`gohan_http_responses_total{code="200",method="GET"}`))
+			Expect(string(body)).To(ContainSubstring(`gohan_request_duration_seconds_count{schema="network",type="get.resources"}`))
+		})
+	})
+
+	Describe("Bearer token", func() {
+		It("should authenticate token given in Authorization header", func() {
+			request, err := http.NewRequest("GET", networkPluralURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("Authorization", "Bearer "+adminTokenID)
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("Request ID", func() {
+		It("should return request ID given by the client", func() {
+			request, err := http.NewRequest("GET", networkPluralURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			request.Header.Set("X-Request-ID", "test-request-id")
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("X-Request-ID")).To(Equal("test-request-id"))
+		})
+
+		It("should generate request ID when it is missing or invalid", func() {
+			_, resp := httpRequest("GET", networkPluralURL, adminTokenID, nil)
+			generated := resp.Header.Get("X-Request-ID")
+			Expect(generated).ToNot(BeEmpty())
+
+			request, err := http.NewRequest("GET", networkPluralURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			request.Header.Set("X-Request-ID", "invalid request id")
+			resp, err = http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("X-Request-ID")).ToNot(BeEmpty())
+			Expect(resp.Header.Get("X-Request-ID")).ToNot(Equal("invalid request id"))
+			Expect(resp.Header.Get("X-Request-ID")).ToNot(Equal(generated))
+		})
+	})
+
+	Describe("Rate limiting", func() {
+		It("should reject requests exceeding the rate limit", func() {
+			rateLimitURL := baseURL + "/v2.0/rate_limit_test"
+			testURL("GET", rateLimitURL, adminTokenID, nil, http.StatusNotFound)
+			testURL("GET", rateLimitURL, adminTokenID, nil, http.StatusNotFound)
+			result, resp := httpRequest("GET", rateLimitURL, adminTokenID, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusTooManyRequests))
+			Expect(resp.Header.Get("Retry-After")).To(Equal("100"))
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("Rate limit exceeded")))
+
+			testURL("GET", rateLimitURL, powerUserTokenID, nil, http.StatusNotFound)
+		})
+	})
+
+	Describe("Quotas", func() {
+		It("should reject resources exceeding the tenant quota", func() {
+			network := map[string]interface{}{
+				"id":        "networkQuota1",
+				"name":      "networkQuota1",
+				"tenant_id": "quota-tenant",
+			}
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+			defer testURL("DELETE", getNetworkSingularURL("Quota1"), adminTokenID, nil, http.StatusNoContent)
+
+			network["id"] = "networkQuota2"
+			result := testURL("POST", networkPluralURL, adminTokenID, network, http.StatusConflict)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("Quota exceeded")))
+
+			network["tenant_id"] = adminTenantID
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+			testURL("DELETE", getNetworkSingularURL("Quota2"), adminTokenID, nil, http.StatusNoContent)
+		})
+	})
+
+	Describe("API keys", func() {
+		apiKeyURL := baseURL + "/gohan/v0.1/api_keys"
+
+		useAPIKey := func(key string) *http.Response {
+			request, err := http.NewRequest("GET", networkPluralURL, nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("Authorization", "ApiKey "+key)
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			resp.Body.Close()
+			return resp
+		}
+
+		It("should authenticate requests with the created key", func() {
+			apiKey := map[string]interface{}{
+				"id":        "test-api-key",
+				"name":      "CI",
+				"tenant_id": memberTenantID,
+				"roles":     []string{"Member"},
+			}
+			result := testURL("POST", apiKeyURL, adminTokenID, apiKey, http.StatusCreated)
+			created := result.(map[string]interface{})["api_key"].(map[string]interface{})
+			Expect(created).ToNot(HaveKey("secret_hash"))
+			key, _ := created["secret"].(string)
+			Expect(key).To(HavePrefix("gak_test-api-key."))
+
+			Expect(useAPIKey(key).StatusCode).To(Equal(http.StatusOK))
+			Expect(useAPIKey(key + "x").StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(useAPIKey("gak_unknown.secret").StatusCode).To(Equal(http.StatusUnauthorized))
+
+			result = testURL("GET", apiKeyURL+"/test-api-key", adminTokenID, nil, http.StatusOK)
+			shown := result.(map[string]interface{})["api_key"].(map[string]interface{})
+			Expect(shown).ToNot(HaveKey("secret_hash"))
+			Expect(shown).ToNot(HaveKey("secret"))
+			Expect(shown["last_used_at"]).ToNot(BeEmpty())
+
+			testURL("PUT", apiKeyURL+"/test-api-key", adminTokenID,
+				map[string]interface{}{"expires_at": "2000-01-01T00:00:00Z"}, http.StatusOK)
+			Expect(useAPIKey(key).StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should not fail on keys without stored roles", func() {
+			apiKey := map[string]interface{}{"id": "test-api-key", "tenant_id": memberTenantID}
+			result := testURL("POST", apiKeyURL, adminTokenID, apiKey, http.StatusCreated)
+			key := result.(map[string]interface{})["api_key"].(map[string]interface{})["secret"].(string)
+
+			apiKeySchema, _ := schema.GetManager().Schema("api_key")
+			Expect(db.Within(testDB, func(tx transaction.Transaction) error {
+				stored, err := tx.Fetch(apiKeySchema, transaction.IDFilter("test-api-key"), nil)
+				if err != nil {
+					return err
+				}
+				stored.Data()["roles"] = nil
+				if err := tx.Update(stored); err != nil {
+					return err
+				}
+				return tx.Commit()
+			})).To(Succeed())
+
+			// the key has no role allowed to list networks
+			Expect(useAPIKey(key).StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject invalid expiry time", func() {
+			apiKey := map[string]interface{}{
+				"id":         "test-api-key",
+				"tenant_id":  memberTenantID,
+				"expires_at": "tomorrow",
+			}
+			result := testURL("POST", apiKeyURL, adminTokenID, apiKey, http.StatusBadRequest)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("RFC3339")))
+		})
+	})
+
+	Describe("Token revocation", func() {
+		revocationURL := baseURL + "/gohan/v0.1/token_revocations"
+
+		It("should reject revoked token", func() {
+			apiKey := map[string]interface{}{"id": "revoked-api-key", "tenant_id": memberTenantID, "roles": []string{"Member"}}
+			result := testURL("POST", baseURL+"/gohan/v0.1/api_keys", adminTokenID, apiKey, http.StatusCreated)
+			key := result.(map[string]interface{})["api_key"].(map[string]interface{})["secret"].(string)
+			testURL("GET", networkPluralURL, key, nil, http.StatusOK)
+
+			testURL("POST", revocationURL, memberTokenID, map[string]interface{}{"token": key}, http.StatusForbidden)
+			testURL("POST", revocationURL, adminTokenID, map[string]interface{}{}, http.StatusBadRequest)
+			testURL("POST", revocationURL, adminTokenID, map[string]interface{}{"token": key}, http.StatusNoContent)
+
+			result = testURL("GET", networkPluralURL, key, nil, http.StatusUnauthorized)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("revoked")))
+		})
+	})
+
+	Describe("Stored config reload", func() {
+		policiesURL := baseURL + "/gohan/v0.1/policies"
+		extensionsURL := baseURL + "/gohan/v0.1/extensions"
+
+		It("should apply stored policies without restart", func() {
+			testURL("GET", parentsPluralURL, memberTokenID, nil, http.StatusUnauthorized)
+
+			policy := map[string]interface{}{
+				"id":        "member_parents",
+				"principal": "Member",
+				"action":    "read",
+				"effect":    "allow",
+				"resource":  map[string]interface{}{"path": "/v1.0/parents.*"},
+			}
+			testURL("POST", policiesURL, adminTokenID, policy, http.StatusCreated)
+			testURL("GET", parentsPluralURL, memberTokenID, nil, http.StatusOK)
+
+			testURL("DELETE", policiesURL+"/member_parents", adminTokenID, nil, http.StatusNoContent)
+			testURL("GET", parentsPluralURL, memberTokenID, nil, http.StatusUnauthorized)
+		})
+
+		It("should reject invalid policies", func() {
+			policy := map[string]interface{}{
+				"id":        "invalid_policy",
+				"principal": "Member",
+				"action":    "read",
+				"resource":  map[string]interface{}{"path": "/v2.0/subnets("},
+			}
+			result := testURL("POST", policiesURL, adminTokenID, policy, http.StatusBadRequest)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("Invalid policy")))
+		})
+
+		It("should swap extension environments without restart", func() {
+			code, err := ioutil.TempFile("", "gohan_extension")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(code.Name())
+			_, err = code.WriteString(`gohan_register_handler("pre_list", function (context) {
+				context.response_code = 390;
+				context.response = "Reloaded.";
+			});`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(code.Close()).To(Succeed())
+
+			extension := map[string]interface{}{
+				"id":        "reloaded_extension",
+				"code_type": "javascript",
+				"path":      "/v2.0/subnets",
+				"url":       "file://" + code.Name(),
+			}
+			testURL("POST", extensionsURL, adminTokenID, extension, http.StatusCreated)
+			result := testURL("GET", subnetPluralURL, adminTokenID, nil, 390)
+			Expect(result).To(HaveKeyWithValue("error", "Reloaded."))
+
+			testURL("DELETE", extensionsURL+"/reloaded_extension", adminTokenID, nil, http.StatusNoContent)
+			testURL("GET", subnetPluralURL, adminTokenID, nil, http.StatusOK)
+		})
+
+		It("should serve stored namespaces only while they exist", func() {
+			namespacesURL := baseURL + "/gohan/v0.1/namespaces"
+			namespaceURL := baseURL + "/reloaded_namespace/"
+			namespace := map[string]interface{}{"id": "reloaded_namespace", "prefix": "reloaded_namespace"}
+
+			testURL("GET", namespaceURL, adminTokenID, nil, http.StatusNotFound)
+			testURL("POST", namespacesURL, adminTokenID, namespace, http.StatusCreated)
+			testURL("GET", namespaceURL, adminTokenID, nil, http.StatusOK)
+
+			testURL("DELETE", namespacesURL+"/reloaded_namespace", adminTokenID, nil, http.StatusNoContent)
+			testURL("GET", namespaceURL, adminTokenID, nil, http.StatusNotFound)
+
+			testURL("POST", namespacesURL, adminTokenID, namespace, http.StatusCreated)
+			testURL("GET", namespaceURL, adminTokenID, nil, http.StatusOK)
+			testURL("DELETE", namespacesURL+"/reloaded_namespace", adminTokenID, nil, http.StatusNoContent)
+		})
+	})
+
+	Describe("Audit log", func() {
+		auditLogsURL := baseURL + "/gohan/v0.1/audit_logs"
+		auditExportURL := baseURL + "/gohan/v0.1/audit_log_export"
+
+		It("should record changes with diffs", func() {
+			network := getNetwork("red", "red")
+			testURL("POST", networkPluralURL, adminTokenID, network, http.StatusCreated)
+			testURL("PUT", getNetworkSingularURL("red"), adminTokenID,
+				map[string]interface{}{"name": "Renamed"}, http.StatusOK)
+			testURL("DELETE", getNetworkSingularURL("red"), adminTokenID, nil, http.StatusNoContent)
+
+			result := testURL("GET", auditLogsURL+"?resource_id=networkred&sort_key=timestamp", adminTokenID, nil, http.StatusOK)
+			records := result.(map[string]interface{})["audit_logs"].([]interface{})
+			Expect(records).To(HaveLen(3))
+			actions := []interface{}{}
+			for _, record := range records {
+				Expect(record).To(HaveKeyWithValue("schema_id", "network"))
+				Expect(record).To(HaveKeyWithValue("tenant_id", adminTenantID))
+				Expect(record).To(HaveKeyWithValue("request_id", Not(BeEmpty())))
+				actions = append(actions, record.(map[string]interface{})["action"])
+				if record.(map[string]interface{})["action"] == "update" {
+					Expect(record).To(HaveKeyWithValue("diff", map[string]interface{}{
+						"name": map[string]interface{}{"old": "Networkred", "new": "Renamed"},
+					}))
+				}
+			}
+			Expect(actions).To(ConsistOf("create", "update", "delete"))
+
+			testURL("GET", auditLogsURL, memberTokenID, nil, http.StatusUnauthorized)
+			testURL("POST", auditLogsURL, adminTokenID, map[string]interface{}{"action": "forged"}, http.StatusBadRequest)
+		})
+
+		It("should export records as NDJSON", func() {
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("red", "red"), http.StatusCreated)
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("blue", "red"), http.StatusCreated)
+
+			request, err := http.NewRequest("GET", auditExportURL+"?action=create", nil)
+			Expect(err).ToNot(HaveOccurred())
+			request.Header.Set("X-Auth-Token", adminTokenID)
+			resp, err := http.DefaultClient.Do(request)
+			Expect(err).ToNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/x-ndjson"))
+
+			resourceIDs := []interface{}{}
+			scanner := bufio.NewScanner(resp.Body)
+			for scanner.Scan() {
+				var record map[string]interface{}
+				Expect(json.Unmarshal(scanner.Bytes(), &record)).To(Succeed())
+				resourceIDs = append(resourceIDs, record["resource_id"])
+			}
+			Expect(resourceIDs).To(ConsistOf("networkred", "networkblue"))
+
+			testURL("GET", auditExportURL, memberTokenID, nil, http.StatusUnauthorized)
+		})
+	})
+
+	Describe("Soft delete", func() {
+		folder := map[string]interface{}{"id": "folder1", "name": "Folder", "tenant_id": adminTenantID}
+		document := map[string]interface{}{"id": "document1", "name": "Document", "folder_id": "folder1", "tenant_id": adminTenantID}
+
+		markDeletedLongAgo := func(schemaID, resourceID string) {
+			deletedSchema, _ := schema.GetManager().Schema(schemaID)
+			Expect(db.Within(testDB, func(tx transaction.Transaction) error {
+				deleted, err := tx.Fetch(deletedSchema, transaction.OnlyDeleted(transaction.IDFilter(resourceID)), nil)
+				if err != nil {
+					return err
+				}
+				deleted.Data()[schema.DeletedAtPropertyID] = "2000-01-01T00:00:00Z"
+				if err := tx.Update(deleted); err != nil {
+					return err
+				}
+				return tx.Commit()
+			})).To(Succeed())
+		}
+
+		It("should hide deleted resources until they are restored", func() {
+			testURL("POST", foldersPluralURL, adminTokenID, folder, http.StatusCreated)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+
+			testURL("GET", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNotFound)
+			result := testURL("GET", foldersPluralURL, adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folders", BeEmpty()))
+			result = testURL("GET", foldersPluralURL+"?deleted=true", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folders", ConsistOf(HaveKeyWithValue("deleted_at", Not(BeNil())))))
+
+			result = testURL("POST", foldersPluralURL+"/folder1/restore", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folder", HaveKeyWithValue("deleted_at", BeNil())))
+			testURL("GET", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusOK)
+			testURL("POST", foldersPluralURL+"/folder1/restore", adminTokenID, nil, http.StatusNotFound)
+		})
+
+		It("should check relations when restoring", func() {
+			testURL("POST", foldersPluralURL, adminTokenID, folder, http.StatusCreated)
+			testURL("POST", documentsPluralURL, adminTokenID, document, http.StatusCreated)
+			testURL("DELETE", documentsPluralURL+"/document1", adminTokenID, nil, http.StatusNoContent)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+
+			testURL("POST", documentsPluralURL+"/document1/restore", adminTokenID, nil, http.StatusBadRequest)
+			testURL("POST", foldersPluralURL+"/folder1/restore", adminTokenID, nil, http.StatusOK)
+			testURL("POST", documentsPluralURL+"/document1/restore", adminTokenID, nil, http.StatusOK)
+		})
+
+		It("should purge resources deleted before retention", func() {
+			testURL("POST", foldersPluralURL, adminTokenID, folder, http.StatusCreated)
+			testURL("POST", foldersPluralURL, adminTokenID, map[string]interface{}{"id": "folder2", "tenant_id": adminTenantID}, http.StatusCreated)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+			testURL("DELETE", foldersPluralURL+"/folder2", adminTokenID, nil, http.StatusNoContent)
+
+			markDeletedLongAgo("folder", "folder1")
+
+			Expect(resources.GetTrash().Purge(testDB)).To(Equal(1))
+			result := testURL("GET", foldersPluralURL+"?deleted=true", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folders", ConsistOf(HaveKeyWithValue("id", "folder2"))))
+		})
+
+		It("should refuse deleting resources with live children", func() {
+			testURL("POST", foldersPluralURL, adminTokenID, folder, http.StatusCreated)
+			testURL("POST", documentsPluralURL, adminTokenID, document, http.StatusCreated)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusConflict)
+			testURL("GET", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusOK)
+
+			testURL("DELETE", documentsPluralURL+"/document1", adminTokenID, nil, http.StatusNoContent)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+		})
+
+		It("should not purge resources with children left", func() {
+			testURL("POST", foldersPluralURL, adminTokenID, folder, http.StatusCreated)
+			testURL("POST", documentsPluralURL, adminTokenID, document, http.StatusCreated)
+			testURL("DELETE", documentsPluralURL+"/document1", adminTokenID, nil, http.StatusNoContent)
+			testURL("DELETE", foldersPluralURL+"/folder1", adminTokenID, nil, http.StatusNoContent)
+			markDeletedLongAgo("folder", "folder1")
+
+			Expect(resources.GetTrash().Purge(testDB)).To(Equal(0))
+
+			markDeletedLongAgo("document", "document1")
+			Expect(resources.GetTrash().Purge(testDB)).To(Equal(2))
+			result := testURL("GET", foldersPluralURL+"?deleted=true", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("folders", BeEmpty()))
+		})
+	})
+
+	Describe("Revision history", func() {
+		article := map[string]interface{}{"id": "article1", "title": "First", "tenant_id": adminTenantID}
+
+		It("should list revisions and read earlier ones", func() {
+			beforeCreate := time.Now().Add(-time.Second).UTC().Format(time.RFC3339)
+			testURL("POST", articlesPluralURL, adminTokenID, article, http.StatusCreated)
+			testURL("PUT", articlesPluralURL+"/article1", adminTokenID, map[string]interface{}{"title": "Second"}, http.StatusOK)
+			testURL("DELETE", articlesPluralURL+"/article1", adminTokenID, nil, http.StatusNoContent)
+
+			result := testURL("GET", articlesPluralURL+"/article1/revisions", adminTokenID, nil, http.StatusOK)
+			revisions := result.(map[string]interface{})["article_revisions"].([]interface{})
+			Expect(revisions).To(HaveLen(3))
+			Expect(revisions[0]).To(HaveKeyWithValue("action", "create"))
+			Expect(revisions[1]).To(HaveKeyWithValue("data", HaveKeyWithValue("title", "Second")))
+			Expect(revisions[2]).To(HaveKeyWithValue("data", BeNil()))
+			testURL("GET", articlesPluralURL+"/article1/revisions", memberTokenID, nil, http.StatusUnauthorized)
+
+			result = testURL("GET", articlesPluralURL+"/article1?as_of=1", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("article", HaveKeyWithValue("title", "First")))
+			testURL("GET", articlesPluralURL+"/article1?as_of="+time.Now().Add(time.Second).UTC().Format(time.RFC3339Nano),
+				adminTokenID, nil, http.StatusNotFound)
+			testURL("GET", articlesPluralURL+"/article1?as_of="+beforeCreate, adminTokenID, nil, http.StatusNotFound)
+			testURL("GET", articlesPluralURL+"/article1?as_of=yesterday", adminTokenID, nil, http.StatusBadRequest)
+		})
+
+		It("should revert to a revision with a regular update", func() {
+			testURL("POST", articlesPluralURL, adminTokenID, article, http.StatusCreated)
+			testURL("PUT", articlesPluralURL+"/article1", adminTokenID, map[string]interface{}{"title": "Second"}, http.StatusOK)
+
+			result := testURL("POST", articlesPluralURL+"/article1/revert", adminTokenID,
+				map[string]interface{}{"revision": 1}, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("article", HaveKeyWithValue("title", "First")))
+			result = testURL("GET", articlesPluralURL+"/article1/revisions?sort_order=desc&limit=1", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("article_revisions", ConsistOf(SatisfyAll(
+				HaveKeyWithValue("action", "update"),
+				HaveKeyWithValue("revision", BeNumerically("==", 3)),
+			))))
+
+			testURL("POST", articlesPluralURL+"/article1/revert", adminTokenID, map[string]interface{}{"revision": 7}, http.StatusNotFound)
+			testURL("POST", articlesPluralURL+"/article1/revert", adminTokenID, map[string]interface{}{"revision": "one"}, http.StatusBadRequest)
+		})
+
+		It("should hide revisions not matching conditions of the policy", func() {
+			publicArticle := map[string]interface{}{"id": "article2", "title": "Public", "tenant_id": powerUserTenantID}
+			testURL("POST", articlesPluralURL, adminTokenID, publicArticle, http.StatusCreated)
+			testURL("PUT", articlesPluralURL+"/article2", adminTokenID, map[string]interface{}{"title": "Draft"}, http.StatusOK)
+			testURL("PUT", articlesPluralURL+"/article2", adminTokenID, map[string]interface{}{"title": "Public"}, http.StatusOK)
+
+			result := testURL("GET", articlesPluralURL+"/article2/revisions", powerUserTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("article_revisions", ConsistOf(
+				HaveKeyWithValue("revision", BeNumerically("==", 1)),
+				HaveKeyWithValue("revision", BeNumerically("==", 3)),
+			)))
+		})
+	})
+
+	Describe("Full-text search", func() {
+		It("should list matching resources by relevance", func() {
+			notes := []map[string]interface{}{
+				{"id": "note1", "title": "Gohan", "body": "Install guide", "tenant_id": adminTenantID},
+				{"id": "note2", "title": "Shopping", "body": "Buy milk", "tenant_id": adminTenantID},
+				{"id": "note3", "title": "Gohan release", "body": "What is new in the release", "tenant_id": adminTenantID},
+			}
+			for _, note := range notes {
+				testURL("POST", notesPluralURL, adminTokenID, note, http.StatusCreated)
+			}
+
+			result := testURL("GET", notesPluralURL+"?q=gohan+release", adminTokenID, nil, http.StatusOK)
+			found := result.(map[string]interface{})["notes"].([]interface{})
+			Expect(found).To(HaveLen(2))
+			Expect(found[0]).To(HaveKeyWithValue("id", "note3"))
+			Expect(found[1]).To(HaveKeyWithValue("id", "note1"))
+
+			result = testURL("GET", notesPluralURL+"?q=gohan&sort_key=id&sort_order=desc", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("notes", ConsistOf(
+				HaveKeyWithValue("id", "note3"),
+				HaveKeyWithValue("id", "note1"),
+			)))
+			testURL("GET", notesPluralURL+"?q=gohan&marker=bm90ZTE", adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", networkPluralURL+"?q=red", adminTokenID, nil, http.StatusBadRequest)
+		})
+
+		It("should refuse searching secret properties", func() {
+			result := testURL("GET", baseURL+"/v1.0/secret_notes?q=password", adminTokenID, nil, http.StatusBadRequest)
+			Expect(result).To(HaveKeyWithValue("error", ContainSubstring("secret")))
+		})
+	})
+
+	Describe("Aggregation", func() {
+		aggregateURL := notesPluralURL + "/_aggregate"
+
+		It("should aggregate groups of matching resources", func() {
+			notes := []map[string]interface{}{
+				{"id": "note1", "title": "Gohan", "body": "Install guide", "pages": 10, "tenant_id": adminTenantID},
+				{"id": "note2", "title": "Shopping", "body": "Buy milk", "pages": 1, "tenant_id": adminTenantID},
+				{"id": "note3", "title": "Gohan release", "body": "What is new", "pages": 4, "tenant_id": powerUserTenantID},
+			}
+			for _, note := range notes {
+				testURL("POST", notesPluralURL, adminTokenID, note, http.StatusCreated)
+			}
+
+			result := testURL("GET", aggregateURL+"?group_by=tenant_id&aggregate=count&aggregate=sum_pages",
+				adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("aggregations", ConsistOf(
+				map[string]interface{}{"tenant_id": adminTenantID, "count": 2.0, "sum_pages": 11.0},
+				map[string]interface{}{"tenant_id": powerUserTenantID, "count": 1.0, "sum_pages": 4.0},
+			)))
+
+			result = testURL("GET", aggregateURL+"?q=gohan&aggregate=max_pages", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("aggregations", ConsistOf(
+				map[string]interface{}{"max_pages": 10.0},
+			)))
+
+			testURL("GET", aggregateURL+"?aggregate=sum_title", adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", aggregateURL+"?aggregate=median_pages", adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", aggregateURL+"?group_by=unknown", adminTokenID, nil, http.StatusBadRequest)
+		})
+
+		It("should not aggregate secret properties", func() {
+			apiKeysAggregateURL := baseURL + "/gohan/v0.1/api_keys/_aggregate"
+			testURL("GET", apiKeysAggregateURL+"?group_by=secret_hash", adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", apiKeysAggregateURL+"?aggregate=max_secret_hash", adminTokenID, nil, http.StatusBadRequest)
+			testURL("GET", apiKeysAggregateURL, adminTokenID, nil, http.StatusOK)
+		})
+
+		It("should not aggregate resources filtered by policy conditions", func() {
+			testURL("GET", articlesPluralURL+"/_aggregate", powerUserTokenID, nil, http.StatusUnauthorized)
+			testURL("GET", articlesPluralURL+"/_aggregate", adminTokenID, nil, http.StatusOK)
+		})
+
+		It("should only aggregate resources of the tenant the policy allows", func() {
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("red", memberTenantID), http.StatusCreated)
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("blue", powerUserTenantID), http.StatusCreated)
+			testURL("POST", networkPluralURL, adminTokenID, getNetwork("green", "green"), http.StatusCreated)
+
+			result := testURL("GET", networkPluralURL+"/_aggregate?group_by=tenant_id", adminTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("aggregations", HaveLen(3)))
+			result = testURL("GET", networkPluralURL+"/_aggregate?group_by=tenant_id", memberTokenID, nil, http.StatusOK)
+			Expect(result).To(HaveKeyWithValue("aggregations", ConsistOf(
+				map[string]interface{}{"tenant_id": memberTenantID, "count": 1.0},
+				map[string]interface{}{"tenant_id": powerUserTenantID, "count": 1.0},
+			)))
+		})
+	})
+
+	Describe("Policy explain", func() {
+		explainURL := baseURL + "/gohan/v0.1/policy_explain"
+
+		It("should report matched policies and denial reasons", func() {
+			request := map[string]interface{}{
+				"action":    "update",
+				"path":      "/v2.0/networks/red",
+				"tenant_id": memberTenantID,
+				"roles":     []string{"Member"},
+				"resource":  map[string]interface{}{"tenant_id": "other"},
+			}
+			testURL("POST", explainURL, memberTokenID, request, http.StatusForbidden)
+			testURL("POST", explainURL, adminTokenID, map[string]interface{}{"action": "read"}, http.StatusBadRequest)
+
+			result := testURL("POST", explainURL, adminTokenID, request, http.StatusOK).(map[string]interface{})
+			Expect(result).To(HaveKeyWithValue("allowed", false))
+			Expect(result).To(HaveKeyWithValue("policy_id", "member_statement"))
+			Expect(result).To(HaveKeyWithValue("reason", ContainSubstring("is prohibited from operating on resources of tenant")))
+			policies := result["policies"].([]interface{})
+			Expect(policies).To(HaveLen(len(schema.GetManager().Policies())))
+			Expect(policies[0]).To(HaveKeyWithValue("reason", "No role matches principal 'admin'"))
+
+			request["resource"] = map[string]interface{}{"tenant_id": memberTenantID}
+			result = testURL("POST", explainURL, adminTokenID, request, http.StatusOK).(map[string]interface{})
+			Expect(result).To(HaveKeyWithValue("allowed", true))
+		})
+	})
+
 	Describe("Resync command test", func() {
 		It("Should resync syncable resources", func() {
 			var err error
@@ -1088,6 +1893,53 @@ func httpRequest(method, url, token string, postData interface{}) (interface{},
 	return data, resp
 }
 
+func conditionalRequest(method, url, header, etag string, postData interface{}) (interface{}, *http.Response) {
+	client := &http.Client{}
+	var reader io.Reader
+	if postData != nil {
+		jsonByte, err := json.Marshal(postData)
+		Expect(err).ToNot(HaveOccurred())
+		reader = bytes.NewBuffer(jsonByte)
+	}
+	request, err := http.NewRequest(method, url, reader)
+	Expect(err).ToNot(HaveOccurred())
+	request.Header.Set("X-Auth-Token", adminTokenID)
+	request.Header.Set(header, etag)
+	var data interface{}
+	resp, err := client.Do(request)
+	Expect(err).ToNot(HaveOccurred())
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(&data)
+	return data, resp
+}
+
+func watchResources(url, token string) (<-chan map[string]interface{}, func()) {
+	request, err := http.NewRequest("GET", url, nil)
+	Expect(err).ToNot(HaveOccurred())
+	request.Header.Set("X-Auth-Token", token)
+	resp, err := http.DefaultClient.Do(request)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+	events := make(chan map[string]interface{}, 10)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			var event map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err == nil {
+				events <- event
+			}
+		}
+	}()
+	return events, func() { resp.Body.Close() }
+}
+
 func clearTable(tx transaction.Transaction, s *schema.Schema) error {
 	if s.IsAbstract() {
 		return nil
@@ -1113,6 +1965,13 @@ func clearTable(tx transaction.Transaction, s *schema.Schema) error {
 	if err != nil {
 		return err
 	}
+	if s.SoftDelete() {
+		deleted, _, err := tx.List(s, transaction.OnlyDeleted(nil), nil, nil)
+		if err != nil {
+			return err
+		}
+		resources = append(resources, deleted...)
+	}
 	for _, resource := range resources {
 		err = tx.Delete(s, resource.ID())
 		if err != nil {
@@ -0,0 +1,201 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/db"
+	"github.com/cloudwan/gohan/db/transaction"
+	"github.com/cloudwan/gohan/extension"
+	"github.com/cloudwan/gohan/extension/golang"
+	"github.com/cloudwan/gohan/metrics"
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/sync"
+	"github.com/twinj/uuid"
+)
+
+const (
+	//StoredConfigReloadPath is the sync key updated whenever stored policies, extensions or namespaces change
+	StoredConfigReloadPath = "/gohan/stored_config_reload"
+
+	storedConfigWatchRetryInterval = 5 * time.Second
+)
+
+//loadStoredConfig loads policies, extensions and namespaces stored in the database
+func loadStoredConfig(dataStore db.DB) error {
+	config, err := readStoredConfig(dataStore)
+	if err != nil {
+		return err
+	}
+	return schema.GetManager().ReplaceStoredConfig(config)
+}
+
+//readStoredConfig reads policies, extensions and namespaces stored in the database
+func readStoredConfig(dataStore db.DB) (*schema.StoredConfig, error) {
+	var policies, extensions, namespaces []*schema.Resource
+	if err := db.Within(dataStore, func(tx transaction.Transaction) error {
+		policies = listStoredConfig(tx, "policy")
+		extensions = listStoredConfig(tx, "extension")
+		namespaces = listStoredConfig(tx, "namespace")
+		return tx.Commit()
+	}); err != nil {
+		return nil, err
+	}
+	return schema.NewStoredConfig(policies, extensions, namespaces)
+}
+
+func listStoredConfig(tx transaction.Transaction, schemaID string) []*schema.Resource {
+	s, ok := schema.GetManager().Schema(schemaID)
+	if !ok {
+		return nil
+	}
+	list, _, err := tx.List(s, nil, nil, nil)
+	if err != nil {
+		log.Info(err.Error())
+	}
+	return list
+}
+
+//StoredConfigReloader reloads policies, extensions and namespaces stored in the database
+//and notifies other nodes about the change using sync
+type StoredConfigReloader struct {
+	server *Server
+	sync   sync.Sync
+	nodeID string
+	mutex  gosync.Mutex
+}
+
+//NewStoredConfigReloader creates reloader; sync may be nil on a single node
+func NewStoredConfigReloader(server *Server, sync sync.Sync) *StoredConfigReloader {
+	return &StoredConfigReloader{server: server, sync: sync, nodeID: uuid.NewV4().String()}
+}
+
+//Reload loads stored config and swaps extension environments of all schemas.
+//Stored config and environments are built first and replaced together only when all of them could be created.
+func (reloader *StoredConfigReloader) Reload() error {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+
+	manager := schema.GetManager()
+	config, err := readStoredConfig(reloader.server.db)
+	if err != nil {
+		return err
+	}
+	extensions := manager.StoredConfigExtensions(config)
+	envs := map[string]extension.Environment{}
+	for _, s := range manager.Schemas() {
+		if s.IsAbstract() {
+			continue
+		}
+		env, err := reloader.server.newEnvironmentWithExtensions(s.ID, s.GetPluralURL(), extensions)
+		if err != nil {
+			return fmt.Errorf("[%s] %s", s.GetPluralURL(), err)
+		}
+		envs[s.ID] = env
+	}
+	if err := extension.GetManager().ReplaceEnvironments(envs, func() error {
+		return manager.ReplaceStoredConfig(config)
+	}); err != nil {
+		return err
+	}
+	reloader.server.mapNamespaceRoutes()
+	metrics.UpdateCounter(1, "config.reload")
+	log.Info("Reloaded stored policies, extensions and namespaces")
+	return nil
+}
+
+//Notify reloads stored config and asks other nodes to reload it
+func (reloader *StoredConfigReloader) Notify() error {
+	if err := reloader.Reload(); err != nil {
+		return err
+	}
+	if reloader.sync == nil {
+		return nil
+	}
+	data, err := json.Marshal(map[string]interface{}{"node": reloader.nodeID, "time": time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	if err := reloader.sync.Update(StoredConfigReloadPath, string(data)); err != nil {
+		return fmt.Errorf("Failed to notify other nodes about stored config change: %s", err)
+	}
+	return nil
+}
+
+//Run reloads stored config whenever another node notifies about a change
+func (reloader *StoredConfigReloader) Run(ctx context.Context) {
+	for {
+		for event := range reloader.sync.WatchContext(ctx, StoredConfigReloadPath, sync.RevisionCurrent) {
+			if event.Err != nil {
+				log.Warning("Watching stored config changes failed: %s", event.Err)
+				break
+			}
+			reloader.handleEvent(event)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(storedConfigWatchRetryInterval):
+		}
+	}
+}
+
+func (reloader *StoredConfigReloader) handleEvent(event *sync.Event) {
+	// existing key is reported as get event when watch starts and config is loaded at boot anyway
+	if event.Action == "get" || event.Action == "delete" {
+		return
+	}
+	if node, _ := event.Data["node"].(string); node == reloader.nodeID {
+		return
+	}
+	if err := reloader.Reload(); err != nil {
+		log.Error("Failed to reload stored config: %s", err)
+	}
+}
+
+//setupStoredConfigReload registers callback validating stored config and reloading it on every change
+func setupStoredConfigReload(server *Server) {
+	golang.RegisterGoCallback("handle_stored_config",
+		func(event string, context map[string]interface{}) error {
+			switch event {
+			case "pre_create", "pre_update":
+				resource, _ := context["resource"].(map[string]interface{})
+				switch context["schema_id"] {
+				case "policy":
+					if _, err := schema.NewPolicy(resource); err != nil {
+						return extension.Errorf(400, "ValidationException", fmt.Sprintf("Invalid policy: %s", err))
+					}
+				case "extension":
+					if _, err := schema.NewExtension(resource); err != nil {
+						return extension.Errorf(400, "ValidationException", fmt.Sprintf("Invalid extension: %s", err))
+					}
+				}
+			case "post_create", "post_update", "post_delete":
+				if server.storedConfig == nil {
+					return nil
+				}
+				if err := server.storedConfig.Notify(); err != nil {
+					log.Error("Failed to reload stored config: %s", err)
+				}
+			}
+			return nil
+		})
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/pagination"
 	"github.com/cloudwan/gohan/db/transaction"
+	l "github.com/cloudwan/gohan/log"
 	"github.com/cloudwan/gohan/schema"
 	gohan_sync "github.com/cloudwan/gohan/sync"
 )
@@ -42,6 +43,7 @@ const (
 // All changes happens in the RDBMS will be synchronized into the
 // sync layer by SyncWriter.
 // SyncWriter gets items to sync from the event table.
+// Every event is also published to resource watchers of all nodes.
 type SyncWriter struct {
 	sync    gohan_sync.Sync
 	db      db.DB
@@ -147,6 +149,8 @@ func (writer *SyncWriter) listEvents() ([]*schema.Resource, error) {
 func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
 	schemaManager := schema.GetManager()
 	eventSchema, _ := schemaManager.Schema("event")
+	requestID, _ := resource.Get("request_id").(string)
+	log := l.WithRequestID(log, requestID)
 	return db.Within(writer.db, func(tx transaction.Transaction) error {
 		var err error
 		eventType := resource.Get("type").(string)
@@ -155,15 +159,14 @@ func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
 		syncPlain := resource.Get("sync_plain").(bool)
 		syncProperty := resource.Get("sync_property").(string)
 
-		path := generatePath(resourcePath, body)
-
 		version, ok := resource.Get("version").(int)
 		if !ok {
-			log.Debug("cannot cast version value in int for %s", path)
+			log.Debug("cannot cast version value in int for %s", resourcePath)
 		}
 		log.Debug("event %s", eventType)
 
 		if eventType == "create" || eventType == "update" {
+			path := generatePath(resourcePath, body)
 			log.Debug("set %s on sync", path)
 
 			content := body
@@ -230,11 +233,15 @@ func (writer *SyncWriter) syncEvent(resource *schema.Resource) error {
 				log.Error(fmt.Sprintf("Delete from sync failed %s", err))
 			}
 			log.Debug("deleting %s", resourcePath)
-			err = writer.sync.Delete(path, false)
+			err = writer.sync.Delete(generatePath(resourcePath, body), false)
 			if err != nil {
 				return fmt.Errorf("delete from sync failed %s", err)
 			}
 		}
+		err = publishResourceEvent(writer.sync, requestID, eventType, resourcePath, int64(version), body)
+		if err != nil {
+			return fmt.Errorf("failed to publish resource event: %s", err)
+		}
 		log.Debug("delete event %d", resource.Get("id"))
 		id := resource.Get("id")
 		err = tx.Delete(eventSchema, id)
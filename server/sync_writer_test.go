@@ -63,6 +63,15 @@ var _ = Describe("Server package test", func() {
 			Expect(ok).To(BeTrue())
 			Expect(configNetwork).To(util.MatchAsJSON(network))
 
+			By("publishing the event to resource watchers")
+			resourceEvent, err := sync.Fetch("/gohan/cluster/resource_event")
+			Expect(err).ToNot(HaveOccurred())
+			var resourceEventContents map[string]interface{}
+			Expect(json.Unmarshal([]byte(resourceEvent.Value), &resourceEventContents)).To(Succeed())
+			Expect(resourceEventContents).To(HaveKeyWithValue("type", "create"))
+			Expect(resourceEventContents).To(HaveKeyWithValue("path", networkResource.Path()))
+			Expect(resourceEventContents).To(HaveKeyWithValue("data", util.MatchAsJSON(network)))
+
 			tx, err = testDB1.Begin()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(tx.Delete(networkSchema, networkResource.ID())).To(Succeed())
@@ -0,0 +1,179 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	gosync "sync"
+	"time"
+
+	"github.com/cloudwan/gohan/util"
+)
+
+type tlsConfig struct {
+	CertFile       string
+	KeyFile        string
+	ClientCAFile   string
+	ClientAuth     tls.ClientAuthType
+	ClientIdentity bool
+	ReloadInterval time.Duration
+}
+
+func newTLSConfig(config *util.Config) (*tlsConfig, error) {
+	reloadInterval, err := time.ParseDuration(config.GetString("tls/reload_interval", "1m"))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse TLS reload interval: %s", err)
+	}
+	result := &tlsConfig{
+		KeyFile:        config.GetString("tls/key_file", "./etc/key.pem"),
+		CertFile:       config.GetString("tls/cert_file", "./etc/cert.pem"),
+		ClientCAFile:   config.GetString("tls/client_ca_file", ""),
+		ClientIdentity: config.GetBool("tls/client_identity/enabled", false),
+		ReloadInterval: reloadInterval,
+	}
+	switch clientAuth := config.GetString("tls/client_auth", "optional"); clientAuth {
+	case "optional":
+		result.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		result.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("tls/client_auth should be optional or require, not %s", clientAuth)
+	}
+	if err := result.validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+//validate checks that client certificates are verified with client CA bundle
+//whenever they are required or clients are identified by them
+func (config *tlsConfig) validate() error {
+	if config.ClientCAFile != "" {
+		return nil
+	}
+	if config.ClientAuth == tls.RequireAndVerifyClientCert {
+		return fmt.Errorf("tls/client_ca_file is required to require client certificates")
+	}
+	if config.ClientIdentity {
+		return fmt.Errorf("tls/client_ca_file is required to identify clients by certificates")
+	}
+	return nil
+}
+
+//certificateReloader serves TLS config with certificate and client CA bundle reloaded when their files change
+type certificateReloader struct {
+	config *tlsConfig
+	now    func() time.Time
+
+	mutex     gosync.Mutex
+	current   *tls.Config
+	checkedAt time.Time
+	modTimes  map[string]time.Time
+}
+
+func newCertificateReloader(config *tlsConfig) (*certificateReloader, error) {
+	reloader := &certificateReloader{config: config, now: time.Now}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+//files returns files the TLS config is read from
+func (reloader *certificateReloader) files() []string {
+	files := []string{reloader.config.CertFile, reloader.config.KeyFile}
+	if reloader.config.ClientCAFile != "" {
+		files = append(files, reloader.config.ClientCAFile)
+	}
+	return files
+}
+
+//reload reads certificate and client CA bundle; it has to be called with the mutex locked
+func (reloader *certificateReloader) reload() error {
+	modTimes := map[string]time.Time{}
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+	certificate, err := tls.LoadX509KeyPair(reloader.config.CertFile, reloader.config.KeyFile)
+	if err != nil {
+		return err
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		ClientAuth:   reloader.config.ClientAuth,
+	}
+	if reloader.config.ClientCAFile != "" {
+		caBundle, err := ioutil.ReadFile(reloader.config.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(caBundle) {
+			return fmt.Errorf("No certificates found in %s", reloader.config.ClientCAFile)
+		}
+	}
+	reloader.current = config
+	reloader.modTimes = modTimes
+	reloader.checkedAt = reloader.now()
+	return nil
+}
+
+//changed checks whether any of the files has been modified since they were loaded
+func (reloader *certificateReloader) changed() bool {
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(reloader.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+//tlsConfig returns the current TLS config, reloading it at most once per reload interval.
+//Previous config is kept when the files can't be loaded, e.g. while they are being replaced.
+func (reloader *certificateReloader) tlsConfig() *tls.Config {
+	reloader.mutex.Lock()
+	defer reloader.mutex.Unlock()
+	if reloader.config.ReloadInterval <= 0 || reloader.now().Sub(reloader.checkedAt) < reloader.config.ReloadInterval {
+		return reloader.current
+	}
+	reloader.checkedAt = reloader.now()
+	if reloader.changed() {
+		if err := reloader.reload(); err != nil {
+			log.Warning("Failed to reload TLS certificates, using the previous ones: %s", err)
+		} else {
+			log.Info("TLS certificates reloaded")
+		}
+	}
+	return reloader.current
+}
+
+//listenerConfig returns TLS config for the listener, which takes the current config on each handshake
+func (reloader *certificateReloader) listenerConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return reloader.tlsConfig(), nil
+		},
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TLS certificate reloader", func() {
+	var (
+		dir      string
+		config   *tlsConfig
+		now      time.Time
+		reloader *certificateReloader
+	)
+
+	writeCertificate := func(commonName string, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(time.Now().UnixNano()),
+			Subject:               pkix.Name{CommonName: commonName},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		Expect(err).ToNot(HaveOccurred())
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		Expect(err).ToNot(HaveOccurred())
+		certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		Expect(ioutil.WriteFile(config.CertFile, certPEM, 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(config.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)).To(Succeed())
+		Expect(ioutil.WriteFile(config.ClientCAFile, certPEM, 0644)).To(Succeed())
+		for _, file := range []string{config.CertFile, config.KeyFile, config.ClientCAFile} {
+			Expect(os.Chtimes(file, modTime, modTime)).To(Succeed())
+		}
+	}
+
+	commonName := func(tlsConfig *tls.Config) string {
+		cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+		Expect(err).ToNot(HaveOccurred())
+		return cert.Subject.CommonName
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "gohan_tls")
+		Expect(err).ToNot(HaveOccurred())
+		config = &tlsConfig{
+			CertFile:       filepath.Join(dir, "cert.pem"),
+			KeyFile:        filepath.Join(dir, "key.pem"),
+			ClientCAFile:   filepath.Join(dir, "ca.pem"),
+			ClientAuth:     tls.RequireAndVerifyClientCert,
+			ReloadInterval: time.Minute,
+		}
+		now = time.Now()
+		writeCertificate("first", now.Add(-time.Hour))
+		reloader, err = newCertificateReloader(config)
+		Expect(err).ToNot(HaveOccurred())
+		reloader.now = func() time.Time { return now }
+		reloader.checkedAt = now
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("reloads changed certificates after reload interval", func() {
+		current := reloader.tlsConfig()
+		Expect(commonName(current)).To(Equal("first"))
+		Expect(current.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+		Expect(current.ClientCAs).ToNot(BeNil())
+
+		writeCertificate("second", now)
+		Expect(commonName(reloader.tlsConfig())).To(Equal("first"))
+
+		now = now.Add(time.Minute)
+		Expect(commonName(reloader.tlsConfig())).To(Equal("second"))
+	})
+
+	It("keeps previous certificates when new ones can't be loaded", func() {
+		Expect(ioutil.WriteFile(config.KeyFile, []byte("broken"), 0600)).To(Succeed())
+		now = now.Add(time.Minute)
+		Expect(commonName(reloader.tlsConfig())).To(Equal("first"))
+	})
+
+	Describe("Validation", func() {
+		It("requires client CA bundle to identify clients by optional certificates", func() {
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			config.ClientIdentity = true
+			Expect(config.validate()).To(Succeed())
+
+			config.ClientCAFile = ""
+			Expect(config.validate()).To(MatchError(ContainSubstring("tls/client_ca_file is required")))
+
+			config.ClientIdentity = false
+			Expect(config.validate()).To(Succeed())
+		})
+
+		It("requires client CA bundle to require client certificates", func() {
+			config.ClientCAFile = ""
+			Expect(config.validate()).To(MatchError(ContainSubstring("tls/client_ca_file is required")))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+
+	"github.com/cloudwan/gohan/schema"
+	"github.com/cloudwan/gohan/server/middleware"
+)
+
+const tokenRevocationURL = "/gohan/v0.1/token_revocations"
+
+//addTokenRevocationRoute adds route revoking a token or all tokens of a tenant or a user
+func (server *Server) addTokenRevocationRoute(revocations *middleware.TokenRevocations) {
+	server.martini.Post(tokenRevocationURL, func(w http.ResponseWriter, r *http.Request, auth schema.Authorization) {
+		if policy, _ := schema.GetManager().PolicyValidate(schema.ActionCreate, tokenRevocationURL, auth); policy == nil {
+			middleware.HTTPJSONError(w, "Not authorized to revoke tokens", http.StatusForbidden)
+			return
+		}
+		data, err := middleware.ReadJSON(r)
+		if err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		token, _ := data["token"].(string)
+		tenantID, _ := data["tenant_id"].(string)
+		userID, _ := data["user_id"].(string)
+		switch {
+		case token != "":
+			err = revocations.RevokeToken(token)
+		case tenantID != "":
+			err = revocations.RevokeTenant(tenantID)
+		case userID != "":
+			err = revocations.RevokeUser(userID)
+		default:
+			middleware.HTTPJSONError(w, "token, tenant_id or user_id has to be given", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			middleware.HTTPJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -16,11 +16,13 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/cloudwan/gohan/db"
 	"github.com/cloudwan/gohan/db/transaction"
+	l "github.com/cloudwan/gohan/log"
 
 	"context"
 
@@ -52,7 +54,7 @@ func (sw *DbSyncWrapper) Begin() (transaction.Transaction, error) {
 	if err != nil {
 		return nil, err
 	}
-	return syncTransactionWrap(tx), nil
+	return syncTransactionWrap(tx, ""), nil
 }
 
 // BeginTx wraps transaction object with sync
@@ -61,19 +63,26 @@ func (sw *DbSyncWrapper) BeginTx(ctx context.Context, options *transaction.TxOpt
 	if err != nil {
 		return nil, err
 	}
-	return syncTransactionWrap(tx), nil
+	return syncTransactionWrap(tx, l.RequestIDFromContext(ctx)), nil
 }
 
 type transactionEventLogger struct {
 	transaction.Transaction
 	eventLogged bool
+	// requestID is ID of the request the transaction was begun for
+	requestID string
 }
 
-func syncTransactionWrap(tx transaction.Transaction) *transactionEventLogger {
-	return &transactionEventLogger{tx, false}
+func syncTransactionWrap(tx transaction.Transaction, requestID string) *transactionEventLogger {
+	return &transactionEventLogger{tx, false, requestID}
 }
 
 func (tl *transactionEventLogger) logEvent(ctx context.Context, eventType string, resource *schema.Resource, version int64) error {
+	// secret properties are never written to the event log nor synced
+	return tl.logEventBody(ctx, eventType, resource, version, resource.Schema().RemoveSecretProperties(resource.Data()))
+}
+
+func (tl *transactionEventLogger) logEventBody(ctx context.Context, eventType string, resource *schema.Resource, version int64, content interface{}) error {
 	schemaManager := schema.GetManager()
 	eventSchema, ok := schemaManager.Schema("event")
 	if !ok {
@@ -85,7 +94,7 @@ func (tl *transactionEventLogger) logEvent(ctx context.Context, eventType string
 		return nil
 	}
 
-	body, err := resource.JSONString()
+	body, err := json.Marshal(content)
 
 	syncPlain := false
 	syncPlainRaw, ok := resource.Schema().Metadata["sync_plain"]
@@ -108,11 +117,16 @@ func (tl *transactionEventLogger) logEvent(ctx context.Context, eventType string
 	if err != nil {
 		return fmt.Errorf("Error during event resource deserialisation: %s", err.Error())
 	}
+	requestID := l.RequestIDFromContext(ctx)
+	if requestID == "" {
+		requestID = tl.requestID
+	}
 	eventResource, err := schema.NewResource(eventSchema, map[string]interface{}{
+		"request_id":    requestID,
 		"type":          eventType,
 		"path":          resource.Path(),
 		"version":       version,
-		"body":          body,
+		"body":          string(body),
 		"sync_plain":    syncPlain,
 		"sync_property": syncProperty,
 		"timestamp":     int64(time.Now().Unix()),
@@ -142,14 +156,19 @@ func (tl *transactionEventLogger) UpdateContext(ctx context.Context, resource *s
 	if err != nil {
 		return err
 	}
+	// soft deleted resources disappear from sync as if they were deleted
+	eventType := "update"
+	if resource.Deleted() {
+		eventType = "delete"
+	}
 	if !resource.Schema().StateVersioning() {
-		return tl.logEvent(ctx, "update", resource, 0)
+		return tl.logEvent(ctx, eventType, resource, 0)
 	}
 	state, err := tl.StateFetch(resource.Schema(), transaction.IDFilter(resource.ID()))
 	if err != nil {
 		return err
 	}
-	return tl.logEvent(ctx, "update", resource, state.ConfigVersion)
+	return tl.logEvent(ctx, eventType, resource, state.ConfigVersion)
 }
 
 func (tl *transactionEventLogger) Resync(resource *schema.Resource) error {
@@ -163,12 +182,32 @@ func (tl *transactionEventLogger) Resync(resource *schema.Resource) error {
 	return tl.logEvent(context.Background(), "update", resource, state.ConfigVersion)
 }
 
+func (tl *transactionEventLogger) StateUpdate(resource *schema.Resource, state *transaction.ResourceState) error {
+	return tl.StateUpdateContext(context.Background(), resource, state)
+}
+
+func (tl *transactionEventLogger) StateUpdateContext(ctx context.Context, resource *schema.Resource, state *transaction.ResourceState) error {
+	err := tl.Transaction.StateUpdateContext(ctx, resource, state)
+	if err != nil {
+		return err
+	}
+	// state updates aren't synced as configs, they are logged for resource watchers only
+	return tl.logEventBody(ctx, stateUpdateEventType, resource, state.ConfigVersion, &stateUpdateEventBody{
+		Resource: resource.Schema().RemoveSecretProperties(resource.Data()),
+		State:    state,
+	})
+}
+
 func (tl *transactionEventLogger) Delete(s *schema.Schema, resourceID interface{}) error {
 	return tl.DeleteContext(context.Background(), s, resourceID)
 }
 
 func (tl *transactionEventLogger) DeleteContext(ctx context.Context, s *schema.Schema, resourceID interface{}) error {
 	resource, err := tl.Fetch(s, transaction.IDFilter(resourceID), nil)
+	if err == transaction.ErrResourceNotFound && s.SoftDelete() {
+		// purged resource was already reported as deleted when it was soft deleted
+		return tl.Transaction.DeleteContext(ctx, s, resourceID)
+	}
 	if err != nil {
 		return err
 	}
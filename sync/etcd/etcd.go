@@ -19,6 +19,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"time"
 
@@ -31,6 +32,9 @@ import (
 const (
 	processPath = "/gohan/cluster/process"
 	masterTTL   = 10
+
+	etcdErrorTestFailed = 101
+	etcdErrorNodeExist  = 105
 )
 
 //Sync is struct for etcd based sync
@@ -69,6 +73,25 @@ func (s *Sync) Update(key, jsonString string) error {
 	return nil
 }
 
+//CompareAndSwap updates the key only when it hasn't been modified since lastRevision
+func (s *Sync) CompareAndSwap(key, jsonString string, lastRevision int64, ttl time.Duration) (bool, error) {
+	var err error
+	ttlSeconds := uint64(math.Ceil(ttl.Seconds()))
+	if lastRevision == 0 {
+		_, err = s.etcdClient.Create(key, jsonString, ttlSeconds)
+	} else {
+		_, err = s.etcdClient.CompareAndSwap(key, jsonString, ttlSeconds, "", uint64(lastRevision))
+	}
+	if etcdErr, ok := err.(*etcd.EtcdError); ok && (etcdErr.ErrorCode == etcdErrorTestFailed || etcdErr.ErrorCode == etcdErrorNodeExist) {
+		return false, nil
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to sync with backend %s", err))
+		return false, err
+	}
+	return true, nil
+}
+
 //Delete sync update sync
 func (s *Sync) Delete(key string, prefix bool) error {
 	if prefix {
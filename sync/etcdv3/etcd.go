@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	syn "sync"
@@ -78,6 +79,8 @@ func (s *Sync) GetProcessID() string {
 	return s.processID
 }
 
+//measureTime records the duration of the etcd call. Calls are not traced, as sync
+//doesn't get the context of the request, and spans without it would start a new trace each.
 func measureTime(timeStarted time.Time, action string) {
 	metrics.UpdateTimer(timeStarted, "sync.v3.%s", action)
 }
@@ -106,6 +109,30 @@ func (s *Sync) Update(key, jsonString string) error {
 	return nil
 }
 
+//CompareAndSwap updates the key only when it hasn't been modified since lastRevision
+func (s *Sync) CompareAndSwap(key, jsonString string, lastRevision int64, ttl time.Duration) (bool, error) {
+	defer measureTime(time.Now(), "compare_and_swap")
+
+	opts := []etcd.OpOption{}
+	if ttl > 0 {
+		lease, err := s.etcdClient.Grant(s.withTimeout(), int64(math.Ceil(ttl.Seconds())))
+		if err != nil {
+			log.Error(fmt.Sprintf("failed to sync with backend %s", err))
+			updateCounter(1, "compare_and_swap.error")
+			return false, err
+		}
+		opts = append(opts, etcd.WithLease(lease.ID))
+	}
+	cmp := etcd.Compare(etcd.ModRevision(key), "=", lastRevision)
+	resp, err := s.etcdClient.Txn(s.withTimeout()).If(cmp).Then(etcd.OpPut(key, jsonString, opts...)).Commit()
+	if err != nil {
+		log.Error(fmt.Sprintf("failed to sync with backend %s", err))
+		updateCounter(1, "compare_and_swap.error")
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
 //Delete sync update sync
 func (s *Sync) Delete(key string, prefix bool) error {
 	defer measureTime(time.Now(), "delete")
@@ -7,6 +7,7 @@ package mock_sync
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	sync "github.com/cloudwan/gohan/sync"
 	gomock "github.com/golang/mock/gomock"
@@ -97,6 +98,19 @@ func (mr *MockSyncMockRecorder) Update(path, json interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockSync)(nil).Update), path, json)
 }
 
+// CompareAndSwap mocks base method
+func (m *MockSync) CompareAndSwap(path, json string, lastRevision int64, ttl time.Duration) (bool, error) {
+	ret := m.ctrl.Call(m, "CompareAndSwap", path, json, lastRevision, ttl)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CompareAndSwap indicates an expected call of CompareAndSwap
+func (mr *MockSyncMockRecorder) CompareAndSwap(path, json, lastRevision, ttl interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CompareAndSwap", reflect.TypeOf((*MockSync)(nil).CompareAndSwap), path, json, lastRevision, ttl)
+}
+
 // Delete mocks base method
 func (m *MockSync) Delete(path string, prefix bool) error {
 	ret := m.ctrl.Call(m, "Delete", path, prefix)
@@ -17,6 +17,7 @@ package noop
 
 import (
 	"context"
+	"time"
 
 	"github.com/cloudwan/gohan/sync"
 )
@@ -40,6 +41,11 @@ func (sync *Sync) Update(path, json string) error {
 	return nil
 }
 
+//CompareAndSwap sync update sync
+func (sync *Sync) CompareAndSwap(path, json string, lastRevision int64, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
 //Delete sync update sync
 func (sync *Sync) Delete(path string, prefix bool) error {
 	return nil
@@ -17,6 +17,7 @@ package sync
 
 import (
 	"context"
+	"time"
 
 	l "github.com/cloudwan/gohan/log"
 )
@@ -33,6 +34,11 @@ type Sync interface {
 	Unlock(path string) error
 	Fetch(path string) (*Node, error)
 	Update(path, json string) error
+	// CompareAndSwap updates path only when its revision equals lastRevision.
+	// Give 0 as lastRevision to create path only when it doesn't exist.
+	// Returns false when the path has been modified in the meantime.
+	// The path expires after ttl, which is rounded up to seconds; give 0 to keep it.
+	CompareAndSwap(path, json string, lastRevision int64, ttl time.Duration) (bool, error)
 	Delete(path string, prefix bool) error
 	// Watch monitors changes on path and emits Events to responseChan.
 	// Close stopChan to cancel.
@@ -0,0 +1,255 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cloudwan/gohan/util"
+)
+
+const (
+	spanQueueSize     = 2048
+	spanBatchSize     = 256
+	spanFlushInterval = time.Second
+)
+
+//exporter sends batches of spans encoded in OTLP JSON format
+type exporter interface {
+	export(data []byte) error
+	close() error
+}
+
+func newExporter(config *util.Config) (exporter, error) {
+	switch exporterType := config.GetString("tracing/exporter", "stdout"); exporterType {
+	case "stdout":
+		return &writerExporter{writer: os.Stdout}, nil
+	case "file":
+		path := config.GetString("tracing/file", "./traces.json")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Can't open trace file %s: %s", path, err)
+		}
+		return &writerExporter{writer: file, closer: file}, nil
+	case "otlp":
+		return &otlpHTTPExporter{
+			endpoint: config.GetString("tracing/endpoint", "http://localhost:4318/v1/traces"),
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown tracing exporter: %s", exporterType)
+	}
+}
+
+//writerExporter writes each batch as a single line
+type writerExporter struct {
+	writer io.Writer
+	closer io.Closer
+}
+
+func (e *writerExporter) export(data []byte) error {
+	_, err := e.writer.Write(append(data, '\n'))
+	return err
+}
+
+func (e *writerExporter) close() error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+//otlpHTTPExporter posts batches to OTLP/HTTP collector endpoint
+type otlpHTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (e *otlpHTTPExporter) export(data []byte) error {
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHTTPExporter) close() error {
+	return nil
+}
+
+//spanProcessor exports finished spans in batches in background
+type spanProcessor struct {
+	exporter    exporter
+	serviceName string
+	spans       chan *Span
+	done        chan struct{}
+	stopOnce    sync.Once
+}
+
+func newSpanProcessor(exporter exporter, serviceName string) *spanProcessor {
+	processor := &spanProcessor{
+		exporter:    exporter,
+		serviceName: serviceName,
+		spans:       make(chan *Span, spanQueueSize),
+		done:        make(chan struct{}),
+	}
+	go processor.run()
+	return processor
+}
+
+func (processor *spanProcessor) onEnd(span *Span) {
+	defer func() {
+		//processor has been stopped in the meantime
+		recover()
+	}()
+	select {
+	case processor.spans <- span:
+	default:
+		log.Warning("Span queue is full, dropping span %s", span.Name)
+	}
+}
+
+func (processor *spanProcessor) run() {
+	defer close(processor.done)
+	ticker := time.NewTicker(spanFlushInterval)
+	defer ticker.Stop()
+	batch := []*Span{}
+	for {
+		select {
+		case span, ok := <-processor.spans:
+			if !ok {
+				processor.flush(batch)
+				if err := processor.exporter.close(); err != nil {
+					log.Warning("Failed to close trace exporter: %s", err)
+				}
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= spanBatchSize {
+				processor.flush(batch)
+				batch = []*Span{}
+			}
+		case <-ticker.C:
+			processor.flush(batch)
+			batch = []*Span{}
+		}
+	}
+}
+
+func (processor *spanProcessor) flush(batch []*Span) {
+	if len(batch) == 0 {
+		return
+	}
+	data, err := json.Marshal(encodeSpans(processor.serviceName, batch))
+	if err != nil {
+		log.Warning("Failed to encode spans: %s", err)
+		return
+	}
+	if err := processor.exporter.export(data); err != nil {
+		log.Warning("Failed to export spans: %s", err)
+	}
+}
+
+func (processor *spanProcessor) stop() {
+	processor.stopOnce.Do(func() {
+		close(processor.spans)
+		<-processor.done
+	})
+}
+
+//encodeSpans encodes spans as OTLP ExportTraceServiceRequest in JSON mapping
+func encodeSpans(serviceName string, spans []*Span) map[string]interface{} {
+	encoded := make([]interface{}, 0, len(spans))
+	for _, span := range spans {
+		encoded = append(encoded, encodeSpan(span))
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": encodeAttributes(map[string]interface{}{"service.name": serviceName}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "github.com/cloudwan/gohan"},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+func encodeSpan(span *Span) map[string]interface{} {
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	encoded := map[string]interface{}{
+		"traceId":           hex.EncodeToString(span.TraceID[:]),
+		"spanId":            hex.EncodeToString(span.SpanID[:]),
+		"name":              span.Name,
+		"kind":              span.Kind,
+		"startTimeUnixNano": strconv.FormatInt(span.StartTime.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(span.EndTime.UnixNano(), 10),
+		"attributes":        encodeAttributes(span.Attributes),
+	}
+	if span.ParentSpanID != [8]byte{} {
+		encoded["parentSpanId"] = hex.EncodeToString(span.ParentSpanID[:])
+	}
+	if span.Error != nil {
+		encoded["status"] = map[string]interface{}{"code": 2, "message": span.Error.Error()}
+	}
+	return encoded
+}
+
+func encodeAttributes(attributes map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	encoded := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		var value map[string]interface{}
+		switch v := attributes[key].(type) {
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": key, "value": value})
+	}
+	return encoded
+}
@@ -0,0 +1,245 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	l "github.com/cloudwan/gohan/log"
+	"github.com/cloudwan/gohan/util"
+)
+
+//SpanKey is a key of the current span in request context maps
+const SpanKey = "trace_span"
+
+//TraceParentHeader is W3C trace context header
+const TraceParentHeader = "traceparent"
+
+//SpanKind describes relationship of the span to its parent, as defined by OpenTelemetry
+type SpanKind int
+
+//Span kinds
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+var (
+	log = l.NewLogger()
+
+	tracerMutex sync.RWMutex
+	tracer      *spanProcessor
+)
+
+type spanContextKey struct{}
+
+//Span is a single timed operation of a trace
+type Span struct {
+	TraceID      [16]byte
+	SpanID       [8]byte
+	ParentSpanID [8]byte
+	Name         string
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	Error        error
+
+	sampled   bool
+	remote    bool
+	mutex     sync.Mutex
+	processor *spanProcessor
+}
+
+//SetupTracing setups tracing from config
+func SetupTracing(config *util.Config) error {
+	StopTracing()
+	if !config.GetBool("tracing/enabled", false) {
+		return nil
+	}
+	exporter, err := newExporter(config)
+	if err != nil {
+		return err
+	}
+	processor := newSpanProcessor(exporter, config.GetString("tracing/service_name", "gohan"))
+	tracerMutex.Lock()
+	tracer = processor
+	tracerMutex.Unlock()
+	log.Info("Tracing enabled, exporter: %s", config.GetString("tracing/exporter", "stdout"))
+	return nil
+}
+
+//StopTracing exports pending spans and disables tracing
+func StopTracing() {
+	tracerMutex.Lock()
+	processor := tracer
+	tracer = nil
+	tracerMutex.Unlock()
+	if processor != nil {
+		processor.stop()
+	}
+}
+
+//Enabled returns whether spans are recorded
+func Enabled() bool {
+	tracerMutex.RLock()
+	defer tracerMutex.RUnlock()
+	return tracer != nil
+}
+
+//StartSpan starts a new span. When parent is nil, the span starts a new trace.
+//It returns nil when tracing is disabled; all the span methods accept nil receiver.
+func StartSpan(parent *Span, name string, kind SpanKind) *Span {
+	return StartSpanAt(parent, name, kind, time.Now())
+}
+
+//StartSpanAt starts a new span at the given time
+func StartSpanAt(parent *Span, name string, kind SpanKind, start time.Time) *Span {
+	tracerMutex.RLock()
+	processor := tracer
+	tracerMutex.RUnlock()
+	if processor == nil {
+		return nil
+	}
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		StartTime:  start,
+		Attributes: map[string]interface{}{},
+		sampled:    true,
+		processor:  processor,
+	}
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+		span.sampled = parent.sampled
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+	return span
+}
+
+//SetAttribute sets attribute of the span
+func (span *Span) SetAttribute(key string, value interface{}) {
+	if span == nil || span.remote {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.Attributes[key] = value
+}
+
+//SetError marks the span as failed
+func (span *Span) SetError(err error) {
+	if span == nil || span.remote || err == nil {
+		return
+	}
+	span.mutex.Lock()
+	defer span.mutex.Unlock()
+	span.Error = err
+}
+
+//End finishes the span and queues it for export
+func (span *Span) End() {
+	if span == nil || span.remote {
+		return
+	}
+	span.mutex.Lock()
+	if !span.EndTime.IsZero() {
+		span.mutex.Unlock()
+		return
+	}
+	span.EndTime = time.Now()
+	span.mutex.Unlock()
+	if span.sampled {
+		span.processor.onEnd(span)
+	}
+}
+
+//TraceParent returns W3C traceparent header value of the span
+func (span *Span) TraceParent() string {
+	if span == nil {
+		return ""
+	}
+	flags := "00"
+	if span.sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(span.TraceID[:]), hex.EncodeToString(span.SpanID[:]), flags)
+}
+
+//Extract returns remote parent span described by traceparent header or nil if there is none
+func Extract(header http.Header) *Span {
+	parts := strings.Split(strings.TrimSpace(header.Get(TraceParentHeader)), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil
+	}
+	span := &Span{remote: true}
+	if _, err := hex.Decode(span.TraceID[:], []byte(parts[1])); err != nil {
+		return nil
+	}
+	if _, err := hex.Decode(span.SpanID[:], []byte(parts[2])); err != nil {
+		return nil
+	}
+	if span.TraceID == [16]byte{} || span.SpanID == [8]byte{} {
+		return nil
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil
+	}
+	span.sampled = flags[0]&1 == 1
+	return span
+}
+
+//Inject sets traceparent header of the span
+func Inject(span *Span, header http.Header) {
+	if span != nil {
+		header.Set(TraceParentHeader, span.TraceParent())
+	}
+}
+
+//ContextWithSpan returns context carrying the span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	if span == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+//SpanFromContext returns span carried by the context or nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+//SpanFromMap returns the current span of the request context map or nil
+func SpanFromMap(requestContext map[string]interface{}) *Span {
+	span, _ := requestContext[SpanKey].(*Span)
+	return span
+}
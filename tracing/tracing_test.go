@@ -0,0 +1,140 @@
+// Copyright (C) 2017 NTT Innovation Institute, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudwan/gohan/tracing"
+	"github.com/cloudwan/gohan/util"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		dir       string
+		traceFile string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "gohan_tracing")
+		Expect(err).ToNot(HaveOccurred())
+		traceFile = filepath.Join(dir, "traces.json")
+		configFile := filepath.Join(dir, "config.yaml")
+		Expect(ioutil.WriteFile(configFile, []byte(
+			"tracing:\n  enabled: true\n  exporter: file\n  file: "+traceFile+"\n  service_name: gohan_test\n"), 0644)).To(Succeed())
+		config := util.GetConfig()
+		Expect(config.ReadConfig(configFile)).To(Succeed())
+		Expect(tracing.SetupTracing(config)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		tracing.StopTracing()
+		os.RemoveAll(dir)
+	})
+
+	readSpans := func() []map[string]interface{} {
+		tracing.StopTracing()
+		file, err := os.Open(traceFile)
+		Expect(err).ToNot(HaveOccurred())
+		defer file.Close()
+		spans := []map[string]interface{}{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var request map[string]interface{}
+			Expect(json.Unmarshal(scanner.Bytes(), &request)).To(Succeed())
+			for _, resourceSpans := range request["resourceSpans"].([]interface{}) {
+				resource := resourceSpans.(map[string]interface{})["resource"]
+				Expect(resource).To(HaveKeyWithValue("attributes", ContainElement(HaveKeyWithValue("key", "service.name"))))
+				for _, scopeSpans := range resourceSpans.(map[string]interface{})["scopeSpans"].([]interface{}) {
+					for _, span := range scopeSpans.(map[string]interface{})["spans"].([]interface{}) {
+						spans = append(spans, span.(map[string]interface{}))
+					}
+				}
+			}
+		}
+		return spans
+	}
+
+	It("continues trace given in traceparent header", func() {
+		header := http.Header{}
+		header.Set(tracing.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		parent := tracing.Extract(header)
+		Expect(parent).ToNot(BeNil())
+
+		span := tracing.StartSpan(parent, "HTTP GET", tracing.SpanKindServer)
+		child := tracing.StartSpan(span, "db list", tracing.SpanKindClient)
+		child.SetAttribute("gohan.schema", "network")
+		child.SetError(errors.New("failed"))
+		child.End()
+		span.End()
+
+		outgoing := http.Header{}
+		tracing.Inject(child, outgoing)
+		Expect(outgoing.Get(tracing.TraceParentHeader)).To(HavePrefix("00-4bf92f3577b34da6a3ce929d0e0e4736-"))
+
+		spans := readSpans()
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0]).To(HaveKeyWithValue("name", "db list"))
+		Expect(spans[0]).To(HaveKeyWithValue("traceId", "4bf92f3577b34da6a3ce929d0e0e4736"))
+		Expect(spans[0]).To(HaveKeyWithValue("parentSpanId", spans[1]["spanId"]))
+		Expect(spans[0]).To(HaveKeyWithValue("status", HaveKeyWithValue("message", "failed")))
+		Expect(spans[0]).To(HaveKeyWithValue("attributes", ConsistOf(map[string]interface{}{
+			"key": "gohan.schema", "value": map[string]interface{}{"stringValue": "network"},
+		})))
+		Expect(spans[1]).To(HaveKeyWithValue("name", "HTTP GET"))
+		Expect(spans[1]).To(HaveKeyWithValue("parentSpanId", "00f067aa0ba902b7"))
+	})
+
+	It("doesn't export spans of not sampled traces", func() {
+		header := http.Header{}
+		header.Set(tracing.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+		span := tracing.StartSpan(tracing.Extract(header), "HTTP GET", tracing.SpanKindServer)
+		span.End()
+		tracing.StartSpan(nil, "HTTP POST", tracing.SpanKindServer).End()
+
+		spans := readSpans()
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0]).To(HaveKeyWithValue("name", "HTTP POST"))
+		Expect(spans[0]).ToNot(HaveKey("parentSpanId"))
+	})
+
+	It("ignores malformed traceparent header", func() {
+		header := http.Header{}
+		header.Set(tracing.TraceParentHeader, "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+		Expect(tracing.Extract(header)).To(BeNil())
+		header.Set(tracing.TraceParentHeader, "invalid")
+		Expect(tracing.Extract(header)).To(BeNil())
+	})
+
+	It("doesn't record spans when tracing is disabled", func() {
+		tracing.StopTracing()
+		Expect(tracing.Enabled()).To(BeFalse())
+		span := tracing.StartSpan(nil, "HTTP GET", tracing.SpanKindServer)
+		Expect(span).To(BeNil())
+		span.SetAttribute("http.method", "GET")
+		span.End()
+	})
+})
@@ -36,6 +36,9 @@ import (
 	"github.com/xeipuuv/gojsonpointer"
 )
 
+//TimestampFormat is format of stored timestamps; they sort in time order as strings
+const TimestampFormat = "2006-01-02T15:04:05.000000Z"
+
 //Counter represents atomic counter
 type Counter struct {
 	value int64